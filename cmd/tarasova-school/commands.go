@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/tarasova-school/internal/tarasova-school/server"
+	"github.com/tarasova-school/internal/tarasova-school/server/handlers"
+	"github.com/tarasova-school/internal/types/config"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n"+
+		"  %[1]s [-config-path path]               запустить сервер\n"+
+		"  %[1]s [-config-path path] config check  проверить конфиг и показать его без секретов\n"+
+		"  %[1]s openapi                           проверить, что все роуты описаны, и вывести спецификацию\n\n"+
+		"Любое поле конфига можно задать переменной окружения %[2]s<YAML_PATH>, например %[2]sSERVER_EMAIL_PASS,\n"+
+		"или файлом секрета через %[2]s<YAML_PATH>_FILE\n\n", os.Args[0], config.EnvPrefix)
+	flag.PrintDefaults()
+}
+
+// runCommand выполняет подкоманду и возвращает код выхода
+func runCommand(configPath string, args []string) int {
+
+	if len(args) == 2 && args[0] == "config" && args[1] == "check" {
+		return checkConfig(configPath)
+	}
+	if len(args) == 1 && args[0] == "openapi" {
+		return printOpenAPI()
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(args, " "))
+	flag.Usage()
+	return 2
+}
+
+func checkConfig(configPath string) int {
+
+	cnf, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = cnf.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err = enc.Encode(config.Redact(cnf)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "config is valid")
+
+	return 0
+}
+
+// printOpenAPI строит роутер без базы и выводит спецификацию, падает на роутах без описания
+func printOpenAPI() int {
+
+	h := handlers.NewHandlers(nil, config.Defaults(), nil)
+	if _, err := server.NewRouter(h); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, h.OpenAPISpec(), "", "  "); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out.WriteString("\n")
+	if _, err := out.WriteTo(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
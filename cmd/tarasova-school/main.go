@@ -1,33 +1,40 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/tarasova-school/internal/clients/postgres"
 	"github.com/tarasova-school/internal/tarasova-school/server"
 	"github.com/tarasova-school/internal/tarasova-school/server/handlers"
 	"github.com/tarasova-school/internal/tarasova-school/service"
 	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/alert"
 	"github.com/tarasova-school/pkg/logger"
-	"gopkg.in/yaml.v3"
+	"github.com/tarasova-school/pkg/ratelimit"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
 
 	configPath := new(string)
-	debug := new(bool)
-	flag.StringVar(configPath, "config-path", "configs/config.yaml", "path to yaml config file")
-	flag.BoolVar(debug, "debug", true, "debug-alarm")
+	flag.StringVar(configPath, "config-path", "configs/config.yaml", "path to yaml config file, empty - only environment")
+	flag.Usage = usage
 	flag.Parse()
-	f, err := os.Open(*configPath)
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(*configPath, flag.Args()))
+	}
+
+	cnf, err := config.Load(*configPath)
 	if err != nil {
-		logger.LogFatal(fmt.Errorf("err with open config file %v, %s", err, *configPath))
+		logger.LogFatal(err)
 	}
-	logger.Debug = *debug
-	cnf := config.Config{}
-	if err = yaml.NewDecoder(f).Decode(&cnf); err != nil {
-		logger.LogFatal(fmt.Errorf("err with parse config %v, %s", err, *configPath))
+	if err = cnf.Validate(); err != nil {
+		logger.LogFatal(err)
 	}
 
 	pg, err := postgres.NewPostgres(cnf.PostgresDsn)
@@ -35,17 +42,73 @@ func main() {
 		logger.LogFatal(err)
 	}
 
-	srv, err := service.NewService(pg, &cnf)
+	srv, err := service.NewService(pg, cnf)
 	if err != nil {
 		logger.LogFatal(err)
 	}
 
-	err = logger.NewLogger(cnf.Telegram)
+	alerting := cnf.Alerting
+	if alerting == nil {
+		alerting = alert.TelegramConfig(cnf.Telegram)
+	}
+	senders := make(map[string]alert.Sender)
+	for name, sender := range srv.NotifySenders() {
+		senders[name] = sender
+	}
+	alerter, err := alert.New(alerting, senders)
 	if err != nil {
-		logger.LogFatal(err)
+		logger.LogFatal(errors.Wrap(err, "err with alert.New"))
 	}
+	alerter.Run(context.Background())
+	logger.SetAlerter(alerter)
 
-	handls := handlers.NewHandlers(srv, &cnf)
-	logger.CheckDebug()
-	server.StartServer(handls, cnf.ServerPort)
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-signals
+		logger.LogInfo(fmt.Sprintf("Получен сигнал %s, останавливаем сервер", sig))
+		cancel()
+	}()
+
+	//фоновые циклы останавливаются по ctx, перед выходом ждем их завершения
+	var workers sync.WaitGroup
+	for _, run := range []func(context.Context){srv.RunSLAMonitor, srv.RunNotificationDispatcher, srv.RunAuditRetention,
+		srv.RunCourseCloner, srv.RunTelegramLinker} {
+		workers.Add(1)
+		go func(run func(context.Context)) {
+			defer workers.Done()
+			run(ctx)
+		}(run)
+	}
+
+	serverCnf := server.NewServerConfig(cnf.Server)
+	limiter, err := ratelimit.New(cnf.RateLimit, pg)
+	if err != nil {
+		logger.LogFatal(errors.Wrap(err, "err with ratelimit.New"))
+	}
+	handls := handlers.NewHandlers(srv, cnf, limiter)
+	if cnf.Metrics != nil && cnf.Metrics.Listen != "" {
+		go func() {
+			if err := server.StartMetricsServer(ctx, handls, cnf.Metrics.Listen, serverCnf); err != nil {
+				logger.LogError(errors.Wrap(err, "err with StartMetricsServer"))
+			}
+		}()
+	}
+	if err = server.StartServer(ctx, handls, cnf.ServerPort, serverCnf); err != nil {
+		logger.LogFatal(errors.Wrap(err, "err with StartServer"))
+	}
+
+	cancel()
+	workers.Wait()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), serverCnf.ShutdownTimeout)
+	defer cancelShutdown()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		logger.LogError(err)
+	}
+	if err = pg.Close(); err != nil {
+		logger.LogError(errors.Wrap(err, "err with Close postgres"))
+	}
+	logger.LogInfo("Сервер остановлен")
+	alerter.Stop(serverCnf.ShutdownTimeout)
 }
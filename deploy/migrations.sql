@@ -264,3 +264,451 @@ create unique index data_users_id_uindex
 
 
 
+
+
+
+
+create table teacher_events
+(
+	id serial not null
+		constraint teacher_events_pk
+			primary key,
+	teacher_id integer not null,
+	chat_id integer default 0 not null,
+	event varchar(32) not null,
+	value bigint default 0 not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table teacher_events owner to school_user;
+
+create index teacher_events_teacher_id_created_at_index
+	on teacher_events (teacher_id, created_at);
+
+
+
+create table chat_sla
+(
+	chat_id integer not null,
+	message_id integer not null,
+	reminded_at timestamp with time zone,
+	escalated_at timestamp with time zone
+);
+
+alter table chat_sla owner to school_user;
+
+create unique index chat_sla_chat_id_message_id_uindex
+	on chat_sla (chat_id, message_id);
+
+
+
+create table notification_settings
+(
+	user_id integer not null
+		constraint notification_settings_pk
+			primary key,
+	email boolean default true not null,
+	telegram boolean default false not null,
+	telegram_chat_id varchar(64) default ''::character varying not null,
+	in_app boolean default true not null,
+	updated_at timestamp with time zone default now() not null
+);
+
+alter table notification_settings owner to school_user;
+
+
+
+create table notifications
+(
+	id serial not null
+		constraint notifications_pk
+			primary key,
+	user_id integer not null,
+	kind varchar(64) not null,
+	title varchar(256) not null,
+	body text not null,
+	read_at timestamp with time zone,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table notifications owner to school_user;
+
+create index notifications_user_id_id_index
+	on notifications (user_id, id);
+
+
+
+create table notification_outbox
+(
+	id serial not null
+		constraint notification_outbox_pk
+			primary key,
+	user_id integer not null,
+	channel varchar(32) not null,
+	address varchar(256) not null,
+	title varchar(256) not null,
+	body text not null,
+	attempts integer default 0 not null,
+	last_error text default ''::text not null,
+	next_attempt_at timestamp with time zone default now() not null,
+	sent_at timestamp with time zone,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table notification_outbox owner to school_user;
+
+create index notification_outbox_next_attempt_at_index
+	on notification_outbox (next_attempt_at) where sent_at is null;
+
+
+
+create table email_verification_sends
+(
+	id serial not null
+		constraint email_verification_sends_pk
+			primary key,
+	user_id integer not null,
+	sent_at timestamp with time zone default now() not null
+);
+
+alter table email_verification_sends owner to school_user;
+
+create index email_verification_sends_user_id_sent_at_index
+	on email_verification_sends (user_id, sent_at);
+
+
+
+create table recovery_attempts
+(
+	id serial not null
+		constraint recovery_attempts_pk
+			primary key,
+	email varchar(256) not null,
+	ip varchar(64) not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table recovery_attempts owner to school_user;
+
+create index recovery_attempts_email_created_at_index
+	on recovery_attempts (email, created_at);
+
+create index recovery_attempts_ip_created_at_index
+	on recovery_attempts (ip, created_at);
+
+
+
+create table user_identities
+(
+	id serial not null
+		constraint user_identities_pk
+			primary key,
+	user_id integer not null,
+	provider varchar(32) not null,
+	subject varchar(256) not null,
+	email varchar(256) default ''::character varying not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table user_identities owner to school_user;
+
+create unique index user_identities_provider_subject_uindex
+	on user_identities (provider, subject);
+
+create unique index user_identities_user_id_provider_uindex
+	on user_identities (user_id, provider);
+
+
+
+create table oauth_states
+(
+	state varchar(64) not null
+		constraint oauth_states_pk
+			primary key,
+	provider varchar(32) not null,
+	code_verifier varchar(128) not null,
+	nonce_hash varchar(64) not null,
+	user_id integer default 0 not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table oauth_states owner to school_user;
+
+
+
+create table user_totp
+(
+	user_id integer not null
+		constraint user_totp_pk
+			primary key,
+	secret varchar(64) not null,
+	enabled_at timestamp with time zone,
+	last_step bigint default 0 not null,
+	challenge varchar(64),
+	created_at timestamp with time zone default now() not null
+);
+
+alter table user_totp owner to school_user;
+
+
+
+create table user_recovery_codes
+(
+	id serial not null
+		constraint user_recovery_codes_pk
+			primary key,
+	user_id integer not null,
+	code_hash varchar(64) not null,
+	used_at timestamp with time zone
+);
+
+alter table user_recovery_codes owner to school_user;
+
+create index user_recovery_codes_user_id_index
+	on user_recovery_codes (user_id);
+
+
+
+create table roles
+(
+	name varchar(64) not null
+		constraint roles_pk
+			primary key,
+	description varchar(256) default ''::character varying not null,
+	builtin boolean default false not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table roles owner to school_user;
+
+create table role_permissions
+(
+	role varchar(64) not null,
+	permission varchar(64) not null,
+	constraint role_permissions_pk
+		primary key (role, permission)
+);
+
+alter table role_permissions owner to school_user;
+
+insert into roles (name, description, builtin) values
+	('student', 'Ученик', true),
+	('teacher', 'Учитель', true),
+	('admin', 'Администратор', true);
+
+insert into role_permissions (role, permission) values
+	('student', 'chats.ask'),
+	('teacher', 'chats.answer'),
+	('teacher', 'users.view'),
+	('teacher', 'auth.two_factor'),
+	('admin', 'content.edit'),
+	('admin', 'chats.read_all'),
+	('admin', 'users.view'),
+	('admin', 'users.manage'),
+	('admin', 'reports.view'),
+	('admin', 'roles.manage'),
+	('admin', 'users.impersonate'),
+	('admin', 'audit.view'),
+	('admin', 'config.view'),
+	('admin', 'auth.two_factor');
+
+
+
+create table impersonations
+(
+	id serial not null
+		constraint impersonations_pk
+			primary key,
+	admin_id integer not null,
+	user_id integer not null,
+	reason varchar(512) not null,
+	created_at timestamp with time zone default now() not null,
+	expires_at timestamp with time zone not null
+);
+
+alter table impersonations owner to school_user;
+
+create index impersonations_user_id_index
+	on impersonations (user_id);
+
+
+
+create table audit_log
+(
+	id bigserial not null
+		constraint audit_log_pk
+			primary key,
+	actor_id integer not null,
+	actor_role varchar(64) not null,
+	impersonator_id integer default 0 not null,
+	action varchar(64) not null,
+	entity varchar(64) not null,
+	entity_id varchar(64) default ''::character varying not null,
+	before jsonb,
+	after jsonb,
+	ip varchar(64) default ''::character varying not null,
+	user_agent varchar(512) default ''::character varying not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table audit_log owner to school_user;
+
+create index audit_log_created_at_index
+	on audit_log (created_at);
+
+create index audit_log_entity_index
+	on audit_log (entity, entity_id);
+
+create index audit_log_actor_id_index
+	on audit_log (actor_id);
+
+-- журнал только дописывается, удаляются лишь записи старше срока хранения
+create rule audit_log_no_update as on update to audit_log do instead nothing;
+
+
+
+create table rate_limits
+(
+	key varchar(512) not null
+		constraint rate_limits_pk
+			primary key,
+	tokens double precision not null,
+	allowed boolean default true not null,
+	updated_at timestamp with time zone not null
+);
+
+alter table rate_limits owner to school_user;
+
+create index rate_limits_updated_at_index
+	on rate_limits (updated_at);
+
+
+
+create table login_lockouts
+(
+	email varchar(256) not null
+		constraint login_lockouts_pk
+			primary key,
+	failures integer default 0 not null,
+	last_failure_at timestamp with time zone default now() not null,
+	locked_until timestamp with time zone
+);
+
+alter table login_lockouts owner to school_user;
+
+
+
+create table course_clone_jobs
+(
+	id serial not null
+		constraint course_clone_jobs_pk
+			primary key,
+	course_id integer not null,
+	new_course_id integer default 0 not null,
+	options jsonb not null,
+	status varchar(16) default 'queued'::character varying not null,
+	total integer default 0 not null,
+	done integer default 0 not null,
+	error text default ''::text not null,
+	lesson_map jsonb,
+	created_by integer not null,
+	created_at timestamp with time zone default now() not null,
+	started_at timestamp with time zone,
+	finished_at timestamp with time zone,
+	locked_until timestamp with time zone
+);
+
+alter table course_clone_jobs owner to school_user;
+
+create index course_clone_jobs_status_index
+	on course_clone_jobs (status) where status in ('queued', 'running');
+
+
+
+create table telegram_link_codes
+(
+	code_hash varchar(64) not null
+		constraint telegram_link_codes_pk
+			primary key,
+	user_id integer not null,
+	created_at timestamp with time zone default now() not null
+);
+
+alter table telegram_link_codes owner to school_user;
+
+
+
+-- обновление существующей базы. Колонки, появившиеся после первого запуска, в create table выше не пишем:
+-- и новая, и старая база получают их только здесь, поэтому путь обновления проверяется каждой установкой.
+-- Раздел можно выполнять повторно
+
+-- подтверждение почты появилось позже регистрации: у уже созданных учеников email_verified_at пустой,
+-- и политика write запретила бы им писать в чаты. Считаем их адреса подтвержденными
+-- при повторном прогоне колонка уже есть, и неподтвержденные новые ученики не станут подтвержденными
+do $$
+begin
+	if not exists (select 1 from information_schema.columns
+		where table_name = 'users' and column_name = 'email_verified_at') then
+		alter table users add column email_verified_at timestamp with time zone;
+		update users set email_verified_at = coalesce(created_at, now());
+	end if;
+end $$;
+
+-- восстановление пароля хранит хеш кода со сроком и счетчиком попыток, один код на email.
+-- Старые коды в открытом виде без срока переносить незачем: таблицу пересоздаем, уже отправленные коды
+-- придется запросить заново
+do $$
+begin
+	if not exists (select 1 from information_schema.columns
+		where table_name = 'recovery_pass' and column_name = 'code_hash') then
+		drop table recovery_pass;
+		create table recovery_pass
+		(
+			email varchar(256) not null
+				constraint recovery_pass_pk
+					primary key,
+			code_hash varchar(64) not null,
+			attempts integer default 0 not null,
+			expires_at timestamp with time zone not null,
+			created_at timestamp with time zone default now() not null
+		);
+		alter table recovery_pass owner to school_user;
+	end if;
+end $$;
+
+-- версия токенов пользователя: смена пароля ее увеличивает и отзывает выданные токены
+alter table users add column if not exists token_version integer default 0 not null;
+
+-- id выданного step-up токена: токен гасится первым же опасным действием
+alter table user_totp add column if not exists step_up varchar(64);
+
+-- блокировка пользователя админом с причиной, которую он увидит при входе
+alter table users add column if not exists suspended_at timestamp with time zone;
+alter table users add column if not exists suspend_reason varchar(512) default ''::character varying not null;
+-- false - пароль сгенерирован при входе через соцсеть. У уже существующих пользователей пароль задан ими самими
+alter table users add column if not exists password_set boolean default true not null;
+
+-- порядок разделов и уровней. У уже созданных место проставляем по порядку создания, как их показывали раньше,
+-- при повторном прогоне колонка уже есть, и переставленные вручную места не сбрасываются
+do $$
+begin
+	if not exists (select 1 from information_schema.columns
+		where table_name = 'sections' and column_name = 'position') then
+		alter table sections add column position integer default 0 not null;
+		update sections set position = o.n - 1
+			from (select id, row_number() over (partition by course_id order by id) as n from sections) o
+			where sections.id = o.id;
+	end if;
+	if not exists (select 1 from information_schema.columns
+		where table_name = 'levels' and column_name = 'position') then
+		alter table levels add column position integer default 0 not null;
+		update levels set position = o.n - 1
+			from (select level_id, row_number() over (partition by section_id order by level_id) as n from levels) o
+			where levels.level_id = o.level_id;
+	end if;
+end $$;
+
+-- версии для оптимистичной блокировки при перестановках и переносе уроков
+alter table sections add column if not exists version integer default 0 not null;
+alter table levels add column if not exists version integer default 0 not null;
+alter table lessons add column if not exists version integer default 0 not null;
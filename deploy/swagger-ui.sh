@@ -0,0 +1,16 @@
+#!/bin/sh
+# Кладет статику swagger ui закрепленной версии в static/swagger-ui, результат коммитится в репозиторий
+set -eu
+
+VERSION=3.52.5
+DIR=$(dirname "$0")/../static/swagger-ui
+TMP=$(mktemp -d)
+trap 'rm -rf "$TMP"' EXIT
+
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-$VERSION.tgz" | tar -xz -C "$TMP"
+mkdir -p "$DIR"
+for f in swagger-ui.css swagger-ui-bundle.js LICENSE; do
+  cp "$TMP/package/$f" "$DIR/$f"
+done
+echo "$VERSION" > "$DIR/VERSION"
+(cd "$DIR" && sha256sum swagger-ui.css swagger-ui-bundle.js > SHA256SUMS)
@@ -1,10 +1,14 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/tarasova-school/internal/types"
+	"time"
 )
 
 type Postgres struct {
@@ -24,33 +28,48 @@ func NewPostgres(dsn string) (*Postgres, error) {
 	return &Postgres{db}, nil
 }
 
+// NewPostgresWithDB - клиент поверх уже открытого пула, в тестах это фейковая база из postgrestest
+func NewPostgresWithDB(db *sql.DB) *Postgres {
+	return &Postgres{db}
+}
+
 func (p *Postgres) Close() error {
 	return p.db.Close()
 }
 
-func (p *Postgres) CreateUser(user *types.User) (int, error) {
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// Stats - состояние пула соединений для метрик
+func (p *Postgres) Stats() sql.DBStats {
+	return p.db.Stats()
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, user *types.User) (int, error) {
 	var id int
-	if err := p.db.QueryRow("INSERT INTO users (email, pass, first_name, user_role) VALUES ($1, $2, $3, $4)"+
-		" RETURNING id", user.Email, user.Password, user.FirstName, user.UserRole).Scan(&id); err != nil {
+	if err := p.db.QueryRowContext(ctx, "INSERT INTO users (email, pass, first_name, user_role, password_set) "+
+		"VALUES ($1, $2, $3, $4, $5) RETURNING id", user.Email, user.Password, user.FirstName, user.UserRole, !user.RandomPassword).
+		Scan(&id); err != nil {
 		return 0, err
 	}
 
 	return id, nil
 }
 
-func (p *Postgres) CreateTeacher(teacher *types.Teacher) error {
-	tx, err := p.db.Begin()
+func (p *Postgres) CreateTeacher(ctx context.Context, teacher *types.Teacher) error {
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(err, "err with Begin")
 	}
 
-	err = tx.QueryRow("INSERT INTO users (email, pass, first_name, user_role) VALUES ($1, $2, $3, $4) "+
-		"RETURNING id", teacher.Email, teacher.Password, teacher.FirstName, teacher.UserRole).Scan(&teacher.ID)
+	err = tx.QueryRowContext(ctx, "INSERT INTO users (email, pass, first_name, user_role, email_verified_at) "+
+		"VALUES ($1, $2, $3, $4, NOW()) RETURNING id", teacher.Email, teacher.Password, teacher.FirstName, teacher.UserRole).Scan(&teacher.ID)
 	if err != nil {
 		return errors.Wrap(err, "err with Postgress bd users")
 	}
 
-	_, err = tx.Exec("INSERT INTO teacher_info (id) VALUES ($1)",
+	_, err = tx.ExecContext(ctx, "INSERT INTO teacher_info (id) VALUES ($1)",
 		teacher.ID)
 	if err != nil {
 		tx.Rollback()
@@ -64,10 +83,10 @@ func (p *Postgres) CreateTeacher(teacher *types.Teacher) error {
 	return nil
 }
 
-func (p *Postgres) GetTeacherByID(id int) (*types.TeacherFullInfo, error) {
+func (p *Postgres) GetTeacherByID(ctx context.Context, id int) (*types.TeacherFullInfo, error) {
 
 	teacher := types.TeacherFullInfo{ID: id}
-	err := p.db.QueryRow("SELECT users.first_name, teacher_info.good, teacher_info.improve, "+
+	err := p.db.QueryRowContext(ctx, "SELECT users.first_name, teacher_info.good, teacher_info.improve, "+
 		"teacher_info.ahtung, users.times_seconds FROM users, teacher_info WHERE "+
 		"users.id = teacher_info.id AND users.id= $1", teacher.ID).Scan(&teacher.FirstName, &teacher.Good,
 		&teacher.Improve, &teacher.Ahtung, &teacher.Times)
@@ -78,9 +97,9 @@ func (p *Postgres) GetTeacherByID(id int) (*types.TeacherFullInfo, error) {
 	return &teacher, nil
 }
 
-func (p *Postgres) UpdateTeacher(teacher *types.Teacher) error {
+func (p *Postgres) UpdateTeacher(ctx context.Context, teacher *types.Teacher) error {
 
-	_, err := p.db.Exec("UPDATE users SET first_name = $2, email = $3, updated_at=NOW() WHERE id = $1",
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET first_name = $2, email = $3, updated_at=NOW() WHERE id = $1",
 		teacher.ID, teacher.FirstName, teacher.Email)
 	if err != nil {
 		return errors.Wrap(err, "err with users bd")
@@ -89,19 +108,19 @@ func (p *Postgres) UpdateTeacher(teacher *types.Teacher) error {
 	return nil
 }
 
-func (p *Postgres) DeleteTeacher(idTeacher int) error {
+func (p *Postgres) DeleteTeacher(ctx context.Context, idTeacher int) error {
 	//todo как понял для удаления нельзя использовать один запрос. Можно прописать одной строкой через точку с запятой
 	//todo но тогда не выловим ошибку на каком именно этапе произошел ерор
-	tx, err := p.db.Begin()
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(err, "err with Begin")
 	}
-	_, err = tx.Exec("DELETE FROM users WHERE id = $1", idTeacher)
+	_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", idTeacher)
 	if err != nil {
 		return errors.Wrap(err, "err with delete teacher from users")
 	}
 
-	_, err = tx.Exec("DELETE FROM teacher_info WHERE id = $1", idTeacher)
+	_, err = tx.ExecContext(ctx, "DELETE FROM teacher_info WHERE id = $1", idTeacher)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "err with teacher_info bd")
@@ -114,11 +133,13 @@ func (p *Postgres) DeleteTeacher(idTeacher int) error {
 	return nil
 }
 
-func (p *Postgres) GetUserByEmail(email string) (*types.User, error) {
+func (p *Postgres) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 
 	user := types.User{Email: email}
-	err := p.db.QueryRow("SELECT id, pass, first_name, user_role FROM users WHERE email = $1", email).
-		Scan(&user.ID, &user.Password, &user.FirstName, &user.UserRole)
+	err := p.db.QueryRowContext(ctx, "SELECT id, pass, first_name, user_role, token_version, suspended_at IS NOT NULL, "+
+		"suspend_reason FROM users WHERE email = $1", email).
+		Scan(&user.ID, &user.Password, &user.FirstName, &user.UserRole, &user.TokenVersion, &user.Suspended,
+			&user.SuspendReason)
 	if err != nil {
 		return nil, err
 	}
@@ -126,10 +147,10 @@ func (p *Postgres) GetUserByEmail(email string) (*types.User, error) {
 	return &user, nil
 }
 
-func (p *Postgres) GetTeacherByEmail(email string) (*types.Teacher, error) {
+func (p *Postgres) GetTeacherByEmail(ctx context.Context, email string) (*types.Teacher, error) {
 
 	teacher := types.Teacher{Email: email}
-	err := p.db.QueryRow("SELECT id, pass, first_name, user_role FROM users WHERE email = $1", email).
+	err := p.db.QueryRowContext(ctx, "SELECT id, pass, first_name, user_role FROM users WHERE email = $1", email).
 		Scan(&teacher.ID, &teacher.Password, &teacher.FirstName, &teacher.UserRole)
 	if err != nil {
 		return nil, err
@@ -138,11 +159,13 @@ func (p *Postgres) GetTeacherByEmail(email string) (*types.Teacher, error) {
 	return &teacher, nil
 }
 
-func (p *Postgres) GetUserByID(id int) (*types.User, error) {
+func (p *Postgres) GetUserByID(ctx context.Context, id int) (*types.User, error) {
 
 	user := types.User{ID: id}
-	err := p.db.QueryRow("SELECT email, pass, first_name, user_role FROM users WHERE id = $1", id).
-		Scan(&user.Email, &user.Password, &user.FirstName, &user.UserRole)
+	err := p.db.QueryRowContext(ctx, "SELECT email, pass, first_name, user_role, token_version, suspended_at IS NOT NULL, "+
+		"suspend_reason FROM users WHERE id = $1", id).
+		Scan(&user.Email, &user.Password, &user.FirstName, &user.UserRole, &user.TokenVersion, &user.Suspended,
+			&user.SuspendReason)
 	if err != nil {
 		return nil, err
 	}
@@ -150,9 +173,11 @@ func (p *Postgres) GetUserByID(id int) (*types.User, error) {
 	return &user, nil
 }
 
-func (p *Postgres) UpdatePassword(ch *types.ChangePassword) error {
+// UpdatePasswordAndRevokeTokens меняет пароль и увеличивает token_version, все выданные ранее токены перестают работать
+func (p *Postgres) UpdatePasswordAndRevokeTokens(ctx context.Context, userID int, pass string) error {
 
-	_, err := p.db.Exec("UPDATE users SET pass = $1, updated_at = NOW() WHERE id = $2", ch.NewPassword, ch.UserID)
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET pass = $1, password_set = true, token_version = token_version + 1, updated_at = NOW() "+
+		"WHERE id = $2", pass, userID)
 	if err != nil {
 		return err
 	}
@@ -160,48 +185,71 @@ func (p *Postgres) UpdatePassword(ch *types.ChangePassword) error {
 	return nil
 }
 
-func (p *Postgres) AddCodeForRecoveryPass(email, code string) error {
+// AddCodeForRecoveryPass сохраняет хеш кода, предыдущий код для этого email заменяется
+func (p *Postgres) AddCodeForRecoveryPass(ctx context.Context, email, codeHash string, expiresAt time.Time) error {
 
-	if _, err := p.db.Exec("INSERT INTO recovery_pass (email, code) VALUES ($1, $2)", email, code); err != nil {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO recovery_pass (email, code_hash, expires_at) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (email) DO UPDATE SET code_hash = $2, expires_at = $3, attempts = 0, created_at = NOW()",
+		email, codeHash, expiresAt)
+	if err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (p *Postgres) CheckRecoveryPass(ch *types.RecoveryPasswordEmailAndCode) error {
-	//todo Пределать ебала какая то
-	if err := p.db.QueryRow("SELECT email, code FROM recovery_pass WHERE email = $1 AND code = $2",
-		ch.Email, ch.Code).Scan(&ch.Email, &ch.Code); err != nil {
+// UseRecoveryPassAttempt атомарно тратит попытку живого кода и возвращает его хеш. Параллельные проверки
+// не видят один и тот же счетчик: после maxAttempts попыток или истечения срока вернется sql.ErrNoRows
+func (p *Postgres) UseRecoveryPassAttempt(ctx context.Context, email string, maxAttempts int) (string, error) {
+
+	var codeHash string
+	err := p.db.QueryRowContext(ctx, "UPDATE recovery_pass SET attempts = attempts + 1 "+
+		"WHERE email = $1 AND attempts < $2 AND expires_at > NOW() RETURNING code_hash", email, maxAttempts).
+		Scan(&codeHash)
+	if err != nil {
+		return "", err
+	}
+
+	return codeHash, nil
+}
+
+func (p *Postgres) DeleteRecoveryPass(ctx context.Context, email string) error {
+
+	if _, err := p.db.ExecContext(ctx, "DELETE FROM recovery_pass WHERE email = $1", email); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (p *Postgres) DeleteRecoveryPass(email string) error {
+func (p *Postgres) AddRecoveryAttempt(ctx context.Context, email, ip string) error {
 
-	if _, err := p.db.Exec("DELETE FROM recovery_pass WHERE email = $1", email); err != nil {
+	if _, err := p.db.ExecContext(ctx, "INSERT INTO recovery_attempts (email, ip) VALUES ($1, $2)", email, ip); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (p Postgres) CheckDBRecoveryPassword(email string) (bool, error) {
-	//todo Пределать ебала какая то
-	if err := p.db.QueryRow("SELECT email FROM recovery_pass WHERE email = $1", email).Scan(&email); err != nil {
-		return false, err
+// CountRecoveryAttempts возвращает число попыток восстановления с since отдельно по email и по ip
+func (p *Postgres) CountRecoveryAttempts(ctx context.Context, email, ip string, since time.Time) (int, int, error) {
+
+	var byEmail, byIP int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FILTER (WHERE email = $1), COUNT(*) FILTER (WHERE ip = $2) "+
+		"FROM recovery_attempts WHERE (email = $1 OR ip = $2) AND created_at >= $3", email, ip, since).
+		Scan(&byEmail, &byIP)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	return true, nil
+	return byEmail, byIP, nil
 }
 
-func (p *Postgres) GetAllStudentsForAdmin() ([]types.UserStat, error) {
+func (p *Postgres) GetAllStudentsForAdmin(ctx context.Context) ([]types.UserStat, error) {
 
 	users := make([]types.UserStat, 0)
 
-	rows, err := p.db.Query("SELECT email, first_name, user_role FROM users WHERE user_role = 'student'")
+	rows, err := p.db.QueryContext(ctx, "SELECT email, first_name, user_role FROM users WHERE user_role = 'student'")
 	if err != nil {
 		return nil, err
 	}
@@ -217,11 +265,11 @@ func (p *Postgres) GetAllStudentsForAdmin() ([]types.UserStat, error) {
 	return users, nil
 }
 
-func (p *Postgres) GetAllTeachersForAdmin() ([]types.UserStat, error) {
+func (p *Postgres) GetAllTeachersForAdmin(ctx context.Context) ([]types.UserStat, error) {
 
 	users := make([]types.UserStat, 0)
 
-	rows, err := p.db.Query("SELECT email, first_name, user_role FROM users WHERE user_role = 'teacher'")
+	rows, err := p.db.QueryContext(ctx, "SELECT email, first_name, user_role FROM users WHERE user_role = 'teacher'")
 	if err != nil {
 		return nil, err
 	}
@@ -237,11 +285,11 @@ func (p *Postgres) GetAllTeachersForAdmin() ([]types.UserStat, error) {
 	return users, nil
 }
 
-func (p *Postgres) GetAllAdminsForAdmin() ([]types.UserStat, error) {
+func (p *Postgres) GetAllAdminsForAdmin(ctx context.Context) ([]types.UserStat, error) {
 
 	users := make([]types.UserStat, 0)
 
-	rows, err := p.db.Query("SELECT email, first_name, user_role FROM users WHERE user_role = 'admin'")
+	rows, err := p.db.QueryContext(ctx, "SELECT email, first_name, user_role FROM users WHERE user_role = 'admin'")
 	if err != nil {
 		return nil, err
 	}
@@ -257,11 +305,31 @@ func (p *Postgres) GetAllAdminsForAdmin() ([]types.UserStat, error) {
 	return users, nil
 }
 
-func (p *Postgres) GetAllUsersForAdmin() ([]types.UserStat, error) {
+// GetAdminIDs - id всех админов, для уведомлений
+func (p *Postgres) GetAdminIDs(ctx context.Context) ([]int, error) {
+
+	ids := make([]int, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT id FROM users WHERE user_role = 'admin' ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		id := 0
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (p *Postgres) GetAllUsersForAdmin(ctx context.Context) ([]types.UserStat, error) {
 
 	users := make([]types.UserStat, 0)
 
-	rows, err := p.db.Query("SELECT email, first_name, user_role FROM users")
+	rows, err := p.db.QueryContext(ctx, "SELECT email, first_name, user_role FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -277,11 +345,11 @@ func (p *Postgres) GetAllUsersForAdmin() ([]types.UserStat, error) {
 	return users, nil
 }
 
-func (p *Postgres) GetAllTeachersInfoForAdmin() ([]types.TeacherFullInfo, error) {
+func (p *Postgres) GetAllTeachersInfoForAdmin(ctx context.Context) ([]types.TeacherFullInfo, error) {
 
 	teachers := make([]types.TeacherFullInfo, 0)
 
-	rows, err := p.db.Query("SELECT users.id, users.first_name, teacher_info.good, teacher_info.improve, " +
+	rows, err := p.db.QueryContext(ctx, "SELECT users.id, users.first_name, teacher_info.good, teacher_info.improve, "+
 		"teacher_info.ahtung, users.times_seconds FROM users, teacher_info WHERE users.id = teacher_info.id")
 	if err != nil {
 		return nil, err
@@ -299,10 +367,10 @@ func (p *Postgres) GetAllTeachersInfoForAdmin() ([]types.TeacherFullInfo, error)
 	return teachers, nil
 }
 
-func (p *Postgres) GetAllCourse() ([]types.Course, error) {
+func (p *Postgres) GetAllCourse(ctx context.Context) ([]types.Course, error) {
 
 	courses := make([]types.Course, 0)
-	rows, err := p.db.Query("SELECT id, name, cost FROM courses")
+	rows, err := p.db.QueryContext(ctx, "SELECT id, name, cost FROM courses")
 	if err != nil {
 		return nil, errors.Wrap(err, "err with query")
 	}
@@ -318,10 +386,10 @@ func (p *Postgres) GetAllCourse() ([]types.Course, error) {
 	return courses, nil
 }
 
-func (p *Postgres) GetAllCoursesInfoForAdmin() ([]types.CourseInfoForAdmin, error) {
+func (p *Postgres) GetAllCoursesInfoForAdmin(ctx context.Context) ([]types.CourseInfoForAdmin, error) {
 
 	courses := make([]types.CourseInfoForAdmin, 0)
-	rows, err := p.db.Query("SELECT id, name, cost, users, dz, sale, total FROM courses")
+	rows, err := p.db.QueryContext(ctx, "SELECT id, name, cost, users, dz, sale, total FROM courses")
 	if err != nil {
 		return nil, errors.Wrap(err, "err with query")
 	}
@@ -338,17 +406,18 @@ func (p *Postgres) GetAllCoursesInfoForAdmin() ([]types.CourseInfoForAdmin, erro
 	return courses, nil
 }
 
-func (p *Postgres) GetAllSectionInCourses(idCourse int) ([]types.Section, error) {
+func (p *Postgres) GetAllSectionInCourses(ctx context.Context, idCourse int) ([]types.Section, error) {
 
 	sections := make([]types.Section, 0)
-	rows, err := p.db.Query("SELECT id, course_id, name FROM sections WHERE course_id = $1 ", idCourse)
+	rows, err := p.db.QueryContext(ctx, "SELECT id, course_id, name, position, version FROM sections WHERE course_id = $1 "+
+		"ORDER BY position, id", idCourse)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
 	defer rows.Close()
 	section := types.Section{}
 	for rows.Next() {
-		if err = rows.Scan(&section.ID, &section.CourseID, &section.Name); err != nil {
+		if err = rows.Scan(&section.ID, &section.CourseID, &section.Name, &section.Position, &section.Version); err != nil {
 			return nil, errors.Wrap(err, "err with Scan")
 		}
 		sections = append(sections, section)
@@ -357,11 +426,11 @@ func (p *Postgres) GetAllSectionInCourses(idCourse int) ([]types.Section, error)
 	return sections, nil
 }
 
-func (p *Postgres) GetAllLevelsInSection(idCourse, idSection int) ([]types.Level, error) {
+func (p *Postgres) GetAllLevelsInSection(ctx context.Context, idCourse, idSection int) ([]types.Level, error) {
 
 	levels := make([]types.Level, 0)
-	rows, err := p.db.Query("SELECT course_id, section_id, level_id, name "+
-		"FROM levels WHERE course_id = $1 AND section_id = $2",
+	rows, err := p.db.QueryContext(ctx, "SELECT course_id, section_id, level_id, name, position, version "+
+		"FROM levels WHERE course_id = $1 AND section_id = $2 ORDER BY position, level_id",
 		idCourse, idSection)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
@@ -370,7 +439,7 @@ func (p *Postgres) GetAllLevelsInSection(idCourse, idSection int) ([]types.Level
 	level := types.Level{}
 	for rows.Next() {
 		if err = rows.Scan(&level.CourseID, &level.SectionID, &level.ID,
-			&level.Name); err != nil {
+			&level.Name, &level.Position, &level.Version); err != nil {
 			return nil, errors.Wrap(err, "err with Scan")
 		}
 
@@ -380,11 +449,13 @@ func (p *Postgres) GetAllLevelsInSection(idCourse, idSection int) ([]types.Level
 	return levels, nil
 }
 
-func (p *Postgres) GetAllLessonsInLevel(idCourse, idSection, idLevel int) ([]types.Lesson, error) {
+func (p *Postgres) GetAllLessonsInLevel(ctx context.Context, idCourse, idSection, idLevel int) ([]types.Lesson, error) {
 
 	lessons := make([]types.Lesson, 0)
-	rows, err := p.db.Query("SELECT course_id, section_id, level_id, lesson_id, name, description, thesis, task "+
-		"FROM lessons WHERE course_id = $1 AND section_id = $2 AND level_id = $3",
+	rows, err := p.db.QueryContext(ctx, "SELECT l.course_id, l.section_id, l.level_id, l.lesson_id, l.name, l.description, l.thesis, l.task, l.version "+
+		"FROM lessons l LEFT JOIN lesson_carousel c ON c.level_id = l.level_id "+
+		"WHERE l.course_id = $1 AND l.section_id = $2 AND l.level_id = $3 "+
+		"ORDER BY array_position(c.lesson_array, l.lesson_id) NULLS LAST, l.lesson_id",
 		idCourse, idSection, idLevel)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
@@ -393,7 +464,7 @@ func (p *Postgres) GetAllLessonsInLevel(idCourse, idSection, idLevel int) ([]typ
 	lesson := types.Lesson{}
 	for rows.Next() {
 		if err = rows.Scan(&lesson.CourseID, &lesson.SectionID, &lesson.LevelID, &lesson.ID,
-			&lesson.Name, &lesson.Description, pq.Array(&lesson.Thesis), &lesson.Task); err != nil {
+			&lesson.Name, &lesson.Description, pq.Array(&lesson.Thesis), &lesson.Task, &lesson.Version); err != nil {
 			return nil, errors.Wrap(err, "err with Scan")
 		}
 
@@ -403,10 +474,10 @@ func (p *Postgres) GetAllLessonsInLevel(idCourse, idSection, idLevel int) ([]typ
 	return lessons, nil
 }
 
-func (p *Postgres) CreateCourse(course *types.Course) (*types.OnlyID, error) {
+func (p *Postgres) CreateCourse(ctx context.Context, course *types.Course) (*types.OnlyID, error) {
 
 	id := types.OnlyID{}
-	if err := p.db.QueryRow("INSERT INTO courses (name, cost, total_price_for_user) VALUES ($1, $2, $3) RETURNING id",
+	if err := p.db.QueryRowContext(ctx, "INSERT INTO courses (name, cost, total_price_for_user) VALUES ($1, $2, $3) RETURNING id",
 		course.Name, course.Cost, course.TotalPrice).Scan(&id.ID); err != nil {
 		return &id, errors.Wrap(err, "err with Exec")
 	}
@@ -414,10 +485,11 @@ func (p *Postgres) CreateCourse(course *types.Course) (*types.OnlyID, error) {
 	return &id, nil
 }
 
-func (p *Postgres) CreateSection(section *types.Section) (*types.OnlyID, error) {
+func (p *Postgres) CreateSection(ctx context.Context, section *types.Section) (*types.OnlyID, error) {
 
 	id := types.OnlyID{}
-	if err := p.db.QueryRow("INSERT INTO sections (course_id, name) VALUES ($1, $2) RETURNING id",
+	if err := p.db.QueryRowContext(ctx, "INSERT INTO sections (course_id, name, position) VALUES ($1, $2, "+
+		"(SELECT COALESCE(MAX(position) + 1, 0) FROM sections WHERE course_id = $1)) RETURNING id",
 		section.CourseID, section.Name).Scan(&id.ID); err != nil {
 		return &id, errors.Wrap(err, "err with Exec")
 	}
@@ -425,21 +497,21 @@ func (p *Postgres) CreateSection(section *types.Section) (*types.OnlyID, error)
 	return &id, nil
 }
 
-func (p *Postgres) CreateLevel(level *types.Level) (*types.OnlyID, error) {
+func (p *Postgres) CreateLevel(ctx context.Context, level *types.Level) (*types.OnlyID, error) {
 
 	id := types.OnlyID{}
-	if err := p.db.QueryRow("INSERT INTO levels (course_id, section_id, name) VALUES ($1, $2, $3) "+
-		"RETURNING level_id", level.CourseID, level.SectionID, level.Name).Scan(&id.ID); err != nil {
+	if err := p.db.QueryRowContext(ctx, "INSERT INTO levels (course_id, section_id, name, position) VALUES ($1, $2, $3, "+
+		"(SELECT COALESCE(MAX(position) + 1, 0) FROM levels WHERE section_id = $2)) RETURNING level_id", level.CourseID, level.SectionID, level.Name).Scan(&id.ID); err != nil {
 		return &id, errors.Wrap(err, "err with Exec")
 	}
 
 	return &id, nil
 }
 
-func (p *Postgres) CreateLesson(lesson *types.Lesson) (*types.OnlyID, error) {
+func (p *Postgres) CreateLesson(ctx context.Context, lesson *types.Lesson) (*types.OnlyID, error) {
 
 	id := types.OnlyID{}
-	err := p.db.QueryRow("INSERT INTO lessons (course_id, section_id, level_id, name, "+
+	err := p.db.QueryRowContext(ctx, "INSERT INTO lessons (course_id, section_id, level_id, name, "+
 		"description, thesis, task) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING lesson_id",
 		lesson.CourseID, lesson.SectionID, lesson.LevelID, lesson.Name,
 		lesson.Description, pq.Array(lesson.Thesis), lesson.Task).Scan(&id.ID)
@@ -450,11 +522,11 @@ func (p *Postgres) CreateLesson(lesson *types.Lesson) (*types.OnlyID, error) {
 	return &id, nil
 }
 
-func (p *Postgres) GetLessonCarousel(idLevel int) (*types.LessonCarousel, error) {
+func (p *Postgres) GetLessonCarousel(ctx context.Context, idLevel int) (*types.LessonCarousel, error) {
 
 	carousel := types.LessonCarousel{}
 	arr := pq.Int64Array{}
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id, lesson_array FROM lesson_carousel "+
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, lesson_array FROM lesson_carousel "+
 		"WHERE level_id = $1", idLevel).Scan(&carousel.CourseID, &carousel.SectionID, &carousel.LevelID, &arr)
 	if err != nil {
 		return nil, err
@@ -465,9 +537,9 @@ func (p *Postgres) GetLessonCarousel(idLevel int) (*types.LessonCarousel, error)
 	return &carousel, nil
 }
 
-func (p *Postgres) AddCarousel(idCourse, idSection, idLevel int, idLesson []int) error {
+func (p *Postgres) AddCarousel(ctx context.Context, idCourse, idSection, idLevel int, idLesson []int) error {
 
-	if _, err := p.db.Exec("INSERT INTO lesson_carousel (course_id, section_id, level_id, lesson_array) "+
+	if _, err := p.db.ExecContext(ctx, "INSERT INTO lesson_carousel (course_id, section_id, level_id, lesson_array) "+
 		"VALUES ($1, $2, $3, $4)", idCourse, idSection, idLevel, pq.Array(idLesson)); err != nil {
 		return err
 	}
@@ -475,9 +547,9 @@ func (p *Postgres) AddCarousel(idCourse, idSection, idLevel int, idLesson []int)
 	return nil
 }
 
-func (p *Postgres) UpdateCarousel(carousel *types.LessonCarousel) error {
+func (p *Postgres) UpdateCarousel(ctx context.Context, carousel *types.LessonCarousel) error {
 
-	_, err := p.db.Exec("UPDATE lesson_carousel SET lesson_array = $1 WHERE level_id = $2",
+	_, err := p.db.ExecContext(ctx, "UPDATE lesson_carousel SET lesson_array = $1 WHERE level_id = $2",
 		pq.Array(carousel.LessonArray), carousel.LevelID)
 	if err != nil {
 		return err
@@ -486,9 +558,9 @@ func (p *Postgres) UpdateCarousel(carousel *types.LessonCarousel) error {
 	return nil
 }
 
-func (p *Postgres) DeleteCarousel(levelID int) error {
+func (p *Postgres) DeleteCarousel(ctx context.Context, levelID int) error {
 
-	_, err := p.db.Exec("DELETE FROM lesson_carousel WHERE level_id = $1", levelID)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM lesson_carousel WHERE level_id = $1", levelID)
 	if err != nil {
 		return err
 	}
@@ -496,10 +568,270 @@ func (p *Postgres) DeleteCarousel(levelID int) error {
 	return nil
 }
 
-func (p *Postgres) GetCourse(idCourse int) (*types.Course, error) {
+// GetCourseLessons - уроки курса по порядку прохождения: места разделов и уровней, затем порядок уроков в карусели уровня
+func (p *Postgres) GetCourseLessons(ctx context.Context, idCourse int) ([]types.LessonNav, error) {
+
+	lessons := make([]types.LessonNav, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT l.lesson_id, l.course_id, l.section_id, l.level_id, l.name FROM lessons l "+
+		"JOIN sections s ON s.id = l.section_id JOIN levels lv ON lv.level_id = l.level_id "+
+		"LEFT JOIN lesson_carousel c ON c.level_id = l.level_id WHERE l.course_id = $1 "+
+		"ORDER BY s.position, s.id, lv.position, lv.level_id, array_position(c.lesson_array, l.lesson_id) NULLS LAST, "+
+		"l.lesson_id", idCourse)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	lesson := types.LessonNav{}
+	for rows.Next() {
+		if err = rows.Scan(&lesson.ID, &lesson.CourseID, &lesson.SectionID, &lesson.LevelID, &lesson.Name); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		lessons = append(lessons, lesson)
+	}
+
+	return lessons, rows.Err()
+}
+
+// GetLevelBreadcrumbs - курс, раздел и сам уровень
+func (p *Postgres) GetLevelBreadcrumbs(ctx context.Context, idLevel int) ([]types.Breadcrumb, error) {
+
+	course := types.Breadcrumb{Type: types.BreadcrumbCourse}
+	section := types.Breadcrumb{Type: types.BreadcrumbSection}
+	level := types.Breadcrumb{Type: types.BreadcrumbLevel}
+	err := p.db.QueryRowContext(ctx, "SELECT c.id, c.name, s.id, s.name, l.level_id, l.name FROM levels l "+
+		"JOIN sections s ON s.id = l.section_id JOIN courses c ON c.id = l.course_id WHERE l.level_id = $1", idLevel).
+		Scan(&course.ID, &course.Name, &section.ID, &section.Name, &level.ID, &level.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return []types.Breadcrumb{course, section, level}, nil
+}
+
+// ReorderSection ставит раздел на место placement.Position среди разделов курса, места остальных пересчитываются.
+// false - версия раздела уже не placement.Version
+func (p *Postgres) ReorderSection(ctx context.Context, placement *types.Placement) (bool, error) {
+	return p.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+		return reorder(ctx, tx, "sections", "id", "course_id", placement)
+	})
+}
+
+// ReorderLevel - то же для уровня среди уровней раздела
+func (p *Postgres) ReorderLevel(ctx context.Context, placement *types.Placement) (bool, error) {
+	return p.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+		return reorder(ctx, tx, "levels", "level_id", "section_id", placement)
+	})
+}
+
+// MoveLesson переносит урок в уровень levelID на место placement.Position вместе с его чатами и пересобирает карусели
+// обоих уровней, для перестановки внутри уровня levelID - текущий уровень урока. Видео лежит по id урока и не переносится.
+// false - версия урока уже не placement.Version
+func (p *Postgres) MoveLesson(ctx context.Context, placement *types.Placement, levelID int) (bool, error) {
+	return p.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+		return moveLesson(ctx, tx, placement, levelID)
+	})
+}
+
+// inTx выполняет fn в транзакции, транзакция фиксируется, только если fn вернула true
+func (p *Postgres) inTx(ctx context.Context, fn func(tx *sql.Tx) (bool, error)) (bool, error) {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "err with Begin")
+	}
+
+	ok, err := fn(tx)
+	if err != nil || !ok {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return false, errors.Wrap(err, "err with Commit")
+	}
+	return true, nil
+}
+
+// reorder - общая часть ReorderSection и ReorderLevel. Сначала блокируются все соседи, потом сверяется версия,
+// так параллельные перестановки в одном списке идут по очереди
+func reorder(ctx context.Context, tx *sql.Tx, table, idColumn, parentColumn string, placement *types.Placement) (bool, error) {
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %[1]s, version FROM %[2]s WHERE %[3]s = "+
+		"(SELECT %[3]s FROM %[2]s WHERE %[1]s = $1) ORDER BY position, %[1]s FOR UPDATE",
+		idColumn, table, parentColumn), placement.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "err with Query")
+	}
+	ids := make([]int64, 0)
+	version := -1
+	for rows.Next() {
+		var id int64
+		var v int
+		if err = rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return false, errors.Wrap(err, "err with Scan")
+		}
+		if int(id) == placement.ID {
+			version = v
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, errors.Wrap(err, "err with Rows")
+	}
+	if version < 0 {
+		return false, sql.ErrNoRows
+	}
+	if version != placement.Version {
+		return false, nil
+	}
+
+	ids, placement.Position = placeAt(ids, int64(placement.ID), placement.Position)
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %[1]s t SET position = o.n - 1 "+
+		"FROM unnest($1::integer[]) WITH ORDINALITY AS o(id, n) WHERE t.%[2]s = o.id", table, idColumn),
+		pq.Array(ids)); err != nil {
+		return false, errors.Wrap(err, "err with update position")
+	}
+	if err = tx.QueryRowContext(ctx, fmt.Sprintf("UPDATE %s SET version = version + 1, updated_at = now() "+
+		"WHERE %s = $1 RETURNING version", table, idColumn), placement.ID).Scan(&placement.Version); err != nil {
+		return false, errors.Wrap(err, "err with update version")
+	}
+
+	return true, nil
+}
+
+func moveLesson(ctx context.Context, tx *sql.Tx, placement *types.Placement, levelID int) (bool, error) {
+
+	from := types.Level{}
+	version := 0
+	if err := tx.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, version FROM lessons "+
+		"WHERE lesson_id = $1 FOR UPDATE", placement.ID).Scan(&from.CourseID, &from.SectionID, &from.ID, &version); err != nil {
+		return false, err
+	}
+	if version != placement.Version {
+		return false, nil
+	}
+
+	//уровни блокируются по возрастанию id, чтобы встречные переносы не взаимоблокировались
+	to := types.Level{ID: levelID}
+	rows, err := tx.QueryContext(ctx, "SELECT course_id, section_id, level_id FROM levels WHERE level_id IN ($1, $2) "+
+		"ORDER BY level_id FOR UPDATE", from.ID, to.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "err with lock levels")
+	}
+	found := false
+	for rows.Next() {
+		level := types.Level{}
+		if err = rows.Scan(&level.CourseID, &level.SectionID, &level.ID); err != nil {
+			rows.Close()
+			return false, errors.Wrap(err, "err with Scan")
+		}
+		if level.ID == to.ID {
+			to, found = level, true
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, errors.Wrap(err, "err with Rows")
+	}
+	//урок переносится только в пределах своего курса, уровень другого курса считается ненайденным
+	if !found || to.CourseID != from.CourseID {
+		return false, sql.ErrNoRows
+	}
+
+	if err = tx.QueryRowContext(ctx, "UPDATE lessons SET course_id = $2, section_id = $3, level_id = $4, "+
+		"version = version + 1, updated_at = now() WHERE lesson_id = $1 RETURNING version",
+		placement.ID, to.CourseID, to.SectionID, to.ID).Scan(&placement.Version); err != nil {
+		return false, errors.Wrap(err, "err with update lessons")
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE chat SET course_id = $2, section_id = $3, level_id = $4 WHERE lesson_id = $1",
+		placement.ID, to.CourseID, to.SectionID, to.ID); err != nil {
+		return false, errors.Wrap(err, "err with update chat")
+	}
+
+	if from.ID != to.ID {
+		lessons, err := levelLessons(ctx, tx, from.ID)
+		if err != nil {
+			return false, err
+		}
+		if err = saveCarousel(ctx, tx, &from, lessons); err != nil {
+			return false, err
+		}
+	}
+	lessons, err := levelLessons(ctx, tx, to.ID)
+	if err != nil {
+		return false, err
+	}
+	lessons, placement.Position = placeAt(lessons, int64(placement.ID), placement.Position)
+	if err = saveCarousel(ctx, tx, &to, lessons); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// levelLessons - id уроков уровня в порядке карусели, уроки не из карусели в конце
+func levelLessons(ctx context.Context, tx *sql.Tx, levelID int) ([]int64, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT l.lesson_id FROM lessons l LEFT JOIN lesson_carousel c ON c.level_id = l.level_id "+
+		"WHERE l.level_id = $1 ORDER BY array_position(c.lesson_array, l.lesson_id) NULLS LAST, l.lesson_id", levelID)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	lessons := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		lessons = append(lessons, id)
+	}
+
+	return lessons, rows.Err()
+}
+
+func saveCarousel(ctx context.Context, tx *sql.Tx, level *types.Level, lessons []int64) error {
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO lesson_carousel (course_id, section_id, level_id, lesson_array) "+
+		"VALUES ($1, $2, $3, $4) ON CONFLICT (level_id) DO UPDATE SET course_id = $1, section_id = $2, lesson_array = $4",
+		level.CourseID, level.SectionID, level.ID, pq.Array(lessons))
+	if err != nil {
+		return errors.Wrap(err, "err with save lesson_carousel")
+	}
+
+	return nil
+}
+
+// placeAt ставит id на место position, место за концом списка - последнее, отрицательное - первое.
+// id может и не быть в списке, например урок переносят из другого уровня. Возвращает новый список и итоговое место
+func placeAt(ids []int64, id int64, position int) ([]int64, int) {
+
+	placed := make([]int64, 0, len(ids)+1)
+	for _, v := range ids {
+		if v != id {
+			placed = append(placed, v)
+		}
+	}
+	if position > len(placed) {
+		position = len(placed)
+	}
+	if position < 0 {
+		position = 0
+	}
+	placed = append(placed, 0)
+	copy(placed[position+1:], placed[position:])
+	placed[position] = id
+
+	return placed, position
+}
+
+func (p *Postgres) GetCourse(ctx context.Context, idCourse int) (*types.Course, error) {
 
 	course := types.Course{ID: idCourse}
-	err := p.db.QueryRow("SELECT name, cost, sale, total_price_for_user FROM courses WHERE id = $1", idCourse).
+	err := p.db.QueryRowContext(ctx, "SELECT name, cost, sale, total_price_for_user FROM courses WHERE id = $1", idCourse).
 		Scan(&course.Name, &course.Cost, &course.Sale, &course.TotalPrice)
 	if err != nil {
 		return nil, err
@@ -508,11 +840,11 @@ func (p *Postgres) GetCourse(idCourse int) (*types.Course, error) {
 	return &course, nil
 }
 
-func (p *Postgres) GetSection(idSection int) (*types.Section, error) {
+func (p *Postgres) GetSection(ctx context.Context, idSection int) (*types.Section, error) {
 
 	section := types.Section{ID: idSection}
-	err := p.db.QueryRow("SELECT course_id, name FROM sections WHERE id = $1", idSection).
-		Scan(&section.CourseID, &section.Name)
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, name, position, version FROM sections WHERE id = $1", idSection).
+		Scan(&section.CourseID, &section.Name, &section.Position, &section.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -520,11 +852,11 @@ func (p *Postgres) GetSection(idSection int) (*types.Section, error) {
 	return &section, nil
 }
 
-func (p *Postgres) GetLevel(idLevel int) (*types.Level, error) {
+func (p *Postgres) GetLevel(ctx context.Context, idLevel int) (*types.Level, error) {
 
 	level := types.Level{ID: idLevel}
-	err := p.db.QueryRow("SELECT course_id, section_id, name FROM levels WHERE level_id = $1", idLevel).
-		Scan(&level.CourseID, &level.SectionID, &level.Name)
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, name, position, version FROM levels WHERE level_id = $1", idLevel).
+		Scan(&level.CourseID, &level.SectionID, &level.Name, &level.Position, &level.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -532,13 +864,13 @@ func (p *Postgres) GetLevel(idLevel int) (*types.Level, error) {
 	return &level, nil
 }
 
-func (p *Postgres) GetLesson(idLesson int) (*types.Lesson, error) {
+func (p *Postgres) GetLesson(ctx context.Context, idLesson int) (*types.Lesson, error) {
 
 	lesson := types.Lesson{ID: idLesson}
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id, name, description, thesis, task, "+
-		"status_free FROM lessons WHERE lesson_id = $1", idLesson).
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, name, description, thesis, task, "+
+		"status_free, version FROM lessons WHERE lesson_id = $1", idLesson).
 		Scan(&lesson.CourseID, &lesson.SectionID, &lesson.LevelID, &lesson.Name, &lesson.Description,
-			pq.Array(&lesson.Thesis), &lesson.Task, &lesson.Status)
+			pq.Array(&lesson.Thesis), &lesson.Task, &lesson.Status, &lesson.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -546,9 +878,9 @@ func (p *Postgres) GetLesson(idLesson int) (*types.Lesson, error) {
 	return &lesson, nil
 }
 
-func (p *Postgres) UpdateCourse(course *types.Course) error {
+func (p *Postgres) UpdateCourse(ctx context.Context, course *types.Course) error {
 
-	_, err := p.db.Exec("UPDATE courses SET name = $2, cost = $3, sale = $4, total_price_for_user = $5, "+
+	_, err := p.db.ExecContext(ctx, "UPDATE courses SET name = $2, cost = $3, sale = $4, total_price_for_user = $5, "+
 		"updated_at = NOW() WHERE id = $1", course.ID, course.Name, course.Cost, course.Sale, course.TotalPrice)
 	if err != nil {
 		return errors.Wrap(err, "err with Exec")
@@ -557,13 +889,13 @@ func (p *Postgres) UpdateCourse(course *types.Course) error {
 	return nil
 }
 
-func (p *Postgres) UpdateSection(section *types.Section) error {
+func (p *Postgres) UpdateSection(ctx context.Context, section *types.Section) error {
 
-	if err := p.db.QueryRow("SELECT FROM sections WHERE id = $1", section.ID).Scan(); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT FROM sections WHERE id = $1", section.ID).Scan(); err != nil {
 		return errors.Wrap(err, "err with QueryRow")
 	}
 
-	_, err := p.db.Exec("UPDATE sections SET name = $2, updated_at=now() WHERE id = $1", section.ID, section.Name)
+	_, err := p.db.ExecContext(ctx, "UPDATE sections SET name = $2, updated_at=now() WHERE id = $1", section.ID, section.Name)
 	if err != nil {
 		return errors.Wrap(err, "err with Exec")
 	}
@@ -571,13 +903,13 @@ func (p *Postgres) UpdateSection(section *types.Section) error {
 	return nil
 }
 
-func (p *Postgres) UpdateLevel(level *types.Level) error {
+func (p *Postgres) UpdateLevel(ctx context.Context, level *types.Level) error {
 
-	if err := p.db.QueryRow("SELECT FROM levels WHERE level_id = $1", level.ID).Scan(); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT FROM levels WHERE level_id = $1", level.ID).Scan(); err != nil {
 		return errors.Wrap(err, "err with QueryRow")
 	}
 
-	_, err := p.db.Exec("UPDATE levels SET name = $2, updated_at=now() WHERE level_id = $1", level.ID, level.Name)
+	_, err := p.db.ExecContext(ctx, "UPDATE levels SET name = $2, updated_at=now() WHERE level_id = $1", level.ID, level.Name)
 	if err != nil {
 		return errors.Wrap(err, "err with Exec")
 	}
@@ -585,13 +917,13 @@ func (p *Postgres) UpdateLevel(level *types.Level) error {
 	return nil
 }
 
-func (p *Postgres) UpdateLesson(lesson *types.Lesson) error {
+func (p *Postgres) UpdateLesson(ctx context.Context, lesson *types.Lesson) error {
 
-	if err := p.db.QueryRow("SELECT FROM lessons WHERE lesson_id = $1", lesson.ID).Scan(); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT FROM lessons WHERE lesson_id = $1", lesson.ID).Scan(); err != nil {
 		return errors.Wrap(err, "err with QueryRow")
 	}
 
-	_, err := p.db.Exec("UPDATE lessons SET name = $2, description = $3, thesis = $4, task = $5, "+
+	_, err := p.db.ExecContext(ctx, "UPDATE lessons SET name = $2, description = $3, thesis = $4, task = $5, "+
 		"updated_at = now() WHERE lesson_id = $1",
 		lesson.ID, lesson.Name, lesson.Description, pq.Array(lesson.Thesis), lesson.Task)
 	if err != nil {
@@ -601,9 +933,9 @@ func (p *Postgres) UpdateLesson(lesson *types.Lesson) error {
 	return nil
 }
 
-func (p *Postgres) DeleteCourse(idCourse int) error {
+func (p *Postgres) DeleteCourse(ctx context.Context, idCourse int) error {
 
-	_, err := p.db.Exec("DELETE FROM courses WHERE id = $1", idCourse)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM courses WHERE id = $1", idCourse)
 	if err != nil {
 		return err
 	}
@@ -611,18 +943,18 @@ func (p *Postgres) DeleteCourse(idCourse int) error {
 	return nil
 }
 
-func (p *Postgres) DeleteSection(idCourse, idSection int) error {
+func (p *Postgres) DeleteSection(ctx context.Context, idCourse, idSection int) error {
 
-	_, err := p.db.Exec("DELETE FROM sections WHERE course_id = $1 AND id = $2", idCourse, idSection)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM sections WHERE course_id = $1 AND id = $2", idCourse, idSection)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
-func (p *Postgres) DeleteSectionAndTeachersBDBySectionID(idSection int) error {
+func (p *Postgres) DeleteSectionAndTeachersBDBySectionID(ctx context.Context, idSection int) error {
 
-	_, err := p.db.Exec("DELETE FROM section_and_teacher WHERE section_id = $1", idSection)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM section_and_teacher WHERE section_id = $1", idSection)
 	if err != nil {
 		return err
 	}
@@ -630,9 +962,9 @@ func (p *Postgres) DeleteSectionAndTeachersBDBySectionID(idSection int) error {
 	return nil
 }
 
-func (p *Postgres) DeleteSectionAndTeachersBDByTeacherID(idTeacher int) error {
+func (p *Postgres) DeleteSectionAndTeachersBDByTeacherID(ctx context.Context, idTeacher int) error {
 
-	_, err := p.db.Exec("DELETE FROM section_and_teacher WHERE teacher_id = $1", idTeacher)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM section_and_teacher WHERE teacher_id = $1", idTeacher)
 	if err != nil {
 		return err
 	}
@@ -640,9 +972,9 @@ func (p *Postgres) DeleteSectionAndTeachersBDByTeacherID(idTeacher int) error {
 	return nil
 }
 
-func (p *Postgres) DeleteLevel(idCourse, idSection, idLevel int) error {
+func (p *Postgres) DeleteLevel(ctx context.Context, idCourse, idSection, idLevel int) error {
 
-	_, err := p.db.Exec("DELETE FROM levels WHERE course_id = $1 AND section_id = $2 AND level_id = $3",
+	_, err := p.db.ExecContext(ctx, "DELETE FROM levels WHERE course_id = $1 AND section_id = $2 AND level_id = $3",
 		idCourse, idSection, idLevel)
 	if err != nil {
 		return err
@@ -651,9 +983,9 @@ func (p *Postgres) DeleteLevel(idCourse, idSection, idLevel int) error {
 	return nil
 }
 
-func (p *Postgres) DeleteLesson(idCourse, idSection, idLevel, idLesson int) error {
+func (p *Postgres) DeleteLesson(ctx context.Context, idCourse, idSection, idLevel, idLesson int) error {
 
-	_, err := p.db.Exec("DELETE FROM lessons WHERE "+
+	_, err := p.db.ExecContext(ctx, "DELETE FROM lessons WHERE "+
 		"course_id = $1 AND section_id = $2 AND level_id = $3 AND lesson_id =$4",
 		idCourse, idSection, idLevel, idLesson)
 	if err != nil {
@@ -663,9 +995,9 @@ func (p *Postgres) DeleteLesson(idCourse, idSection, idLevel, idLesson int) erro
 	return nil
 }
 
-func (p *Postgres) GetChatsIDByLessonID(lessonID int) ([]int, error) {
+func (p *Postgres) GetChatsIDByLessonID(ctx context.Context, lessonID int) ([]int, error) {
 	chats := make([]int, 0)
-	rows, err := p.db.Query("SELECT chat_id FROM chat WHERE lesson_id = $1", lessonID)
+	rows, err := p.db.QueryContext(ctx, "SELECT chat_id FROM chat WHERE lesson_id = $1", lessonID)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
@@ -681,9 +1013,9 @@ func (p *Postgres) GetChatsIDByLessonID(lessonID int) ([]int, error) {
 	return chats, nil
 }
 
-func (p *Postgres) DeleteChat(chatID int) error {
+func (p *Postgres) DeleteChat(ctx context.Context, chatID int) error {
 
-	_, err := p.db.Exec("DELETE FROM chat WHERE chat_id = $1", chatID)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM chat WHERE chat_id = $1", chatID)
 	if err != nil {
 		return err
 	}
@@ -691,9 +1023,9 @@ func (p *Postgres) DeleteChat(chatID int) error {
 	return nil
 }
 
-func (p *Postgres) DeleteMessageByChatID(chatID int) error {
+func (p *Postgres) DeleteMessageByChatID(ctx context.Context, chatID int) error {
 
-	_, err := p.db.Exec("DELETE FROM messages WHERE chat_id = $1", chatID)
+	_, err := p.db.ExecContext(ctx, "DELETE FROM messages WHERE chat_id = $1", chatID)
 	if err != nil {
 		return err
 	}
@@ -701,8 +1033,8 @@ func (p *Postgres) DeleteMessageByChatID(chatID int) error {
 	return nil
 }
 
-func (p *Postgres) RecordTime(rec *types.RecordTime) error {
-	_, err := p.db.Exec("INSERT INTO request_log (user_id, request_url) VALUES ($1, $2)",
+func (p *Postgres) RecordTime(ctx context.Context, rec *types.RecordTime) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO request_log (user_id, request_url) VALUES ($1, $2)",
 		rec.UserID, rec.RequestURL)
 	if err != nil {
 		return err
@@ -711,10 +1043,10 @@ func (p *Postgres) RecordTime(rec *types.RecordTime) error {
 	return nil
 }
 
-func (p *Postgres) GetChatID(chat *types.ChatData) (int, error) {
+func (p *Postgres) GetChatID(ctx context.Context, chat *types.ChatData) (int, error) {
 	var id int
 
-	err := p.db.QueryRow("SELECT chat_id FROM chat WHERE course_id = $1 AND section_id = $2 "+
+	err := p.db.QueryRowContext(ctx, "SELECT chat_id FROM chat WHERE course_id = $1 AND section_id = $2 "+
 		"AND level_id = $3 AND lesson_id = $4 AND student_id = $5",
 		chat.CourseID, chat.SectionID, chat.LevelID, chat.LessonID, chat.StudentID).Scan(&id)
 	if err != nil {
@@ -724,11 +1056,11 @@ func (p *Postgres) GetChatID(chat *types.ChatData) (int, error) {
 	return id, nil
 }
 
-func (p *Postgres) GetMessage(chatID int) ([]types.Message, error) {
+func (p *Postgres) GetMessage(ctx context.Context, chatID int) ([]types.Message, error) {
 
 	messages := []types.Message{}
 
-	rows, err := p.db.Query("SELECT message_id, text, role, time_mes, first_name FROM messages WHERE chat_id = $1 ", chatID)
+	rows, err := p.db.QueryContext(ctx, "SELECT message_id, text, role, time_mes, first_name FROM messages WHERE chat_id = $1 ", chatID)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
@@ -744,11 +1076,11 @@ func (p *Postgres) GetMessage(chatID int) ([]types.Message, error) {
 	return messages, nil
 }
 
-func (p *Postgres) MakeChat(chat *types.ChatData) (int, error) {
+func (p *Postgres) MakeChat(ctx context.Context, chat *types.ChatData) (int, error) {
 
 	var id int
 
-	err := p.db.QueryRow("INSERT INTO chat (course_id, section_id, level_id, lesson_id, student_id) "+
+	err := p.db.QueryRowContext(ctx, "INSERT INTO chat (course_id, section_id, level_id, lesson_id, student_id) "+
 		"VALUES ($1, $2, $3, $4, $5) RETURNING chat_id", chat.CourseID, chat.SectionID, chat.LevelID, chat.LessonID,
 		chat.StudentID).Scan(&id)
 	if err != nil {
@@ -758,8 +1090,8 @@ func (p *Postgres) MakeChat(chat *types.ChatData) (int, error) {
 	return id, nil
 }
 
-func (p *Postgres) SendMessageChat(chatID int, mes *types.MessageBody) error {
-	_, err := p.db.Exec("INSERT INTO messages (chat_id, text, role, first_name) VALUES ($1, $2, $3, $4)",
+func (p *Postgres) SendMessageChat(ctx context.Context, chatID int, mes *types.MessageBody) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO messages (chat_id, text, role, first_name) VALUES ($1, $2, $3, $4)",
 		chatID, mes.Text, mes.Role, mes.FirstName)
 	if err != nil {
 		return err
@@ -768,11 +1100,11 @@ func (p *Postgres) SendMessageChat(chatID int, mes *types.MessageBody) error {
 	return nil
 }
 
-func (p *Postgres) GetAllSectionsIDByTeacherID(teacherID int) ([]int, error) {
+func (p *Postgres) GetAllSectionsIDByTeacherID(ctx context.Context, teacherID int) ([]int, error) {
 
 	sectionsID := make([]int, 0)
 
-	rows, err := p.db.Query("SELECT section_id FROM section_and_teacher WHERE teacher_id = $1", teacherID)
+	rows, err := p.db.QueryContext(ctx, "SELECT section_id FROM section_and_teacher WHERE teacher_id = $1", teacherID)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
@@ -789,11 +1121,11 @@ func (p *Postgres) GetAllSectionsIDByTeacherID(teacherID int) ([]int, error) {
 	return sectionsID, nil
 }
 
-func (p *Postgres) GetChatsIDBySectionID(sectionID int) ([]int, error) {
+func (p *Postgres) GetChatsIDBySectionID(ctx context.Context, sectionID int) ([]int, error) {
 
 	chatsID := make([]int, 0)
 
-	rows, err := p.db.Query("SELECT chat_id FROM chat WHERE section_id = $1", sectionID)
+	rows, err := p.db.QueryContext(ctx, "SELECT chat_id FROM chat WHERE section_id = $1", sectionID)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
@@ -809,11 +1141,11 @@ func (p *Postgres) GetChatsIDBySectionID(sectionID int) ([]int, error) {
 	return chatsID, nil
 }
 
-func (p *Postgres) GetAllChatsIDByStudentID(studentID int) ([]int, error) {
+func (p *Postgres) GetAllChatsIDByStudentID(ctx context.Context, studentID int) ([]int, error) {
 
 	chatsID := make([]int, 0)
 
-	rows, err := p.db.Query("SELECT chat_id FROM chat WHERE student_id = $1", studentID)
+	rows, err := p.db.QueryContext(ctx, "SELECT chat_id FROM chat WHERE student_id = $1", studentID)
 	if err != nil {
 		return nil, errors.Wrap(err, "err with Query")
 	}
@@ -829,10 +1161,10 @@ func (p *Postgres) GetAllChatsIDByStudentID(studentID int) ([]int, error) {
 	return chatsID, nil
 }
 
-func (p *Postgres) GetStudentIDByChatID(chatID int) (int, error) {
+func (p *Postgres) GetStudentIDByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var studentID int
-	err := p.db.QueryRow("SELECT student_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&studentID)
+	err := p.db.QueryRowContext(ctx, "SELECT student_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&studentID)
 	if err != nil {
 		return 0, err
 	}
@@ -840,10 +1172,10 @@ func (p *Postgres) GetStudentIDByChatID(chatID int) (int, error) {
 	return studentID, nil
 }
 
-func (p *Postgres) GetUserNameByUserID(userID int) (string, error) {
+func (p *Postgres) GetUserNameByUserID(ctx context.Context, userID int) (string, error) {
 
 	var UserName string
-	err := p.db.QueryRow("SELECT first_name FROM users WHERE id = $1 ", userID).Scan(&UserName)
+	err := p.db.QueryRowContext(ctx, "SELECT first_name FROM users WHERE id = $1 ", userID).Scan(&UserName)
 	if err != nil {
 		return "", err
 	}
@@ -851,10 +1183,10 @@ func (p *Postgres) GetUserNameByUserID(userID int) (string, error) {
 	return UserName, nil
 }
 
-func (p *Postgres) GetLessonIDByChatID(chatID int) (int, error) {
+func (p *Postgres) GetLessonIDByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var lessonID int
-	err := p.db.QueryRow("SELECT lesson_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&lessonID)
+	err := p.db.QueryRowContext(ctx, "SELECT lesson_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&lessonID)
 	if err != nil {
 		return 0, err
 	}
@@ -862,10 +1194,10 @@ func (p *Postgres) GetLessonIDByChatID(chatID int) (int, error) {
 	return lessonID, nil
 }
 
-func (p *Postgres) GetLessonNameByLessonID(LessonID int) (string, error) {
+func (p *Postgres) GetLessonNameByLessonID(ctx context.Context, LessonID int) (string, error) {
 
 	var lessonName string
-	err := p.db.QueryRow("SELECT name FROM lessons WHERE lesson_id = $1 ", LessonID).Scan(&lessonName)
+	err := p.db.QueryRowContext(ctx, "SELECT name FROM lessons WHERE lesson_id = $1 ", LessonID).Scan(&lessonName)
 	if err != nil {
 		return "", err
 	}
@@ -873,10 +1205,10 @@ func (p *Postgres) GetLessonNameByLessonID(LessonID int) (string, error) {
 	return lessonName, nil
 }
 
-func (p *Postgres) GetSectionNameBySectionsID(sectionID int) (string, error) {
+func (p *Postgres) GetSectionNameBySectionsID(ctx context.Context, sectionID int) (string, error) {
 
 	var name string
-	err := p.db.QueryRow("SELECT name FROM sections WHERE id = $1 ", sectionID).Scan(&name)
+	err := p.db.QueryRowContext(ctx, "SELECT name FROM sections WHERE id = $1 ", sectionID).Scan(&name)
 	if err != nil {
 		return "", err
 	}
@@ -884,10 +1216,10 @@ func (p *Postgres) GetSectionNameBySectionsID(sectionID int) (string, error) {
 	return name, nil
 }
 
-func (p *Postgres) GetTimeByChatID(chatID int) (string, error) {
+func (p *Postgres) GetTimeByChatID(ctx context.Context, chatID int) (string, error) {
 
 	var time string
-	err := p.db.QueryRow("SELECT MAX(time_mes) FROM messages WHERE chat_id = $1 ", chatID).Scan(&time)
+	err := p.db.QueryRowContext(ctx, "SELECT MAX(time_mes) FROM messages WHERE chat_id = $1 ", chatID).Scan(&time)
 	if err != nil {
 		return "", err
 	}
@@ -895,10 +1227,10 @@ func (p *Postgres) GetTimeByChatID(chatID int) (string, error) {
 	return time, nil
 }
 
-func (p *Postgres) GetAhtungByChatID(chatID int) (bool, error) {
+func (p *Postgres) GetAhtungByChatID(ctx context.Context, chatID int) (bool, error) {
 
 	var ahtung bool
-	err := p.db.QueryRow("SELECT ahtung FROM chat WHERE chat_id = $1 ", chatID).Scan(&ahtung)
+	err := p.db.QueryRowContext(ctx, "SELECT ahtung FROM chat WHERE chat_id = $1 ", chatID).Scan(&ahtung)
 	if err != nil {
 		return false, err
 	}
@@ -906,10 +1238,10 @@ func (p *Postgres) GetAhtungByChatID(chatID int) (bool, error) {
 	return ahtung, nil
 }
 
-func (p *Postgres) GetSectionIDByChatID(chatID int) (int, error) {
+func (p *Postgres) GetSectionIDByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var sectionID int
-	err := p.db.QueryRow("SELECT section_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&sectionID)
+	err := p.db.QueryRowContext(ctx, "SELECT section_id FROM chat WHERE chat_id = $1 ", chatID).Scan(&sectionID)
 	if err != nil {
 		return 0, err
 	}
@@ -917,10 +1249,10 @@ func (p *Postgres) GetSectionIDByChatID(chatID int) (int, error) {
 	return sectionID, nil
 }
 
-func (p *Postgres) GetLastTeacherMessageByChatID(chatID int) (string, error) {
+func (p *Postgres) GetLastTeacherMessageByChatID(ctx context.Context, chatID int) (string, error) {
 
 	var lastMessage string
-	err := p.db.QueryRow("SELECT text FROM messages WHERE message_id = "+
+	err := p.db.QueryRowContext(ctx, "SELECT text FROM messages WHERE message_id = "+
 		"(SELECT MAX(message_id) FROM messages WHERE "+
 		"(SELECT MAX(message_id) FROM messages WHERE chat_id = $1) = "+
 		"(SELECT MAX(message_id) FROM messages WHERE chat_id = $1 AND role = 'teacher'))",
@@ -934,10 +1266,10 @@ func (p *Postgres) GetLastTeacherMessageByChatID(chatID int) (string, error) {
 	return lastMessage, nil
 }
 
-func (p *Postgres) GetChatDataByChatID(chatID int) (*types.ChatData, error) {
+func (p *Postgres) GetChatDataByChatID(ctx context.Context, chatID int) (*types.ChatData, error) {
 
 	chatData := types.ChatData{ChatID: chatID}
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id, lesson_id, student_id, rating FROM chat "+
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, lesson_id, student_id, rating FROM chat "+
 		"WHERE chat_id = $1", chatID).Scan(&chatData.CourseID, &chatData.SectionID, &chatData.LevelID,
 		&chatData.LessonID, &chatData.StudentID, &chatData.Rating)
 	if err != nil {
@@ -947,18 +1279,18 @@ func (p *Postgres) GetChatDataByChatID(chatID int) (*types.ChatData, error) {
 	return &chatData, nil
 }
 
-func (p *Postgres) CheckURLByC(courseID int) error {
+func (p *Postgres) CheckURLByC(ctx context.Context, courseID int) error {
 
-	err := p.db.QueryRow("SELECT id FROM courses WHERE id = $1", courseID).Scan(&courseID)
+	err := p.db.QueryRowContext(ctx, "SELECT id FROM courses WHERE id = $1", courseID).Scan(&courseID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
-func (p *Postgres) CheckURLByCS(courseID, sectionID int) error {
+func (p *Postgres) CheckURLByCS(ctx context.Context, courseID, sectionID int) error {
 
-	err := p.db.QueryRow("SELECT course_id, id FROM sections WHERE course_id = $1 AND id = $2",
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, id FROM sections WHERE course_id = $1 AND id = $2",
 		courseID, sectionID).Scan(&courseID, &sectionID)
 	if err != nil {
 		return err
@@ -966,9 +1298,9 @@ func (p *Postgres) CheckURLByCS(courseID, sectionID int) error {
 
 	return nil
 }
-func (p *Postgres) CheckURLByCSL(courseID, sectionID, levelID int) error {
+func (p *Postgres) CheckURLByCSL(ctx context.Context, courseID, sectionID, levelID int) error {
 
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id FROM levels WHERE "+
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id FROM levels WHERE "+
 		"course_id = $1 AND section_id = $2 AND level_id = $3", courseID, sectionID, levelID).
 		Scan(&courseID, &sectionID, &levelID)
 	if err != nil {
@@ -977,9 +1309,9 @@ func (p *Postgres) CheckURLByCSL(courseID, sectionID, levelID int) error {
 
 	return nil
 }
-func (p *Postgres) CheckURLByCSLL(courseID, sectionID, levelID, lessonID int) error {
+func (p *Postgres) CheckURLByCSLL(ctx context.Context, courseID, sectionID, levelID, lessonID int) error {
 
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id, lesson_id FROM lessons WHERE "+
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, lesson_id FROM lessons WHERE "+
 		"course_id = $1 AND section_id = $2 AND level_id = $3 AND lesson_id = $4",
 		courseID, sectionID, levelID, lessonID).Scan(&courseID, &sectionID, &levelID, &lessonID)
 	if err != nil {
@@ -988,9 +1320,9 @@ func (p *Postgres) CheckURLByCSLL(courseID, sectionID, levelID, lessonID int) er
 
 	return nil
 }
-func (p *Postgres) CheckURLByCSLLC(courseID, sectionID, levelID, lessonID, chatID int) error {
+func (p *Postgres) CheckURLByCSLLC(ctx context.Context, courseID, sectionID, levelID, lessonID, chatID int) error {
 
-	err := p.db.QueryRow("SELECT course_id, section_id, level_id, lesson_id, chat_id FROM chat WHERE "+
+	err := p.db.QueryRowContext(ctx, "SELECT course_id, section_id, level_id, lesson_id, chat_id FROM chat WHERE "+
 		"course_id = $1 AND section_id = $2 AND level_id = $3 AND lesson_id = $4 AND chat_id = $5",
 		courseID, sectionID, levelID, lessonID, chatID).Scan(&courseID, &sectionID, &levelID, &lessonID, &chatID)
 	if err != nil {
@@ -1000,9 +1332,9 @@ func (p *Postgres) CheckURLByCSLLC(courseID, sectionID, levelID, lessonID, chatI
 	return nil
 }
 
-func (p *Postgres) ChangeAhtung(ch *types.Ahtung) error {
+func (p *Postgres) ChangeAhtung(ctx context.Context, ch *types.Ahtung) error {
 
-	_, err := p.db.Exec("UPDATE chat SET ahtung_teacher = $1, ahtung = $2 WHERE chat_id = $3",
+	_, err := p.db.ExecContext(ctx, "UPDATE chat SET ahtung_teacher = $1, ahtung = $2 WHERE chat_id = $3",
 		ch.TeacherID, ch.Ahtung, ch.ChatID)
 	if err != nil {
 		return err
@@ -1011,9 +1343,9 @@ func (p *Postgres) ChangeAhtung(ch *types.Ahtung) error {
 	return nil
 }
 
-func (p *Postgres) IncrementAhtung(teacherID int) error {
+func (p *Postgres) IncrementAhtung(ctx context.Context, teacherID int) error {
 
-	_, err := p.db.Exec("UPDATE teacher_info SET ahtung = ahtung + 1 WHERE id = $1", teacherID)
+	_, err := p.db.ExecContext(ctx, "UPDATE teacher_info SET ahtung = ahtung + 1 WHERE id = $1", teacherID)
 	if err != nil {
 		return err
 	}
@@ -1021,9 +1353,9 @@ func (p *Postgres) IncrementAhtung(teacherID int) error {
 	return nil
 }
 
-func (p *Postgres) IncrementGood(teacherID int) error {
+func (p *Postgres) IncrementGood(ctx context.Context, teacherID int) error {
 
-	_, err := p.db.Exec("UPDATE teacher_info SET good = good + 1 WHERE id = $1", teacherID)
+	_, err := p.db.ExecContext(ctx, "UPDATE teacher_info SET good = good + 1 WHERE id = $1", teacherID)
 	if err != nil {
 		return err
 	}
@@ -1031,9 +1363,9 @@ func (p *Postgres) IncrementGood(teacherID int) error {
 	return nil
 }
 
-func (p *Postgres) IncrementImprove(teacherID int) error {
+func (p *Postgres) IncrementImprove(ctx context.Context, teacherID int) error {
 
-	_, err := p.db.Exec("UPDATE teacher_info SET improve = improve + 1 WHERE id = $1", teacherID)
+	_, err := p.db.ExecContext(ctx, "UPDATE teacher_info SET improve = improve + 1 WHERE id = $1", teacherID)
 	if err != nil {
 		return err
 	}
@@ -1042,9 +1374,9 @@ func (p *Postgres) IncrementImprove(teacherID int) error {
 }
 
 // Надо получить айди курса
-func (p *Postgres) IncrementHomeWork(courseID int) error {
+func (p *Postgres) IncrementHomeWork(ctx context.Context, courseID int) error {
 
-	_, err := p.db.Exec("UPDATE courses SET dz = dz + 1 WHERE id = $1", courseID)
+	_, err := p.db.ExecContext(ctx, "UPDATE courses SET dz = dz + 1 WHERE id = $1", courseID)
 	if err != nil {
 		return err
 	}
@@ -1052,9 +1384,9 @@ func (p *Postgres) IncrementHomeWork(courseID int) error {
 	return nil
 }
 
-func (p *Postgres) ChangeRating(ch *types.Rating) error {
+func (p *Postgres) ChangeRating(ctx context.Context, ch *types.Rating) error {
 
-	_, err := p.db.Exec("UPDATE chat SET rating_teacher = $1, rating = $2 WHERE chat_id = $3",
+	_, err := p.db.ExecContext(ctx, "UPDATE chat SET rating_teacher = $1, rating = $2 WHERE chat_id = $3",
 		ch.TeacherID, ch.Rating, ch.ChatID)
 	if err != nil {
 		return err
@@ -1063,10 +1395,10 @@ func (p *Postgres) ChangeRating(ch *types.Rating) error {
 	return nil
 }
 
-func (p *Postgres) GetRatingByChatID(chatID int) (string, error) {
+func (p *Postgres) GetRatingByChatID(ctx context.Context, chatID int) (string, error) {
 
 	var rating string
-	if err := p.db.QueryRow("SELECT rating FROM chat WHERE chat_id = $1", chatID).Scan(&rating); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT rating FROM chat WHERE chat_id = $1", chatID).Scan(&rating); err != nil {
 		if err == sql.ErrNoRows {
 			return "", err
 		}
@@ -1076,10 +1408,10 @@ func (p *Postgres) GetRatingByChatID(chatID int) (string, error) {
 	return rating, nil
 }
 
-func (p *Postgres) GetLastMessageByChatID(chatID int) (string, error) {
+func (p *Postgres) GetLastMessageByChatID(ctx context.Context, chatID int) (string, error) {
 
 	var lastMessage string
-	err := p.db.QueryRow("SELECT text FROM messages WHERE message_id = "+
+	err := p.db.QueryRowContext(ctx, "SELECT text FROM messages WHERE message_id = "+
 		"(SELECT MAX(message_id) FROM messages WHERE chat_id = $1)", chatID).Scan(&lastMessage)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -1090,9 +1422,9 @@ func (p *Postgres) GetLastMessageByChatID(chatID int) (string, error) {
 	return lastMessage, nil
 }
 
-func (p *Postgres) OffsetTeacherMessages(chatID int) error {
+func (p *Postgres) OffsetTeacherMessages(ctx context.Context, chatID int) error {
 
-	_, err := p.db.Exec("UPDATE messages SET not_read = false WHERE chat_id = $1 AND role = 'teacher'", chatID)
+	_, err := p.db.ExecContext(ctx, "UPDATE messages SET not_read = false WHERE chat_id = $1 AND role = 'teacher'", chatID)
 	if err != nil {
 		return err
 	}
@@ -1100,11 +1432,11 @@ func (p *Postgres) OffsetTeacherMessages(chatID int) error {
 	return nil
 }
 
-func (p *Postgres) GetNotViewMessageForStudentByChatID(chatID int) (int, error) {
+func (p *Postgres) GetNotViewMessageForStudentByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var notViewMes int
 
-	err := p.db.QueryRow("SELECT COUNT (role) FROM messages WHERE role = 'teacher' AND not_read = true "+
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT (role) FROM messages WHERE role = 'teacher' AND not_read = true "+
 		"AND chat_id = $1", chatID).Scan(&notViewMes)
 	if err != nil {
 		return 0, err
@@ -1113,9 +1445,9 @@ func (p *Postgres) GetNotViewMessageForStudentByChatID(chatID int) (int, error)
 	return notViewMes, err
 }
 
-func (p *Postgres) OffsetStudentMessages(chatID int) error {
+func (p *Postgres) OffsetStudentMessages(ctx context.Context, chatID int) error {
 
-	_, err := p.db.Exec("UPDATE messages SET not_read = false WHERE chat_id = $1 AND role = 'student'", chatID)
+	_, err := p.db.ExecContext(ctx, "UPDATE messages SET not_read = false WHERE chat_id = $1 AND role = 'student'", chatID)
 	if err != nil {
 		return err
 	}
@@ -1123,11 +1455,11 @@ func (p *Postgres) OffsetStudentMessages(chatID int) error {
 	return nil
 }
 
-func (p *Postgres) GetNotViewMessageForTeacherByChatID(chatID int) (int, error) {
+func (p *Postgres) GetNotViewMessageForTeacherByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var notViewMes int
 
-	err := p.db.QueryRow("SELECT COUNT (role) FROM messages WHERE role = 'student' AND not_read = true "+
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT (role) FROM messages WHERE role = 'student' AND not_read = true "+
 		"AND chat_id = $1", chatID).Scan(&notViewMes)
 	if err != nil {
 		return 0, err
@@ -1136,48 +1468,51 @@ func (p *Postgres) GetNotViewMessageForTeacherByChatID(chatID int) (int, error)
 	return notViewMes, err
 }
 
-func (p *Postgres) GetCourseIDByChatID(chatID int) (int, error) {
+func (p *Postgres) GetCourseIDByChatID(ctx context.Context, chatID int) (int, error) {
 
 	var courseID int
-	if err := p.db.QueryRow("SELECT course_id FROM chat WHERE chat_id = $1", chatID).Scan(&courseID); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT course_id FROM chat WHERE chat_id = $1", chatID).Scan(&courseID); err != nil {
 		return 0, err
 	}
 
 	return courseID, nil
 }
 
-func (p *Postgres) LastSession(userID int) (string, error) {
+func (p *Postgres) LastSession(ctx context.Context, userID int) (string, error) {
 
 	var date string
-	if err := p.db.QueryRow("SELECT MAX(created_at) FROM request_log WHERE user_id = $1", userID).Scan(&date); err != nil {
+	if err := p.db.QueryRowContext(ctx, "SELECT MAX(created_at) FROM request_log WHERE user_id = $1", userID).Scan(&date); err != nil {
 		return "", err
 	}
 
 	return date, nil
 }
 
-func (p *Postgres) AddTime(seconds, userID int) error {
+func (p *Postgres) AddTime(ctx context.Context, seconds, userID int) error {
 
-	if _, err := p.db.Exec("UPDATE users SET times_seconds = times_seconds + $1 WHERE id = $2", seconds, userID); err != nil {
+	if _, err := p.db.ExecContext(ctx, "UPDATE users SET times_seconds = times_seconds + $1 WHERE id = $2", seconds, userID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (p *Postgres) CheckUserInDBUsers(userID int) error {
+func (p *Postgres) GetUserAccess(ctx context.Context, userID int) (*types.UserAccess, error) {
 
-	if err := p.db.QueryRow("SELECT FROM users WHERE id = $1", userID).Scan(); err != nil {
-		return err
+	access := types.UserAccess{}
+	if err := p.db.QueryRowContext(ctx, "SELECT user_role, token_version, suspended_at IS NOT NULL, suspend_reason "+
+		"FROM users WHERE id = $1", userID).
+		Scan(&access.Role, &access.TokenVersion, &access.Suspended, &access.SuspendReason); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &access, nil
 }
 
-func (p *Postgres) FindLastStudentMessageNotAnswer(chatID int) (string, error) {
+func (p *Postgres) FindLastStudentMessageNotAnswer(ctx context.Context, chatID int) (string, error) {
 
 	var time string
-	if err := p.db.QueryRow("SELECT time_mes FROM messages WHERE chat_id = $1 AND "+
+	if err := p.db.QueryRowContext(ctx, "SELECT time_mes FROM messages WHERE chat_id = $1 AND "+
 		"message_id = (SELECT MAX(message_id) FROM messages "+
 		"WHERE "+
 		"("+
@@ -1191,9 +1526,9 @@ func (p *Postgres) FindLastStudentMessageNotAnswer(chatID int) (string, error) {
 	return time, nil
 }
 
-func (p *Postgres) AddTimeAnswer(teacherID, seconds int) error {
+func (p *Postgres) AddTimeAnswer(ctx context.Context, teacherID, seconds int) error {
 
-	if _, err := p.db.Exec("UPDATE teacher_info SET answer_time_sec = answer_time_sec + $1, "+
+	if _, err := p.db.ExecContext(ctx, "UPDATE teacher_info SET answer_time_sec = answer_time_sec + $1, "+
 		"answer_count = answer_count + 1 WHERE id = $2", seconds, teacherID); err != nil {
 		return err
 	}
@@ -1201,13 +1536,1521 @@ func (p *Postgres) AddTimeAnswer(teacherID, seconds int) error {
 	return nil
 }
 
-func (p *Postgres) GetAverageTimeByTeacherID(teacherID int) (*types.AverageTime, error) {
+func (p *Postgres) GetAverageTimeByTeacherID(ctx context.Context, teacherID int) (*types.AverageTime, error) {
 
 	averageTime := &types.AverageTime{}
-	if err := p.db.QueryRow("SELECT answer_time_sec, answer_count FROM teacher_info WHERE id = $1", teacherID).
+	if err := p.db.QueryRowContext(ctx, "SELECT answer_time_sec, answer_count FROM teacher_info WHERE id = $1", teacherID).
 		Scan(&averageTime.TotalTimeForAnswer, &averageTime.CountAnswer); err != nil {
 		return nil, err
 	}
 
 	return averageTime, nil
 }
+
+// siteTimeInPeriod - секунды на сайте за период $1..$2 по request_log: промежутки между запросами короче
+// 30 минут, как считает RecordTime
+const siteTimeInPeriod = "site_time AS (SELECT user_id, SUM(gap)::bigint AS seconds FROM (" +
+	"SELECT user_id, EXTRACT(EPOCH FROM created_at - LAG(created_at) OVER (PARTITION BY user_id ORDER BY created_at)) AS gap " +
+	"FROM request_log WHERE user_id > 0 AND created_at >= $1 AND created_at < $2) gaps " +
+	"WHERE gap < 1800 GROUP BY user_id) "
+
+// roleHasPermission - пользователи, чья роль дает право $3. Отчеты отбирают учеников и учителей по правам
+// chats.ask и chats.answer, а не по имени роли, чтобы попадали и пользователи ролей, созданных админом
+const roleHasPermission = "users.user_role IN (SELECT role FROM role_permissions WHERE permission = $3)"
+
+// ExportCoursesInfo выгружает курсы, по которым ученики писали в чаты за период: ученики и сданные дз - за период,
+// цена со скидкой - total_price_for_user, который пишут создание и редактирование курса
+func (p *Postgres) ExportCoursesInfo(ctx context.Context, period *types.ReportPeriod, fn func(*types.CourseInfoForAdmin) error) error {
+
+	rows, err := p.db.QueryContext(ctx, "SELECT courses.id, courses.name, courses.cost, "+
+		"COUNT(DISTINCT chat.student_id), COUNT(DISTINCT chat.chat_id), courses.sale, courses.total_price_for_user "+
+		"FROM courses "+
+		"JOIN chat ON chat.course_id = courses.id "+
+		"JOIN messages ON messages.chat_id = chat.chat_id AND messages.role = 'student' "+
+		"AND messages.time_mes >= $1 AND messages.time_mes < $2 "+
+		"GROUP BY courses.id ORDER BY courses.id", period.From, period.To)
+	if err != nil {
+		return errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	course := types.CourseInfoForAdmin{}
+	for rows.Next() {
+		if err = rows.Scan(&course.ID, &course.Name, &course.Cost, &course.Users, &course.Dz,
+			&course.Sale, &course.Total); err != nil {
+			return errors.Wrap(err, "err with Scan")
+		}
+		if err = fn(&course); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportTeachersInfo выгружает учителей, активных за период: оценки, время на сайте и время ответа - за период
+func (p *Postgres) ExportTeachersInfo(ctx context.Context, period *types.ReportPeriod, fn func(*types.TeacherFullInfo) error) error {
+
+	rows, err := p.db.QueryContext(ctx, "WITH events AS (SELECT teacher_id, "+
+		"COUNT(*) FILTER (WHERE event = 'good') AS good, "+
+		"COUNT(*) FILTER (WHERE event = 'improve') AS improve, "+
+		"COUNT(*) FILTER (WHERE event = 'ahtung') AS ahtung, "+
+		"AVG(value) FILTER (WHERE event = 'answer') AS average "+
+		"FROM teacher_events WHERE created_at >= $1 AND created_at < $2 GROUP BY teacher_id), "+
+		siteTimeInPeriod+
+		"SELECT users.id, users.first_name, COALESCE(events.good, 0), COALESCE(events.improve, 0), "+
+		"COALESCE(events.ahtung, 0), COALESCE(site_time.seconds, 0), COALESCE(events.average, 0)::bigint "+
+		"FROM users JOIN teacher_info ON teacher_info.id = users.id "+
+		"LEFT JOIN events ON events.teacher_id = users.id "+
+		"LEFT JOIN site_time ON site_time.user_id = users.id "+
+		"WHERE events.teacher_id IS NOT NULL OR site_time.user_id IS NOT NULL ORDER BY users.id",
+		period.From, period.To)
+	if err != nil {
+		return errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	teacher := types.TeacherFullInfo{}
+	for rows.Next() {
+		if err = rows.Scan(&teacher.ID, &teacher.FirstName, &teacher.Good, &teacher.Improve, &teacher.Ahtung,
+			&teacher.Times, &teacher.AverageTime); err != nil {
+			return errors.Wrap(err, "err with Scan")
+		}
+		if err = fn(&teacher); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportStudents выгружает учеников, заходивших на сайт или писавших в чаты за период, с временем на сайте за период
+func (p *Postgres) ExportStudents(ctx context.Context, period *types.ReportPeriod, fn func(*types.StudentReport) error) error {
+
+	rows, err := p.db.QueryContext(ctx, "WITH "+siteTimeInPeriod+
+		"SELECT users.id, users.email, users.first_name, COALESCE(users.created_at, users.updated_at), "+
+		"COALESCE(site_time.seconds, 0) "+
+		"FROM users LEFT JOIN site_time ON site_time.user_id = users.id "+
+		"WHERE "+roleHasPermission+" AND (EXISTS (SELECT 1 FROM request_log WHERE request_log.user_id = users.id "+
+		"AND request_log.created_at >= $1 AND request_log.created_at < $2) "+
+		"OR EXISTS (SELECT 1 FROM chat JOIN messages ON messages.chat_id = chat.chat_id "+
+		"WHERE chat.student_id = users.id AND messages.role = 'student' "+
+		"AND messages.time_mes >= $1 AND messages.time_mes < $2)) ORDER BY users.id", period.From, period.To,
+		types.PermChatsAsk)
+	if err != nil {
+		return errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	student := types.StudentReport{}
+	for rows.Next() {
+		if err = rows.Scan(&student.ID, &student.Email, &student.FirstName, &student.CreatedAT,
+			&student.Times); err != nil {
+			return errors.Wrap(err, "err with Scan")
+		}
+		if err = fn(&student); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportTeacherChatStats считает по каждому учителю чаты и сообщения его разделов за период
+func (p *Postgres) ExportTeacherChatStats(ctx context.Context, period *types.ReportPeriod, fn func(*types.TeacherChatStat) error) error {
+
+	rows, err := p.db.QueryContext(ctx, "SELECT users.id, users.first_name, COUNT(DISTINCT messages.chat_id), "+
+		"COUNT(messages.message_id) FILTER (WHERE messages.role = 'student'), "+
+		"COUNT(messages.message_id) FILTER (WHERE messages.role = 'teacher') "+
+		"FROM users "+
+		"LEFT JOIN section_and_teacher ON section_and_teacher.teacher_id = users.id "+
+		"LEFT JOIN chat ON chat.section_id = section_and_teacher.section_id "+
+		"LEFT JOIN messages ON messages.chat_id = chat.chat_id "+
+		"AND messages.time_mes >= $1 AND messages.time_mes < $2 "+
+		"WHERE "+roleHasPermission+" GROUP BY users.id, users.first_name ORDER BY users.id",
+		period.From, period.To, types.PermChatsAnswer)
+	if err != nil {
+		return errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	stat := types.TeacherChatStat{}
+	for rows.Next() {
+		if err = rows.Scan(&stat.TeacherID, &stat.FirstName, &stat.Chats, &stat.StudentMessages,
+			&stat.TeacherMessages); err != nil {
+			return errors.Wrap(err, "err with Scan")
+		}
+		if err = fn(&stat); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (p *Postgres) AddTeacherEvent(ctx context.Context, ev *types.TeacherEvent) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO teacher_events (teacher_id, chat_id, event, value) VALUES ($1, $2, $3, $4)",
+		ev.TeacherID, ev.ChatID, ev.Event, ev.Value)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const teacherEventsAggregate = "COUNT(*) FILTER (WHERE event = 'good'), " +
+	"COUNT(*) FILTER (WHERE event = 'improve'), " +
+	"COUNT(*) FILTER (WHERE event = 'ahtung'), " +
+	"COUNT(*) FILTER (WHERE event = 'answer'), " +
+	"COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY value) FILTER (WHERE event = 'answer'), 0)::bigint, " +
+	"COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY value) FILTER (WHERE event = 'answer'), 0)::bigint "
+
+func (p *Postgres) GetTeacherEventsTotal(ctx context.Context, teacherID int, period *types.ReportPeriod) (*types.TeacherAnalyticsBucket, error) {
+
+	bucket := types.TeacherAnalyticsBucket{}
+	err := p.db.QueryRowContext(ctx, "SELECT "+teacherEventsAggregate+"FROM teacher_events "+
+		"WHERE teacher_id = $1 AND created_at >= $2 AND created_at < $3", teacherID, period.From, period.To).
+		Scan(&bucket.Good, &bucket.Improve, &bucket.Ahtung, &bucket.Answers, &bucket.AnswerTimeP50,
+			&bucket.AnswerTimeP90)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bucket, nil
+}
+
+// GetTeacherEventsByPeriod группирует события учителя по дням или неделям, unit - day или week
+func (p *Postgres) GetTeacherEventsByPeriod(ctx context.Context, teacherID int, period *types.ReportPeriod,
+	unit string) ([]types.TeacherAnalyticsBucket, error) {
+
+	buckets := make([]types.TeacherAnalyticsBucket, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT date_trunc($4, created_at) AS start, "+teacherEventsAggregate+
+		"FROM teacher_events WHERE teacher_id = $1 AND created_at >= $2 AND created_at < $3 "+
+		"GROUP BY start ORDER BY start", teacherID, period.From, period.To, unit)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	bucket := types.TeacherAnalyticsBucket{}
+	for rows.Next() {
+		if err = rows.Scan(&bucket.Start, &bucket.Good, &bucket.Improve, &bucket.Ahtung, &bucket.Answers,
+			&bucket.AnswerTimeP50, &bucket.AnswerTimeP90); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// CountUnansweredChatsByTeacherID считает чаты разделов учителя, где последнее сообщение
+// от ученика и отправлено в указанный период
+func (p *Postgres) CountUnansweredChatsByTeacherID(ctx context.Context, teacherID int, period *types.ReportPeriod) (int, error) {
+
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(DISTINCT chat.chat_id) FROM chat "+
+		"JOIN section_and_teacher ON section_and_teacher.section_id = chat.section_id "+
+		"AND section_and_teacher.teacher_id = $1 "+
+		"JOIN LATERAL (SELECT role, time_mes FROM messages WHERE messages.chat_id = chat.chat_id "+
+		"ORDER BY message_id DESC LIMIT 1) last ON true "+
+		"WHERE last.role = 'student' AND last.time_mes >= $2 AND last.time_mes < $3",
+		teacherID, period.From, period.To).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetAllTeachersAnalytics - итоги за период по всем учителям одним запросом: события и неотвеченные чаты
+func (p *Postgres) GetAllTeachersAnalytics(ctx context.Context, period *types.ReportPeriod) ([]types.TeacherAnalytics, error) {
+
+	analytics := make([]types.TeacherAnalytics, 0)
+	rows, err := p.db.QueryContext(ctx, "WITH events (teacher_id, good, improve, ahtung, answers, p50, p90) AS "+
+		"(SELECT teacher_id, "+teacherEventsAggregate+"FROM teacher_events "+
+		"WHERE created_at >= $1 AND created_at < $2 GROUP BY teacher_id), "+
+		"unanswered AS (SELECT section_and_teacher.teacher_id, COUNT(DISTINCT chat.chat_id) AS chats FROM chat "+
+		"JOIN section_and_teacher ON section_and_teacher.section_id = chat.section_id "+
+		"JOIN LATERAL (SELECT role, time_mes FROM messages WHERE messages.chat_id = chat.chat_id "+
+		"ORDER BY message_id DESC LIMIT 1) last ON true "+
+		"WHERE last.role = 'student' AND last.time_mes >= $1 AND last.time_mes < $2 "+
+		"GROUP BY section_and_teacher.teacher_id) "+
+		"SELECT users.id, users.first_name, COALESCE(unanswered.chats, 0), COALESCE(events.good, 0), "+
+		"COALESCE(events.improve, 0), COALESCE(events.ahtung, 0), COALESCE(events.answers, 0), "+
+		"COALESCE(events.p50, 0), COALESCE(events.p90, 0) "+
+		"FROM users LEFT JOIN events ON events.teacher_id = users.id "+
+		"LEFT JOIN unanswered ON unanswered.teacher_id = users.id "+
+		"WHERE "+roleHasPermission+" ORDER BY users.id", period.From, period.To, types.PermChatsAnswer)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		teacher := types.TeacherAnalytics{}
+		if err = rows.Scan(&teacher.TeacherID, &teacher.FirstName, &teacher.Unanswered, &teacher.Total.Good,
+			&teacher.Total.Improve, &teacher.Total.Ahtung, &teacher.Total.Answers, &teacher.Total.AnswerTimeP50,
+			&teacher.Total.AnswerTimeP90); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		analytics = append(analytics, teacher)
+	}
+
+	return analytics, rows.Err()
+}
+
+// CountChatsWaitingAnswer считает чаты, где последнее сообщение от ученика
+func (p *Postgres) CountChatsWaitingAnswer(ctx context.Context) (int, error) {
+
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chat "+
+		"JOIN LATERAL (SELECT role FROM messages WHERE messages.chat_id = chat.chat_id "+
+		"ORDER BY message_id DESC LIMIT 1) last ON last.role = 'student'").Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetChatsWaitingAnswer ищет чаты, где последнее сообщение от ученика, и возвращает время
+// первого неотвеченного сообщения, если оно отправлено раньше before
+func (p *Postgres) GetChatsWaitingAnswer(ctx context.Context, before time.Time) ([]types.OverdueChat, error) {
+
+	chats := make([]types.OverdueChat, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT chat.chat_id, chat.course_id, chat.section_id, chat.lesson_id, "+
+		"chat.student_id, first.message_id, first.time_mes, chat_sla.reminded_at, chat_sla.escalated_at "+
+		"FROM chat "+
+		"JOIN LATERAL (SELECT role FROM messages WHERE messages.chat_id = chat.chat_id "+
+		"ORDER BY message_id DESC LIMIT 1) last ON last.role = 'student' "+
+		"JOIN LATERAL (SELECT message_id, time_mes FROM messages WHERE messages.chat_id = chat.chat_id "+
+		"AND role = 'student' AND message_id > COALESCE((SELECT MAX(message_id) FROM messages "+
+		"WHERE messages.chat_id = chat.chat_id AND role = 'teacher'), 0) "+
+		"ORDER BY message_id LIMIT 1) first ON true "+
+		"LEFT JOIN chat_sla ON chat_sla.chat_id = chat.chat_id AND chat_sla.message_id = first.message_id "+
+		"WHERE first.time_mes < $1 ORDER BY first.time_mes", before)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		chat := types.OverdueChat{}
+		if err = rows.Scan(&chat.ChatID, &chat.CourseID, &chat.SectionID, &chat.LessonID, &chat.StudentID,
+			&chat.MessageID, &chat.WaitingSince, &chat.RemindedAt, &chat.EscalatedAt); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		chats = append(chats, chat)
+	}
+
+	return chats, rows.Err()
+}
+
+func (p *Postgres) MarkSLAReminded(ctx context.Context, chatID, messageID int) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO chat_sla (chat_id, message_id, reminded_at) VALUES ($1, $2, NOW()) "+
+		"ON CONFLICT (chat_id, message_id) DO UPDATE SET reminded_at = NOW()", chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) MarkSLAEscalated(ctx context.Context, chatID, messageID int) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO chat_sla (chat_id, message_id, escalated_at) VALUES ($1, $2, NOW()) "+
+		"ON CONFLICT (chat_id, message_id) DO UPDATE SET escalated_at = NOW()", chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetTeachersBySectionID(ctx context.Context, sectionID int) ([]types.User, error) {
+
+	teachers := make([]types.User, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT users.id, users.email, users.first_name FROM users, section_and_teacher "+
+		"WHERE users.id = section_and_teacher.teacher_id AND section_and_teacher.section_id = $1", sectionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	teacher := types.User{UserRole: types.RoleTeacher}
+	for rows.Next() {
+		if err = rows.Scan(&teacher.ID, &teacher.Email, &teacher.FirstName); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		teachers = append(teachers, teacher)
+	}
+
+	return teachers, rows.Err()
+}
+
+// GetTeachersBySectionIDs - учителя нескольких разделов одним запросом, ключ - id раздела
+func (p *Postgres) GetTeachersBySectionIDs(ctx context.Context, sectionIDs []int) (map[int][]types.User, error) {
+
+	teachers := make(map[int][]types.User)
+	rows, err := p.db.QueryContext(ctx, "SELECT section_and_teacher.section_id, users.id, users.email, users.first_name "+
+		"FROM users, section_and_teacher WHERE users.id = section_and_teacher.teacher_id "+
+		"AND section_and_teacher.section_id = ANY($1)", pq.Array(sectionIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sectionID := 0
+		teacher := types.User{UserRole: types.RoleTeacher}
+		if err = rows.Scan(&sectionID, &teacher.ID, &teacher.Email, &teacher.FirstName); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		teachers[sectionID] = append(teachers[sectionID], teacher)
+	}
+
+	return teachers, rows.Err()
+}
+
+func (p *Postgres) GetNotificationSettings(ctx context.Context, userID int) (*types.NotificationSettings, error) {
+
+	settings := types.NotificationSettings{}
+	err := p.db.QueryRowContext(ctx, "SELECT email, telegram, telegram_chat_id, in_app FROM notification_settings "+
+		"WHERE user_id = $1", userID).Scan(&settings.Email, &settings.Telegram, &settings.TelegramChatID,
+		&settings.InApp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// UpdateNotificationSettings меняет каналы, чат телеграма меняется только через SetTelegramChat
+func (p *Postgres) UpdateNotificationSettings(ctx context.Context, userID int, settings *types.NotificationSettings) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO notification_settings (user_id, email, telegram, in_app) "+
+		"VALUES ($1, $2, $3, $4) ON CONFLICT (user_id) DO UPDATE SET email = $2, telegram = $3, "+
+		"in_app = $4, updated_at = NOW()",
+		userID, settings.Email, settings.Telegram, settings.InApp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetTelegramChat подключает чат, который подтвердил владение кодом из ссылки, и включает канал telegram
+func (p *Postgres) SetTelegramChat(ctx context.Context, userID int, chatID string) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO notification_settings (user_id, telegram, telegram_chat_id) "+
+		"VALUES ($1, true, $2) ON CONFLICT (user_id) DO UPDATE SET telegram = true, telegram_chat_id = $2, "+
+		"updated_at = NOW()", userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddTelegramLinkCode(ctx context.Context, codeHash string, userID int) error {
+
+	if _, err := p.db.ExecContext(ctx, "INSERT INTO telegram_link_codes (code_hash, user_id) VALUES ($1, $2)",
+		codeHash, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TakeTelegramLinkCode достает код и сразу удаляет его, второй раз тот же код не пройдет
+func (p *Postgres) TakeTelegramLinkCode(ctx context.Context, codeHash string) (int, time.Time, error) {
+
+	var userID int
+	var createdAt time.Time
+	if err := p.db.QueryRowContext(ctx, "DELETE FROM telegram_link_codes WHERE code_hash = $1 RETURNING user_id, created_at",
+		codeHash).Scan(&userID, &createdAt); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return userID, createdAt, nil
+}
+
+func (p *Postgres) DeleteTelegramLinkCodesBefore(ctx context.Context, before time.Time) error {
+
+	if _, err := p.db.ExecContext(ctx, "DELETE FROM telegram_link_codes WHERE created_at < $1", before); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddNotification(ctx context.Context, userID int, n *types.Notification) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO notifications (user_id, kind, title, body) VALUES ($1, $2, $3, $4)",
+		userID, n.Kind, n.Title, n.Body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetNotifications(ctx context.Context, userID int, unreadOnly bool, limit, offset int) ([]types.Notification, error) {
+
+	notifications := make([]types.Notification, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT id, kind, title, body, read_at IS NOT NULL, created_at FROM notifications "+
+		"WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL) ORDER BY id DESC LIMIT $3 OFFSET $4",
+		userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	n := types.Notification{}
+	for rows.Next() {
+		if err = rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &n.Read, &n.CreatedAT); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		notifications = append(notifications, n)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "err with rows")
+	}
+
+	return notifications, nil
+}
+
+func (p *Postgres) CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID).
+		Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (p *Postgres) MarkNotificationRead(ctx context.Context, userID, notificationID int) error {
+
+	var id int
+	err := p.db.QueryRowContext(ctx, "UPDATE notifications SET read_at = COALESCE(read_at, NOW()) "+
+		"WHERE user_id = $1 AND id = $2 RETURNING id", userID, notificationID).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) MarkAllNotificationsRead(ctx context.Context, userID int) error {
+
+	_, err := p.db.ExecContext(ctx, "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddOutboxMessage(ctx context.Context, m *types.OutboxMessage) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO notification_outbox (user_id, channel, address, title, body) "+
+		"VALUES ($1, $2, $3, $4, $5)", m.UserID, m.Channel, m.Address, m.Title, m.Body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimOutboxMessages забирает готовые к отправке сообщения и откладывает их на lockFor,
+// чтобы при падении отправителя они ушли повторно, а параллельный воркер их не взял
+func (p *Postgres) ClaimOutboxMessages(ctx context.Context, maxAttempts, limit int, lockFor time.Duration) ([]types.OutboxMessage, error) {
+
+	messages := make([]types.OutboxMessage, 0)
+	rows, err := p.db.QueryContext(ctx, "UPDATE notification_outbox SET next_attempt_at = $3 WHERE id IN "+
+		"(SELECT id FROM notification_outbox WHERE sent_at IS NULL AND attempts < $1 AND next_attempt_at <= NOW() "+
+		"ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING id, user_id, channel, address, title, body, attempts",
+		maxAttempts, limit, time.Now().Add(lockFor))
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	m := types.OutboxMessage{}
+	for rows.Next() {
+		if err = rows.Scan(&m.ID, &m.UserID, &m.Channel, &m.Address, &m.Title, &m.Body, &m.Attempts); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func (p *Postgres) MarkOutboxSent(ctx context.Context, id int) error {
+
+	_, err := p.db.ExecContext(ctx, "UPDATE notification_outbox SET sent_at = NOW(), attempts = attempts + 1 WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) MarkOutboxFailed(ctx context.Context, id int, lastErr string, retryAt time.Time) error {
+
+	_, err := p.db.ExecContext(ctx, "UPDATE notification_outbox SET attempts = attempts + 1, last_error = $2, "+
+		"next_attempt_at = $3 WHERE id = $1", id, lastErr, retryAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetEmailVerifiedAt(ctx context.Context, userID int) (*time.Time, error) {
+
+	var verifiedAt *time.Time
+	if err := p.db.QueryRowContext(ctx, "SELECT email_verified_at FROM users WHERE id = $1", userID).
+		Scan(&verifiedAt); err != nil {
+		return nil, err
+	}
+
+	return verifiedAt, nil
+}
+
+func (p *Postgres) SetEmailVerified(ctx context.Context, userID int, email string) error {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) "+
+		"WHERE id = $1 AND email = $2", userID, email)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "err with RowsAffected")
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddEmailVerificationSend(ctx context.Context, userID int) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO email_verification_sends (user_id) VALUES ($1)", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetEmailVerificationSends возвращает число отправок с since и время последней отправки
+func (p *Postgres) GetEmailVerificationSends(ctx context.Context, userID int, since time.Time) (int, *time.Time, error) {
+
+	var count int
+	var last *time.Time
+	if err := p.db.QueryRowContext(ctx, "SELECT COUNT(*), MAX(sent_at) FROM email_verification_sends "+
+		"WHERE user_id = $1 AND sent_at >= $2", userID, since).Scan(&count, &last); err != nil {
+		return 0, nil, err
+	}
+
+	return count, last, nil
+}
+
+func (p *Postgres) AddOAuthState(ctx context.Context, state *types.OAuthState) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO oauth_states (state, provider, code_verifier, nonce_hash, user_id) "+
+		"VALUES ($1, $2, $3, $4, $5)", state.State, state.Provider, state.CodeVerifier, state.NonceHash, state.UserID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TakeOAuthState достает state и сразу удаляет его, второй раз тот же state не пройдет
+func (p *Postgres) TakeOAuthState(ctx context.Context, state string) (*types.OAuthState, error) {
+
+	s := types.OAuthState{State: state}
+	err := p.db.QueryRowContext(ctx, "DELETE FROM oauth_states WHERE state = $1 "+
+		"RETURNING provider, code_verifier, nonce_hash, user_id, created_at", state).
+		Scan(&s.Provider, &s.CodeVerifier, &s.NonceHash, &s.UserID, &s.CreatedAT)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (p *Postgres) DeleteOAuthStatesBefore(ctx context.Context, before time.Time) error {
+
+	if _, err := p.db.ExecContext(ctx, "DELETE FROM oauth_states WHERE created_at < $1", before); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetUserIDByIdentity(ctx context.Context, provider, subject string) (int, error) {
+
+	var userID int
+	err := p.db.QueryRowContext(ctx, "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, subject).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (p *Postgres) AddUserIdentity(ctx context.Context, identity *types.UserIdentity) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetUserIdentities(ctx context.Context, userID int) ([]types.UserIdentity, error) {
+
+	identities := make([]types.UserIdentity, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT provider, subject, email, created_at FROM user_identities "+
+		"WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	identity := types.UserIdentity{UserID: userID}
+	var createdAt time.Time
+	for rows.Next() {
+		if err = rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &createdAt); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		identity.CreatedAT = createdAt.Format(time.RFC3339)
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "err with rows")
+	}
+
+	return identities, nil
+}
+
+// DeleteUserIdentity отвязывает соцсеть. false - это последний способ входа: пароль пользователю не известен
+// и других соцсетей нет. Строка пользователя блокируется, чтобы параллельные отвязки не убрали все соцсети
+func (p *Postgres) DeleteUserIdentity(ctx context.Context, userID int, provider string) (bool, error) {
+
+	return p.inTx(ctx, func(tx *sql.Tx) (bool, error) {
+		var passwordSet bool
+		if err := tx.QueryRowContext(ctx, "SELECT password_set FROM users WHERE id = $1 FOR UPDATE", userID).
+			Scan(&passwordSet); err != nil {
+			return false, err
+		}
+		var identities int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_identities WHERE user_id = $1", userID).
+			Scan(&identities); err != nil {
+			return false, errors.Wrap(err, "err with count user_identities")
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM user_identities WHERE user_id = $1 AND provider = $2", userID, provider)
+		if err != nil {
+			return false, errors.Wrap(err, "err with delete user_identities")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, errors.Wrap(err, "err with RowsAffected")
+		}
+		if n == 0 {
+			return false, sql.ErrNoRows
+		}
+
+		return passwordSet || identities > 1, nil
+	})
+}
+
+// SaveTOTPSecret сохраняет новый секрет, 2FA остается выключенной до подтверждения кодом
+func (p *Postgres) SaveTOTPSecret(ctx context.Context, userID int, secret string) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_totp (user_id, secret) VALUES ($1, $2) "+
+		"ON CONFLICT (user_id) DO UPDATE SET secret = $2, enabled_at = NULL, last_step = 0, challenge = NULL, step_up = NULL, created_at = NOW()",
+		userID, secret)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetTOTP(ctx context.Context, userID int) (*types.TOTP, error) {
+
+	totp := types.TOTP{UserID: userID}
+	if err := p.db.QueryRowContext(ctx, "SELECT secret, enabled_at IS NOT NULL, last_step, COALESCE(challenge, '') "+
+		"FROM user_totp WHERE user_id = $1", userID).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep, &totp.Challenge); err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SetTOTPChallenge запоминает id выданного challenge, прежний перестает действовать. Пустой id гасит challenge
+func (p *Postgres) SetTOTPChallenge(ctx context.Context, userID int, challenge string) error {
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE user_totp SET challenge = NULLIF($2, '') WHERE user_id = $1",
+		userID, challenge); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPChallenge гасит challenge, false - его уже использовали или выдали новый
+func (p *Postgres) UseTOTPChallenge(ctx context.Context, userID int, challenge string) (bool, error) {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE user_totp SET challenge = NULL WHERE user_id = $1 AND challenge = $2",
+		userID, challenge)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "err with RowsAffected")
+	}
+
+	return n > 0, nil
+}
+
+// SetTOTPStepUp запоминает id выданного step-up токена, прежний перестает действовать
+func (p *Postgres) SetTOTPStepUp(ctx context.Context, userID int, stepUp string) error {
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE user_totp SET step_up = $2 WHERE user_id = $1", userID, stepUp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStepUp гасит step-up токен, false - его уже использовали или выдали новый
+func (p *Postgres) UseTOTPStepUp(ctx context.Context, userID int, stepUp string) (bool, error) {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE user_totp SET step_up = NULL WHERE user_id = $1 AND step_up = $2",
+		userID, stepUp)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "err with RowsAffected")
+	}
+
+	return n > 0, nil
+}
+
+// UseTOTPStep запоминает шаг использованного кода, повторно тот же или более ранний код не пройдет
+func (p *Postgres) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2", userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "err with RowsAffected")
+	}
+
+	return n > 0, nil
+}
+
+// EnableTOTP включает 2FA и заменяет коды восстановления
+func (p *Postgres) EnableTOTP(ctx context.Context, userID int, recoveryHashes []string) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE user_totp SET enabled_at = NOW() WHERE user_id = $1", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with update user_totp")
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete user_recovery_codes")
+	}
+	for _, hash := range recoveryHashes {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hash); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "err with insert user_recovery_codes")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteTOTP(ctx context.Context, userID int) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete user_totp")
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete user_recovery_codes")
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+// UseRecoveryCode гасит неиспользованный код восстановления, false - такого кода нет
+func (p *Postgres) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE user_recovery_codes SET used_at = NOW() "+
+		"WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "err with RowsAffected")
+	}
+
+	return n > 0, nil
+}
+
+func (p *Postgres) CountRecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+
+	var count int
+	if err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (p *Postgres) GetRoles(ctx context.Context) ([]types.Role, error) {
+
+	roles := make([]types.Role, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT roles.name, roles.description, roles.builtin, "+
+		"COALESCE(ARRAY_AGG(role_permissions.permission ORDER BY role_permissions.permission) "+
+		"FILTER (WHERE role_permissions.permission IS NOT NULL), '{}') "+
+		"FROM roles LEFT JOIN role_permissions ON role_permissions.role = roles.name "+
+		"GROUP BY roles.name ORDER BY roles.created_at, roles.name")
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		role := types.Role{}
+		if err = rows.Scan(&role.Name, &role.Description, &role.Builtin, pq.Array(&role.Permissions)); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "err with rows")
+	}
+
+	return roles, nil
+}
+
+func (p *Postgres) CreateRole(ctx context.Context, role *types.Role) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+
+	if _, err = tx.ExecContext(ctx, "INSERT INTO roles (name, description) VALUES ($1, $2)",
+		role.Name, role.Description); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with insert roles")
+	}
+	if err = insertRolePermissions(ctx, tx, role); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+// UpdateRole меняет описание и полностью заменяет набор прав роли
+func (p *Postgres) UpdateRole(ctx context.Context, role *types.Role) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE roles SET description = $2 WHERE name = $1", role.Name, role.Description)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with update roles")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role = $1", role.Name); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete role_permissions")
+	}
+	if err = insertRolePermissions(ctx, tx, role); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+func insertRolePermissions(ctx context.Context, tx *sql.Tx, role *types.Role) error {
+	for _, permission := range role.Permissions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO role_permissions (role, permission) VALUES ($1, $2)",
+			role.Name, permission); err != nil {
+			return errors.Wrap(err, "err with insert role_permissions")
+		}
+	}
+	return nil
+}
+
+// DeleteRole удаляет не встроенную роль, которая никому не назначена
+func (p *Postgres) DeleteRole(ctx context.Context, name string) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE name = $1 AND NOT builtin "+
+		"AND NOT EXISTS (SELECT FROM users WHERE user_role = $1)", name)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete roles")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role = $1", name); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with delete role_permissions")
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+// ChangeUserRole меняет роль и увеличивает token_version, токены со старой ролью перестают работать
+func (p *Postgres) ChangeUserRole(ctx context.Context, userID int, role string) error {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET user_role = $2, token_version = token_version + 1, updated_at = NOW() "+
+		"WHERE id = $1", userID, role)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *Postgres) SuspendUser(ctx context.Context, userID int, reason string) error {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET suspended_at = NOW(), suspend_reason = $2, updated_at = NOW() "+
+		"WHERE id = $1", userID, reason)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *Postgres) UnsuspendUser(ctx context.Context, userID int) error {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET suspended_at = NULL, suspend_reason = '', updated_at = NOW() "+
+		"WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeUserTokens увеличивает token_version, все выданные токены пользователя перестают работать
+func (p *Postgres) RevokeUserTokens(ctx context.Context, userID int) error {
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET token_version = token_version + 1 WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddImpersonation(ctx context.Context, adminID, userID int, reason string, expiresAt time.Time) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO impersonations (admin_id, user_id, reason, expires_at) VALUES ($1, $2, $3, $4)",
+		adminID, userID, reason, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) AddAuditEntry(ctx context.Context, entry *types.AuditEntry) error {
+
+	_, err := p.db.ExecContext(ctx, "INSERT INTO audit_log (actor_id, actor_role, impersonator_id, action, entity, entity_id, "+
+		"before, after, ip, user_agent) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		entry.ActorID, entry.ActorRole, entry.ImpersonatorID, entry.Action, entry.Entity, entry.EntityID,
+		nullJSON(entry.Before), nullJSON(entry.After), entry.IP, entry.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAuditLog - пустые поля фильтра не ограничивают выборку
+func (p *Postgres) GetAuditLog(ctx context.Context, filter *types.AuditFilter) ([]types.AuditEntry, int, error) {
+
+	const where = "WHERE ($1 = 0 OR actor_id = $1) AND ($2 = '' OR action = $2) AND ($3 = '' OR entity = $3) " +
+		"AND ($4 = '' OR entity_id = $4) AND created_at >= $5 AND created_at < $6"
+	args := []interface{}{filter.ActorID, filter.Action, filter.Entity, filter.EntityID,
+		filter.Period.From, filter.Period.To}
+
+	var total int
+	if err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log "+where, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "err with count audit_log")
+	}
+
+	entries := make([]types.AuditEntry, 0)
+	rows, err := p.db.QueryContext(ctx, "SELECT id, actor_id, actor_role, impersonator_id, action, entity, entity_id, before, "+
+		"after, ip, user_agent, created_at FROM audit_log "+where+" ORDER BY id DESC LIMIT $7 OFFSET $8",
+		append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "err with Query")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := types.AuditEntry{}
+		if err = rows.Scan(&e.ID, &e.ActorID, &e.ActorRole, &e.ImpersonatorID, &e.Action, &e.Entity, &e.EntityID,
+			&e.Before, &e.After, &e.IP, &e.UserAgent, &e.CreatedAT); err != nil {
+			return nil, 0, errors.Wrap(err, "err with Scan")
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// DeleteAuditBefore удаляет записи журнала старше before, возвращает сколько удалено
+func (p *Postgres) DeleteAuditBefore(ctx context.Context, before time.Time) (int64, error) {
+
+	res, err := p.db.ExecContext(ctx, "DELETE FROM audit_log WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// rateLimitRefill - токены корзины к моменту $4 с учетом пополнения со скоростью $3 в секунду, не больше $2
+const rateLimitRefill = "LEAST($2::float8, rate_limits.tokens + " +
+	"EXTRACT(EPOCH FROM ($4::timestamptz - rate_limits.updated_at)) * $3::float8)"
+
+// TakeRateLimitToken забирает токен из корзины key одним запросом, возвращает успех и остаток токенов
+func (p *Postgres) TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+
+	var allowed bool
+	var tokens float64
+	err := p.db.QueryRowContext(ctx, "INSERT INTO rate_limits (key, tokens, allowed, updated_at) "+
+		"VALUES ($1, $2::float8 - 1, true, $4) ON CONFLICT (key) DO UPDATE SET "+
+		"tokens = CASE WHEN "+rateLimitRefill+" >= 1 THEN "+rateLimitRefill+" - 1 ELSE "+rateLimitRefill+" END, "+
+		"allowed = "+rateLimitRefill+" >= 1, updated_at = $4 "+
+		"RETURNING allowed, tokens", key, burst, rate, now).Scan(&allowed, &tokens)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, tokens, nil
+}
+
+func (p *Postgres) DeleteRateLimitsBefore(ctx context.Context, before time.Time) error {
+
+	if _, err := p.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE updated_at < $1", before); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddLoginFailure считает неудачный вход, счетчик начинается заново, если прошлая неудача раньше windowStart
+func (p *Postgres) AddLoginFailure(ctx context.Context, email string, windowStart time.Time) (int, error) {
+
+	var failures int
+	err := p.db.QueryRowContext(ctx, "INSERT INTO login_lockouts (email, failures, last_failure_at) "+
+		"VALUES ($1, 1, NOW()) ON CONFLICT (email) DO UPDATE SET "+
+		"failures = CASE WHEN login_lockouts.last_failure_at < $2 THEN 1 ELSE login_lockouts.failures + 1 END, "+
+		"last_failure_at = NOW() RETURNING failures", email, windowStart).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (p *Postgres) SetLoginLockedUntil(ctx context.Context, email string, until time.Time) error {
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE login_lockouts SET locked_until = $2 WHERE email = $1",
+		email, until); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetLoginLockedUntil - до какого времени заблокирован вход, sql.ErrNoRows если неудачных входов не было
+func (p *Postgres) GetLoginLockedUntil(ctx context.Context, email string) (time.Time, error) {
+
+	var until sql.NullTime
+	if err := p.db.QueryRowContext(ctx, "SELECT locked_until FROM login_lockouts WHERE email = $1", email).
+		Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+
+	return until.Time, nil
+}
+
+func (p *Postgres) DeleteLoginFailures(ctx context.Context, email string) error {
+
+	if _, err := p.db.ExecContext(ctx, "DELETE FROM login_lockouts WHERE email = $1", email); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) CreateCourseCloneJob(ctx context.Context, job *types.CourseCloneJob) error {
+
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return errors.Wrap(err, "err with Marshal options")
+	}
+	if err = p.db.QueryRowContext(ctx, "INSERT INTO course_clone_jobs (course_id, options, created_by) VALUES ($1, $2, $3) "+
+		"RETURNING id, status, created_at", job.CourseID, options, job.CreatedBy).
+		Scan(&job.ID, &job.Status, &job.CreatedAt); err != nil {
+		return errors.Wrap(err, "err with QueryRow")
+	}
+
+	return nil
+}
+
+func (p *Postgres) GetCourseCloneJob(ctx context.Context, id int) (*types.CourseCloneJob, error) {
+
+	row := p.db.QueryRowContext(ctx, "SELECT "+courseCloneJobColumns+" FROM course_clone_jobs WHERE id = $1", id)
+	return scanCourseCloneJob(row)
+}
+
+// ClaimCourseCloneJob берет в работу новую задачу или брошенную задачу, лок которой истек, sql.ErrNoRows - задач нет
+func (p *Postgres) ClaimCourseCloneJob(ctx context.Context, lockFor time.Duration) (*types.CourseCloneJob, error) {
+
+	row := p.db.QueryRowContext(ctx, "UPDATE course_clone_jobs SET status = $1, started_at = COALESCE(started_at, NOW()), "+
+		"locked_until = $3 WHERE id = (SELECT id FROM course_clone_jobs WHERE status = $2 OR "+
+		"(status = $1 AND locked_until < NOW()) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING "+courseCloneJobColumns, types.CloneRunning, types.CloneQueued, time.Now().Add(lockFor))
+	return scanCourseCloneJob(row)
+}
+
+// SetCourseCloneProgress сохраняет прогресс и продлевает лок задачи
+func (p *Postgres) SetCourseCloneProgress(ctx context.Context, id, done int, lockFor time.Duration) error {
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE course_clone_jobs SET done = $2, locked_until = $3 WHERE id = $1",
+		id, done, time.Now().Add(lockFor)); err != nil {
+		return errors.Wrap(err, "err with Exec")
+	}
+
+	return nil
+}
+
+// FinishCourseCloneJob завершает задачу, с непустым errText - как неудачную
+func (p *Postgres) FinishCourseCloneJob(ctx context.Context, id int, errText string) error {
+
+	status := types.CloneDone
+	if errText != "" {
+		status = types.CloneFailed
+	}
+	if _, err := p.db.ExecContext(ctx, "UPDATE course_clone_jobs SET status = $2, error = $3, finished_at = NOW(), "+
+		"locked_until = NULL WHERE id = $1", id, status, errText); err != nil {
+		return errors.Wrap(err, "err with Exec")
+	}
+
+	return nil
+}
+
+// CloneCourse копирует course.ID с разделами, уровнями, уроками и каруселями в новый курс course одной транзакцией,
+// поэтому упавшее копирование не оставляет половину курса. videos - копируются ли потом видео, они входят в total задачи
+func (p *Postgres) CloneCourse(ctx context.Context, job *types.CourseCloneJob, course *types.Course, videos bool, lockFor time.Duration) error {
+
+	//снимок исходного курса на момент начала транзакции, правки во время копирования в копию не попадут
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return errors.Wrap(err, "err with Begin")
+	}
+	if err = p.cloneCourse(ctx, tx, job, course, videos, lockFor); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "err with Commit")
+	}
+	return nil
+}
+
+func (p *Postgres) cloneCourse(ctx context.Context, tx *sql.Tx, job *types.CourseCloneJob, course *types.Course, videos bool, lockFor time.Duration) error {
+
+	sections, err := scanInts(tx.QueryContext(ctx, "SELECT id FROM sections WHERE course_id = $1 ORDER BY position, id", course.ID))
+	if err != nil {
+		return errors.Wrap(err, "err with select sections")
+	}
+	levels, err := cloneLevels(ctx, tx, course.ID)
+	if err != nil {
+		return err
+	}
+	lessons, err := cloneLessons(ctx, tx, course.ID)
+	if err != nil {
+		return err
+	}
+
+	job.Total = len(sections) + len(levels) + len(lessons)
+	if videos {
+		job.Total += len(lessons)
+	}
+	//прогресс пишется мимо транзакции, чтобы его было видно до конца копирования
+	if _, err = p.db.ExecContext(ctx, "UPDATE course_clone_jobs SET total = $2, done = 0 WHERE id = $1", job.ID, job.Total); err != nil {
+		return errors.Wrap(err, "err with update total")
+	}
+	job.Done = 0
+	progress := func() error {
+		job.Done++
+		return p.SetCourseCloneProgress(ctx, job.ID, job.Done, lockFor)
+	}
+
+	if err = tx.QueryRowContext(ctx, "INSERT INTO courses (name, cost, sale, total_price_for_user) VALUES ($1, $2, $3, $4) "+
+		"RETURNING id", course.Name, course.Cost, course.Sale, course.TotalPrice).Scan(&job.NewCourseID); err != nil {
+		return errors.Wrap(err, "err with insert courses")
+	}
+
+	sectionMap := make(map[int]int, len(sections))
+	for _, id := range sections {
+		var newID int
+		if err = tx.QueryRowContext(ctx, "INSERT INTO sections (course_id, name, position) "+
+			"SELECT $2, name, position FROM sections WHERE id = $1 RETURNING id", id, job.NewCourseID).Scan(&newID); err != nil {
+			return errors.Wrap(err, "err with insert sections")
+		}
+		sectionMap[id] = newID
+		if err = progress(); err != nil {
+			return err
+		}
+	}
+
+	newLevels := make(map[int]*types.Level, len(levels))
+	for _, level := range levels {
+		sectionID, ok := sectionMap[level.SectionID]
+		if !ok {
+			return errors.Errorf("level %d is in section %d outside the course", level.ID, level.SectionID)
+		}
+		newLevel := &types.Level{CourseID: job.NewCourseID, SectionID: sectionID}
+		if err = tx.QueryRowContext(ctx, "INSERT INTO levels (course_id, section_id, name, position) "+
+			"SELECT $2, $3, name, position FROM levels WHERE level_id = $1 RETURNING level_id",
+			level.ID, newLevel.CourseID, newLevel.SectionID).Scan(&newLevel.ID); err != nil {
+			return errors.Wrap(err, "err with insert levels")
+		}
+		newLevels[level.ID] = newLevel
+		if err = progress(); err != nil {
+			return err
+		}
+	}
+
+	job.LessonMap = make(map[int]int, len(lessons))
+	for _, lesson := range lessons {
+		level, ok := newLevels[lesson.LevelID]
+		if !ok {
+			return errors.Errorf("lesson %d is in level %d outside the course", lesson.ID, lesson.LevelID)
+		}
+		var newID int
+		if err = tx.QueryRowContext(ctx, "INSERT INTO lessons (course_id, section_id, level_id, name, description, thesis, "+
+			"task, status_free) SELECT $2, $3, $4, name, description, thesis, task, status_free FROM lessons "+
+			"WHERE lesson_id = $1 RETURNING lesson_id", lesson.ID, job.NewCourseID, level.SectionID, level.ID).
+			Scan(&newID); err != nil {
+			return errors.Wrap(err, "err with insert lessons")
+		}
+		job.LessonMap[lesson.ID] = newID
+		if err = progress(); err != nil {
+			return err
+		}
+	}
+
+	//карусели копируются в том же порядке, уроки без карусели попадают в конец, как и в исходном курсе
+	for _, level := range levels {
+		carousel, err := levelLessons(ctx, tx, level.ID)
+		if err != nil {
+			return err
+		}
+		cloned := make([]int64, 0, len(carousel))
+		for _, id := range carousel {
+			if newID, ok := job.LessonMap[int(id)]; ok {
+				cloned = append(cloned, int64(newID))
+			}
+		}
+		if err = saveCarousel(ctx, tx, newLevels[level.ID], cloned); err != nil {
+			return err
+		}
+	}
+
+	//задача обновляется в транзакции последней: после этого прогресс мимо транзакции ждал бы ее лок
+	lessonMap, err := json.Marshal(job.LessonMap)
+	if err != nil {
+		return errors.Wrap(err, "err with Marshal lesson_map")
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE course_clone_jobs SET new_course_id = $2, lesson_map = $3 WHERE id = $1",
+		job.ID, job.NewCourseID, lessonMap); err != nil {
+		return errors.Wrap(err, "err with update course_clone_jobs")
+	}
+
+	return nil
+}
+
+func cloneLevels(ctx context.Context, tx *sql.Tx, courseID int) ([]types.Level, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT level_id, section_id FROM levels WHERE course_id = $1 "+
+		"ORDER BY position, level_id", courseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with select levels")
+	}
+	defer rows.Close()
+	levels := make([]types.Level, 0)
+	level := types.Level{}
+	for rows.Next() {
+		if err = rows.Scan(&level.ID, &level.SectionID); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, rows.Err()
+}
+
+func cloneLessons(ctx context.Context, tx *sql.Tx, courseID int) ([]types.LessonNav, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT lesson_id, section_id, level_id FROM lessons WHERE course_id = $1 "+
+		"ORDER BY lesson_id", courseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "err with select lessons")
+	}
+	defer rows.Close()
+	lessons := make([]types.LessonNav, 0)
+	lesson := types.LessonNav{}
+	for rows.Next() {
+		if err = rows.Scan(&lesson.ID, &lesson.SectionID, &lesson.LevelID); err != nil {
+			return nil, errors.Wrap(err, "err with Scan")
+		}
+		lessons = append(lessons, lesson)
+	}
+
+	return lessons, rows.Err()
+}
+
+const courseCloneJobColumns = "id, course_id, new_course_id, options, status, total, done, error, lesson_map, created_by, " +
+	"created_at, started_at, finished_at"
+
+func scanCourseCloneJob(row *sql.Row) (*types.CourseCloneJob, error) {
+
+	job := types.CourseCloneJob{}
+	var options, lessonMap []byte
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.CourseID, &job.NewCourseID, &options, &job.Status, &job.Total, &job.Done, &job.Error,
+		&lessonMap, &job.CreatedBy, &job.CreatedAt, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(options, &job.Options); err != nil {
+		return nil, errors.Wrap(err, "err with Unmarshal options")
+	}
+	if lessonMap != nil {
+		if err := json.Unmarshal(lessonMap, &job.LessonMap); err != nil {
+			return nil, errors.Wrap(err, "err with Unmarshal lesson_map")
+		}
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+// scanInts читает все строки из одной колонки int и закрывает rows, в транзакции следующий запрос можно делать только после этого
+func scanInts(rows *sql.Rows, err error) ([]int, error) {
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceAt(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		ids      []int64
+		id       int64
+		position int
+		want     []int64
+		wantPos  int
+	}{
+		{name: "to start", ids: []int64{1, 2, 3, 4}, id: 3, position: 0, want: []int64{3, 1, 2, 4}, wantPos: 0},
+		{name: "to end", ids: []int64{1, 2, 3, 4}, id: 1, position: 3, want: []int64{2, 3, 4, 1}, wantPos: 3},
+		{name: "down", ids: []int64{1, 2, 3, 4}, id: 2, position: 2, want: []int64{1, 3, 2, 4}, wantPos: 2},
+		{name: "up", ids: []int64{1, 2, 3, 4}, id: 4, position: 1, want: []int64{1, 4, 2, 3}, wantPos: 1},
+		{name: "same position", ids: []int64{1, 2, 3}, id: 2, position: 1, want: []int64{1, 2, 3}, wantPos: 1},
+		{name: "past the end", ids: []int64{1, 2, 3}, id: 1, position: 10, want: []int64{2, 3, 1}, wantPos: 2},
+		{name: "negative", ids: []int64{1, 2, 3}, id: 3, position: -1, want: []int64{3, 1, 2}, wantPos: 0},
+		{name: "new id", ids: []int64{1, 2}, id: 9, position: 1, want: []int64{1, 9, 2}, wantPos: 1},
+		{name: "new id past the end", ids: []int64{1, 2}, id: 9, position: 5, want: []int64{1, 2, 9}, wantPos: 2},
+		{name: "empty list", ids: nil, id: 9, position: 3, want: []int64{9}, wantPos: 0},
+		{name: "single", ids: []int64{9}, id: 9, position: 0, want: []int64{9}, wantPos: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := append([]int64(nil), tt.ids...)
+			got, pos := placeAt(ids, tt.id, tt.position)
+			if !reflect.DeepEqual(got, tt.want) || pos != tt.wantPos {
+				t.Errorf("placeAt(%v, %d, %d) = %v, %d, want %v, %d", tt.ids, tt.id, tt.position, got, pos, tt.want, tt.wantPos)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) && len(tt.ids) > 0 {
+				t.Errorf("input changed to %v", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Package postgrestest - база в памяти для тестов сервиса и хендлеров без Postgres: ответы на запросы
+// задаются заранее по подстроке SQL, запрос без заготовки возвращает пустой результат
+package postgrestest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/tarasova-school/internal/clients/postgres"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DB - заготовленные ответы и журнал выполненных запросов
+type DB struct {
+	mu      sync.Mutex
+	stubs   []*Stub
+	queries []Query
+}
+
+// Query - выполненный запрос с аргументами
+type Query struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// Stub - ответ на запросы, содержащие подстроку query
+type Stub struct {
+	query    string
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// New возвращает клиент Postgres поверх фейковой базы
+func New() (*DB, *postgres.Postgres) {
+	db := &DB{}
+	return db, postgres.NewPostgresWithDB(sql.OpenDB(connector{db}))
+}
+
+// On добавляет ответ на запросы с подстрокой query. Заготовки проверяются в порядке добавления
+func (db *DB) On(query string, columns ...string) *Stub {
+	stub := &Stub{query: query, columns: columns}
+	db.mu.Lock()
+	db.stubs = append(db.stubs, stub)
+	db.mu.Unlock()
+	return stub
+}
+
+// Row добавляет строку результата, значения - в порядке колонок On
+func (s *Stub) Row(values ...interface{}) *Stub {
+	row := make([]driver.Value, len(values))
+	for i, v := range values {
+		if n, ok := v.(int); ok {
+			v = int64(n)
+		}
+		row[i] = v
+	}
+	s.rows = append(s.rows, row)
+	return s
+}
+
+// Affected - сколько строк изменил Exec
+func (s *Stub) Affected(n int64) *Stub {
+	s.affected = n
+	return s
+}
+
+// Err - запрос завершится ошибкой
+func (s *Stub) Err(err error) *Stub {
+	s.err = err
+	return s
+}
+
+// Queries - все выполненные запросы по порядку, вместе с BEGIN, COMMIT и ROLLBACK транзакций
+func (db *DB) Queries() []Query {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Query(nil), db.queries...)
+}
+
+// Executed - выполнялся ли запрос с подстрокой query
+func (db *DB) Executed(query string) bool {
+	for _, q := range db.Queries() {
+		if strings.Contains(q.SQL, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) find(query string, args []driver.NamedValue) *Stub {
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, Query{SQL: query, Args: values})
+	for _, stub := range db.stubs {
+		if strings.Contains(query, stub.query) {
+			return stub
+		}
+	}
+	return &Stub{}
+}
+
+type connector struct {
+	db *DB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, driver.ErrSkip
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.db.find("BEGIN", nil)
+	return tx{db: c.db}, nil
+}
+
+// CheckNamedValue принимает аргументы как есть, в том числе pq.Array
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if valuer, ok := v.Value.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		v.Value = value
+	}
+	return nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	stub := c.db.find(query, args)
+	if stub.err != nil {
+		return nil, stub.err
+	}
+	return &rows{columns: stub.columns, values: stub.rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	stub := c.db.find(query, args)
+	if stub.err != nil {
+		return nil, stub.err
+	}
+	return driver.RowsAffected(stub.affected), nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+// tx только пишет COMMIT и ROLLBACK в журнал, изменения в фейковой базе не хранятся
+type tx struct {
+	db *DB
+}
+
+func (t tx) Commit() error {
+	t.db.find("COMMIT", nil)
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.db.find("ROLLBACK", nil)
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
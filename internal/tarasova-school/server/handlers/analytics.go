@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) GetTeacherAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idTeacher, err := strconv.Atoi(query["idTeacher"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	period, err := reportPeriodByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	unit := r.FormValue("group")
+	if unit == "" {
+		unit = types.AnalyticsByDay
+	}
+
+	analytics, err := h.srv.GetTeacherAnalytics(r.Context(), idTeacher, period, unit)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, analytics)
+}
+
+func (h *Handlers) GetAllTeachersAnalytics(w http.ResponseWriter, r *http.Request) {
+
+	period, err := reportPeriodByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	analytics, err := h.srv.GetAllTeachersAnalytics(r.Context(), period)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, analytics)
+}
+
+func (h *Handlers) GetSLAOverview(w http.ResponseWriter, r *http.Request) {
+
+	overview, err := h.srv.GetSLAOverview(r.Context())
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, overview)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	auditBodyLimit     = 64 << 10
+	auditUserAgentSize = 512
+)
+
+// auditEntityVars - какой параметр пути хранит id сущности
+var auditEntityVars = map[string]string{
+	"course":  "idCourse",
+	"section": "idSection",
+	"level":   "idLevel",
+	"lesson":  "idLesson",
+	"teacher": "idTeacher",
+	"user":    "idUser",
+	"chat":    "idChat",
+	"role":    "name",
+}
+
+// Audit пишет в журнал изменяющие запросы. Действие берется из имени маршрута вида "сущность.действие",
+// состояние сущности снимается до и после запроса
+func (h *Handlers) Audit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+		if err != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		entity, action := auditAction(r)
+		vars := mux.Vars(r)
+		body := auditRequestBody(r)
+		before := h.auditSnapshot(r.Context(), entity, vars)
+
+		rec := &auditResponse{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		if rec.status >= http.StatusBadRequest {
+			return
+		}
+
+		entry := &types.AuditEntry{
+			ActorID:        claims.UserID,
+			ActorRole:      claims.Role,
+			ImpersonatorID: claims.ImpersonatorID,
+			Action:         entity + "." + action,
+			Entity:         entity,
+			EntityID:       vars[auditEntityVars[entity]],
+			IP:             h.clientIP(r),
+			UserAgent:      r.UserAgent(),
+		}
+		if len(entry.UserAgent) > auditUserAgentSize {
+			entry.UserAgent = entry.UserAgent[:auditUserAgentSize]
+		}
+
+		var after interface{}
+		if r.Method != http.MethodDelete {
+			if after = h.auditSnapshot(r.Context(), entity, vars); after == nil && body != nil {
+				after = body
+			}
+		}
+		if entry.EntityID == "" {
+			//при создании id сущности приходит в ответе
+			created := types.OnlyID{}
+			if json.Unmarshal(rec.body.Bytes(), &created) == nil && created.ID != 0 {
+				entry.EntityID = strconv.Itoa(created.ID)
+			}
+		}
+
+		h.srv.RecordAudit(r.Context(), entry, before, after)
+	})
+}
+
+func (h *Handlers) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+
+	period, err := reportPeriodByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	filter := types.AuditFilter{
+		Action:   r.FormValue("action"),
+		Entity:   r.FormValue("entity"),
+		EntityID: r.FormValue("entity_id"),
+		Period:   period,
+	}
+	for key, value := range map[string]*int{
+		"actor_id": &filter.ActorID,
+		"limit":    &filter.Limit,
+		"offset":   &filter.Offset,
+	} {
+		if v := r.FormValue(key); v != "" {
+			if *value, err = strconv.Atoi(v); err != nil {
+				apiErrorEncode(w, r, infrastruct.ErrorBadRequest)
+				return
+			}
+		}
+	}
+
+	log, err := h.srv.GetAuditLog(r.Context(), &filter)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, log)
+}
+
+// auditSnapshot - текущее состояние сущности, nil если снимок для нее не делается или ее уже нет
+func (h *Handlers) auditSnapshot(ctx context.Context, entity string, vars map[string]string) interface{} {
+
+	ids := make(map[string]int, len(vars))
+	for key, value := range vars {
+		if id, err := strconv.Atoi(value); err == nil {
+			ids[key] = id
+		}
+	}
+	if _, ok := ids[auditEntityVars[entity]]; !ok && entity != "role" {
+		return nil
+	}
+
+	var snapshot interface{}
+	var err error
+	switch entity {
+	case "course":
+		snapshot, err = h.srv.GetCourse(ctx, ids["idCourse"])
+	case "section":
+		snapshot, err = h.srv.GetSection(ctx, ids["idCourse"], ids["idSection"])
+	case "level":
+		snapshot, err = h.srv.GetLevel(ctx, ids["idCourse"], ids["idSection"], ids["idLevel"])
+	case "lesson":
+		snapshot, err = h.srv.GetLesson(ctx, ids["idCourse"], ids["idSection"], ids["idLevel"], ids["idLesson"])
+	case "teacher":
+		snapshot, err = h.srv.GetTeacher(ctx, ids["idTeacher"])
+	case "user":
+		snapshot, err = h.srv.GetUserAccess(ctx, ids["idUser"])
+	case "role":
+		roles, rolesErr := h.srv.GetRoles(ctx)
+		for i := range roles {
+			if roles[i].Name == vars["name"] {
+				return roles[i]
+			}
+		}
+		err = rolesErr
+	}
+	if err != nil {
+		return nil
+	}
+
+	return snapshot
+}
+
+// auditAction разбирает имя маршрута, без имени действием считается метод запроса
+func auditAction(r *http.Request) (string, string) {
+
+	route := mux.CurrentRoute(r)
+	if route != nil {
+		if parts := strings.SplitN(route.GetName(), ".", 2); len(parts) == 2 {
+			return parts[0], parts[1]
+		}
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template, strings.ToLower(r.Method)
+		}
+	}
+
+	return r.URL.Path, strings.ToLower(r.Method)
+}
+
+// auditRequestBody читает json тело запроса и возвращает его обратно в запрос, файлы не читаются
+func auditRequestBody(r *http.Request) json.RawMessage {
+
+	if r.Body == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") &&
+		r.Header.Get("Content-Type") != "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, auditBodyLimit+1))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) > auditBodyLimit || !json.Valid(body) {
+		return nil
+	}
+
+	return body
+}
+
+// auditResponse запоминает статус и начало ответа, чтобы достать id созданной сущности
+type auditResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (a *auditResponse) WriteHeader(status int) {
+	a.status = status
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditResponse) Write(b []byte) (int, error) {
+	if a.body.Len() < auditBodyLimit {
+		a.body.Write(b)
+	}
+	return a.ResponseWriter.Write(b)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) CloneCourse(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idCourse, err := strconv.Atoi(query["idCourse"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	options := types.CloneCourse{}
+	if err := decodeJSON(r, &options); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	job, err := h.srv.CloneCourse(r.Context(), idCourse, &options, claims)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, job)
+}
+
+func (h *Handlers) GetCourseCloneJob(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idJob, err := strconv.Atoi(query["idJob"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	job, err := h.srv.GetCourseCloneJob(r.Context(), idJob)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, job)
+}
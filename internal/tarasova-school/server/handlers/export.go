@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/tarasova-school/internal/tarasova-school/service/export"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"time"
+)
+
+const reportDateLayout = "2006-01-02"
+
+func (h *Handlers) ExportCoursesInfo(w http.ResponseWriter, r *http.Request) {
+	h.exportReport(w, r, "courses", h.srv.ExportCoursesInfo)
+}
+
+func (h *Handlers) ExportTeachersInfo(w http.ResponseWriter, r *http.Request) {
+	h.exportReport(w, r, "teachers", h.srv.ExportTeachersInfo)
+}
+
+func (h *Handlers) ExportStudents(w http.ResponseWriter, r *http.Request) {
+	h.exportReport(w, r, "students", h.srv.ExportStudents)
+}
+
+func (h *Handlers) ExportTeacherChatStats(w http.ResponseWriter, r *http.Request) {
+	h.exportReport(w, r, "teachers_chats", h.srv.ExportTeacherChatStats)
+}
+
+func (h *Handlers) exportReport(w http.ResponseWriter, r *http.Request, name string,
+	report func(context.Context, *types.ReportPeriod, export.Writer) error) {
+
+	period, err := reportPeriodByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	res := &exportResponse{w: w, format: format,
+		fileName: fmt.Sprintf("%s_%s.%s", name, time.Now().Format(reportDateLayout), format)}
+	writer, err := export.NewWriter(format, res)
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest)
+		return
+	}
+
+	if err = report(r.Context(), period, writer); err != nil && !res.started {
+		apiErrorEncode(w, r, err)
+	}
+}
+
+// reportPeriodByRequest читает from и to (включительно) в формате 2006-01-02, оба необязательные
+func reportPeriodByRequest(r *http.Request) (*types.ReportPeriod, error) {
+
+	period := &types.ReportPeriod{To: time.Now()}
+	if from := r.FormValue("from"); from != "" {
+		t, err := time.ParseInLocation(reportDateLayout, from, time.Local)
+		if err != nil {
+			return nil, infrastruct.ErrorBadRequest
+		}
+		period.From = t
+	}
+	if to := r.FormValue("to"); to != "" {
+		t, err := time.ParseInLocation(reportDateLayout, to, time.Local)
+		if err != nil {
+			return nil, infrastruct.ErrorBadRequest
+		}
+		period.To = t.AddDate(0, 0, 1)
+	}
+
+	if !period.From.Before(period.To) {
+		return nil, infrastruct.ErrorBadRequest
+	}
+
+	return period, nil
+}
+
+// exportResponse выставляет заголовки файла только при первой записи,
+// чтобы до начала выгрузки можно было ответить обычной ошибкой
+type exportResponse struct {
+	w        http.ResponseWriter
+	format   string
+	fileName string
+	started  bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", export.ContentType(e.format))
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.fileName))
+	}
+
+	return e.w.Write(p)
+}
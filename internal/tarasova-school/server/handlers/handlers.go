@@ -9,8 +9,13 @@ import (
 	"github.com/tarasova-school/internal/types/config"
 	"github.com/tarasova-school/pkg/infrastruct"
 	"github.com/tarasova-school/pkg/logger"
+	"github.com/tarasova-school/pkg/openapi"
+	"github.com/tarasova-school/pkg/ratelimit"
+	"github.com/tarasova-school/pkg/validate"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -19,16 +24,31 @@ import (
 
 type Handlers struct {
 	srv       *service.Service
-	soc       *config.SocAuth
 	secretKey string
+	metrics   *config.Metrics
+	cnf       *config.Config
+	limiter   *ratelimit.Limiter
+	openapi   *openapi.Document
+	spec      []byte
+	proxies   []*net.IPNet
 }
 
-func NewHandlers(srv *service.Service, cnf *config.Config) *Handlers {
+func NewHandlers(srv *service.Service, cnf *config.Config, limiter *ratelimit.Limiter) *Handlers {
+
+	metrics := cnf.Metrics
+	if metrics == nil {
+		metrics = &config.Metrics{}
+	}
+	//trusted_proxies проверяются в config.Validate
+	proxies, _ := cnf.Server.Proxies()
 
 	return &Handlers{
 		srv:       srv,
 		secretKey: cnf.SecretKeyJWT,
-		soc:       cnf.Soc,
+		metrics:   metrics,
+		cnf:       cnf,
+		limiter:   limiter,
+		proxies:   proxies,
 	}
 }
 
@@ -36,37 +56,61 @@ func (h *Handlers) Ping(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("pong"))
 }
 
+// GetConfig - текущие настройки без секретов
+func (h *Handlers) GetConfig(w http.ResponseWriter, _ *http.Request) {
+	apiResponseEncoder(w, config.Redact(h.cnf))
+}
+
+// Healthz - liveness, процесс жив и обрабатывает запросы, зависимости не проверяются
+func (h *Handlers) Healthz(w http.ResponseWriter, _ *http.Request) {
+	_, _ = w.Write([]byte(types.CheckOK))
+}
+
+// Readyz - readiness, 503 пока недоступна база, каталог видео, почта или статика /docs
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+
+	readiness := h.srv.Ready(r.Context())
+	readiness.Checks["docs"] = types.CheckOK
+	if err := h.CheckDocs(); err != nil {
+		logger.LogErrorCtx(r.Context(), errors.Wrap(err, "err with readiness check docs"))
+		readiness.Checks["docs"] = types.CheckFailed
+		readiness.Ready = false
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	apiResponseEncoder(w, readiness)
+}
+
 func (h *Handlers) UploadVideo(w http.ResponseWriter, r *http.Request) {
 
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	src, _, err := r.FormFile("video")
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with FormFile in UploadVideo"))
+		logger.LogErrorCtx(r.Context(), errors.Wrap(err, "err with FormFile in UploadVideo"))
 		return
 	}
 	video := types.UploadVideo{}
@@ -79,9 +123,9 @@ func (h *Handlers) UploadVideo(w http.ResponseWriter, r *http.Request) {
 
 	defer src.Close()
 
-	err = h.srv.UploadVideo(&video)
+	err = h.srv.UploadVideo(r.Context(), &video)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -92,26 +136,22 @@ func (h *Handlers) GetVideo(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
@@ -122,10 +162,29 @@ func (h *Handlers) GetVideo(w http.ResponseWriter, r *http.Request) {
 	video.LevelID = idLevel
 	video.LessonID = idLesson
 
-	url, err := h.srv.GetVideoURL(&video)
-	videoStream, _ := os.Open(url)
+	url, err := h.srv.GetVideoURL(r.Context(), &video)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+	videoStream, err := os.Open(url)
+	if err != nil {
+		if os.IsNotExist(err) {
+			//урок есть, а видео к нему еще не загрузили
+			apiErrorEncode(w, r, infrastruct.ErrorNotFound)
+			return
+		}
+		apiErrorEncode(w, r, errors.Wrap(err, "err with Open video"))
+		return
+	}
+	defer videoStream.Close()
 
-	io.Copy(w, videoStream)
+	n, err := io.Copy(w, videoStream)
+	videoBytesServed.Add(float64(n))
+	if err != nil {
+		//заголовки уже отправлены, клиент мог просто закрыть соединение
+		logger.LogErrorCtx(r.Context(), errors.Wrap(err, "err with Copy video"))
+	}
 }
 
 func (h *Handlers) Authorize(w http.ResponseWriter, r *http.Request) {
@@ -133,16 +192,15 @@ func (h *Handlers) Authorize(w http.ResponseWriter, r *http.Request) {
 	auth := types.Authorize{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&auth); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &auth); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	auth.Email = strings.ToLower(auth.Email)
 
-	token, err := h.srv.Authorize(&auth)
+	token, err := h.srv.Authorize(r.Context(), &auth)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -154,21 +212,15 @@ func (h *Handlers) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	user := types.User{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&user); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &user); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	user.Email = strings.ToLower(user.Email)
 
-	if user.Email == "" || user.FirstName == "" || user.Password == "" {
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	token, err := h.srv.RegisterStudent(&user)
+	token, err := h.srv.RegisterStudent(r.Context(), &user)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -180,22 +232,20 @@ func (h *Handlers) RegisterTeacher(w http.ResponseWriter, r *http.Request) {
 	teacher := types.Teacher{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&teacher); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &teacher); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	teacher.Email = strings.ToLower(teacher.Email)
 
-	if teacher.Email == "" || teacher.FirstName == "" || teacher.Password == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = validate.Field("password", teacher.Password, "required,min=6"); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	id, err := h.srv.RegisterTeacher(&teacher)
+	id, err := h.srv.RegisterTeacher(r.Context(), &teacher)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -207,13 +257,12 @@ func (h *Handlers) GetTeacher(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idTeacher, err := strconv.Atoi(query["idTeacher"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 	}
 
-	teacher, err := h.srv.GetTeacher(idTeacher)
+	teacher, err := h.srv.GetTeacher(r.Context(), idTeacher)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -225,28 +274,21 @@ func (h *Handlers) UpdateTeacher(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idTeacher, err := strconv.Atoi(query["idTeacher"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 	}
 
 	teacher := types.Teacher{}
-	if err := json.NewDecoder(r.Body).Decode(&teacher); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &teacher); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	teacher.Email = strings.ToLower(teacher.Email)
 
-	if teacher.FirstName == "" || teacher.Email == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-	}
-
 	teacher.ID = idTeacher
 
-	err = h.srv.UpdateTeacher(&teacher)
+	err = h.srv.UpdateTeacher(r.Context(), &teacher)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -256,13 +298,12 @@ func (h *Handlers) DeleteTeacher(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idTeacher, err := strconv.Atoi(query["idTeacher"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 	}
 
-	err = h.srv.DeleteTeacher(idTeacher)
+	err = h.srv.DeleteTeacher(r.Context(), idTeacher)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -272,17 +313,22 @@ func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	ch := types.ChangePassword{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&ch); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	if ch.NewPassword != ch.RepeatPassword {
-		apiResponseEncoder(w, infrastruct.ErrorPasswordsDoNotMatch)
+		apiErrorEncode(w, r, infrastruct.ErrorPasswordsDoNotMatch)
 		return
 	}
-	if err = h.srv.ChangePassword(&ch); err != nil {
-		apiErrorEncode(w, err)
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+	ch.UserID = claims.UserID
+	if err = h.srv.ChangePassword(r.Context(), &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -292,16 +338,16 @@ func (h *Handlers) RecoveryPassword(w http.ResponseWriter, r *http.Request) {
 	ch := types.RecoveryPasswordEmail{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&ch); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	ch.Email = strings.ToLower(ch.Email)
 	ch.Email = strings.TrimSpace(ch.Email)
+	ch.IP = h.clientIP(r)
 
-	if err = h.srv.RecoveryPassword(&ch); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.RecoveryPassword(r.Context(), &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -311,18 +357,17 @@ func (h *Handlers) CheckValidRecoveryPassword(w http.ResponseWriter, r *http.Req
 	ch := types.RecoveryPasswordEmailAndCode{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&ch); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	ch.Email = strings.ToLower(ch.Email)
 	ch.Email = strings.TrimSpace(ch.Email)
-	ch.Code = strings.ToUpper(ch.Code)
+	ch.IP = h.clientIP(r)
 
-	ok, err := h.srv.CheckValidRecoveryPassword(&ch)
+	ok, err := h.srv.CheckValidRecoveryPassword(r.Context(), &ch)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -336,23 +381,23 @@ func (h *Handlers) NewRecoveryPassword(w http.ResponseWriter, r *http.Request) {
 	ch := types.RecoveryPasswordNewPass{}
 	var err error
 
-	if err = json.NewDecoder(r.Body).Decode(&ch); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 	ch.Email = strings.ToLower(ch.Email)
 	ch.Email = strings.TrimSpace(ch.Email)
+	ch.IP = h.clientIP(r)
 
-	if err = h.srv.NewRecoveryPassword(&ch); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.NewRecoveryPassword(r.Context(), &ch); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
 
 func (h *Handlers) Upload(w http.ResponseWriter, r *http.Request) {
 	bb, _ := ioutil.ReadAll(r.Body)
-	logger.LogInfo(string(bb))
+	logger.LogInfoCtx(r.Context(), string(bb))
 }
 
 func (h *Handlers) GetStudentByQueryID(w http.ResponseWriter, r *http.Request) {
@@ -360,24 +405,25 @@ func (h *Handlers) GetStudentByQueryID(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idStudent, err := strconv.Atoi(query["idStudent"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	user, err := h.srv.GetStudentByID(idStudent)
+	user, err := h.srv.GetStudentByID(r.Context(), idStudent)
 	if err != nil {
-
+		apiErrorEncode(w, r, err)
+		return
 	}
+
 	apiResponseEncoder(w, user)
 }
 
 func (h *Handlers) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 	userRole := r.FormValue("role")
-	moreUser, err := h.srv.GetUsers(userRole)
+	moreUser, err := h.srv.GetUsers(r.Context(), userRole)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 	apiResponseEncoder(w, moreUser)
@@ -385,30 +431,30 @@ func (h *Handlers) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handlers) GetAllTeachersInfoForAdmin(w http.ResponseWriter, r *http.Request) {
 
-	teacherArr, err := h.srv.GetAllTeachersInfoForAdmin()
+	teacherArr, err := h.srv.GetAllTeachersInfoForAdmin(r.Context())
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 	apiResponseEncoder(w, teacherArr)
 }
 
-func (h *Handlers) GetAllCourses(w http.ResponseWriter, _ *http.Request) {
+func (h *Handlers) GetAllCourses(w http.ResponseWriter, r *http.Request) {
 
-	courseArr, err := h.srv.GetAllCourse()
+	courseArr, err := h.srv.GetAllCourse(r.Context())
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	apiResponseEncoder(w, courseArr)
 }
 
-func (h *Handlers) GetAllCoursesInfoForAdmin(w http.ResponseWriter, _ *http.Request) {
+func (h *Handlers) GetAllCoursesInfoForAdmin(w http.ResponseWriter, r *http.Request) {
 
-	courseArr, err := h.srv.GetAllCoursesInfoForAdmin()
+	courseArr, err := h.srv.GetAllCoursesInfoForAdmin(r.Context())
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -420,14 +466,13 @@ func (h *Handlers) GetAllSectionsInCourse(w http.ResponseWriter, r *http.Request
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	sectionArr, err := h.srv.GetAllSectionsInCourse(idCourse)
+	sectionArr, err := h.srv.GetAllSectionsInCourse(r.Context(), idCourse)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -439,20 +484,18 @@ func (h *Handlers) GetAllLevelsInSection(w http.ResponseWriter, r *http.Request)
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	levelArr, err := h.srv.GetAllLevelsInSection(idCourse, idSection)
+	levelArr, err := h.srv.GetAllLevelsInSection(r.Context(), idCourse, idSection)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -464,26 +507,23 @@ func (h *Handlers) GetAllLessonsInLevel(w http.ResponseWriter, r *http.Request)
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	lessonArr, err := h.srv.GetAllLessonsInLevel(idCourse, idSection, idLevel)
+	lessonArr, err := h.srv.GetAllLessonsInLevel(r.Context(), idCourse, idSection, idLevel)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -494,21 +534,14 @@ func (h *Handlers) AddCourse(w http.ResponseWriter, r *http.Request) {
 
 	course := types.Course{}
 
-	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &course); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	if course.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	id, err := h.srv.AddCourse(&course)
+	id, err := h.srv.AddCourse(r.Context(), &course)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -520,30 +553,22 @@ func (h *Handlers) AddSection(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	section := types.Section{}
 
-	if err = json.NewDecoder(r.Body).Decode(&section); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &section); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	section.CourseID = idCourse
 
-	if section.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	idSection, err := h.srv.AddSection(&section)
+	idSection, err := h.srv.AddSection(r.Context(), &section)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -555,37 +580,28 @@ func (h *Handlers) AddLevel(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	level := types.Level{}
 
-	if err = json.NewDecoder(r.Body).Decode(&level); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &level); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	level.CourseID = idCourse
 	level.SectionID = idSection
 
-	if level.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	idLevel, err := h.srv.AddLevel(&level)
+	idLevel, err := h.srv.AddLevel(r.Context(), &level)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -597,28 +613,24 @@ func (h *Handlers) AddLesson(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	lesson := types.Lesson{}
 
-	if err = json.NewDecoder(r.Body).Decode(&lesson); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err = decodeJSON(r, &lesson); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -626,15 +638,9 @@ func (h *Handlers) AddLesson(w http.ResponseWriter, r *http.Request) {
 	lesson.SectionID = idSection
 	lesson.LevelID = idLevel
 
-	if lesson.Name == "" || lesson.Description == "" || len(lesson.Thesis) == 0 || lesson.Task == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	idLesson, err := h.srv.AddLesson(&lesson)
+	idLesson, err := h.srv.AddLesson(r.Context(), &lesson)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -646,14 +652,13 @@ func (h *Handlers) GetCourse(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	course, err := h.srv.GetCourse(idCourse)
+	course, err := h.srv.GetCourse(r.Context(), idCourse)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -665,21 +670,19 @@ func (h *Handlers) GetSection(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	section, err := h.srv.GetSection(idCourse, idSection)
+	section, err := h.srv.GetSection(r.Context(), idCourse, idSection)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -691,26 +694,23 @@ func (h *Handlers) GetLevel(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	level, err := h.srv.GetLevel(idCourse, idSection, idLevel)
+	level, err := h.srv.GetLevel(r.Context(), idCourse, idSection, idLevel)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -722,32 +722,28 @@ func (h *Handlers) GetLesson(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	lesson, err := h.srv.GetLesson(idCourse, idSection, idLevel, idLesson)
+	lesson, err := h.srv.GetLesson(r.Context(), idCourse, idSection, idLevel, idLesson)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -759,28 +755,20 @@ func (h *Handlers) UpdateCourse(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	course := types.Course{}
-	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &course); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	course.ID = idCourse
 
-	if course.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	if err := h.srv.UpdateCourse(&course); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.UpdateCourse(r.Context(), &course); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -790,35 +778,26 @@ func (h *Handlers) UpdateSection(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	section := types.Section{}
-	if err := json.NewDecoder(r.Body).Decode(&section); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &section); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	section.CourseID = idCourse
 	section.ID = idSection
 
-	if section.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	if err := h.srv.UpdateSection(&section); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.UpdateSection(r.Context(), &section); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -828,27 +807,23 @@ func (h *Handlers) UpdateLevel(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	level := types.Level{}
-	if err := json.NewDecoder(r.Body).Decode(&level); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &level); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -856,14 +831,8 @@ func (h *Handlers) UpdateLevel(w http.ResponseWriter, r *http.Request) {
 	level.SectionID = idSection
 	level.ID = idLevel
 
-	if level.Name == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	if err := h.srv.UpdateLevel(&level); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.UpdateLevel(r.Context(), &level); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -873,33 +842,28 @@ func (h *Handlers) UpdateLesson(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	lesson := types.Lesson{}
-	if err := json.NewDecoder(r.Body).Decode(&lesson); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+	if err := decodeJSON(r, &lesson); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -908,14 +872,8 @@ func (h *Handlers) UpdateLesson(w http.ResponseWriter, r *http.Request) {
 	lesson.LevelID = idLevel
 	lesson.ID = idLesson
 
-	if lesson.Name == "" || lesson.Description == "" || len(lesson.Thesis) == 0 || lesson.Task == "" {
-		logger.LogError(infrastruct.ErrorBadRequest)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
-		return
-	}
-
-	if err := h.srv.UpdateLesson(&lesson); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.UpdateLesson(r.Context(), &lesson); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -925,13 +883,12 @@ func (h *Handlers) DeleteCourse(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	if err := h.srv.DeleteCourse(idCourse); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.DeleteCourse(r.Context(), idCourse); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -941,19 +898,17 @@ func (h *Handlers) DeleteSection(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	if err := h.srv.DeleteSection(idCourse, idSection); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.DeleteSection(r.Context(), idCourse, idSection); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -963,25 +918,22 @@ func (h *Handlers) DeleteLevel(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	if err := h.srv.DeleteLevel(idCourse, idSection, idLevel); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.DeleteLevel(r.Context(), idCourse, idSection, idLevel); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -991,31 +943,27 @@ func (h *Handlers) DeleteLesson(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	if err := h.srv.DeleteLesson(idCourse, idSection, idLevel, idLesson); err != nil {
-		apiErrorEncode(w, err)
+	if err := h.srv.DeleteLesson(r.Context(), idCourse, idSection, idLevel, idLesson); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -1025,32 +973,28 @@ func (h *Handlers) GetChatForStudentByLesson(w http.ResponseWriter, r *http.Requ
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1061,9 +1005,9 @@ func (h *Handlers) GetChatForStudentByLesson(w http.ResponseWriter, r *http.Requ
 		StudentID: claims.UserID,
 	}
 
-	messages, err := h.srv.GetChatByLessonForStudent(chat)
+	messages, err := h.srv.GetChatByLessonForStudent(r.Context(), chat)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1075,32 +1019,28 @@ func (h *Handlers) SendMessageToChatByLessonForStudent(w http.ResponseWriter, r
 	query := mux.Vars(r)
 	idCourse, err := strconv.Atoi(query["idCourse"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idSection, err := strconv.Atoi(query["idSection"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLevel, err := strconv.Atoi(query["idLevel"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 	idLesson, err := strconv.Atoi(query["idLesson"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1111,16 +1051,15 @@ func (h *Handlers) SendMessageToChatByLessonForStudent(w http.ResponseWriter, r
 		StudentID: claims.UserID,
 	}
 	text := types.MessageBody{}
-	if err = json.NewDecoder(r.Body).Decode(&text); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+	if err = decodeJSON(r, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
-	text.Role = claims.Role
+	text.Role = types.RoleStudent
 	text.UserID = claims.UserID
 
-	if err = h.srv.SendMessageToChatByLessonForStudent(chat, &text); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.SendMessageToChatByLessonForStudent(r.Context(), chat, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -1130,20 +1069,19 @@ func (h *Handlers) GetChatByProfileStudent(w http.ResponseWriter, r *http.Reques
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	messages, err := h.srv.GetChatByProfileStudent(idChat, claims)
+	messages, err := h.srv.GetChatByProfileStudent(r.Context(), idChat, claims)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1155,28 +1093,26 @@ func (h *Handlers) SendMessageToChatByProfileStudent(w http.ResponseWriter, r *h
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	text := types.MessageBody{}
-	if err = json.NewDecoder(r.Body).Decode(&text); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+	if err = decodeJSON(r, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
-	text.Role = claims.Role
+	text.Role = types.RoleStudent
 	text.UserID = claims.UserID
 
-	if err = h.srv.SendMessageToChatByProfileStudent(idChat, &text); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.SendMessageToChatByProfileStudent(r.Context(), idChat, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -1187,20 +1123,19 @@ func (h *Handlers) GetChatForTeacher(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	messages, err := h.srv.GetChatForTeacher(idChat, claims)
+	messages, err := h.srv.GetChatForTeacher(r.Context(), idChat, claims)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1212,14 +1147,13 @@ func (h *Handlers) GetChatForAdmin(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	messages, err := h.srv.GetChatForAdmin(idChat)
+	messages, err := h.srv.GetChatForAdmin(r.Context(), idChat)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1232,28 +1166,26 @@ func (h *Handlers) SendMessageToChatForTeacher(w http.ResponseWriter, r *http.Re
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	text := types.MessageBody{}
-	if err = json.NewDecoder(r.Body).Decode(&text); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+	if err = decodeJSON(r, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
-	text.Role = claims.Role
+	text.Role = types.RoleTeacher
 	text.UserID = claims.UserID
 
-	if err = h.srv.SendMessageToChatForTeacher(idChat, &text); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.SendMessageToChatForTeacher(r.Context(), idChat, &text); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -1262,13 +1194,13 @@ func (h Handlers) GetAllChatsForStudent(w http.ResponseWriter, r *http.Request)
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	previewChats, err := h.srv.GetAllChatsForStudent(claims.UserID)
+	previewChats, err := h.srv.GetAllChatsForStudent(r.Context(), claims.UserID)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1279,13 +1211,13 @@ func (h Handlers) GetAllChatsForTeacher(w http.ResponseWriter, r *http.Request)
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	previewChats, err := h.srv.GetAllChatsForTeacher(claims.UserID)
+	previewChats, err := h.srv.GetAllChatsForTeacher(r.Context(), claims.UserID)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1297,14 +1229,13 @@ func (h Handlers) GetAllChatsForAdmin(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idTeacher, err := strconv.Atoi(query["idTeacher"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
-	previewChats, err := h.srv.GetAllChatsForAdmin(idTeacher)
+	previewChats, err := h.srv.GetAllChatsForAdmin(r.Context(), idTeacher)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
@@ -1316,21 +1247,20 @@ func (h *Handlers) Ahtung(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	ahtung := &types.Ahtung{ChatID: idChat, TeacherID: claims.UserID}
 
-	if err = h.srv.Ahtung(ahtung); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.Ahtung(r.Context(), ahtung); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
@@ -1340,49 +1270,77 @@ func (h *Handlers) Rating(w http.ResponseWriter, r *http.Request) {
 	query := mux.Vars(r)
 	idChat, err := strconv.Atoi(query["idChat"])
 	if err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorBadRequest)
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
 		return
 	}
 
 	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	rating := &types.Rating{}
-	if err = json.NewDecoder(r.Body).Decode(&rating); err != nil {
-		logger.LogError(err)
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+	if err = decodeJSON(r, rating); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
 	rating.TeacherID = claims.UserID
 	rating.ChatID = idChat
 
-	if err = h.srv.Rating(rating); err != nil {
-		apiErrorEncode(w, err)
+	if err = h.srv.Rating(r.Context(), rating); err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 }
 
-func apiErrorEncode(w http.ResponseWriter, err error) {
+// apiErrorEncode отдает ошибку на языке из Accept-Language. Ошибки не из infrastruct
+// отдаются как внутренняя ошибка, причина обернутых ошибок пишется в лог
+func apiErrorEncode(w http.ResponseWriter, r *http.Request, err error) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	if customError, ok := err.(*infrastruct.CustomError); ok {
-		w.WriteHeader(customError.Code)
-	}
-
-	result := struct {
-		Err string `json:"error"`
-	}{
-		Err: err.Error(),
+	lang := infrastruct.Lang(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+
+	var customError *infrastruct.CustomError
+	var fields []infrastruct.FieldError
+	switch e := err.(type) {
+	case *infrastruct.CustomError:
+		customError = e
+	case *infrastruct.RetryError:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		customError = e.CustomError
+	case *infrastruct.ValidationError:
+		customError = e.CustomError
+		for _, field := range e.Fields {
+			fields = append(fields, field.Localize(lang))
+		}
+	default:
+		customError = infrastruct.ErrorInternalServerError.Wrap(err)
+	}
+	if cause := customError.Unwrap(); cause != nil {
+		logger.LogErrorCtx(r.Context(), cause)
+	}
+
+	result := types.Error{
+		Err:    customError.Message(lang),
+		Code:   customError.Key(),
+		Fields: fields,
+	}
+
+	w.WriteHeader(customError.Code)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.LogErrorCtx(r.Context(), err)
 	}
+}
 
-	if err = json.NewEncoder(w).Encode(result); err != nil {
-		logger.LogError(err)
+// decodeJSON читает тело запроса в v и проверяет его по тегам validate до вызова сервиса.
+// Ошибку можно сразу отдавать в apiErrorEncode
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return infrastruct.ErrorBadRequest.Wrap(err)
 	}
+	return validate.Struct(v)
 }
 
 func apiResponseEncoder(w http.ResponseWriter, res interface{}) {
@@ -1391,3 +1349,49 @@ func apiResponseEncoder(w http.ResponseWriter, res interface{}) {
 		logger.LogError(err)
 	}
 }
+
+// clientIP - адрес клиента. Заголовкам X-Forwarded-For и X-Real-IP верим, только если запрос пришел от прокси
+// из trusted_proxies, в X-Forwarded-For берем последний адрес перед цепочкой доверенных прокси
+func (h *Handlers) clientIP(r *http.Request) string {
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !h.trustedProxy(remote) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if i == 0 || !h.trustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remote
+}
+
+func (h *Handlers) trustedProxy(addr string) bool {
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range h.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"github.com/tarasova-school/internal/types/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+
+	cnf := config.Defaults()
+	cnf.Server = &config.Server{TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16"}}
+	h := NewHandlers(nil, cnf, nil)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{name: "direct", remote: "1.2.3.4:5000", want: "1.2.3.4"},
+		{name: "spoofed forwarded", remote: "1.2.3.4:5000", forwarded: "5.6.7.8", want: "1.2.3.4"},
+		{name: "spoofed real ip", remote: "1.2.3.4:5000", realIP: "5.6.7.8", want: "1.2.3.4"},
+		{name: "proxy", remote: "10.0.0.1:5000", forwarded: "5.6.7.8", want: "5.6.7.8"},
+		{name: "proxy chain", remote: "10.0.0.1:5000", forwarded: "5.6.7.8, 192.168.1.1", want: "5.6.7.8"},
+		{name: "client prepends", remote: "10.0.0.1:5000", forwarded: "9.9.9.9, 5.6.7.8", want: "5.6.7.8"},
+		{name: "proxy real ip", remote: "10.0.0.1:5000", realIP: "5.6.7.8", want: "5.6.7.8"},
+		{name: "proxy garbage", remote: "10.0.0.1:5000", forwarded: "garbage", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := h.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unmatchedRoute - метка для запросов мимо роутов, чтобы произвольные пути не плодили ряды метрик
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = metrics.NewCounterVec("school_http_requests_total",
+		"HTTP запросы", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("school_http_request_duration_seconds",
+		"Время обработки HTTP запросов", metrics.DefaultBuckets, "method", "route")
+	videoBytesServed = metrics.NewCounterVec("school_video_bytes_served_total",
+		"Отданные байты видео уроков")
+	deprecatedRequests = metrics.NewCounterVec("school_http_deprecated_requests_total",
+		"Запросы на старые адреса api", "method", "route")
+)
+
+func observeRequest(method, route string, matched bool, status int, latency time.Duration) {
+	if !matched {
+		route = unmatchedRoute
+	}
+	httpRequests.Inc(method, route, strconv.Itoa(status))
+	httpDuration.Observe(latency.Seconds(), method, route)
+}
+
+// MetricsOnMainPort - отдавать ли /metrics на основном порту: только с токеном и без отдельного адреса
+func (h *Handlers) MetricsOnMainPort() bool {
+	return h.metrics.Listen == "" && h.metrics.Token != ""
+}
+
+// Metrics отдает метрики Prometheus, если задан metrics.token, проверяет Authorization: Bearer
+func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
+
+	if h.metrics.Token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.metrics.Token)) != 1 {
+			apiErrorEncode(w, r, infrastruct.ErrorPermissionDenied)
+			return
+		}
+	}
+
+	//без сервиса, как в тестах роутера, отдаются только метрики пакетов
+	var registry *metrics.Registry
+	if h.srv != nil {
+		registry = h.srv.Metrics()
+	}
+	metrics.Handler(registry).ServeHTTP(w, r)
+}
@@ -1,25 +1,124 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"github.com/gorilla/mux"
 	"github.com/tarasova-school/internal/types"
 	"github.com/tarasova-school/pkg/infrastruct"
 	"github.com/tarasova-school/pkg/logger"
 	"net/http"
+	"regexp"
+	"time"
 )
 
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRegexp - id от nginx или клиента принимаем, только если он похож на id, иначе выдаем свой
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// RequestLogger выдает запросу X-Request-ID, кладет в контекст логгер запроса и пишет access log.
+// Оборачивает роутер целиком, чтобы 404 и 405 тоже попадали в лог и метрики: middleware роутера mux вызывает
+// только для найденных роутов. Шаблон роута запоминает CaptureRoute
+func (h *Handlers) RequestLogger(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDRegexp.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		var userID int
+		if claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey); err == nil {
+			userID = claims.UserID
+		}
+		ctx := logger.NewContext(r.Context(), requestID, userID)
+		matched := &matchedRoute{}
+		ctx = context.WithValue(ctx, matchedRouteKey{}, matched)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r.WithContext(ctx))
+
+		latency := time.Since(start)
+		route := r.URL.Path
+		if matched.ok {
+			route = matched.template
+		}
+		observeRequest(r.Method, route, matched.ok, rec.status, latency)
+		logger.FromContext(ctx).Info().
+			Str("method", r.Method).
+			Str("route", route).
+			Int("status", rec.status).
+			Int("bytes", rec.bytes).
+			Float64("latency_ms", float64(latency.Microseconds())/1000).
+			Msg("request")
+	})
+}
+
+type matchedRouteKey struct{}
+
+// matchedRoute - шаблон роута, который нашел mux. RequestLogger стоит снаружи роутера и видит запрос
+// до того, как mux положит в него роут, поэтому шаблон передается через указатель в контексте
+type matchedRoute struct {
+	template string
+	ok       bool
+}
+
+// CaptureRoute запоминает для RequestLogger шаблон найденного роута, ставится первым middleware роутера
+func (h *Handlers) CaptureRoute(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matched, ok := r.Context().Value(matchedRouteKey{}).(*matchedRoute); ok {
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					matched.template, matched.ok = template, true
+				}
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder запоминает статус и размер ответа для access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
 func (h *Handlers) RecoverPanic(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 
-			r := recover()
-			if r == nil {
+			rec := recover()
+			if rec == nil {
 				return
 			}
 
-			err := fmt.Errorf("PANIC:'%v'\nRecovered in: %s", r, infrastruct.IdentifyPanic())
-			logger.LogError(err)
-			apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+			err := fmt.Errorf("PANIC:'%v'\nRecovered in: %s", rec, infrastruct.IdentifyPanic())
+			apiErrorEncode(w, r, infrastruct.ErrorInternalServerError.Wrap(err))
 		}()
 
 		handler.ServeHTTP(w, r)
@@ -27,16 +126,35 @@ func (h *Handlers) RecoverPanic(handler http.Handler) http.Handler {
 	})
 }
 
-func (h *Handlers) CheckRoleTeacher(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
-		if err != nil {
-			apiErrorEncode(w, err)
-			return
-		}
+// CheckPermission пускает только роли, которым в таблице role_permissions выдано право permission
+func (h *Handlers) CheckPermission(permission string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+			if err != nil {
+				apiErrorEncode(w, r, err)
+				return
+			}
 
-		if claims.Role != types.RoleTeacher {
-			apiErrorEncode(w, infrastruct.ErrorPermissionDenied)
+			ok, err := h.srv.HasPermission(r.Context(), claims.Role, permission)
+			if err != nil {
+				apiErrorEncode(w, r, err)
+				return
+			}
+			if !ok {
+				apiErrorEncode(w, r, infrastruct.ErrorPermissionDenied)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h *Handlers) CheckAuthorized(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := infrastruct.GetClaimsByRequest(r, h.secretKey); err != nil {
+			apiErrorEncode(w, r, err)
 			return
 		}
 
@@ -44,33 +162,34 @@ func (h *Handlers) CheckRoleTeacher(handler http.Handler) http.Handler {
 	})
 }
 
-func (h *Handlers) CheckRoleAdmin(handler http.Handler) http.Handler {
+func (h *Handlers) RecordRequest(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 		if err != nil {
-			apiErrorEncode(w, err)
+			handler.ServeHTTP(w, r)
 			return
 		}
 
-		if claims.Role != types.RoleAdmin {
-			apiErrorEncode(w, infrastruct.ErrorPermissionDenied)
-			return
+		if err := h.srv.RecordTime(r.Context(), &types.RecordTime{
+			UserID:     claims.UserID,
+			RequestURL: r.RequestURI,
+		}); err != nil {
+			logger.LogErrorCtx(r.Context(), err)
 		}
 
 		handler.ServeHTTP(w, r)
 	})
 }
 
-func (h *Handlers) CheckRoleStudent(handler http.Handler) http.Handler {
+func (h *Handlers) CheckUserInDBUsers(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 		if err != nil {
-			apiErrorEncode(w, err)
+			handler.ServeHTTP(w, r)
 			return
 		}
-
-		if claims.Role != types.RoleStudent {
-			apiErrorEncode(w, infrastruct.ErrorPermissionDenied)
+		if err = h.srv.CheckUserInDBUsers(r.Context(), claims); err != nil {
+			apiErrorEncode(w, r, err)
 			return
 		}
 
@@ -78,16 +197,16 @@ func (h *Handlers) CheckRoleStudent(handler http.Handler) http.Handler {
 	})
 }
 
-func (h *Handlers) CheckRoleAdminAndTeacher(handler http.Handler) http.Handler {
+// CheckEmailVerified пускает неподтвержденных пользователей по политике: GET считается чтением, остальное записью
+func (h *Handlers) CheckEmailVerified(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 		if err != nil {
-			apiErrorEncode(w, err)
+			apiErrorEncode(w, r, err)
 			return
 		}
-
-		if claims.Role != types.RoleAdmin && claims.Role != types.RoleTeacher {
-			apiErrorEncode(w, infrastruct.ErrorPermissionDenied)
+		if err = h.srv.CheckEmailVerified(r.Context(), claims.UserID, r.Method != http.MethodGet); err != nil {
+			apiErrorEncode(w, r, err)
 			return
 		}
 
@@ -95,37 +214,67 @@ func (h *Handlers) CheckRoleAdminAndTeacher(handler http.Handler) http.Handler {
 	})
 }
 
-func (h *Handlers) RecordRequest(handler http.Handler) http.Handler {
+// CheckStepUp - для опасных действий нужен свежий step-up токен из /users/2fa/step-up в заголовке X-step-up-token,
+// каждый токен годится на одно действие
+func (h *Handlers) CheckStepUp(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 		if err != nil {
-			handler.ServeHTTP(w, r)
+			apiErrorEncode(w, r, err)
 			return
 		}
-
-		if err := h.srv.RecordTime(&types.RecordTime{
-			UserID:     claims.UserID,
-			RequestURL: r.RequestURI,
-		}); err != nil {
-			logger.LogError(err)
+		if err = h.srv.CheckStepUp(r.Context(), claims.UserID, r.Header.Get("X-step-up-token")); err != nil {
+			apiErrorEncode(w, r, err)
+			return
 		}
 
 		handler.ServeHTTP(w, r)
 	})
 }
 
-func (h *Handlers) CheckUserInDBUsers(handler http.Handler) http.Handler {
+// DenyImpersonation - с токеном входа от имени пользователя нельзя менять его пароль, 2FA и привязки соцсетей
+func (h *Handlers) DenyImpersonation(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 		if err != nil {
-			handler.ServeHTTP(w, r)
+			apiErrorEncode(w, r, err)
 			return
 		}
-		if err = h.srv.CheckUserInDBUsers(claims.UserID); err != nil {
-			apiErrorEncode(w, err)
+		if claims.ImpersonatorID != 0 {
+			apiErrorEncode(w, r, infrastruct.ErrorPermissionDenied)
 			return
 		}
 
 		handler.ServeHTTP(w, r)
 	})
 }
+
+// Deprecated помечает ответы на старые адреса из legacy заголовком Deprecation, в Link отдает новый адрес.
+// Стоит на корневом роутере, чтобы заголовок был и в ошибках авторизации
+func (h *Handlers) Deprecated(legacy map[*mux.Route]*mux.Route) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := mux.CurrentRoute(r)
+			successor, ok := legacy[current]
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Deprecation", "true")
+			vars := mux.Vars(r)
+			pairs := make([]string, 0, len(vars)*2)
+			for key, value := range vars {
+				pairs = append(pairs, key, value)
+			}
+			if url, err := successor.URLPath(pairs...); err == nil {
+				w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", url.Path))
+			}
+			if template, err := current.GetPathTemplate(); err == nil {
+				deprecatedRequests.Inc(r.Method, template)
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) GetLessonByID(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idLesson, err := strconv.Atoi(query["idLesson"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	lesson, err := h.srv.GetLessonByID(r.Context(), idLesson)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, lesson)
+}
+
+func (h *Handlers) GetLevelByID(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idLevel, err := strconv.Atoi(query["idLevel"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	level, err := h.srv.GetLevelByID(r.Context(), idLevel)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, level)
+}
+
+func (h *Handlers) GetChatByID(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idChat, err := strconv.Atoi(query["idChat"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	chat, err := h.srv.GetChatByID(r.Context(), idChat, claims)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, chat)
+}
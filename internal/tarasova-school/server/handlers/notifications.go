@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) GetNotifications(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.FormValue("limit"))
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	unreadOnly := r.FormValue("unread") == "true"
+
+	feed, err := h.srv.GetNotifications(r.Context(), claims.UserID, unreadOnly, limit, offset)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, feed)
+}
+
+func (h *Handlers) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+
+	query := mux.Vars(r)
+	idNotification, err := strconv.Atoi(query["idNotification"])
+	if err != nil {
+		apiErrorEncode(w, r, infrastruct.ErrorBadRequest.Wrap(err))
+		return
+	}
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.MarkNotificationRead(r.Context(), claims.UserID, idNotification); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.MarkAllNotificationsRead(r.Context(), claims.UserID); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	settings, err := h.srv.GetNotificationSettings(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, settings)
+}
+
+func (h *Handlers) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	settings := types.NotificationSettings{}
+	if err = decodeJSON(r, &settings); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.UpdateNotificationSettings(r.Context(), claims.UserID, &settings); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) StartTelegramLink(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	link, err := h.srv.StartTelegramLink(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, link)
+}
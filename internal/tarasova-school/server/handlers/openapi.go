@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/pkg/openapi"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// docsPage - swagger ui, статика отдается из docs_directory_path через DocsAsset, спецификация с /openapi.json
+const docsPage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8">
+  <title>Tarasova school API</title>
+  <link rel="stylesheet" href="/docs/swagger-ui/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="/docs/swagger-ui/swagger-ui-bundle.js"></script>
+<script>
+  SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+// docsAssets - файлы swagger ui, которые кладет deploy/swagger-ui.sh, остальное в каталоге не отдается
+var docsAssets = map[string]bool{
+	"swagger-ui.css":       true,
+	"swagger-ui-bundle.js": true,
+}
+
+// SetOpenAPI - спецификация строится по роутеру уже после создания хендлеров, см. server.NewRouter
+func (h *Handlers) SetOpenAPI(doc *openapi.Document) error {
+
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "err with Marshal openapi")
+	}
+	h.openapi, h.spec = doc, spec
+
+	return nil
+}
+
+// OpenAPISpec - спецификация в json, пустая до NewRouter
+func (h *Handlers) OpenAPISpec() []byte {
+	return h.spec
+}
+
+func (h *Handlers) OpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(h.spec)
+}
+
+func (h *Handlers) Docs(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(docsPage))
+}
+
+func (h *Handlers) DocsAsset(w http.ResponseWriter, r *http.Request) {
+
+	file := mux.Vars(r)["file"]
+	if !docsAssets[file] {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(h.cnf.DocsDir, file))
+}
+
+// CheckDocs сверяет статику swagger ui в docs_directory_path с SHA256SUMS, который пишет deploy/swagger-ui.sh.
+// Без файлов /docs - пустая страница, поэтому их отсутствие видно в /readyz
+func (h *Handlers) CheckDocs() error {
+
+	f, err := os.Open(filepath.Join(h.cnf.DocsDir, "SHA256SUMS"))
+	if err != nil {
+		return errors.Wrap(err, "err with Open SHA256SUMS")
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			sums[fields[1]] = fields[0]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.Wrap(err, "err with read SHA256SUMS")
+	}
+
+	for file := range docsAssets {
+		want, ok := sums[file]
+		if !ok {
+			return errors.Errorf("%s is not in SHA256SUMS", file)
+		}
+		got, err := fileSHA256(filepath.Join(h.cnf.DocsDir, file))
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return errors.Errorf("%s sha256 %s does not match SHA256SUMS", file, got)
+		}
+	}
+
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "err with Open")
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", errors.Wrap(err, "err with read")
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
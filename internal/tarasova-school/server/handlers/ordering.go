@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) ReorderSection(w http.ResponseWriter, r *http.Request) {
+
+	ids, err := contentIDs(r, "idCourse", "idSection")
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	placement := types.Placement{}
+	if err := decodeJSON(r, &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err := h.srv.ReorderSection(r.Context(), ids[0], ids[1], &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, placement)
+}
+
+func (h *Handlers) ReorderLevel(w http.ResponseWriter, r *http.Request) {
+
+	ids, err := contentIDs(r, "idCourse", "idSection", "idLevel")
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	placement := types.Placement{}
+	if err := decodeJSON(r, &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err := h.srv.ReorderLevel(r.Context(), ids[0], ids[1], ids[2], &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, placement)
+}
+
+func (h *Handlers) ReorderLesson(w http.ResponseWriter, r *http.Request) {
+
+	ids, err := contentIDs(r, "idCourse", "idSection", "idLevel", "idLesson")
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	placement := types.Placement{}
+	if err := decodeJSON(r, &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err := h.srv.ReorderLesson(r.Context(), ids[0], ids[1], ids[2], ids[3], &placement); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, placement)
+}
+
+func (h *Handlers) MoveLesson(w http.ResponseWriter, r *http.Request) {
+
+	ids, err := contentIDs(r, "idCourse", "idSection", "idLevel", "idLesson")
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	move := types.MoveLesson{}
+	if err := decodeJSON(r, &move); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	placement, err := h.srv.MoveLesson(r.Context(), ids[0], ids[1], ids[2], ids[3], &move)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, placement)
+}
+
+// contentIDs - id из пути по порядку names
+func contentIDs(r *http.Request, names ...string) ([]int, error) {
+
+	query := mux.Vars(r)
+	ids := make([]int, len(names))
+	for i, name := range names {
+		id, err := strconv.Atoi(query[name])
+		if err != nil {
+			return nil, infrastruct.ErrorBadRequest.Wrap(err)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
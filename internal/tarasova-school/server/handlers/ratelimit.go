@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"github.com/tarasova-school/pkg/metrics"
+	"github.com/tarasova-school/pkg/ratelimit"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var rateLimited = metrics.NewCounterVec("school_rate_limited_total",
+	"Запросы, отклоненные ограничением частоты", "policy")
+
+// RateLimit ограничивает частоту запросов к handler по политике policy, лимиты считаются по ip,
+// пользователю из токена и email из тела запроса
+func (h *Handlers) RateLimit(policy string, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		keys := ratelimit.Keys{ratelimit.ByIP: h.clientIP(r)}
+		if claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey); err == nil {
+			keys[ratelimit.ByUser] = strconv.Itoa(claims.UserID)
+		}
+		if email := requestEmail(r); email != "" {
+			keys[ratelimit.ByEmail] = email
+		}
+
+		allowed, retryAfter, err := h.limiter.Allow(r.Context(), policy, keys)
+		if err != nil {
+			//если хранилище лимитов недоступно, запрос пропускаем, чтобы не закрыть вход всем
+			logger.LogErrorCtx(r.Context(), err)
+		} else if !allowed {
+			rateLimited.Inc(policy)
+			apiErrorEncode(w, r, infrastruct.NewRetryError(infrastruct.ErrorTooManyRequests, retryAfter))
+			return
+		}
+
+		handler(w, r)
+	})
+}
+
+// requestEmail - email из json тела запроса, тело остается доступным обработчику
+func requestEmail(r *http.Request) string {
+
+	body := auditRequestBody(r)
+	if body == nil {
+		return ""
+	}
+	data := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(data.Email))
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"net/http"
+)
+
+func (h *Handlers) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	apiResponseEncoder(w, h.srv.GetPermissions())
+}
+
+func (h *Handlers) GetRoles(w http.ResponseWriter, r *http.Request) {
+
+	roles, err := h.srv.GetRoles(r.Context())
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, roles)
+}
+
+func (h *Handlers) CreateRole(w http.ResponseWriter, r *http.Request) {
+
+	role := types.Role{}
+	if err := decodeJSON(r, &role); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err := h.srv.CreateRole(r.Context(), &role); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, role)
+}
+
+func (h *Handlers) UpdateRole(w http.ResponseWriter, r *http.Request) {
+
+	role := types.Role{}
+	if err := decodeJSON(r, &role); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+	role.Name = mux.Vars(r)["name"]
+
+	if err := h.srv.UpdateRole(r.Context(), &role); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, role)
+}
+
+func (h *Handlers) DeleteRole(w http.ResponseWriter, r *http.Request) {
+
+	if err := h.srv.DeleteRole(r.Context(), mux.Vars(r)["name"]); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
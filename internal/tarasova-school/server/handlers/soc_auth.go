@@ -1,74 +1,126 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/pkg/errors"
-	"github.com/tarasova-school/internal/types"
+	"github.com/gorilla/mux"
 	"github.com/tarasova-school/pkg/infrastruct"
 	"github.com/tarasova-school/pkg/logger"
 	"net/http"
+	"time"
 )
 
-func (h *Handlers) VKCallback(w http.ResponseWriter, r *http.Request) {
-	errVK := r.FormValue("error")
-	errVKDesc := r.FormValue("error_description")
+// oauthNonceCookie - nonce входа через соцсеть, callback принимается только из браузера, который начал вход
+const oauthNonceCookie = "oauth_nonce"
+
+func (h *Handlers) OAuthLogin(w http.ResponseWriter, r *http.Request) {
+
+	redirect, err := h.srv.OAuthLoginURL(r.Context(), mux.Vars(r)["provider"], 0)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	setOAuthNonce(w, redirect.Nonce, h.srv.OAuthStateTTL())
+	apiResponseEncoder(w, redirect)
+}
+
+func (h *Handlers) OAuthLink(w http.ResponseWriter, r *http.Request) {
 
-	if errVK != "" {
-		logger.LogError(fmt.Errorf("err with auth vk, err:%s\n%s", errVK, errVKDesc))
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
 	}
 
-	code := r.FormValue("code")
-	accessURL := fmt.Sprintf("https://oauth.vk.com/access_token?client_id=%s&client_secret=%s&redirect_uri=https://tarasova-school.ru/api/vk/callback&code=%s", h.soc.VKAppID, h.soc.VKSecretKey, code)
-	res, err := http.Get(accessURL)
+	redirect, err := h.srv.OAuthLoginURL(r.Context(), mux.Vars(r)["provider"], claims.UserID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with http.Get accessURL"))
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	accessToken := struct {
-		AccessToken string `json:"access_token"`
-		Email       string `json:"email"`
-	}{}
+	setOAuthNonce(w, redirect.Nonce, h.srv.OAuthStateTTL())
+	apiResponseEncoder(w, redirect)
+}
+
+func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	h.oauthCallback(w, r, mux.Vars(r)["provider"])
+}
+
+// VKCallback - старый адрес callback, он прописан в настройках приложения vk
+func (h *Handlers) VKCallback(w http.ResponseWriter, r *http.Request) {
+	h.oauthCallback(w, r, "vk")
+}
+
+func (h *Handlers) oauthCallback(w http.ResponseWriter, r *http.Request, provider string) {
 
-	if err = json.NewDecoder(res.Body).Decode(&accessToken); err != nil {
-		logger.LogError(errors.Wrap(err, "err with Decode access token"))
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+	if errOAuth := r.FormValue("error"); errOAuth != "" {
+		logger.LogErrorCtx(r.Context(), fmt.Errorf("err with auth %s, err:%s\n%s", provider, errOAuth, r.FormValue("error_description")))
+		apiErrorEncode(w, r, infrastruct.ErrorOAuthStateInvalid)
 		return
 	}
 
-	getUserURL := fmt.Sprintf("https://api.vk.com/method/users.get?fields=bdate&access_token=%s&v=5.124", accessToken.AccessToken)
+	nonce := ""
+	if cookie, err := r.Cookie(oauthNonceCookie); err == nil {
+		nonce = cookie.Value
+	}
+	//nonce одноразовый, как и state
+	setOAuthNonce(w, "", -1)
 
-	res, err = http.Get(getUserURL)
+	token, err := h.srv.OAuthCallback(r.Context(), provider, r.FormValue("code"), r.FormValue("state"), nonce)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with Get getUserURL"))
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	firstName := struct {
-		Response []struct {
-			FirstName string `json:"first_name"`
-		}
-	}{}
+	apiResponseEncoder(w, token)
+}
 
-	if err = json.NewDecoder(res.Body).Decode(&firstName); err != nil {
-		logger.LogError(errors.Wrap(err, "err with Decode first name"))
-		apiErrorEncode(w, infrastruct.ErrorInternalServerError)
+func (h *Handlers) GetUserIdentities(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	auth := &types.AuthorizeVK{Email: accessToken.Email}
-	if len(firstName.Response) > 0 {
-		auth.Firstname = firstName.Response[0].FirstName
+	identities, err := h.srv.GetUserIdentities(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
 	}
 
-	token, err := h.srv.AuthorizeVK(auth)
+	apiResponseEncoder(w, identities)
+}
+
+func (h *Handlers) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
 	if err != nil {
-		apiErrorEncode(w, err)
+		apiErrorEncode(w, r, err)
 		return
 	}
 
-	apiResponseEncoder(w, token)
+	if err = h.srv.UnlinkIdentity(r.Context(), claims.UserID, mux.Vars(r)["provider"]); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+// setOAuthNonce ставит cookie с nonce, ttl меньше 0 удаляет ее. SameSite=Lax: возврат от провайдера - переход
+// с чужого сайта, со Strict браузер cookie не пришлет
+func setOAuthNonce(w http.ResponseWriter, nonce string, ttl time.Duration) {
+
+	cookie := &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if ttl < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
 }
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+)
+
+func (h *Handlers) AuthorizeTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	login := types.TwoFactorLogin{}
+	if err := decodeJSON(r, &login); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	token, err := h.srv.AuthorizeTwoFactor(r.Context(), &login)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, token)
+}
+
+func (h *Handlers) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	status, err := h.srv.GetTwoFactorStatus(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, status)
+}
+
+func (h *Handlers) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	setup, err := h.srv.SetupTwoFactor(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, setup)
+}
+
+func (h *Handlers) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	claims, code, err := h.twoFactorCodeByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	codes, err := h.srv.EnableTwoFactor(r.Context(), claims.UserID, code)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, codes)
+}
+
+func (h *Handlers) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	claims, code, err := h.twoFactorCodeByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.DisableTwoFactor(r.Context(), claims.UserID, code); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) StepUp(w http.ResponseWriter, r *http.Request) {
+
+	claims, code, err := h.twoFactorCodeByRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	token, err := h.srv.StepUp(r.Context(), claims.UserID, code)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, token)
+}
+
+func (h *Handlers) twoFactorCodeByRequest(r *http.Request) (*infrastruct.CustomClaims, string, error) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	code := types.TwoFactorCode{}
+	if err = decodeJSON(r, &code); err != nil {
+		return nil, "", err
+	}
+
+	return claims, code.Code, nil
+}
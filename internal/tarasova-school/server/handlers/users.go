@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handlers) ChangeUserRole(w http.ResponseWriter, r *http.Request) {
+
+	idUser, claims, err := h.adminUserRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	change := types.UserRoleChange{}
+	if err = decodeJSON(r, &change); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.ChangeUserRole(r.Context(), claims.UserID, idUser, change.Role); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) SuspendUser(w http.ResponseWriter, r *http.Request) {
+
+	idUser, claims, err := h.adminUserRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	suspend := types.UserSuspend{}
+	if err = decodeJSON(r, &suspend); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.SuspendUser(r.Context(), claims.UserID, idUser, suspend.Reason); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+
+	idUser, claims, err := h.adminUserRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.UnsuspendUser(r.Context(), claims.UserID, idUser); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) ForceLogout(w http.ResponseWriter, r *http.Request) {
+
+	idUser, claims, err := h.adminUserRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.ForceLogout(r.Context(), claims.UserID, idUser); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) Impersonate(w http.ResponseWriter, r *http.Request) {
+
+	idUser, claims, err := h.adminUserRequest(r)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	impersonate := types.Impersonate{}
+	if err = decodeJSON(r, &impersonate); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	token, err := h.srv.Impersonate(r.Context(), claims.UserID, idUser, impersonate.Reason)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, token)
+}
+
+// adminUserRequest достает id пользователя из пути и claims админа
+func (h *Handlers) adminUserRequest(r *http.Request) (int, *infrastruct.CustomClaims, error) {
+
+	idUser, err := strconv.Atoi(mux.Vars(r)["idUser"])
+	if err != nil {
+		return 0, nil, infrastruct.ErrorBadRequest.Wrap(err)
+	}
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return idUser, claims, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+)
+
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	verify := types.VerifyEmail{}
+	if err := decodeJSON(r, &verify); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err := h.srv.VerifyEmail(r.Context(), verify.Token); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
+
+func (h *Handlers) GetEmailVerificationStatus(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	status, err := h.srv.GetEmailVerificationStatus(r.Context(), claims.UserID)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	apiResponseEncoder(w, status)
+}
+
+func (h *Handlers) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+
+	claims, err := infrastruct.GetClaimsByRequest(r, h.secretKey)
+	if err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+
+	if err = h.srv.ResendEmailVerification(r.Context(), claims.UserID); err != nil {
+		apiErrorEncode(w, r, err)
+		return
+	}
+}
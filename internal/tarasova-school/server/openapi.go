@@ -0,0 +1,319 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/openapi"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	securityToken  = "apiToken"
+	securityStepUp = "stepUpToken"
+
+	contentCSV   = "text/csv"
+	contentXLSX  = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	contentText  = "text/plain"
+	contentHTML  = "text/html"
+	contentCSS   = "text/css"
+	contentJS    = "application/javascript"
+	contentVideo = "video/mp4"
+)
+
+// access - кто может вызвать роуты подроутера, записывается при создании подроутера в NewRouter
+type access struct {
+	auth       bool
+	permission string
+	stepUp     bool
+}
+
+// routeDoc - описание роута для openapi. request и response - значения типов тела запроса и ответа,
+// content - типы ответа не в json, optional - роут есть не во всех конфигурациях
+type routeDoc struct {
+	summary  string
+	tag      string
+	query    []openapi.Parameter
+	request  interface{}
+	upload   string
+	response interface{}
+	content  []string
+	statuses map[int]interface{}
+	optional bool
+}
+
+func query(name, typ, description string, enum ...string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description,
+		Schema: &openapi.Schema{Type: typ, Enum: enum}}
+}
+
+var (
+	periodQuery = []openapi.Parameter{
+		query("from", "string", "начало периода включительно, 2006-01-02"),
+		query("to", "string", "конец периода включительно, 2006-01-02"),
+	}
+	exportQuery = append([]openapi.Parameter{query("format", "string", "формат файла, по умолчанию csv", "csv", "xlsx")}, periodQuery...)
+	oauthQuery  = []openapi.Parameter{
+		query("code", "string", "код авторизации от провайдера"),
+		query("state", "string", "state из адреса входа"),
+		query("error", "string", "ошибка от провайдера"),
+	}
+)
+
+// routeDocs - описание всех роутов, ключ - метод и путь в формате openapi, старые адреса описываются по новому роуту.
+// Роут без описания или описание без роута - ошибка при старте, так спецификация не отстает от роутера
+var routeDocs = map[string]routeDoc{
+	"GET /ping":                   {summary: "Проверка связи", tag: "system", content: []string{contentText}},
+	"GET /healthz":                {summary: "Liveness", tag: "system", content: []string{contentText}},
+	"GET /readyz":                 {summary: "Readiness", tag: "system", response: types.Readiness{}, statuses: map[int]interface{}{http.StatusServiceUnavailable: types.Readiness{}}},
+	"GET /metrics":                {summary: "Метрики Prometheus", tag: "system", content: []string{contentText}, optional: true},
+	"GET /openapi.json":           {summary: "Эта спецификация", tag: "system", response: map[string]interface{}{}},
+	"GET /docs":                   {summary: "Swagger UI", tag: "system", content: []string{contentHTML}},
+	"GET /docs/swagger-ui/{file}": {summary: "Статика Swagger UI", tag: "system", content: []string{contentCSS, contentJS}},
+
+	"POST /v1/auth/login":                   {summary: "Вход по email и паролю", tag: "auth", request: types.Authorize{}, response: types.Token{}},
+	"POST /v1/auth/login/2fa":               {summary: "Второй шаг входа кодом 2FA", tag: "auth", request: types.TwoFactorLogin{}, response: types.Token{}},
+	"POST /v1/auth/register":                {summary: "Регистрация ученика", tag: "auth", request: types.User{}, response: types.Token{}},
+	"POST /v1/auth/email/verify":            {summary: "Подтверждение email по токену из письма", tag: "auth", request: types.VerifyEmail{}},
+	"GET /v1/me/email":                      {summary: "Статус подтверждения email", tag: "auth", response: types.EmailVerificationStatus{}},
+	"POST /v1/me/email/resend":              {summary: "Отправить письмо подтверждения еще раз", tag: "auth"},
+	"POST /v1/auth/password/change":         {summary: "Смена пароля", tag: "auth", request: types.ChangePassword{}},
+	"POST /v1/auth/password/recovery":       {summary: "Отправить код восстановления пароля", tag: "auth", request: types.RecoveryPasswordEmail{}},
+	"POST /v1/auth/password/recovery/check": {summary: "Проверить код восстановления", tag: "auth", request: types.RecoveryPasswordEmailAndCode{}, response: types.CheckCode{}},
+	"POST /v1/auth/password/recovery/new":   {summary: "Новый пароль по коду восстановления", tag: "auth", request: types.RecoveryPasswordNewPass{}},
+
+	"GET /vk/callback":                    {summary: "Возврат из VK, адрес зарегистрирован у провайдера", tag: "oauth", query: oauthQuery, response: types.Token{}},
+	"GET /v1/oauth/{provider}/login":      {summary: "Адрес входа через провайдера", tag: "oauth", response: types.OAuthRedirect{}},
+	"GET /v1/oauth/{provider}/callback":   {summary: "Возврат от провайдера, выдает токен", tag: "oauth", query: oauthQuery, response: types.Token{}},
+	"POST /v1/oauth/{provider}/link":      {summary: "Адрес привязки соцсети к аккаунту", tag: "oauth", response: types.OAuthRedirect{}},
+	"GET /v1/me/identities":               {summary: "Привязанные соцсети", tag: "oauth", response: []types.UserIdentity{}},
+	"DELETE /v1/me/identities/{provider}": {summary: "Отвязать соцсеть", tag: "oauth"},
+
+	"POST /v1/teachers":               {summary: "Регистрация учителя", tag: "teachers", request: types.Teacher{}, response: types.OnlyID{}},
+	"GET /v1/teachers/{idTeacher}":    {summary: "Учитель", tag: "teachers", response: types.TeacherFullInfo{}},
+	"PUT /v1/teachers/{idTeacher}":    {summary: "Изменить учителя", tag: "teachers", request: types.Teacher{}},
+	"DELETE /v1/teachers/{idTeacher}": {summary: "Удалить учителя", tag: "teachers"},
+
+	"GET /v1/me/2fa":          {summary: "Статус 2FA", tag: "2fa", response: types.TwoFactorStatus{}},
+	"POST /v1/me/2fa/setup":   {summary: "Начать подключение 2FA", tag: "2fa", response: types.TwoFactorSetup{}},
+	"POST /v1/me/2fa/enable":  {summary: "Включить 2FA", tag: "2fa", request: types.TwoFactorCode{}, response: types.RecoveryCodes{}},
+	"POST /v1/me/2fa/disable": {summary: "Выключить 2FA", tag: "2fa", request: types.TwoFactorCode{}},
+	"POST /v1/me/2fa/step-up": {summary: "Step-up токен для опасных действий", tag: "2fa", request: types.TwoFactorCode{}, response: types.StepUpToken{}},
+
+	"GET /v1/reports/courses":               {summary: "Курсы со статистикой", tag: "reports", response: []types.CourseInfoForAdmin{}},
+	"GET /v1/reports/teachers":              {summary: "Учителя со статистикой", tag: "reports", response: []types.TeacherFullInfo{}},
+	"GET /v1/reports/export/courses":        {summary: "Выгрузка курсов", tag: "reports", query: exportQuery, content: []string{contentCSV, contentXLSX}},
+	"GET /v1/reports/export/teachers":       {summary: "Выгрузка учителей", tag: "reports", query: exportQuery, content: []string{contentCSV, contentXLSX}},
+	"GET /v1/reports/export/teachers/chats": {summary: "Выгрузка статистики чатов учителей", tag: "reports", query: exportQuery, content: []string{contentCSV, contentXLSX}},
+	"GET /v1/reports/export/students":       {summary: "Выгрузка учеников", tag: "reports", query: exportQuery, content: []string{contentCSV, contentXLSX}},
+	"GET /v1/reports/teachers/analytics":    {summary: "Аналитика учителей за период", tag: "reports", query: periodQuery, response: []types.TeacherAnalytics{}},
+	"GET /v1/reports/teachers/{idTeacher}/analytics": {summary: "Аналитика учителя по дням или неделям", tag: "reports",
+		query: append(periodQuery[:len(periodQuery):len(periodQuery)], query("group", "string", "группировка", "day", "week")), response: types.TeacherAnalytics{}},
+	"GET /v1/reports/sla": {summary: "Просроченные ответы на домашку", tag: "reports", response: types.SLAOverview{}},
+
+	"GET /v1/users":                {summary: "Пользователи", tag: "users", query: []openapi.Parameter{query("role", "string", "роль пользователей")}, response: []types.UserStat{}},
+	"GET /v1/students/{idStudent}": {summary: "Ученик", tag: "users", response: types.UserProfile{}},
+
+	"GET /v1/courses":                                                                              {summary: "Все курсы", tag: "content", response: []types.Course{}},
+	"GET /v1/courses/{idCourse}/sections":                                                          {summary: "Разделы курса", tag: "content", response: []types.Section{}},
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels":                                       {summary: "Уровни раздела", tag: "content", response: []types.Level{}},
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons":                     {summary: "Уроки уровня", tag: "content", response: []types.Lesson{}},
+	"POST /v1/courses":                                                                             {summary: "Создать курс", tag: "content", request: types.Course{}, response: types.OnlyID{}},
+	"POST /v1/courses/{idCourse}/sections":                                                         {summary: "Создать раздел", tag: "content", request: types.Section{}, response: types.OnlyID{}},
+	"POST /v1/courses/{idCourse}/sections/{idSection}/levels":                                      {summary: "Создать уровень", tag: "content", request: types.Level{}, response: types.OnlyID{}},
+	"POST /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons":                    {summary: "Создать урок", tag: "content", request: types.Lesson{}, response: types.OnlyID{}},
+	"GET /v1/courses/{idCourse}":                                                                   {summary: "Курс", tag: "content", response: types.Course{}},
+	"GET /v1/courses/{idCourse}/sections/{idSection}":                                              {summary: "Раздел", tag: "content", response: types.Section{}},
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}":                             {summary: "Уровень", tag: "content", response: types.Level{}},
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}":          {summary: "Урок", tag: "content", response: types.Lesson{}},
+	"GET /v1/lessons/{idLesson}":                                                                   {summary: "Урок по id с хлебными крошками и соседними уроками", tag: "content", response: types.LessonView{}},
+	"GET /v1/levels/{idLevel}":                                                                     {summary: "Уровень по id с хлебными крошками", tag: "content", response: types.LevelView{}},
+	"PUT /v1/courses/{idCourse}":                                                                   {summary: "Изменить курс", tag: "content", request: types.Course{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}":                                              {summary: "Изменить раздел", tag: "content", request: types.Section{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}":                             {summary: "Изменить уровень", tag: "content", request: types.Level{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}":          {summary: "Изменить урок", tag: "content", request: types.Lesson{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}/position":                                     {summary: "Переставить раздел в курсе", tag: "content", request: types.Placement{}, response: types.Placement{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/position":                    {summary: "Переставить уровень в разделе", tag: "content", request: types.Placement{}, response: types.Placement{}},
+	"PUT /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/position": {summary: "Переставить урок в уровне", tag: "content", request: types.Placement{}, response: types.Placement{}},
+	"POST /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/move":    {summary: "Перенести урок в другой уровень", tag: "content", request: types.MoveLesson{}, response: types.Placement{}},
+	"POST /v1/courses/{idCourse}/clone":                                                            {summary: "Скопировать курс в фоне", tag: "content", request: types.CloneCourse{}, response: types.CourseCloneJob{}},
+	"GET /v1/course-clones/{idJob}":                                                                {summary: "Ход копирования курса", tag: "content", response: types.CourseCloneJob{}},
+	"DELETE /v1/courses/{idCourse}":                                                                {summary: "Удалить курс", tag: "content"},
+	"DELETE /v1/courses/{idCourse}/sections/{idSection}":                                           {summary: "Удалить раздел", tag: "content"},
+	"DELETE /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}":                          {summary: "Удалить уровень", tag: "content"},
+	"DELETE /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}":       {summary: "Удалить урок", tag: "content"},
+	"POST /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/video":   {summary: "Загрузить видео урока", tag: "content", upload: "video"},
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/video":    {summary: "Видео урока, поддерживает Range", tag: "content", content: []string{contentVideo}},
+
+	"GET /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/chat":  {summary: "Чат ученика на странице урока", tag: "chats", response: types.ChatData{}},
+	"POST /v1/courses/{idCourse}/sections/{idSection}/levels/{idLevel}/lessons/{idLesson}/chat": {summary: "Сообщение в чат урока", tag: "chats", request: types.MessageBody{}},
+	"GET /v1/student/chats":                       {summary: "Превью чатов ученика", tag: "chats", response: []types.ChatsPreviewForStudent{}},
+	"GET /v1/chats/{idChat}":                      {summary: "Чат по id для ученика, учителя раздела или админа", tag: "chats", response: types.ChatView{}},
+	"GET /v1/student/chats/{idChat}":              {summary: "Чат ученика", tag: "chats", response: types.ChatData{}},
+	"POST /v1/student/chats/{idChat}":             {summary: "Сообщение ученика в чат", tag: "chats", request: types.MessageBody{}},
+	"GET /v1/teacher/chats":                       {summary: "Превью чатов учителя", tag: "chats", response: []types.ChatsPreviewForTeacher{}},
+	"GET /v1/teachers/{idTeacher}/chats":          {summary: "Чаты учителя для админа", tag: "chats", response: []types.ChatsPreviewForAdmin{}},
+	"GET /v1/teachers/{idTeacher}/chats/{idChat}": {summary: "Чат учителя для админа", tag: "chats", response: types.ChatData{}},
+	"GET /v1/teacher/chats/{idChat}":              {summary: "Чат учителя", tag: "chats", response: types.ChatData{}},
+	"POST /v1/teacher/chats/{idChat}":             {summary: "Ответ учителя в чат", tag: "chats", request: types.MessageBody{}},
+	"POST /v1/teacher/chats/{idChat}/ahtung":      {summary: "Позвать админа в чат", tag: "chats"},
+	"POST /v1/teacher/chats/{idChat}/rating":      {summary: "Оценка домашки", tag: "chats", request: types.Rating{}},
+
+	"GET /v1/me/notifications": {summary: "Уведомления", tag: "notifications", response: types.NotificationFeed{}, query: []openapi.Parameter{
+		query("unread", "boolean", "только непрочитанные"),
+		query("limit", "integer", "размер страницы"),
+		query("offset", "integer", "смещение"),
+	}},
+	"POST /v1/me/notifications/read":                  {summary: "Прочитать все уведомления", tag: "notifications"},
+	"POST /v1/me/notifications/{idNotification}/read": {summary: "Прочитать уведомление", tag: "notifications"},
+	"GET /v1/me/notifications/settings":               {summary: "Настройки уведомлений", tag: "notifications", response: types.NotificationSettings{}},
+	"PUT /v1/me/notifications/settings":               {summary: "Изменить настройки уведомлений", tag: "notifications", request: types.NotificationSettings{}},
+	"POST /v1/me/notifications/telegram":              {summary: "Ссылка на бота для подключения телеграма", tag: "notifications", response: types.TelegramLink{}},
+
+	"PUT /v1/users/{idUser}/role":         {summary: "Сменить роль пользователя", tag: "admin", request: types.UserRoleChange{}},
+	"POST /v1/users/{idUser}/suspend":     {summary: "Заблокировать пользователя", tag: "admin", request: types.UserSuspend{}},
+	"POST /v1/users/{idUser}/unsuspend":   {summary: "Разблокировать пользователя", tag: "admin"},
+	"POST /v1/users/{idUser}/logout":      {summary: "Завершить сессии пользователя", tag: "admin"},
+	"POST /v1/users/{idUser}/impersonate": {summary: "Войти от имени пользователя", tag: "admin", request: types.Impersonate{}, response: types.ImpersonationToken{}},
+	"GET /v1/audit": {summary: "Журнал действий", tag: "admin", response: types.AuditLog{}, query: []openapi.Parameter{
+		query("actor_id", "integer", "кто сделал"),
+		query("entity", "string", "тип сущности"),
+		query("entity_id", "string", "id сущности"),
+		query("action", "string", "действие, например course.update"),
+		periodQuery[0], periodQuery[1],
+		query("limit", "integer", "размер страницы"),
+		query("offset", "integer", "смещение"),
+	}},
+	"GET /v1/config": {summary: "Настройки без секретов", tag: "admin", response: map[string]interface{}{}},
+
+	"GET /v1/permissions":     {summary: "Все права", tag: "roles", response: []types.Permission{}},
+	"GET /v1/roles":           {summary: "Роли и их права", tag: "roles", response: []types.Role{}},
+	"POST /v1/roles":          {summary: "Создать роль", tag: "roles", request: types.Role{}, response: types.Role{}},
+	"PUT /v1/roles/{name}":    {summary: "Изменить роль", tag: "roles", request: types.Role{}, response: types.Role{}},
+	"DELETE /v1/roles/{name}": {summary: "Удалить роль", tag: "roles"},
+}
+
+// buildOpenAPI обходит роутер и описывает каждый роут по routeDocs, права и заголовки берутся из routes,
+// старые адреса из legacy помечаются deprecated
+func buildOpenAPI(router *mux.Router, routes map[*mux.Router]access, legacy map[*mux.Route]*mux.Route) (*openapi.Document, error) {
+
+	doc := openapi.New("Tarasova school API", "1.0.0", "Ошибки приходят в формате Error, язык сообщений выбирается по Accept-Language")
+	doc.Components.SecuritySchemes[securityToken] = openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-api-token",
+		Description: "токен из /users/auth"}
+	doc.Components.SecuritySchemes[securityStepUp] = openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-step-up-token",
+		Description: "свежий одноразовый токен из /users/2fa/step-up"}
+	errorSchema := doc.SchemaOf(types.Error{})
+
+	described := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, parent *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			//подроутеры без методов
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		path, successor := openapi.Path(template), ""
+		if current, ok := legacy[route]; ok {
+			if successor, err = current.GetPathTemplate(); err != nil {
+				return err
+			}
+			successor = openapi.Path(successor)
+		}
+		for _, method := range methods {
+			key := method + " " + path
+			if successor != "" {
+				key = method + " " + successor
+			}
+			d, ok := routeDocs[key]
+			if !ok {
+				return fmt.Errorf("route %s %s is not described in openapi", method, path)
+			}
+			described[key] = true
+			op := d.operation(doc, template, routes[parent], errorSchema)
+			if successor != "" {
+				op.Deprecated = true
+				op.Description = "Старый адрес, используйте " + successor
+			}
+			doc.Add(method, path, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "err with Walk router")
+	}
+
+	missing := make([]string, 0)
+	for key, d := range routeDocs {
+		if !described[key] && !d.optional {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("openapi describes routes missing in router: %s", strings.Join(missing, ", "))
+	}
+
+	return doc, nil
+}
+
+func (d routeDoc) operation(doc *openapi.Document, template string, a access, errorSchema *openapi.Schema) *openapi.Operation {
+
+	op := &openapi.Operation{
+		Summary:    d.summary,
+		Tags:       []string{d.tag},
+		Parameters: append(openapi.PathParameters(template), d.query...),
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OK"},
+			"default": {Description: "ошибка", Content: map[string]openapi.MediaType{
+				"application/json": {Schema: errorSchema},
+			}},
+		},
+		Permission: a.permission,
+	}
+
+	switch {
+	case d.request != nil:
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"application/json": {Schema: doc.SchemaOf(d.request)},
+		}}
+	case d.upload != "":
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"multipart/form-data": {Schema: &openapi.Schema{
+				Type:       "object",
+				Required:   []string{d.upload},
+				Properties: map[string]*openapi.Schema{d.upload: {Type: "string", Format: "binary"}},
+			}},
+		}}
+	}
+
+	if d.response != nil {
+		op.Responses["200"].Content = map[string]openapi.MediaType{"application/json": {Schema: doc.SchemaOf(d.response)}}
+	}
+	if len(d.content) != 0 {
+		op.Responses["200"].Content = make(map[string]openapi.MediaType)
+		for _, content := range d.content {
+			op.Responses["200"].Content[content] = openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary"}}
+		}
+	}
+	for status, response := range d.statuses {
+		op.Responses[openapi.Status(status)] = &openapi.Response{Description: http.StatusText(status), Content: map[string]openapi.MediaType{
+			"application/json": {Schema: doc.SchemaOf(response)},
+		}}
+	}
+
+	if a.auth {
+		requirement := map[string][]string{securityToken: {}}
+		if a.stepUp {
+			requirement[securityStepUp] = []string{}
+		}
+		op.Security = []map[string][]string{requirement}
+	}
+
+	return op
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/tarasova-school/internal/clients/postgres/postgrestest"
+	"github.com/tarasova-school/internal/tarasova-school/server/handlers"
+	"github.com/tarasova-school/internal/tarasova-school/service"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/openapi"
+	"github.com/tarasova-school/pkg/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "test"
+
+func newTestConfig() *config.Config {
+	cnf := config.Defaults()
+	cnf.SecretKeyJWT = testSecretKey
+	cnf.DocsDir = "../../../static/swagger-ui"
+	return cnf
+}
+
+// newTestRouter - роутер без базы, как в команде openapi
+func newTestRouter(t *testing.T) (*mux.Router, *handlers.Handlers) {
+	t.Helper()
+
+	return newRouterWithService(t, nil, newTestConfig())
+}
+
+// newTestServer - роутер с настоящим сервисом поверх фейковой базы, ответы базы задаются через db.On
+func newTestServer(t *testing.T) (*mux.Router, *handlers.Handlers, *postgrestest.DB) {
+	t.Helper()
+
+	cnf := newTestConfig()
+	if cnf.Email == nil {
+		cnf.Email = &config.ConfigForSendEmail{}
+	}
+	db, pg := postgrestest.New()
+	srv, err := service.NewService(pg, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, h := newRouterWithService(t, srv, cnf)
+
+	return router, h, db
+}
+
+func newRouterWithService(t *testing.T, srv *service.Service, cnf *config.Config) (*mux.Router, *handlers.Handlers) {
+	t.Helper()
+
+	limiter, err := ratelimit.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.NewHandlers(srv, cnf, limiter)
+	router, err := NewRouter(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return router, h
+}
+
+// TestRouterMatchesRouteDocs - каждый роут роутера есть в спецификации, каждое описание routeDocs - в роутере.
+// Старые адреса описываются по новому роуту и помечаются deprecated
+func TestRouterMatchesRouteDocs(t *testing.T) {
+
+	router, h := newTestRouter(t)
+	doc := specOf(t, h)
+
+	routed := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routed[method+" "+openapi.Path(template)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			key := strings.ToUpper(method) + " " + path
+			if !routed[key] {
+				t.Errorf("spec describes %s missing in router", key)
+			}
+			if !op.Deprecated {
+				documented[key] = true
+			}
+		}
+	}
+	for key := range routed {
+		if doc.Operation(strings.Fields(key)[0], strings.Fields(key)[1]) == nil {
+			t.Errorf("route %s is missing in spec", key)
+		}
+	}
+
+	var undocumented, unrouted []string
+	for key := range documented {
+		if _, ok := routeDocs[key]; !ok {
+			undocumented = append(undocumented, key)
+		}
+	}
+	for key, d := range routeDocs {
+		if !documented[key] && !d.optional {
+			unrouted = append(unrouted, key)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	if len(undocumented) != 0 {
+		t.Errorf("routes without routeDocs:\n%s", strings.Join(undocumented, "\n"))
+	}
+	if len(unrouted) != 0 {
+		t.Errorf("routeDocs without routes:\n%s", strings.Join(unrouted, "\n"))
+	}
+}
+
+func TestResponsesMatchSchemas(t *testing.T) {
+
+	router, h := newTestRouter(t)
+	doc := specOf(t, h)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "spec", method: http.MethodGet, target: "/openapi.json", path: "/openapi.json", status: http.StatusOK},
+		{name: "bad json", method: http.MethodPost, target: "/v1/auth/login", path: "/v1/auth/login", body: "{", status: http.StatusBadRequest},
+		{name: "validation", method: http.MethodPost, target: "/v1/auth/login", path: "/v1/auth/login", body: `{"email":"bad"}`, status: http.StatusBadRequest},
+		{name: "deprecated alias", method: http.MethodPost, target: "/users/auth", path: "/v1/auth/login", body: "{", status: http.StatusBadRequest},
+		{name: "no token", method: http.MethodGet, target: "/v1/me/email", path: "/v1/me/email", status: http.StatusForbidden},
+		{name: "no token password change", method: http.MethodPost, target: "/v1/auth/password/change", path: "/v1/auth/password/change",
+			body: `{"old_password":"secret","new_password":"secret2","repeat_password":"secret2"}`, status: http.StatusForbidden},
+		{name: "no token with permission", method: http.MethodGet, target: "/v1/reports/courses", path: "/v1/reports/courses", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d, body %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+				t.Fatalf("content type %q is not json", rec.Header().Get("Content-Type"))
+			}
+			if err := doc.ValidateResponse(tt.method, tt.path, rec.Code, rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestSuccessResponsesMatchSchemas - ответы 200 настоящих хендлеров и сервиса совпадают со схемами спецификации
+func TestSuccessResponsesMatchSchemas(t *testing.T) {
+
+	studentToken, err := infrastruct.GenerateJWT(7, types.RoleStudent, 0, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teacherToken, err := infrastruct.GenerateJWT(3, types.RoleTeacher, 0, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		path   string
+		body   string
+		token  string
+		stub   func(db *postgrestest.DB)
+		check  func(t *testing.T, body []byte)
+	}{
+		{
+			name: "courses", method: http.MethodGet, target: "/v1/courses", path: "/v1/courses",
+			stub: func(db *postgrestest.DB) {
+				db.On("SELECT id, name, cost FROM courses", "id", "name", "cost").
+					Row(1, "Английский для начинающих", 5000).
+					Row(2, "Грамматика", 3000)
+			},
+			check: func(t *testing.T, body []byte) {
+				var courses []types.Course
+				if err := json.Unmarshal(body, &courses); err != nil || len(courses) != 2 || courses[1].Name != "Грамматика" {
+					t.Errorf("courses %s: %v", body, err)
+				}
+			},
+		},
+		{
+			name: "login", method: http.MethodPost, target: "/v1/auth/login", path: "/v1/auth/login",
+			body: `{"email":"Anna@mail.ru","password":"secret"}`,
+			stub: func(db *postgrestest.DB) {
+				db.On("FROM users WHERE email = $1", "id", "pass", "first_name", "user_role", "token_version",
+					"suspended", "suspend_reason").Row(7, "secret", "Анна", types.RoleStudent, 0, false, "")
+			},
+			check: func(t *testing.T, body []byte) {
+				token := types.Token{}
+				if err := json.Unmarshal(body, &token); err != nil {
+					t.Fatal(err)
+				}
+				claims, err := infrastruct.ValidateJwt(token.Token, testSecretKey)
+				if err != nil {
+					t.Fatalf("token %q: %v", token.Token, err)
+				}
+				if id := claims.Claims.(*infrastruct.CustomClaims).UserID; id != 7 {
+					t.Errorf("token for user %d, want 7", id)
+				}
+			},
+		},
+		{
+			name: "chat", method: http.MethodGet, target: "/v1/chats/5", path: "/v1/chats/{idChat}", token: studentToken,
+			stub: func(db *postgrestest.DB) {
+				db.On("FROM users WHERE id = $1", "user_role", "token_version", "suspended", "suspend_reason").
+					Row(types.RoleStudent, 0, false, "")
+				db.On("SELECT MAX(created_at) FROM request_log", "max").Row(time.Now().Format(time.RFC3339))
+				db.On("FROM chat WHERE chat_id = $1", "course_id", "section_id", "level_id", "lesson_id", "student_id", "rating").
+					Row(1, 2, 3, 4, 7, "")
+				db.On("FROM messages WHERE chat_id = $1", "message_id", "text", "role", "time_mes", "first_name").
+					Row(10, "Вот мое задание", types.RoleStudent, "2021-01-01T10:00:00Z", "Анна").
+					Row(11, "Хорошо", types.RoleTeacher, "2021-01-01T11:00:00Z", "Ольга")
+				db.On("FROM levels l JOIN sections s", "c.id", "c.name", "s.id", "s.name", "l.level_id", "l.name").
+					Row(1, "Английский для начинающих", 2, "Основы", 3, "Первый уровень")
+				db.On("SELECT name FROM lessons WHERE lesson_id = $1", "name").Row("Present Simple")
+			},
+			check: func(t *testing.T, body []byte) {
+				chat := types.ChatView{}
+				if err := json.Unmarshal(body, &chat); err != nil {
+					t.Fatal(err)
+				}
+				if chat.ChatID != 5 || len(chat.Messages) != 2 || len(chat.Breadcrumbs) != 4 ||
+					chat.Breadcrumbs[3].Name != "Present Simple" {
+					t.Errorf("chat %s", body)
+				}
+			},
+		},
+		{
+			name: "student", method: http.MethodGet, target: "/v1/students/7", path: "/v1/students/{idStudent}",
+			token: teacherToken,
+			stub: func(db *postgrestest.DB) {
+				db.On("SELECT user_role, token_version", "user_role", "token_version", "suspended", "suspend_reason").
+					Row(types.RoleTeacher, 0, false, "")
+				db.On("FROM roles LEFT JOIN role_permissions", "name", "description", "builtin", "permissions").
+					Row(types.RoleTeacher, "", true, "{chats.answer,users.view}")
+				db.On("SELECT email, pass, first_name", "email", "pass", "first_name", "user_role", "token_version",
+					"suspended", "suspend_reason").Row("anna@mail.ru", "secret", "Анна", types.RoleStudent, 0, false, "")
+			},
+			check: func(t *testing.T, body []byte) {
+				if strings.Contains(string(body), "secret") || strings.Contains(string(body), "password") {
+					t.Errorf("password in profile %s", body)
+				}
+				profile := types.UserProfile{}
+				if err := json.Unmarshal(body, &profile); err != nil || profile.ID != 7 || profile.Email != "anna@mail.ru" {
+					t.Errorf("profile %s: %v", body, err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, h, db := newTestServer(t)
+			doc := specOf(t, h)
+			tt.stub(db)
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("X-api-token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+			}
+			if err := doc.ValidateResponse(tt.method, tt.path, rec.Code, rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+			tt.check(t, rec.Body.Bytes())
+		})
+	}
+}
+
+// TestDocsAssets - статика swagger ui закоммичена и совпадает с SHA256SUMS, /docs отдает ее файлы
+func TestDocsAssets(t *testing.T) {
+
+	router, h := newTestRouter(t)
+	if err := h.CheckDocs(); err != nil {
+		t.Fatalf("%v, run deploy/swagger-ui.sh and commit static/swagger-ui", err)
+	}
+
+	for _, target := range []string{"/docs", "/docs/swagger-ui/swagger-ui.css", "/docs/swagger-ui/swagger-ui-bundle.js"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("%s: status %d, %d bytes", target, rec.Code, rec.Body.Len())
+		}
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/swagger-ui/SHA256SUMS", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("SHA256SUMS: status %d, want 404", rec.Code)
+	}
+}
+
+// specOf - спецификация, которую отдает /openapi.json
+func specOf(t *testing.T, h *handlers.Handlers) *openapi.Document {
+	t.Helper()
+
+	doc := &openapi.Document{}
+	if err := json.Unmarshal(h.OpenAPISpec(), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
@@ -3,97 +3,261 @@ package server
 import (
 	"github.com/gorilla/mux"
 	"github.com/tarasova-school/internal/tarasova-school/server/handlers"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/ratelimit"
 	"net/http"
 )
 
-func NewRouter(h *handlers.Handlers) *mux.Router {
-	//todo надо проверить логичность всех путей
+const (
+	apiV1 = "/v1"
+
+	coursePath  = "/courses/{idCourse:[0-9]+}"
+	sectionPath = coursePath + "/sections/{idSection:[0-9]+}"
+	levelPath   = sectionPath + "/levels/{idLevel:[0-9]+}"
+	lessonPath  = levelPath + "/lessons/{idLesson:[0-9]+}"
+	teacherPath = "/teachers/{idTeacher:[0-9]+}"
+	userPath    = "/users/{idUser:[0-9]+}"
+)
+
+func NewRouter(h *handlers.Handlers) (*mux.Router, error) {
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(h.CaptureRoute)
 	router.Use(h.RecoverPanic)
 	router.Use(h.RecordRequest)
-	adminRouter := router.PathPrefix("").Subrouter()
-	teacherRouter := router.PathPrefix("").Subrouter()
-	studentRouter := router.PathPrefix("").Subrouter()
-	adminAndTeacherRouter := router.PathPrefix("").Subrouter()
-	adminRouter.Use(h.CheckRoleAdmin)
-	teacherRouter.Use(h.CheckRoleTeacher)
-	studentRouter.Use(h.CheckRoleStudent)
-	adminAndTeacherRouter.Use(h.CheckRoleAdminAndTeacher)
-	adminRouter.Use(h.CheckUserInDBUsers)
-	teacherRouter.Use(h.CheckUserInDBUsers)
-	studentRouter.Use(h.CheckUserInDBUsers)
-	adminAndTeacherRouter.Use(h.CheckUserInDBUsers)
-
-	adminRouter.Methods(http.MethodPost).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}/upload").HandlerFunc(h.UploadVideo)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}/video").HandlerFunc(h.GetVideo)
+	//старые адреса api, ключ - алиас, значение - новый роут
+	legacy := make(map[*mux.Route]*mux.Route)
+	router.Use(h.Deprecated(legacy))
+	//права и заголовки подроутеров попадают в openapi
+	routes := make(map[*mux.Router]access)
+	//доступ к разделам выдается правами ролей из таблицы role_permissions, см. /admin/roles
+	contentRouter := permissionRouter(router, h, routes, types.PermContentEdit, false)
+	usersManageRouter := permissionRouter(router, h, routes, types.PermUsersManage, false)
+	usersViewRouter := permissionRouter(router, h, routes, types.PermUsersView, false)
+	reportsRouter := permissionRouter(router, h, routes, types.PermReportsView, false)
+	chatsAskRouter := permissionRouter(router, h, routes, types.PermChatsAsk, false)
+	chatsAnswerRouter := permissionRouter(router, h, routes, types.PermChatsAnswer, false)
+	chatsReadAllRouter := permissionRouter(router, h, routes, types.PermChatsReadAll, false)
+	twoFactorRouter := permissionRouter(router, h, routes, types.PermTwoFactor, false)
+	rolesRouter := permissionRouter(router, h, routes, types.PermRolesManage, false)
+	stepUpRolesRouter := permissionRouter(router, h, routes, types.PermRolesManage, true)
+	impersonateRouter := permissionRouter(router, h, routes, types.PermImpersonate, true)
+	stepUpContentRouter := permissionRouter(router, h, routes, types.PermContentEdit, true)
+	stepUpUsersManageRouter := permissionRouter(router, h, routes, types.PermUsersManage, true)
+	userRouter := router.PathPrefix("").Subrouter()
+	userRouter.Use(h.CheckAuthorized)
+	userRouter.Use(h.CheckUserInDBUsers)
+	routes[userRouter] = access{auth: true}
+	accountRouter := router.PathPrefix("").Subrouter()
+	accountRouter.Use(h.CheckAuthorized)
+	accountRouter.Use(h.CheckUserInDBUsers)
+	accountRouter.Use(h.DenyImpersonation)
+	routes[accountRouter] = access{auth: true}
+	twoFactorRouter.Use(h.DenyImpersonation)
+	chatsAskRouter.Use(h.CheckEmailVerified)
+	auditRouter := permissionRouter(router, h, routes, types.PermAuditView, false)
+	configRouter := permissionRouter(router, h, routes, types.PermConfigView, false)
+	//все изменения админов и учителей пишутся в журнал действий
+	for _, r := range []*mux.Router{contentRouter, stepUpContentRouter, usersManageRouter, stepUpUsersManageRouter,
+		rolesRouter, stepUpRolesRouter, impersonateRouter, chatsAnswerRouter} {
+		r.Use(h.Audit)
+	}
 
+	//служебные роуты без версии
 	router.Methods(http.MethodGet).Path("/ping").HandlerFunc(h.Ping)
-	router.Methods(http.MethodPost).Path("/users/auth").HandlerFunc(h.Authorize)
-	router.Methods(http.MethodPost).Path("/users/register").HandlerFunc(h.RegisterUser)
-	router.Methods(http.MethodPost).Path("/password/change").HandlerFunc(h.ChangePassword)
-	router.Methods(http.MethodPost).Path("/password/recovery").HandlerFunc(h.RecoveryPassword)
-	router.Methods(http.MethodPost).Path("/password/recovery/check").HandlerFunc(h.CheckValidRecoveryPassword)
-	router.Methods(http.MethodPost).Path("/password/recovery/new").HandlerFunc(h.NewRecoveryPassword)
-
+	router.Methods(http.MethodGet).Path("/healthz").HandlerFunc(h.Healthz)
+	router.Methods(http.MethodGet).Path("/readyz").HandlerFunc(h.Readyz)
+	router.Methods(http.MethodGet).Path("/openapi.json").HandlerFunc(h.OpenAPI)
+	router.Methods(http.MethodGet).Path("/docs").HandlerFunc(h.Docs)
+	router.Methods(http.MethodGet).Path("/docs/swagger-ui/{file}").HandlerFunc(h.DocsAsset)
+	if h.MetricsOnMainPort() {
+		router.Methods(http.MethodGet).Path("/metrics").HandlerFunc(h.Metrics)
+	}
+	//адрес возврата зарегистрирован в VK, поэтому остается без версии
 	router.Methods(http.MethodGet).Path("/vk/callback").HandlerFunc(h.VKCallback)
 
-	adminRouter.Methods(http.MethodPost).Path("/users/register/teacher").HandlerFunc(h.RegisterTeacher)
-	adminRouter.Methods(http.MethodGet).Path("/users/teacher/{idTeacher:[0-9]+}").HandlerFunc(h.GetTeacher)
-	adminRouter.Methods(http.MethodPut).Path("/users/teacher/{idTeacher:[0-9]+}").HandlerFunc(h.UpdateTeacher)
-	adminRouter.Methods(http.MethodDelete).Path("/users/teacher/{idTeacher:[0-9]+}").HandlerFunc(h.DeleteTeacher)
-
-	adminRouter.Methods(http.MethodGet).Path("/admin/courses/all").HandlerFunc(h.GetAllCoursesInfoForAdmin)
-	adminRouter.Methods(http.MethodGet).Path("/admin/teachers/all").HandlerFunc(h.GetAllTeachersInfoForAdmin)
-
-	adminAndTeacherRouter.Methods(http.MethodGet).Path("/users").HandlerFunc(h.GetUsers)
-	//todo дописать в сваггер GetStudentByQueryID, проверить поля в постгрессе
-	router.Methods(http.MethodGet).Path("/users/{idStudent:[0-9]+}").HandlerFunc(h.GetStudentByQueryID)
-	router.Methods(http.MethodGet).Path("/courses/all").HandlerFunc(h.GetAllCourses)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/all").HandlerFunc(h.GetAllSectionsInCourse)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/all").HandlerFunc(h.GetAllLevelsInSection)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/all").HandlerFunc(h.GetAllLessonsInLevel)
-
-	adminRouter.Methods(http.MethodPost).Path("/courses").HandlerFunc(h.AddCourse)
-	adminRouter.Methods(http.MethodPost).Path("/courses/{idCourse:[0-9]+}/sections").HandlerFunc(h.AddSection)
-	adminRouter.Methods(http.MethodPost).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels").HandlerFunc(h.AddLevel)
-	adminRouter.Methods(http.MethodPost).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons").HandlerFunc(h.AddLesson)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}").HandlerFunc(h.GetCourse)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}").HandlerFunc(h.GetSection)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}").HandlerFunc(h.GetLevel)
-	router.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}").HandlerFunc(h.GetLesson)
-	adminRouter.Methods(http.MethodPut).Path("/courses/{idCourse:[0-9]+}").HandlerFunc(h.UpdateCourse)
-	adminRouter.Methods(http.MethodPut).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}").HandlerFunc(h.UpdateSection)
-	adminRouter.Methods(http.MethodPut).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}").HandlerFunc(h.UpdateLevel)
-	adminRouter.Methods(http.MethodPut).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}").HandlerFunc(h.UpdateLesson)
-	adminRouter.Methods(http.MethodDelete).Path("/courses/{idCourse:[0-9]+}").HandlerFunc(h.DeleteCourse)
-	adminRouter.Methods(http.MethodDelete).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}").HandlerFunc(h.DeleteSection)
-	adminRouter.Methods(http.MethodDelete).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}").HandlerFunc(h.DeleteLevel)
-	adminRouter.Methods(http.MethodDelete).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}").HandlerFunc(h.DeleteLesson)
+	//роуты api живут под /v1, второй путь - старый адрес, он работает с заголовком Deprecation, пока фронт не переедет
+	v1 := &api{prefix: apiV1, legacy: legacy}
+
+	v1.handle(router, http.MethodPost, "/auth/login", "/users/auth", h.RateLimit(ratelimit.PolicyAuth, h.Authorize).ServeHTTP)
+	v1.handle(router, http.MethodPost, "/auth/login/2fa", "/users/auth/2fa", h.RateLimit(ratelimit.PolicyTwoFactor, h.AuthorizeTwoFactor).ServeHTTP)
+	v1.handle(router, http.MethodPost, "/auth/register", "/users/register", h.RateLimit(ratelimit.PolicyRegister, h.RegisterUser).ServeHTTP)
+	v1.handle(router, http.MethodPost, "/auth/email/verify", "/users/email/verify", h.VerifyEmail)
+	v1.handle(accountRouter, http.MethodPost, "/auth/password/change", "/password/change", h.ChangePassword)
+	v1.handle(router, http.MethodPost, "/auth/password/recovery", "/password/recovery", h.RateLimit(ratelimit.PolicyRecovery, h.RecoveryPassword).ServeHTTP)
+	v1.handle(router, http.MethodPost, "/auth/password/recovery/check", "/password/recovery/check", h.RateLimit(ratelimit.PolicyRecovery, h.CheckValidRecoveryPassword).ServeHTTP)
+	v1.handle(router, http.MethodPost, "/auth/password/recovery/new", "/password/recovery/new", h.RateLimit(ratelimit.PolicyRecovery, h.NewRecoveryPassword).ServeHTTP)
+
+	//вход через соцсети: login отдает адрес провайдера, после входа провайдер возвращает на callback
+	v1.handle(router, http.MethodGet, "/oauth/{provider:[a-z]+}/login", "/oauth/{provider:[a-z]+}/login", h.OAuthLogin)
+	v1.handle(router, http.MethodGet, "/oauth/{provider:[a-z]+}/callback", "/oauth/{provider:[a-z]+}/callback", h.OAuthCallback)
+	v1.handle(accountRouter, http.MethodPost, "/oauth/{provider:[a-z]+}/link", "/oauth/{provider:[a-z]+}/link", h.OAuthLink)
 
+	//текущий пользователь: email, соцсети, 2FA и уведомления
+	v1.handle(userRouter, http.MethodGet, "/me/email", "/users/email", h.GetEmailVerificationStatus)
+	v1.handle(userRouter, http.MethodPost, "/me/email/resend", "/users/email/resend", h.ResendEmailVerification)
+	v1.handle(userRouter, http.MethodGet, "/me/identities", "/oauth/identities", h.GetUserIdentities)
+	v1.handle(accountRouter, http.MethodDelete, "/me/identities/{provider:[a-z]+}", "/oauth/identities/{provider:[a-z]+}", h.UnlinkIdentity)
+	//двухфакторная авторизация, по умолчанию право есть у админов и учителей
+	v1.handle(twoFactorRouter, http.MethodGet, "/me/2fa", "/users/2fa", h.GetTwoFactorStatus)
+	v1.handle(twoFactorRouter, http.MethodPost, "/me/2fa/setup", "/users/2fa/setup", h.SetupTwoFactor)
+	v1.handle(twoFactorRouter, http.MethodPost, "/me/2fa/enable", "/users/2fa/enable", h.EnableTwoFactor)
+	v1.handle(twoFactorRouter, http.MethodPost, "/me/2fa/disable", "/users/2fa/disable", h.DisableTwoFactor)
+	v1.handle(twoFactorRouter, http.MethodPost, "/me/2fa/step-up", "/users/2fa/step-up", h.StepUp)
+	//уведомления текущего пользователя: ?unread=true&limit=20&offset=0
+	v1.handle(userRouter, http.MethodGet, "/me/notifications", "/notifications", h.GetNotifications)
+	v1.handle(userRouter, http.MethodPost, "/me/notifications/read", "/notifications/read", h.MarkAllNotificationsRead)
+	v1.handle(userRouter, http.MethodPost, "/me/notifications/{idNotification:[0-9]+}/read", "/notifications/{idNotification:[0-9]+}/read", h.MarkNotificationRead)
+	v1.handle(userRouter, http.MethodGet, "/me/notifications/settings", "/notifications/settings", h.GetNotificationSettings)
+	v1.handle(userRouter, http.MethodPut, "/me/notifications/settings", "/notifications/settings", h.UpdateNotificationSettings)
+	v1.handle(accountRouter, http.MethodPost, "/me/notifications/telegram", "", h.StartTelegramLink)
+
+	v1.handle(usersManageRouter, http.MethodPost, "/teachers", "/users/register/teacher", h.RegisterTeacher).Name("teacher.create")
+	v1.handle(usersManageRouter, http.MethodGet, teacherPath, "/users/teacher/{idTeacher:[0-9]+}", h.GetTeacher)
+	v1.handle(usersManageRouter, http.MethodPut, teacherPath, "/users/teacher/{idTeacher:[0-9]+}", h.UpdateTeacher).Name("teacher.update")
+	v1.handle(stepUpUsersManageRouter, http.MethodDelete, teacherPath, "/users/teacher/{idTeacher:[0-9]+}", h.DeleteTeacher).Name("teacher.delete")
+	//чаты учителя в инфо блоке на его страничке
+	v1.handle(chatsReadAllRouter, http.MethodGet, teacherPath+"/chats", "/users/teacher/{idTeacher:[0-9]+}/chats", h.GetAllChatsForAdmin)
+	v1.handle(chatsReadAllRouter, http.MethodGet, teacherPath+"/chats/{idChat:[0-9]+}", "/users/teacher/{idTeacher:[0-9]+}/chat/{idChat:[0-9]+}", h.GetChatForAdmin)
+
+	v1.handle(usersViewRouter, http.MethodGet, "/users", "/users", h.GetUsers)
+	//todo проверить поля в постгрессе
+	v1.handle(usersViewRouter, http.MethodGet, "/students/{idStudent:[0-9]+}", "/users/{idStudent:[0-9]+}", h.GetStudentByQueryID)
+	//управление пользователями: смена роли, блокировка, завершение сессий и вход от имени пользователя
+	v1.handle(stepUpRolesRouter, http.MethodPut, userPath+"/role", "/admin/users/{idUser:[0-9]+}/role", h.ChangeUserRole).Name("user.change_role")
+	v1.handle(usersManageRouter, http.MethodPost, userPath+"/suspend", "/admin/users/{idUser:[0-9]+}/suspend", h.SuspendUser).Name("user.suspend")
+	v1.handle(usersManageRouter, http.MethodPost, userPath+"/unsuspend", "/admin/users/{idUser:[0-9]+}/unsuspend", h.UnsuspendUser).Name("user.unsuspend")
+	v1.handle(usersManageRouter, http.MethodPost, userPath+"/logout", "/admin/users/{idUser:[0-9]+}/logout", h.ForceLogout).Name("user.force_logout")
+	v1.handle(impersonateRouter, http.MethodPost, userPath+"/impersonate", "/admin/users/{idUser:[0-9]+}/impersonate", h.Impersonate).Name("user.impersonate")
+
+	v1.handle(reportsRouter, http.MethodGet, "/reports/courses", "/admin/courses/all", h.GetAllCoursesInfoForAdmin)
+	v1.handle(reportsRouter, http.MethodGet, "/reports/teachers", "/admin/teachers/all", h.GetAllTeachersInfoForAdmin)
+	//выгрузка отчетов в csv или xlsx: ?format=xlsx&from=2021-01-01&to=2021-01-31
+	v1.handle(reportsRouter, http.MethodGet, "/reports/export/courses", "/admin/export/courses", h.ExportCoursesInfo)
+	v1.handle(reportsRouter, http.MethodGet, "/reports/export/teachers", "/admin/export/teachers", h.ExportTeachersInfo)
+	v1.handle(reportsRouter, http.MethodGet, "/reports/export/teachers/chats", "/admin/export/teachers/chats", h.ExportTeacherChatStats)
+	v1.handle(reportsRouter, http.MethodGet, "/reports/export/students", "/admin/export/students", h.ExportStudents)
+	//аналитика учителей за период: ?from=2021-01-01&to=2021-01-31&group=day|week
+	v1.handle(reportsRouter, http.MethodGet, "/reports/teachers/analytics", "/admin/teachers/analytics", h.GetAllTeachersAnalytics)
+	v1.handle(reportsRouter, http.MethodGet, "/reports"+teacherPath+"/analytics", "/admin/teachers/{idTeacher:[0-9]+}/analytics", h.GetTeacherAnalytics)
+	//просроченные ответы на домашку по курсам и учителям
+	v1.handle(reportsRouter, http.MethodGet, "/reports/sla", "/admin/sla", h.GetSLAOverview)
+
+	v1.handle(router, http.MethodGet, "/courses", "/courses/all", h.GetAllCourses)
+	v1.handle(router, http.MethodGet, coursePath+"/sections", coursePath+"/sections/all", h.GetAllSectionsInCourse)
+	v1.handle(router, http.MethodGet, sectionPath+"/levels", sectionPath+"/levels/all", h.GetAllLevelsInSection)
+	v1.handle(router, http.MethodGet, levelPath+"/lessons", levelPath+"/lessons/all", h.GetAllLessonsInLevel)
+	v1.handle(contentRouter, http.MethodPost, "/courses", "/courses", h.AddCourse).Name("course.create")
+	v1.handle(contentRouter, http.MethodPost, coursePath+"/sections", coursePath+"/sections", h.AddSection).Name("section.create")
+	v1.handle(contentRouter, http.MethodPost, sectionPath+"/levels", sectionPath+"/levels", h.AddLevel).Name("level.create")
+	v1.handle(contentRouter, http.MethodPost, levelPath+"/lessons", levelPath+"/lessons", h.AddLesson).Name("lesson.create")
+	v1.handle(router, http.MethodGet, coursePath, coursePath, h.GetCourse)
+	v1.handle(router, http.MethodGet, sectionPath, sectionPath, h.GetSection)
+	v1.handle(router, http.MethodGet, levelPath, levelPath, h.GetLevel)
+	v1.handle(router, http.MethodGet, lessonPath, lessonPath, h.GetLesson)
+	v1.handle(contentRouter, http.MethodPut, coursePath, coursePath, h.UpdateCourse).Name("course.update")
+	v1.handle(contentRouter, http.MethodPut, sectionPath, sectionPath, h.UpdateSection).Name("section.update")
+	v1.handle(contentRouter, http.MethodPut, levelPath, levelPath, h.UpdateLevel).Name("level.update")
+	v1.handle(contentRouter, http.MethodPut, lessonPath, lessonPath, h.UpdateLesson).Name("lesson.update")
+	v1.handle(stepUpContentRouter, http.MethodDelete, coursePath, coursePath, h.DeleteCourse).Name("course.delete")
+	v1.handle(contentRouter, http.MethodDelete, sectionPath, sectionPath, h.DeleteSection).Name("section.delete")
+	v1.handle(contentRouter, http.MethodDelete, levelPath, levelPath, h.DeleteLevel).Name("level.delete")
+	v1.handle(contentRouter, http.MethodDelete, lessonPath, lessonPath, h.DeleteLesson).Name("lesson.delete")
+	v1.handle(contentRouter, http.MethodPost, lessonPath+"/video", lessonPath+"/upload", h.UploadVideo).Name("lesson.upload_video")
+	v1.handle(router, http.MethodGet, lessonPath+"/video", lessonPath+"/video", h.GetVideo)
+	//порядок разделов, уровней и уроков, version защищает от одновременных правок
+	v1.handle(contentRouter, http.MethodPut, sectionPath+"/position", "", h.ReorderSection).Name("section.reorder")
+	v1.handle(contentRouter, http.MethodPut, levelPath+"/position", "", h.ReorderLevel).Name("level.reorder")
+	v1.handle(contentRouter, http.MethodPut, lessonPath+"/position", "", h.ReorderLesson).Name("lesson.reorder")
+	v1.handle(contentRouter, http.MethodPost, lessonPath+"/move", "", h.MoveLesson).Name("lesson.move")
+	//копия курса для нового потока делается в фоне, ход копирования - по id задачи
+	v1.handle(contentRouter, http.MethodPost, coursePath+"/clone", "", h.CloneCourse).Name("course.clone")
+	v1.handle(contentRouter, http.MethodGet, "/course-clones/{idJob:[0-9]+}", "", h.GetCourseCloneJob)
+	//урок и уровень по id без пути курса, с хлебными крошками
+	v1.handle(router, http.MethodGet, "/lessons/{idLesson:[0-9]+}", "", h.GetLessonByID)
+	v1.handle(router, http.MethodGet, "/levels/{idLevel:[0-9]+}", "", h.GetLevelByID)
+
+	//чат по id для ученика, учителя раздела или админа
+	v1.handle(userRouter, http.MethodGet, "/chats/{idChat:[0-9]+}", "", h.GetChatByID)
 	//получить чат на странице урока
-	studentRouter.Methods(http.MethodGet).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}/chat").HandlerFunc(h.GetChatForStudentByLesson)
+	v1.handle(chatsAskRouter, http.MethodGet, lessonPath+"/chat", lessonPath+"/chat", h.GetChatForStudentByLesson)
 	//отправка сообщения (начать или продолжить чат на странице урока)
-	studentRouter.Methods(http.MethodPost).Path("/courses/{idCourse:[0-9]+}/sections/{idSection:[0-9]+}/levels/{idLevel:[0-9]+}/lessons/{idLesson:[0-9]+}/chat").HandlerFunc(h.SendMessageToChatByLessonForStudent)
+	v1.handle(chatsAskRouter, http.MethodPost, lessonPath+"/chat", lessonPath+"/chat", h.RateLimit(ratelimit.PolicyChat, h.SendMessageToChatByLessonForStudent).ServeHTTP)
 	//показать превью чатов которые уже были начаты
-	studentRouter.Methods(http.MethodGet).Path("/student/chat/all").HandlerFunc(h.GetAllChatsForStudent)
+	v1.handle(chatsAskRouter, http.MethodGet, "/student/chats", "/student/chat/all", h.GetAllChatsForStudent)
 	//получить чат из превью в личном кабинете
-	studentRouter.Methods(http.MethodGet).Path("/student/chat/{idChat:[0-9]+}").HandlerFunc(h.GetChatByProfileStudent)
+	v1.handle(chatsAskRouter, http.MethodGet, "/student/chats/{idChat:[0-9]+}", "/student/chat/{idChat:[0-9]+}", h.GetChatByProfileStudent)
 	//отправить сообщение в уже существующий чат полученный из превью в личном кабинете
-	studentRouter.Methods(http.MethodPost).Path("/student/chat/{idChat:[0-9]+}").HandlerFunc(h.SendMessageToChatByProfileStudent)
+	v1.handle(chatsAskRouter, http.MethodPost, "/student/chats/{idChat:[0-9]+}", "/student/chat/{idChat:[0-9]+}", h.RateLimit(ratelimit.PolicyChat, h.SendMessageToChatByProfileStudent).ServeHTTP)
 
 	//показать чаты в разделе чаты
-	teacherRouter.Methods(http.MethodGet).Path("/teacher/chat/all").HandlerFunc(h.GetAllChatsForTeacher)
-	//показать чаты в инфо блоке на страничке учителя
-	adminRouter.Methods(http.MethodGet).Path("/users/teacher/{idTeacher:[0-9]+}/chats").HandlerFunc(h.GetAllChatsForAdmin)
-	//показать чат на страничке учителя
-	adminRouter.Methods(http.MethodGet).Path("/users/teacher/{idTeacher:[0-9]+}/chat/{idChat:[0-9]+}").HandlerFunc(h.GetChatForAdmin)
+	v1.handle(chatsAnswerRouter, http.MethodGet, "/teacher/chats", "/teacher/chat/all", h.GetAllChatsForTeacher)
 	//получить конкретный чат из превью
-	teacherRouter.Methods(http.MethodGet).Path("/teacher/chat/{idChat:[0-9]+}").HandlerFunc(h.GetChatForTeacher)
+	v1.handle(chatsAnswerRouter, http.MethodGet, "/teacher/chats/{idChat:[0-9]+}", "/teacher/chat/{idChat:[0-9]+}", h.GetChatForTeacher)
 	//отправить сообщение в конкретный чат из превью
-	teacherRouter.Methods(http.MethodPost).Path("/teacher/chat/{idChat:[0-9]+}").HandlerFunc(h.SendMessageToChatForTeacher)
+	v1.handle(chatsAnswerRouter, http.MethodPost, "/teacher/chats/{idChat:[0-9]+}", "/teacher/chat/{idChat:[0-9]+}", h.RateLimit(ratelimit.PolicyChat, h.SendMessageToChatForTeacher).ServeHTTP).Name("chat.answer")
+	v1.handle(chatsAnswerRouter, http.MethodPost, "/teacher/chats/{idChat:[0-9]+}/ahtung", "/teacher/chat/{idChat:[0-9]+}/ahtung", h.Ahtung).Name("chat.ahtung")
+	v1.handle(chatsAnswerRouter, http.MethodPost, "/teacher/chats/{idChat:[0-9]+}/rating", "/teacher/chat/{idChat:[0-9]+}/rating", h.Rating).Name("chat.rating")
+
+	//журнал действий: ?actor_id=1&entity=course&entity_id=2&action=course.update&from=2021-01-01&to=2021-01-31&limit=50&offset=0
+	v1.handle(auditRouter, http.MethodGet, "/audit", "/admin/audit", h.GetAuditLog)
+	v1.handle(configRouter, http.MethodGet, "/config", "/admin/config", h.GetConfig)
+
+	//роли и их права
+	v1.handle(rolesRouter, http.MethodGet, "/permissions", "/admin/permissions", h.GetPermissions)
+	v1.handle(rolesRouter, http.MethodGet, "/roles", "/admin/roles", h.GetRoles)
+	v1.handle(stepUpRolesRouter, http.MethodPost, "/roles", "/admin/roles", h.CreateRole).Name("role.create")
+	v1.handle(stepUpRolesRouter, http.MethodPut, "/roles/{name:[a-z_]+}", "/admin/roles/{name:[a-z_]+}", h.UpdateRole).Name("role.update")
+	v1.handle(stepUpRolesRouter, http.MethodDelete, "/roles/{name:[a-z_]+}", "/admin/roles/{name:[a-z_]+}", h.DeleteRole).Name("role.delete")
+
+	doc, err := buildOpenAPI(router, routes, legacy)
+	if err != nil {
+		return nil, err
+	}
+	if err = h.SetOpenAPI(doc); err != nil {
+		return nil, err
+	}
+
+	return router, nil
+}
+
+// permissionRouter - подроутер, который пускает только пользователей с правом permission,
+// со stepUp еще и только со свежим step-up токеном
+func permissionRouter(router *mux.Router, h *handlers.Handlers, routes map[*mux.Router]access, permission string, stepUp bool) *mux.Router {
+	r := router.PathPrefix("").Subrouter()
+	r.Use(h.CheckPermission(permission))
+	r.Use(h.CheckUserInDBUsers)
+	if stepUp {
+		r.Use(h.CheckStepUp)
+	}
+	routes[r] = access{auth: true, permission: permission, stepUp: stepUp}
+	return r
+}
+
+// api регистрирует роуты версии prefix, старые пути - устаревшие алиасы, legacy связывает алиас с новым роутом
+type api struct {
+	prefix string
+	legacy map[*mux.Route]*mux.Route
+}
+
+// handle регистрирует prefix+path и, если задан oldPath, старый путь с тем же обработчиком
+func (a *api) handle(r *mux.Router, method, path, oldPath string, handler http.HandlerFunc) routeGroup {
+
+	route := r.Methods(method).Path(a.prefix + path).Handler(handler)
+	if oldPath == "" {
+		return routeGroup{route}
+	}
+	alias := r.Methods(method).Path(oldPath).Handler(handler)
+	a.legacy[alias] = route
+
+	return routeGroup{route, alias}
+}
 
-	teacherRouter.Methods(http.MethodPost).Path("/teacher/chat/{idChat:[0-9]+}/ahtung").HandlerFunc(h.Ahtung)
-	teacherRouter.Methods(http.MethodPost).Path("/teacher/chat/{idChat:[0-9]+}/rating").HandlerFunc(h.Rating)
+// routeGroup - роут и его старые адреса
+type routeGroup []*mux.Route
 
-	return router
+// Name - имя для журнала действий, у алиаса то же, что у нового роута
+func (g routeGroup) Name(name string) {
+	for _, route := range g {
+		route.Name(name)
+	}
 }
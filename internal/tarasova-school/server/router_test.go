@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequestLoggerWrapsRouter - запросы мимо роутов тоже получают X-Request-ID и попадают в метрики
+func TestRequestLoggerWrapsRouter(t *testing.T) {
+
+	router, h := newTestRouter(t)
+	handler := h.RequestLogger(router)
+
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{method: http.MethodGet, target: "/v1/no-such-route", status: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/v1/auth/login", status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/openapi.json", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+		if rec.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s %s: no X-Request-ID", tt.method, tt.target)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`school_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`school_http_requests_total{method="DELETE",route="unmatched",status="405"}`,
+		`school_http_requests_total{method="GET",route="/openapi.json",status="200"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics without %s", want)
+		}
+	}
+}
+
+// TestStudentNeedsUsersView - профиль ученика видят только роли с правом users.view
+func TestStudentNeedsUsersView(t *testing.T) {
+
+	studentToken, err := infrastruct.GenerateJWT(8, types.RoleStudent, 0, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+	}{
+		{name: "anonymous", target: "/v1/students/7", status: http.StatusForbidden},
+		{name: "anonymous old path", target: "/users/7", status: http.StatusForbidden},
+		{name: "student", target: "/v1/students/7", token: studentToken, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _, db := newTestServer(t)
+			db.On("SELECT user_role, token_version", "user_role", "token_version", "suspended", "suspend_reason").
+				Row(types.RoleStudent, 0, false, "")
+			db.On("FROM roles LEFT JOIN role_permissions", "name", "description", "builtin", "permissions").
+				Row(types.RoleStudent, "", true, "{chats.ask}")
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("X-api-token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if db.Executed("SELECT email, pass, first_name") {
+				t.Error("profile loaded without users.view")
+			}
+		})
+	}
+}
@@ -1,15 +1,90 @@
 package server
 
 import (
+	"context"
 	"github.com/tarasova-school/internal/tarasova-school/server/handlers"
+	"github.com/tarasova-school/internal/types/config"
 	"github.com/tarasova-school/pkg/logger"
 	"net/http"
+	"time"
 )
 
-func StartServer(handlers *handlers.Handlers, port string) {
-	router := NewRouter(handlers)
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 10 * time.Minute
+	defaultWriteTimeout      = 30 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// StartServer обслуживает запросы, пока не отменят ctx, затем ждет текущие запросы не дольше shutdown_timeout
+func StartServer(ctx context.Context, handlers *handlers.Handlers, port string, cnf *config.Server) error {
 	logger.LogInfo("Restart server")
-	if err := http.ListenAndServe(port, router); err != nil {
-		logger.LogFatal(err)
+	router, err := NewRouter(handlers)
+	if err != nil {
+		return err
+	}
+	//access log и метрики снаружи роутера, иначе 404 и 405 в них не попадут
+	return run(ctx, newHTTPServer(port, handlers.RequestLogger(router), cnf), cnf)
+}
+
+// StartMetricsServer отдает /metrics на отдельном адресе, обычно доступном только изнутри
+func StartMetricsServer(ctx context.Context, handlers *handlers.Handlers, addr string, cnf *config.Server) error {
+	router := http.NewServeMux()
+	router.HandleFunc("/metrics", handlers.Metrics)
+	return run(ctx, newHTTPServer(addr, router, cnf), cnf)
+}
+
+func run(ctx context.Context, srv *http.Server, cnf *config.Server) error {
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cnf.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func newHTTPServer(addr string, handler http.Handler, cnf *config.Server) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cnf.ReadHeaderTimeout,
+		ReadTimeout:       cnf.ReadTimeout,
+		WriteTimeout:      cnf.WriteTimeout,
+		IdleTimeout:       cnf.IdleTimeout,
+	}
+}
+
+// NewServerConfig заполняет незаданные таймауты значениями по умолчанию
+func NewServerConfig(cnf *config.Server) *config.Server {
+
+	if cnf == nil {
+		cnf = &config.Server{}
+	}
+	if cnf.ReadHeaderTimeout <= 0 {
+		cnf.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if cnf.ReadTimeout <= 0 {
+		cnf.ReadTimeout = defaultReadTimeout
+	}
+	if cnf.WriteTimeout <= 0 {
+		cnf.WriteTimeout = defaultWriteTimeout
+	}
+	if cnf.IdleTimeout <= 0 {
+		cnf.IdleTimeout = defaultIdleTimeout
+	}
+	if cnf.ShutdownTimeout <= 0 {
+		cnf.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	return cnf
 }
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/tarasova-school/internal/clients/postgres/postgrestest"
+	"github.com/tarasova-school/internal/tarasova-school/service"
+	"github.com/tarasova-school/internal/types/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetVideo(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	if err = ioutil.WriteFile(filepath.Join(dir, "4"), []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		lesson bool
+		target string
+		status int
+		body   string
+	}{
+		{name: "unknown lesson", target: "/v1/courses/1/sections/2/levels/3/lessons/4/video", status: http.StatusNotFound},
+		{name: "video not uploaded", lesson: true, target: "/v1/courses/1/sections/2/levels/3/lessons/5/video",
+			status: http.StatusNotFound},
+		{name: "video", lesson: true, target: "/v1/courses/1/sections/2/levels/3/lessons/4/video",
+			status: http.StatusOK, body: "video"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := newTestConfig()
+			cnf.VideoDir = dir
+			cnf.Email = &config.ConfigForSendEmail{}
+			db, pg := postgrestest.New()
+			srv, err := service.NewService(pg, cnf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			router, _ := newRouterWithService(t, srv, cnf)
+			if tt.lesson {
+				db.On("FROM lessons WHERE course_id = $1 AND section_id = $2", "course_id", "section_id", "level_id", "lesson_id").
+					Row(1, 2, 3, 4)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body %q, want %q", rec.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+)
+
+func (s *Service) GetTeacherAnalytics(ctx context.Context, teacherID int, period *types.ReportPeriod, unit string) (*types.TeacherAnalytics, error) {
+
+	if unit != types.AnalyticsByDay && unit != types.AnalyticsByWeek {
+		return nil, infrastruct.ErrorBadRequest
+	}
+
+	analytics, err := s.teacherAnalyticsTotal(ctx, teacherID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics.Buckets, err = s.p.GetTeacherEventsByPeriod(ctx, teacherID, period, unit)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTeacherEventsByPeriod"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return analytics, nil
+}
+
+func (s *Service) GetAllTeachersAnalytics(ctx context.Context, period *types.ReportPeriod) ([]types.TeacherAnalytics, error) {
+
+	analytics, err := s.p.GetAllTeachersAnalytics(ctx, period)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllTeachersAnalytics"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return analytics, nil
+}
+
+func (s *Service) teacherAnalyticsTotal(ctx context.Context, teacherID int, period *types.ReportPeriod) (*types.TeacherAnalytics, error) {
+
+	name, err := s.p.GetUserNameByUserID(ctx, teacherID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	total, err := s.p.GetTeacherEventsTotal(ctx, teacherID, period)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTeacherEventsTotal"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	unanswered, err := s.p.CountUnansweredChatsByTeacherID(ctx, teacherID, period)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CountUnansweredChatsByTeacherID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.TeacherAnalytics{
+		TeacherID:  teacherID,
+		FirstName:  name,
+		Unanswered: unanswered,
+		Total:      *total,
+	}, nil
+}
+
+// addTeacherEvent пишет событие в журнал аналитики, ошибка не должна ломать основной запрос
+func (s *Service) addTeacherEvent(ctx context.Context, ev *types.TeacherEvent) {
+
+	if err := s.p.AddTeacherEvent(ctx, ev); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddTeacherEvent"))
+	}
+}
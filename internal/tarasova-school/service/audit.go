@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditRetention       = 365 * 24 * time.Hour
+	defaultAuditCleanupInterval = 24 * time.Hour
+	defaultAuditLimit           = 50
+	maxAuditLimit               = 500
+	auditRedacted               = "***"
+)
+
+// auditSecretFields - значения этих полей в журнал не попадают
+var auditSecretFields = []string{"pass", "token", "code", "secret"}
+
+// RecordAudit сохраняет действие в журнал. before и after - состояние сущности до и после,
+// в журнал пишутся только изменившиеся поля
+func (s *Service) RecordAudit(ctx context.Context, entry *types.AuditEntry, before, after interface{}) {
+
+	beforeMap, err := auditFields(before)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with auditFields before"))
+	}
+	afterMap, err := auditFields(after)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with auditFields after"))
+	}
+	if beforeMap != nil && afterMap != nil {
+		for key, value := range beforeMap {
+			if reflect.DeepEqual(value, afterMap[key]) {
+				delete(beforeMap, key)
+				delete(afterMap, key)
+			}
+		}
+	}
+
+	if entry.Before, err = marshalAuditFields(beforeMap); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with marshal audit before"))
+	}
+	if entry.After, err = marshalAuditFields(afterMap); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with marshal audit after"))
+	}
+
+	if err = s.p.AddAuditEntry(ctx, entry); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, fmt.Sprintf("err with AddAuditEntry %s %s", entry.Action, entry.EntityID)))
+	}
+}
+
+func (s *Service) GetAuditLog(ctx context.Context, filter *types.AuditFilter) (*types.AuditLog, error) {
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	entries, total, err := s.p.GetAuditLog(ctx, filter)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAuditLog"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	log := &types.AuditLog{Entries: make([]types.AuditEntryView, 0, len(entries)), Total: total}
+	for _, entry := range entries {
+		view := types.AuditEntryView{AuditEntry: entry}
+		if len(entry.Before) != 0 {
+			view.Before = json.RawMessage(entry.Before)
+		}
+		if len(entry.After) != 0 {
+			view.After = json.RawMessage(entry.After)
+		}
+		log.Entries = append(log.Entries, view)
+	}
+
+	return log, nil
+}
+
+// GetUserAccess - роль и блокировка пользователя, нужна журналу для снимков состояния
+func (s *Service) GetUserAccess(ctx context.Context, userID int) (*types.UserAccess, error) {
+	return s.getUserAccess(ctx, userID)
+}
+
+// RunAuditRetention раз в cleanup_interval удаляет записи журнала старше retention, пока не отменят ctx
+func (s *Service) RunAuditRetention(ctx context.Context) {
+
+	ticker := time.NewTicker(s.audit.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.p.DeleteAuditBefore(ctx, time.Now().Add(-s.audit.Retention))
+		if err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteAuditBefore"))
+		} else if deleted > 0 {
+			logger.LogInfoCtx(ctx, fmt.Sprintf("Из журнала действий удалено старых записей: %d", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// auditFields переводит снимок сущности в map полей json и прячет секреты
+func auditFields(v interface{}) (map[string]interface{}, error) {
+
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		fields = map[string]interface{}{"value": decoded}
+	}
+	redactAudit(fields)
+
+	return fields, nil
+}
+
+func redactAudit(v interface{}) {
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if isAuditSecret(key) {
+				value[key] = auditRedacted
+				continue
+			}
+			redactAudit(field)
+		}
+	case []interface{}:
+		for _, item := range value {
+			redactAudit(item)
+		}
+	}
+}
+
+func isAuditSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range auditSecretFields {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func marshalAuditFields(fields map[string]interface{}) ([]byte, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+func newAuditConfig(audit *config.Audit) *config.Audit {
+
+	if audit == nil {
+		audit = &config.Audit{}
+	}
+	if audit.Retention <= 0 {
+		audit.Retention = defaultAuditRetention
+	}
+	if audit.CleanupInterval <= 0 {
+		audit.CleanupInterval = defaultAuditCleanupInterval
+	}
+
+	return audit
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClonePollInterval = 5 * time.Second
+	defaultCloneLockFor      = 5 * time.Minute
+
+	//причина ошибки пишется в лог, в задаче остается только факт
+	cloneFailedMessage = "копирование не удалось, причина в логе сервера"
+)
+
+// CloneCourse ставит копирование курса в очередь, копирует RunCourseCloner. Ход копирования - в GetCourseCloneJob
+func (s *Service) CloneCourse(ctx context.Context, idCourse int, options *types.CloneCourse, claims *infrastruct.CustomClaims) (*types.CourseCloneJob, error) {
+
+	//check correct courseID in URL
+	if err := s.p.CheckURLByC(ctx, idCourse); err != nil {
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	options.Name = strings.TrimSpace(options.Name)
+	if options.Videos == "" {
+		options.Videos = types.CloneVideosNone
+	}
+	job := &types.CourseCloneJob{CourseID: idCourse, Options: *options, CreatedBy: claims.UserID}
+	if err := s.p.CreateCourseCloneJob(ctx, job); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateCourseCloneJob"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return job, nil
+}
+
+func (s *Service) GetCourseCloneJob(ctx context.Context, id int) (*types.CourseCloneJob, error) {
+
+	job, err := s.p.GetCourseCloneJob(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetCourseCloneJob"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	switch {
+	case job.Status == types.CloneDone:
+		job.Progress = 100
+	case job.Total > 0:
+		job.Progress = job.Done * 100 / job.Total
+	}
+
+	return job, nil
+}
+
+// RunCourseCloner копирует курсы из очереди по одному, пока не отменят ctx. Задача, прерванная остановкой сервиса,
+// остается в работе и подхватывается заново, когда истечет ее лок
+func (s *Service) RunCourseCloner(ctx context.Context) {
+
+	ticker := time.NewTicker(s.courseClone.PollInterval)
+	defer ticker.Stop()
+	for {
+		for s.cloneNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cloneNext выполняет одну задачу из очереди, false - задач нет или сервис останавливается
+func (s *Service) cloneNext(ctx context.Context) bool {
+
+	job, err := s.p.ClaimCourseCloneJob(ctx, s.courseClone.LockFor)
+	if err != nil {
+		if err != sql.ErrNoRows && ctx.Err() == nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ClaimCourseCloneJob"))
+		}
+		return false
+	}
+
+	errText := ""
+	if err = s.cloneCourse(ctx, job); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, fmt.Sprintf("err with clone course %d, job %d", job.CourseID, job.ID)))
+		errText = cloneFailedMessage
+	}
+	if err = s.p.FinishCourseCloneJob(ctx, job.ID, errText); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with FinishCourseCloneJob"))
+	}
+
+	return true
+}
+
+// cloneCourse копирует курс, затем видео. Если курс уже скопирован до падения, повторяются только видео
+func (s *Service) cloneCourse(ctx context.Context, job *types.CourseCloneJob) error {
+
+	videos := job.Options.Videos == types.CloneVideosLink || job.Options.Videos == types.CloneVideosCopy
+	if job.NewCourseID == 0 {
+		course, err := s.p.GetCourse(ctx, job.CourseID)
+		if err != nil {
+			return errors.Wrap(err, "err with GetCourse")
+		}
+		course.Name = cloneName(course.Name, job.Options.Name)
+		if job.Options.Cost != nil {
+			course.Cost = *job.Options.Cost
+		}
+		if job.Options.ResetSale {
+			course.Sale = 0
+		}
+		course.TotalPrice = totalPrice(course.Cost, course.Sale)
+
+		if err = s.p.CloneCourse(ctx, job, course, videos, s.courseClone.LockFor); err != nil {
+			return errors.Wrap(err, "err with CloneCourse")
+		}
+	}
+	if !videos {
+		return nil
+	}
+
+	job.Done = job.Total - len(job.LessonMap)
+	for from, to := range job.LessonMap {
+		if err := s.cloneVideo(from, to, job.Options.Videos); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("err with clone video of lesson %d", from))
+		}
+		job.Done++
+		if err := s.p.SetCourseCloneProgress(ctx, job.ID, job.Done, s.courseClone.LockFor); err != nil {
+			return errors.Wrap(err, "err with SetCourseCloneProgress")
+		}
+	}
+
+	return nil
+}
+
+// cloneVideo копирует видео урока from уроку to, если оно есть. Жесткая ссылка не мешает заменить видео копии:
+// UploadVideo удаляет старый файл и создает новый, видео исходного урока остается
+func (s *Service) cloneVideo(from, to int, mode string) error {
+
+	src := filepath.Join(s.videoDir, strconv.Itoa(from))
+	dst := filepath.Join(s.videoDir, strconv.Itoa(to))
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	//после падения копия могла остаться недописанной
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if mode == types.CloneVideosLink {
+		return os.Link(src, dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func cloneName(source, name string) string {
+	if name != "" {
+		return name
+	}
+	return source + " (копия)"
+}
+
+func newCourseCloneConfig(clone *config.CourseClone) *config.CourseClone {
+
+	if clone == nil {
+		clone = &config.CourseClone{}
+	}
+	if clone.PollInterval <= 0 {
+		clone.PollInterval = defaultClonePollInterval
+	}
+	if clone.LockFor <= 0 {
+		clone.LockFor = defaultCloneLockFor
+	}
+
+	return clone
+}
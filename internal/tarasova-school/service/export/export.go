@@ -0,0 +1,85 @@
+package export
+
+import (
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer пишет отчет построчно, не держа его целиком в памяти
+type Writer interface {
+	WriteRow(row []string) error
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w), nil
+	default:
+		return nil, errors.Errorf("unknown export format %q", format)
+	}
+}
+
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// flushEvery - сколько строк копим в буфере перед отправкой клиенту
+const flushEvery = 100
+
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteRow(row []string) error {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		escaped[i] = escapeFormula(cell)
+	}
+	if err := c.w.Write(escaped); err != nil {
+		return errors.Wrap(err, "err with csv Write")
+	}
+	c.rows++
+	if c.rows%flushEvery == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula - excel считает ячейку, начинающуюся с =, +, -, @, табуляции или перевода строки, формулой.
+// Имена и тексты пишут пользователи, поэтому такие ячейки экранируем апострофом. Числа вроде -5 оставляем
+// как есть, иначе excel прочитает их текстом
+func escapeFormula(cell string) string {
+	if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return cell
+	}
+	if _, err := strconv.ParseFloat(cell, 64); err == nil {
+		return cell
+	}
+	return "'" + cell
+}
@@ -0,0 +1,27 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSVEscapesFormulas(t *testing.T) {
+
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := []string{"=HYPERLINK(\"x\")", "+1", "-1", "-2.5", "-1+cmd|' /C calc'!A0", "@SUM(A1)", "\tx", "\rx", "Иван", "", "a=b"}
+	if err = w.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\"'=HYPERLINK(\"\"x\"\")\",+1,-1,-2.5,'-1+cmd|' /C calc'!A0,'@SUM(A1),'\tx,\"'\rx\",Иван,,a=b\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// xlsxWriter пишет минимальную книгу с одним листом. Лист идет первым файлом архива и
+// пишется по мере поступления строк, остальные служебные файлы дописываются в Close.
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w)}
+}
+
+func (x *xlsxWriter) start() error {
+	f, err := x.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return errors.Wrap(err, "err with Create sheet")
+	}
+	x.sheet = bufio.NewWriter(f)
+	_, err = x.sheet.WriteString(xml.Header +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return err
+}
+
+func (x *xlsxWriter) WriteRow(row []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.sheet == nil {
+		if x.err = x.start(); x.err != nil {
+			return x.err
+		}
+	}
+
+	x.rows++
+	x.write(`<row r="` + strconv.Itoa(x.rows) + `">`)
+	for i, v := range row {
+		ref := columnName(i) + strconv.Itoa(x.rows)
+		if isNumber(v) {
+			x.write(`<c r="` + ref + `"><v>` + v + `</v></c>`)
+			continue
+		}
+		x.write(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if x.err == nil {
+			x.err = xml.EscapeText(x.sheet, []byte(v))
+		}
+		x.write(`</t></is></c>`)
+	}
+	x.write(`</row>`)
+
+	if x.err == nil && x.rows%flushEvery == 0 {
+		x.err = x.sheet.Flush()
+		if x.err == nil {
+			x.err = x.zw.Flush()
+		}
+	}
+
+	return x.err
+}
+
+func (x *xlsxWriter) write(s string) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = x.sheet.WriteString(s)
+}
+
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.sheet == nil {
+		if err := x.start(); err != nil {
+			return err
+		}
+	}
+
+	x.write(`</sheetData></worksheet>`)
+	if x.err != nil {
+		return errors.Wrap(x.err, "err with write sheet")
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return errors.Wrap(err, "err with Flush sheet")
+	}
+
+	for _, f := range xlsxStaticFiles {
+		fw, err := x.zw.Create(f.name)
+		if err != nil {
+			return errors.Wrap(err, "err with Create "+f.name)
+		}
+		if _, err = io.WriteString(fw, xml.Header+f.body); err != nil {
+			return errors.Wrap(err, "err with write "+f.name)
+		}
+	}
+
+	return x.zw.Close()
+}
+
+// isNumber - числа пишем числовыми ячейками, чтобы по ним работали формулы
+func isNumber(v string) bool {
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		return false
+	}
+	return strings.IndexFunc(v, unicode.IsLetter) == -1
+}
+
+// columnName переводит индекс колонки в буквенное обозначение: 0 -> A, 26 -> AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+var xlsxStaticFiles = []struct {
+	name string
+	body string
+}{
+	{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="report" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// readXLSX открывает книгу и возвращает файлы архива по именам и порядок, в котором они записаны
+func readXLSX(t *testing.T, data []byte) (map[string]string, []string) {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	var names []string
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(body)
+		names = append(names, f.Name)
+	}
+
+	return files, names
+}
+
+func TestXLSXWriter(t *testing.T) {
+
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatXLSX, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow([]string{"Курс", "Цена"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow([]string{`<b>"Tom & Jerry"</b>`, "1500", "-2.5", "1e5", "=SUM(A1)", "  x  "}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, names := readXLSX(t, buf.Bytes())
+	if names[0] != "xl/worksheets/sheet1.xml" {
+		t.Errorf("first file %q, sheet must be streamed first", names[0])
+	}
+	for _, f := range xlsxStaticFiles {
+		if _, ok := files[f.name]; !ok {
+			t.Errorf("no %s in workbook", f.name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	want := `<sheetData>` +
+		`<row r="1">` +
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">Курс</t></is></c>` +
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">Цена</t></is></c>` +
+		`</row>` +
+		`<row r="2">` +
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;b&gt;&#34;Tom &amp; Jerry&#34;&lt;/b&gt;</t></is></c>` +
+		`<c r="B2"><v>1500</v></c>` +
+		`<c r="C2"><v>-2.5</v></c>` +
+		`<c r="D2" t="inlineStr"><is><t xml:space="preserve">1e5</t></is></c>` +
+		`<c r="E2" t="inlineStr"><is><t xml:space="preserve">=SUM(A1)</t></is></c>` +
+		`<c r="F2" t="inlineStr"><is><t xml:space="preserve">  x  </t></is></c>` +
+		`</row>` +
+		`</sheetData>`
+	if !strings.Contains(sheet, want) {
+		t.Errorf("sheet\n%s\nwant\n%s", sheet, want)
+	}
+
+	//ячейки должны читаться обратно как написаны, включая экранированные символы
+	var parsed struct {
+		Rows []struct {
+			Cells []struct {
+				Ref   string `xml:"r,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err = xml.Unmarshal([]byte(sheet), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Rows[1].Cells[0].Text; got != `<b>"Tom & Jerry"</b>` {
+		t.Errorf("A2 = %q", got)
+	}
+	if got := parsed.Rows[1].Cells[1].Value; got != "1500" {
+		t.Errorf("B2 = %q", got)
+	}
+}
+
+func TestXLSXWriterEmpty(t *testing.T) {
+
+	var buf bytes.Buffer
+	w := newXLSXWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := readXLSX(t, buf.Bytes())
+	if sheet := files["xl/worksheets/sheet1.xml"]; !strings.HasSuffix(sheet, `<sheetData></sheetData></worksheet>`) {
+		t.Errorf("sheet %q", sheet)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for i, want := range tests {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/logger"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// readyCheckTimeout - на каждую проверку /readyz, чтобы зависшая зависимость не держала пробу
+const readyCheckTimeout = 3 * time.Second
+
+// Ready проверяет зависимости, без которых сервис не может обслуживать запросы
+func (s *Service) Ready(ctx context.Context) *types.Readiness {
+
+	checks := map[string]func(ctx context.Context) error{
+		"postgres":  s.p.Ping,
+		"video_dir": s.checkVideoDir,
+		"mail":      s.mailer.Check,
+	}
+
+	readiness := &types.Readiness{Ready: true, Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+			defer cancel()
+
+			result := types.CheckOK
+			if err := check(checkCtx); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrapf(err, "err with readiness check %s", name))
+				result = types.CheckFailed
+			}
+
+			mu.Lock()
+			readiness.Checks[name] = result
+			if result != types.CheckOK {
+				readiness.Ready = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	return readiness
+}
+
+func (s *Service) checkVideoDir(_ context.Context) error {
+
+	f, err := ioutil.TempFile(s.videoDir, ".check-*")
+	if err != nil {
+		return errors.Wrap(err, "err with TempFile")
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// Shutdown ждет фоновые задачи, запущенные запросами (письма, уведомления), не дольше ctx
+func (s *Service) Shutdown(ctx context.Context) error {
+
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("background tasks are not finished before shutdown timeout")
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLockoutThreshold    = 5
+	defaultLockoutWindow       = 15 * time.Minute
+	defaultLockoutBaseDuration = time.Minute
+	defaultLockoutMaxDuration  = time.Hour
+)
+
+// checkLoginLockout возвращает ошибку с Retry-After, если вход по email сейчас заблокирован
+func (s *Service) checkLoginLockout(ctx context.Context, email string) error {
+
+	wait, err := s.lockedFor(ctx, lockoutKey(email))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		loginFailures.Inc(loginFailureLocked)
+		return infrastruct.NewRetryError(infrastruct.ErrorLoginLocked, wait)
+	}
+
+	return nil
+}
+
+func (s *Service) addLoginFailure(ctx context.Context, email string) {
+	s.addFailure(ctx, lockoutKey(email))
+}
+
+func (s *Service) resetLoginFailures(ctx context.Context, email string) {
+	s.resetFailures(ctx, lockoutKey(email))
+}
+
+// lockedFor - сколько еще заблокирован ключ, 0 - не заблокирован
+func (s *Service) lockedFor(ctx context.Context, key string) (time.Duration, error) {
+
+	until, err := s.p.GetLoginLockedUntil(ctx, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLoginLockedUntil"))
+		return 0, infrastruct.ErrorInternalServerError
+	}
+	if wait := time.Until(until); wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
+
+// addFailure считает неудачу и после threshold неудач блокирует ключ, каждый раз вдвое дольше.
+// Возвращает, на сколько ключ заблокирован, 0 - не заблокирован
+func (s *Service) addFailure(ctx context.Context, key string) time.Duration {
+
+	failures, err := s.p.AddLoginFailure(ctx, key, time.Now().Add(-s.lockout.Window))
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddLoginFailure"))
+		return 0
+	}
+	if failures < s.lockout.Threshold {
+		return 0
+	}
+
+	duration := s.lockout.BaseDuration
+	for i := s.lockout.Threshold; i < failures && duration < s.lockout.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > s.lockout.MaxDuration {
+		duration = s.lockout.MaxDuration
+	}
+	if err = s.p.SetLoginLockedUntil(ctx, key, time.Now().Add(duration)); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetLoginLockedUntil"))
+	}
+
+	return duration
+}
+
+func (s *Service) resetFailures(ctx context.Context, key string) {
+	if err := s.p.DeleteLoginFailures(ctx, key); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteLoginFailures"))
+	}
+}
+
+func lockoutKey(email string) string {
+	return normalizeEmail(email)
+}
+
+// normalizeEmail - email в том виде, в каком он хранится в users
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// twoFactorLockoutKey - неверные коды 2FA считаются по пользователю, общим счетчиком для входа, step-up и отключения
+func twoFactorLockoutKey(userID int) string {
+	return "2fa:" + strconv.Itoa(userID)
+}
+
+func newLoginLockoutConfig(lockout *config.LoginLockout) *config.LoginLockout {
+
+	if lockout == nil {
+		lockout = &config.LoginLockout{}
+	}
+	if lockout.Threshold <= 0 {
+		lockout.Threshold = defaultLockoutThreshold
+	}
+	if lockout.Window <= 0 {
+		lockout.Window = defaultLockoutWindow
+	}
+	if lockout.BaseDuration <= 0 {
+		lockout.BaseDuration = defaultLockoutBaseDuration
+	}
+	if lockout.MaxDuration < lockout.BaseDuration {
+		lockout.MaxDuration = defaultLockoutMaxDuration
+		if lockout.MaxDuration < lockout.BaseDuration {
+			lockout.MaxDuration = lockout.BaseDuration
+		}
+	}
+
+	return lockout
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"testing"
+	"time"
+)
+
+// TestAuthorizeNormalizesEmail - блокировка, ее счетчик и поиск пользователя идут по одному email
+func TestAuthorizeNormalizesEmail(t *testing.T) {
+
+	for _, email := range []string{"anna@mail.ru", " Anna@Mail.RU\t", "ANNA@MAIL.RU "} {
+		t.Run(email, func(t *testing.T) {
+			srv, db := newTestService(t)
+			db.On("INSERT INTO login_lockouts", "failures").Row(1)
+
+			_, err := srv.Authorize(context.Background(), &types.Authorize{Email: email, Password: "wrong"})
+			if err != infrastruct.ErrorPasswordIsIncorrect {
+				t.Fatalf("err %v, want ErrorPasswordIsIncorrect", err)
+			}
+			for _, q := range db.Queries() {
+				if len(q.Args) > 0 && q.Args[0] != "anna@mail.ru" {
+					t.Errorf("%s with %q", q.SQL, q.Args[0])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeLockedOut(t *testing.T) {
+
+	srv, db := newTestService(t)
+	db.On("SELECT locked_until FROM login_lockouts", "locked_until").Row(time.Now().Add(time.Minute))
+
+	_, err := srv.Authorize(context.Background(), &types.Authorize{Email: " Anna@Mail.RU", Password: "secret"})
+	if _, ok := err.(*infrastruct.RetryError); !ok {
+		t.Fatalf("err %v, want RetryError", err)
+	}
+	if db.Executed("FROM users WHERE email") {
+		t.Error("user looked up while login is locked")
+	}
+}
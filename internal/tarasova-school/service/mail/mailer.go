@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types/config"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+)
+
+// Mailer собирает письмо из шаблона реестра и отдает его транспорту
+type Mailer struct {
+	from      string
+	fromName  string
+	transport Transport
+}
+
+func NewMailer(cnf *config.ConfigForSendEmail, transport Transport) *Mailer {
+	return &Mailer{from: cnf.EmailLogin, fromName: cnf.FromName, transport: transport}
+}
+
+// NewTransport выбирает транспорт по конфигу: smtp по умолчанию или file для разработки
+func NewTransport(cnf *config.ConfigForSendEmail) (Transport, error) {
+	switch cnf.Transport {
+	case "", TransportSMTP:
+		return NewSMTPTransport(cnf), nil
+	case TransportFile:
+		return NewFileTransport(cnf.FileDir)
+	default:
+		return nil, errors.Errorf("unknown mail transport %q", cnf.Transport)
+	}
+}
+
+// Send отправляет письмо, шаблон и тема определяются типом data
+func (m *Mailer) Send(to []string, data TemplateData) error {
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+
+	msg, err := render(data)
+	if err != nil {
+		return errors.Wrap(err, "err while render")
+	}
+	msg.From = Address{Name: m.fromName, Email: m.from}
+	msg.To = to
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "err while build message")
+	}
+
+	if err = m.transport.Send(m.from, to, body); err != nil {
+		return errors.Wrap(err, "err while send")
+	}
+
+	return nil
+}
+
+// Check проверяет, что транспорт сейчас может отправлять письма
+func (m *Mailer) Check(ctx context.Context) error {
+	if checker, ok := m.transport.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
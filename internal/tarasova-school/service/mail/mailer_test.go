@@ -0,0 +1,222 @@
+package mail
+
+import (
+	"bytes"
+	"github.com/tarasova-school/internal/types/config"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+)
+
+func newTestMailer() (*Mailer, *MemoryTransport) {
+	transport := NewMemoryTransport()
+	return NewMailer(&config.ConfigForSendEmail{EmailLogin: "school@tarasova-school.ru", FromName: "Школа Тарасовой"},
+		transport), transport
+}
+
+func TestSendHeaders(t *testing.T) {
+
+	m, transport := newTestMailer()
+	to := []string{"anna@mail.ru", "boris@mail.ru"}
+	if err := m.Send(to, PasswordRecovery{Code: "123456"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := transport.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	if sent[0].From != "school@tarasova-school.ru" || strings.Join(sent[0].To, ",") != "anna@mail.ru,boris@mail.ru" {
+		t.Errorf("envelope from %s to %v", sent[0].From, sent[0].To)
+	}
+
+	msg := parse(t, sent[0].Body)
+	from, err := msg.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from[0].Name != "Школа Тарасовой" || from[0].Address != "school@tarasova-school.ru" {
+		t.Errorf("from %+v", from[0])
+	}
+	if got := msg.Header.Get("To"); got != "anna@mail.ru, boris@mail.ru" {
+		t.Errorf("to %q", got)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@tarasova-school.ru>") {
+		t.Errorf("message id %q", msg.Header.Get("Message-ID"))
+	}
+	if _, err = msg.Header.Date(); err != nil {
+		t.Errorf("date: %v", err)
+	}
+	if msg.Header.Get("MIME-Version") != "1.0" {
+		t.Errorf("mime version %q", msg.Header.Get("MIME-Version"))
+	}
+}
+
+func TestSendSubjectEncoded(t *testing.T) {
+
+	m, transport := newTestMailer()
+	if err := m.Send([]string{"anna@mail.ru"}, PasswordRecovery{Code: "123456"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := parse(t, transport.Messages()[0].Body).Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?UTF-8?b?") {
+		t.Errorf("subject %q is not B-encoded", raw)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Восстановление пароля для tarasova-school.ru" {
+		t.Errorf("subject %q", subject)
+	}
+}
+
+func TestSendRendersTemplate(t *testing.T) {
+
+	m, transport := newTestMailer()
+	data := EmailVerification{FirstName: "<b>Анна</b>", URL: "https://tarasova-school.ru/verify?token=a&b"}
+	if err := m.Send([]string{"anna@mail.ru"}, data); err != nil {
+		t.Fatal(err)
+	}
+
+	body := transport.Messages()[0].Body
+	if bytes.Count(body, []byte("Content-Transfer-Encoding: quoted-printable")) != 2 {
+		t.Error("parts are not quoted-printable")
+	}
+	parts := partsOf(t, parse(t, body))
+	text, html := parts["text/plain; charset=UTF-8"], parts["text/html; charset=UTF-8"]
+	if !strings.Contains(text, "<b>Анна</b>, подтвердите email, перейдя по ссылке: "+data.URL) {
+		t.Errorf("text part %q", text)
+	}
+	if !strings.HasSuffix(text, footer) {
+		t.Errorf("text part without footer %q", text)
+	}
+	if !strings.Contains(html, "&lt;b&gt;Анна&lt;/b&gt;") || strings.Contains(html, "<b>Анна</b>") {
+		t.Errorf("html part is not escaped %q", html)
+	}
+	if !strings.Contains(html, `href="https://tarasova-school.ru/verify?token=a&amp;b"`) {
+		t.Errorf("html part link %q", html)
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+
+	tests := []struct {
+		data    TemplateData
+		subject string
+		text    string
+		html    string
+	}{
+		{
+			data:    Welcome{FirstName: "Анна"},
+			subject: "Добро пожаловать в школу Тарасовой",
+			text:    "Анна, вы успешно зарегистрировались на tarasova-school.ru.",
+			html:    "<h3>Анна, добро пожаловать!</h3>",
+		},
+		{
+			data:    PasswordRecovery{Code: "123456"},
+			subject: "Восстановление пароля для tarasova-school.ru",
+			text:    "Ваш код для восстановления пароля - 123456",
+			html:    "<h3>Ваш код для восстановления пароля - 123456</h3>",
+		},
+		{
+			data:    Enrollment{FirstName: "Анна", CourseName: "Английский"},
+			subject: "Вы записаны на курс «Английский»",
+			text:    "Анна, вы записаны на курс «Английский». Уроки уже доступны в личном кабинете.",
+			html:    "<h3>Анна, вы записаны на курс «Английский»</h3>",
+		},
+		{
+			data:    HomeworkReviewed{FirstName: "Анна", LessonName: "Present Simple", Comment: "Хорошо & <аккуратно>"},
+			subject: "Домашнее задание по уроку «Present Simple» проверено",
+			text:    "Анна, учитель проверил ваше задание по уроку «Present Simple».\n\nХорошо & <аккуратно>",
+			html:    "<p>Хорошо &amp; &lt;аккуратно&gt;</p>",
+		},
+		{
+			data:    Certificate{FirstName: "Анна", CourseName: "Английский", URL: "https://tarasova-school.ru/cert/1"},
+			subject: "Сертификат об окончании курса «Английский»",
+			text:    "Анна, поздравляем с окончанием курса «Английский»! Сертификат: https://tarasova-school.ru/cert/1",
+			html:    `<a href="https://tarasova-school.ru/cert/1">Скачать сертификат</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data.TemplateName(), func(t *testing.T) {
+			msg, err := render(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("subject %q, want %q", msg.Subject, tt.subject)
+			}
+			if msg.Text != tt.text+footer {
+				t.Errorf("text %q, want %q", msg.Text, tt.text+footer)
+			}
+			if !strings.Contains(msg.HTML, tt.html) {
+				t.Errorf("html %q does not contain %q", msg.HTML, tt.html)
+			}
+		})
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+
+	m, transport := newTestMailer()
+	if err := m.Send(nil, Welcome{FirstName: "Анна"}); err == nil {
+		t.Error("sent without recipients")
+	}
+	if err := m.Send([]string{"anna@mail.ru"}, unknownTemplate{}); err == nil {
+		t.Error("sent with unknown template")
+	}
+	if len(transport.Messages()) != 0 {
+		t.Error("failed message reached transport")
+	}
+}
+
+type unknownTemplate struct{}
+
+func (unknownTemplate) TemplateName() string { return "unknown" }
+
+func parse(t *testing.T, body []byte) *netmail.Message {
+	t.Helper()
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// partsOf - части multipart/alternative по Content-Type, уже без quoted-printable и с переводами строк \n
+func partsOf(t *testing.T, msg *netmail.Message) map[string]string {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+
+	parts := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		//quoted-printable multipart.Reader снимает сам
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[part.Header.Get("Content-Type")] = strings.ReplaceAll(string(body), "\r\n", "\n")
+	}
+
+	return parts
+}
@@ -0,0 +1,108 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+type Address struct {
+	Name  string
+	Email string
+}
+
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Email
+	}
+	return fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("UTF-8", a.Name), a.Email)
+}
+
+// Message - письмо с текстовой и html версией, собирается в multipart/alternative
+type Message struct {
+	From    Address
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Date    time.Time
+}
+
+func (m *Message) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID, err := newMessageID(m.From.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := multipart.NewWriter(buf)
+	header := []struct{ key, value string }{
+		{"From", m.From.String()},
+		{"To", strings.Join(m.To, ", ")},
+		{"Subject", mime.BEncoding.Encode("UTF-8", m.Subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", mw.Boundary())},
+	}
+	for _, h := range header {
+		buf.WriteString(h.key + ": " + h.value + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	if err = writePart(mw, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if err = writePart(mw, "text/html", m.HTML); err != nil {
+		return nil, err
+	}
+	if err = mw.Close(); err != nil {
+		return nil, errors.Wrap(err, "err with Close multipart")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writePart(mw *multipart.Writer, contentType, body string) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return errors.Wrap(err, "err with CreatePart")
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(body)); err != nil {
+		return errors.Wrap(err, "err with write part")
+	}
+
+	return qp.Close()
+}
+
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "err with rand.Read")
+	}
+
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// TemplateData - данные письма, каждый тип данных знает свой шаблон
+type TemplateData interface {
+	TemplateName() string
+}
+
+type PasswordRecovery struct {
+	Code string
+}
+
+type PasswordChanged struct {
+	FirstName string
+}
+
+type Welcome struct {
+	FirstName string
+}
+
+type EmailVerification struct {
+	FirstName string
+	URL       string
+}
+
+type Enrollment struct {
+	FirstName  string
+	CourseName string
+}
+
+type HomeworkReviewed struct {
+	FirstName  string
+	LessonName string
+	Comment    string
+}
+
+type Certificate struct {
+	FirstName  string
+	CourseName string
+	URL        string
+}
+
+type Notification struct {
+	Title string
+	Body  string
+}
+
+func (PasswordRecovery) TemplateName() string  { return "password_recovery" }
+func (PasswordChanged) TemplateName() string   { return "password_changed" }
+func (Welcome) TemplateName() string           { return "welcome" }
+func (EmailVerification) TemplateName() string { return "email_verification" }
+func (Enrollment) TemplateName() string        { return "enrollment" }
+func (HomeworkReviewed) TemplateName() string  { return "homework_reviewed" }
+func (Certificate) TemplateName() string       { return "certificate" }
+func (Notification) TemplateName() string      { return "notification" }
+
+type template struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+const (
+	site   = "tarasova-school.ru"
+	footer = "\n\n--\nШкола Тарасовой, https://" + site
+)
+
+var templates = map[string]*template{}
+
+func register(name, subject, text, html string) {
+	templates[name] = &template{
+		subject: texttemplate.Must(texttemplate.New(name).Parse(subject)),
+		text:    texttemplate.Must(texttemplate.New(name).Parse(text + footer)),
+		html: htmltemplate.Must(htmltemplate.New(name).Parse("<html><body>" + html +
+			`<p><a href="https://` + site + `">` + site + `</a></p></body></html>`)),
+	}
+}
+
+func init() {
+	register(PasswordRecovery{}.TemplateName(),
+		"Восстановление пароля для "+site,
+		"Ваш код для восстановления пароля - {{.Code}}",
+		"<h3>Ваш код для восстановления пароля - {{.Code}}</h3>")
+	register(PasswordChanged{}.TemplateName(),
+		"Пароль на "+site+" изменен",
+		"{{.FirstName}}, пароль от вашего аккаунта был изменен. Если это были не вы, восстановите пароль и напишите нам.",
+		"<h3>{{.FirstName}}, пароль от вашего аккаунта был изменен</h3>"+
+			"<p>Если это были не вы, восстановите пароль и напишите нам.</p>")
+	register(Welcome{}.TemplateName(),
+		"Добро пожаловать в школу Тарасовой",
+		"{{.FirstName}}, вы успешно зарегистрировались на "+site+".",
+		"<h3>{{.FirstName}}, добро пожаловать!</h3><p>Вы успешно зарегистрировались на "+site+".</p>")
+	register(EmailVerification{}.TemplateName(),
+		"Подтвердите email на "+site,
+		"{{.FirstName}}, подтвердите email, перейдя по ссылке: {{.URL}}",
+		"<h3>{{.FirstName}}, подтвердите email</h3>"+
+			`<p><a href="{{.URL}}">Подтвердить email</a></p>`)
+	register(Enrollment{}.TemplateName(),
+		"Вы записаны на курс «{{.CourseName}}»",
+		"{{.FirstName}}, вы записаны на курс «{{.CourseName}}». Уроки уже доступны в личном кабинете.",
+		"<h3>{{.FirstName}}, вы записаны на курс «{{.CourseName}}»</h3><p>Уроки уже доступны в личном кабинете.</p>")
+	register(HomeworkReviewed{}.TemplateName(),
+		"Домашнее задание по уроку «{{.LessonName}}» проверено",
+		"{{.FirstName}}, учитель проверил ваше задание по уроку «{{.LessonName}}».\n\n{{.Comment}}",
+		"<h3>{{.FirstName}}, учитель проверил ваше задание по уроку «{{.LessonName}}»</h3><p>{{.Comment}}</p>")
+	register(Certificate{}.TemplateName(),
+		"Сертификат об окончании курса «{{.CourseName}}»",
+		"{{.FirstName}}, поздравляем с окончанием курса «{{.CourseName}}»! Сертификат: {{.URL}}",
+		"<h3>{{.FirstName}}, поздравляем с окончанием курса «{{.CourseName}}»!</h3>"+
+			`<p><a href="{{.URL}}">Скачать сертификат</a></p>`)
+	register(Notification{}.TemplateName(),
+		"{{.Title}}",
+		"{{.Title}}\n\n{{.Body}}",
+		"<h3>{{.Title}}</h3><p>{{.Body}}</p>")
+}
+
+func render(data TemplateData) (*Message, error) {
+	t, ok := templates[data.TemplateName()]
+	if !ok {
+		return nil, errors.Errorf("unknown mail template %q", data.TemplateName())
+	}
+
+	subject, text, html := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	if err := t.subject.Execute(subject, data); err != nil {
+		return nil, errors.Wrap(err, "err while Execute subject")
+	}
+	if err := t.text.Execute(text, data); err != nil {
+		return nil, errors.Wrap(err, "err while Execute text")
+	}
+	if err := t.html.Execute(html, data); err != nil {
+		return nil, errors.Wrap(err, "err while Execute html")
+	}
+
+	return &Message{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
@@ -0,0 +1,121 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types/config"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Transport доставляет уже собранное письмо
+type Transport interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// Checker - транспорт, который умеет проверить свою доступность
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type SMTPTransport struct {
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPTransport(cnf *config.ConfigForSendEmail) *SMTPTransport {
+	return &SMTPTransport{
+		addr: fmt.Sprintf("%s:%s", cnf.EmailHost, cnf.EmailPort),
+		auth: smtp.PlainAuth("", cnf.EmailLogin, cnf.EmailPass, cnf.EmailHost),
+	}
+}
+
+func (t *SMTPTransport) Send(from string, to []string, msg []byte) error {
+	if err := smtp.SendMail(t.addr, t.auth, from, to, msg); err != nil {
+		return errors.Wrap(err, "err while SendMail")
+	}
+	return nil
+}
+
+// Check проверяет, что SMTP сервер принимает соединения
+func (t *SMTPTransport) Check(ctx context.Context) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return errors.Wrap(err, "err with Dial")
+	}
+	return conn.Close()
+}
+
+// FileTransport складывает письма в каталог файлами .eml, удобно для разработки
+type FileTransport struct {
+	dir string
+	mu  sync.Mutex
+	n   int
+}
+
+func NewFileTransport(dir string) (*FileTransport, error) {
+	if dir == "" {
+		return nil, errors.New("mail file_dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "err with MkdirAll")
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Send(_ string, _ []string, msg []byte) error {
+	t.mu.Lock()
+	t.n++
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), t.n)
+	t.mu.Unlock()
+
+	if err := ioutil.WriteFile(filepath.Join(t.dir, name), msg, 0644); err != nil {
+		return errors.Wrap(err, "err with WriteFile")
+	}
+	return nil
+}
+
+// Check проверяет, что в каталог можно писать
+func (t *FileTransport) Check(_ context.Context) error {
+	f, err := ioutil.TempFile(t.dir, ".check-*")
+	if err != nil {
+		return errors.Wrap(err, "err with TempFile")
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+type SentMessage struct {
+	From string
+	To   []string
+	Body []byte
+}
+
+// MemoryTransport хранит письма в памяти, для тестов
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, SentMessage{From: from, To: to, Body: msg})
+	return nil
+}
+
+func (t *MemoryTransport) Messages() []SentMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SentMessage(nil), t.messages...)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/pkg/logger"
+	"github.com/tarasova-school/pkg/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	loginFailurePassword  = "password"
+	loginFailureSuspended = "suspended"
+	loginFailureTwoFactor = "two_factor"
+	loginFailureLocked    = "locked"
+
+	//unansweredCacheTTL - подсчет неотвеченных чатов идет по всем сообщениям, поэтому не чаще раза в это время
+	unansweredCacheTTL  = 30 * time.Second
+	metricsQueryTimeout = 5 * time.Second
+)
+
+var (
+	chatMessagesSent = metrics.NewCounterVec("school_chat_messages_sent_total",
+		"Отправленные сообщения в чатах домашек", "role")
+	loginFailures = metrics.NewCounterVec("school_login_failures_total",
+		"Неудачные попытки входа", "reason")
+)
+
+type unansweredCache struct {
+	mu       sync.Mutex
+	loadedAt time.Time
+	count    int
+}
+
+// registerMetrics регистрирует в реестре сервиса метрики, которые считаются при запросе /metrics.
+// Реестр у каждого сервиса свой, поэтому второй сервис не дублирует метрики первого
+func (s *Service) registerMetrics() {
+
+	s.metrics = metrics.NewRegistry()
+
+	s.metrics.NewGaugeFunc("school_db_open_connections", "Открытые соединения с базой", func() (float64, bool) {
+		return float64(s.p.Stats().OpenConnections), true
+	})
+	s.metrics.NewGaugeFunc("school_db_in_use_connections", "Занятые соединения с базой", func() (float64, bool) {
+		return float64(s.p.Stats().InUse), true
+	})
+	s.metrics.NewGaugeFunc("school_db_idle_connections", "Свободные соединения с базой", func() (float64, bool) {
+		return float64(s.p.Stats().Idle), true
+	})
+	s.metrics.NewGaugeFunc("school_db_max_open_connections", "Максимум соединений с базой", func() (float64, bool) {
+		return float64(s.p.Stats().MaxOpenConnections), true
+	})
+	s.metrics.NewCounterFunc("school_db_wait_count_total", "Сколько раз ждали свободное соединение", func() (float64, bool) {
+		return float64(s.p.Stats().WaitCount), true
+	})
+	s.metrics.NewCounterFunc("school_db_wait_duration_seconds_total", "Суммарное ожидание свободного соединения",
+		func() (float64, bool) {
+			return s.p.Stats().WaitDuration.Seconds(), true
+		})
+	s.metrics.NewGaugeFunc("school_homework_unanswered", "Чаты домашек, где последнее сообщение от ученика",
+		s.unansweredHomework)
+}
+
+// Metrics - реестр метрик сервиса для /metrics
+func (s *Service) Metrics() *metrics.Registry {
+	return s.metrics
+}
+
+func (s *Service) unansweredHomework() (float64, bool) {
+
+	s.unanswered.mu.Lock()
+	defer s.unanswered.mu.Unlock()
+	if time.Since(s.unanswered.loadedAt) < unansweredCacheTTL {
+		return float64(s.unanswered.count), true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsQueryTimeout)
+	defer cancel()
+	count, err := s.p.CountChatsWaitingAnswer(ctx)
+	if err != nil {
+		logger.LogError(errors.Wrap(err, "err with CountChatsWaitingAnswer"))
+		return 0, false
+	}
+	s.unanswered.count = count
+	s.unanswered.loadedAt = time.Now()
+
+	return float64(count), true
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+)
+
+// lessonURL - адрес урока во вложенном виде, как его отдавал GetLesson
+const lessonURL = "/v1/courses/%d/sections/%d/levels/%d/lessons/%d"
+
+// GetLessonByID - урок без пути курса: родители для хлебных крошек и соседние уроки через границы уровней и разделов
+func (s *Service) GetLessonByID(ctx context.Context, idLesson int) (*types.LessonView, error) {
+
+	lesson, err := s.p.GetLesson(ctx, idLesson)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLesson"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	breadcrumbs, err := s.breadcrumbs(ctx, lesson.LevelID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &types.LessonView{Lesson: *lesson, Breadcrumbs: breadcrumbs}
+	if view.Previous, view.Next, err = s.lessonNeighbours(ctx, lesson); err != nil {
+		return nil, err
+	}
+	setNextLesson(&view.Lesson, view.Next)
+
+	return view, nil
+}
+
+func (s *Service) GetLevelByID(ctx context.Context, idLevel int) (*types.LevelView, error) {
+
+	level, err := s.p.GetLevel(ctx, idLevel)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLevel"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	breadcrumbs, err := s.breadcrumbs(ctx, idLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	//сам уровень в крошки не входит
+	return &types.LevelView{Level: *level, Breadcrumbs: breadcrumbs[:len(breadcrumbs)-1]}, nil
+}
+
+// GetChatByID - чат по id для любой роли: ученик видит свои чаты, учитель - чаты своих разделов,
+// с правом chats.read_all - любые. Сообщения собеседника помечаются прочитанными, как в чатах по ролям
+func (s *Service) GetChatByID(ctx context.Context, chatID int, claims *infrastruct.CustomClaims) (*types.ChatView, error) {
+
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
+		}
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	markRead, err := s.chatReader(ctx, chat, claims)
+	if err != nil {
+		return nil, err
+	}
+	if markRead != nil {
+		if err = markRead(ctx, chat.ChatID); err != nil && err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with mark chat messages read"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+	}
+
+	chat.Messages, err = s.p.GetMessage(ctx, chat.ChatID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetMessage"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	breadcrumbs, err := s.breadcrumbs(ctx, chat.LevelID)
+	if err != nil {
+		return nil, err
+	}
+	lessonName, err := s.p.GetLessonNameByLessonID(ctx, chat.LessonID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	breadcrumbs = append(breadcrumbs, types.Breadcrumb{Type: types.BreadcrumbLesson, ID: chat.LessonID, Name: lessonName})
+
+	return &types.ChatView{ChatData: *chat, Breadcrumbs: breadcrumbs}, nil
+}
+
+// chatReader проверяет доступ к чату и возвращает, чьи сообщения пометить прочитанными, nil - ничьи
+func (s *Service) chatReader(ctx context.Context, chat *types.ChatData, claims *infrastruct.CustomClaims) (func(context.Context, int) error, error) {
+
+	if claims.UserID == chat.StudentID {
+		return s.p.OffsetTeacherMessages, nil
+	}
+
+	readAll, err := s.HasPermission(ctx, claims.Role, types.PermChatsReadAll)
+	if err != nil {
+		return nil, err
+	}
+	if readAll {
+		return nil, nil
+	}
+
+	answer, err := s.HasPermission(ctx, claims.Role, types.PermChatsAnswer)
+	if err != nil {
+		return nil, err
+	}
+	if !answer {
+		return nil, infrastruct.ErrorPermissionDenied
+	}
+	sectionsID, err := s.p.GetAllSectionsIDByTeacherID(ctx, claims.UserID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	for _, sectionID := range sectionsID {
+		if sectionID == chat.SectionID {
+			return s.p.OffsetStudentMessages, nil
+		}
+	}
+
+	return nil, infrastruct.ErrorPermissionDenied
+}
+
+// breadcrumbs - курс, раздел и уровень
+func (s *Service) breadcrumbs(ctx context.Context, idLevel int) ([]types.Breadcrumb, error) {
+
+	breadcrumbs, err := s.p.GetLevelBreadcrumbs(ctx, idLevel)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLevelBreadcrumbs"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return breadcrumbs, nil
+}
+
+// lessonNeighbours - предыдущий и следующий урок в порядке прохождения курса, nil на краях курса
+func (s *Service) lessonNeighbours(ctx context.Context, lesson *types.Lesson) (*types.LessonNav, *types.LessonNav, error) {
+
+	lessons, err := s.p.GetCourseLessons(ctx, lesson.CourseID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetCourseLessons"))
+		return nil, nil, infrastruct.ErrorInternalServerError
+	}
+
+	var previous, next *types.LessonNav
+	for i := range lessons {
+		if lessons[i].ID != lesson.ID {
+			continue
+		}
+		if i > 0 {
+			previous = &lessons[i-1]
+		}
+		if i < len(lessons)-1 {
+			next = &lessons[i+1]
+		}
+		break
+	}
+
+	return previous, next, nil
+}
+
+func setNextLesson(lesson *types.Lesson, next *types.LessonNav) {
+	lesson.NextLessonID, lesson.NextLessonURL = 0, ""
+	if next != nil {
+		lesson.NextLessonID = next.ID
+		lesson.NextLessonURL = fmt.Sprintf(lessonURL, next.CourseID, next.SectionID, next.LevelID, next.ID)
+	}
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/mail"
+	"github.com/tarasova-school/internal/tarasova-school/service/notify"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"time"
+)
+
+const (
+	defaultNotifyPollInterval = 10 * time.Second
+	defaultNotifyMaxAttempts  = 8
+	defaultNotifyBatchSize    = 50
+
+	// outboxLockFor - на сколько откладываем взятое в работу сообщение, если воркер не успеет отчитаться
+	outboxLockFor    = 5 * time.Minute
+	outboxMaxBackoff = 6 * time.Hour
+)
+
+func (s *Service) GetNotifications(ctx context.Context, userID int, unreadOnly bool, limit, offset int) (*types.NotificationFeed, error) {
+
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var err error
+	feed := &types.NotificationFeed{}
+	feed.Notifications, err = s.p.GetNotifications(ctx, userID, unreadOnly, limit, offset)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetNotifications"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	feed.Unread, err = s.p.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CountUnreadNotifications"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return feed, nil
+}
+
+func (s *Service) MarkNotificationRead(ctx context.Context, userID, notificationID int) error {
+
+	if err := s.p.MarkNotificationRead(ctx, userID, notificationID); err != nil {
+		if err == sql.ErrNoRows {
+			return infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkNotificationRead"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+func (s *Service) MarkAllNotificationsRead(ctx context.Context, userID int) error {
+
+	if err := s.p.MarkAllNotificationsRead(ctx, userID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkAllNotificationsRead"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+func (s *Service) GetNotificationSettings(ctx context.Context, userID int) (*types.NotificationSettings, error) {
+
+	settings, err := s.p.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetNotificationSettings"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		return &types.NotificationSettings{Email: true, InApp: true}, nil
+	}
+
+	return settings, nil
+}
+
+// UpdateNotificationSettings меняет каналы. Чат телеграма из запроса не берется: его подключает только бот,
+// иначе уведомления можно направить в чужой чат
+func (s *Service) UpdateNotificationSettings(ctx context.Context, userID int, settings *types.NotificationSettings) error {
+
+	current, err := s.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	settings.TelegramChatID = current.TelegramChatID
+	if settings.Telegram && settings.TelegramChatID == "" {
+		return infrastruct.ErrorTelegramNotLinked
+	}
+
+	if err = s.p.UpdateNotificationSettings(ctx, userID, settings); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateNotificationSettings"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+// RunNotificationDispatcher отправляет сообщения из outbox с повторами, пока не отменят ctx
+func (s *Service) RunNotificationDispatcher(ctx context.Context) {
+
+	ticker := time.NewTicker(s.notifications.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.dispatchOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) dispatchOutbox(ctx context.Context) {
+
+	messages, err := s.p.ClaimOutboxMessages(ctx, s.notifications.MaxAttempts, s.notifications.BatchSize, outboxLockFor)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ClaimOutboxMessages"))
+		return
+	}
+
+	for _, m := range messages {
+		sender, ok := s.senders[m.Channel]
+		if !ok {
+			err = errors.Errorf("no sender for channel %q", m.Channel)
+		} else {
+			err = sender.Send(m.Address, m.Title, m.Body)
+		}
+
+		if err == nil {
+			if err = s.p.MarkOutboxSent(ctx, m.ID); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkOutboxSent"))
+			}
+			continue
+		}
+
+		if m.Attempts+1 >= s.notifications.MaxAttempts {
+			logger.LogErrorCtx(ctx, errors.Wrapf(err, "notification %d dropped after %d attempts", m.ID, m.Attempts+1))
+		}
+		if err = s.p.MarkOutboxFailed(ctx, m.ID, err.Error(), time.Now().Add(outboxBackoff(m.Attempts))); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkOutboxFailed"))
+		}
+	}
+}
+
+// notify кладет уведомление в ленту и в outbox по каналам, которые выбрал пользователь.
+// Ошибки только логируем: уведомление не должно ломать основное действие
+func (s *Service) notify(ctx context.Context, userID int, kind string, data interface{}) {
+
+	n, err := notify.Render(kind, data)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with notify.Render"))
+		return
+	}
+
+	settings, err := s.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	if settings.InApp {
+		if err = s.p.AddNotification(ctx, userID, n); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddNotification"))
+		}
+	}
+
+	if settings.Email {
+		user, err := s.p.GetUserByID(ctx, userID)
+		if err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+		} else {
+			s.enqueue(ctx, &types.OutboxMessage{UserID: userID, Channel: types.NotifyChannelEmail,
+				Address: user.Email, Title: n.Title, Body: n.Body})
+		}
+	}
+
+	if settings.Telegram && settings.TelegramChatID != "" {
+		s.enqueue(ctx, &types.OutboxMessage{UserID: userID, Channel: types.NotifyChannelTelegram,
+			Address: settings.TelegramChatID, Title: n.Title, Body: n.Body})
+	}
+}
+
+func (s *Service) enqueue(ctx context.Context, m *types.OutboxMessage) {
+
+	if err := s.p.AddOutboxMessage(ctx, m); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddOutboxMessage"))
+	}
+}
+
+// notifyStudentAboutReply запускается горутиной, перед запуском нужен s.background.Add(1)
+func (s *Service) notifyStudentAboutReply(ctx context.Context, chat *types.ChatData, mes *types.MessageBody) {
+	defer s.background.Done()
+
+	lessonName, err := s.p.GetLessonNameByLessonID(ctx, chat.LessonID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
+		return
+	}
+
+	s.notify(ctx, chat.StudentID, types.NotifyTeacherReply,
+		notify.TeacherReply{TeacherName: mes.FirstName, LessonName: lessonName, Text: mes.Text})
+}
+
+// notifyTeachersAboutHomework запускается горутиной, перед запуском нужен s.background.Add(1)
+func (s *Service) notifyTeachersAboutHomework(ctx context.Context, chat *types.ChatData, mes *types.MessageBody) {
+	defer s.background.Done()
+
+	lessonName, err := s.p.GetLessonNameByLessonID(ctx, chat.LessonID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
+		return
+	}
+
+	teachers, err := s.p.GetTeachersBySectionID(ctx, chat.SectionID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTeachersBySectionID"))
+		return
+	}
+
+	for _, teacher := range teachers {
+		s.notify(ctx, teacher.ID, types.NotifyNewHomework,
+			notify.NewHomework{StudentName: mes.FirstName, LessonName: lessonName, Text: mes.Text})
+	}
+}
+
+func outboxBackoff(attempts int) time.Duration {
+
+	backoff := time.Minute << uint(attempts)
+	if backoff <= 0 || backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+
+	return backoff
+}
+
+func newNotificationsConfig(n *config.Notifications) *config.Notifications {
+
+	if n == nil {
+		n = &config.Notifications{}
+	}
+	if n.PollInterval <= 0 {
+		n.PollInterval = defaultNotifyPollInterval
+	}
+	if n.MaxAttempts <= 0 {
+		n.MaxAttempts = defaultNotifyMaxAttempts
+	}
+	if n.BatchSize <= 0 {
+		n.BatchSize = defaultNotifyBatchSize
+	}
+
+	return n
+}
+
+// NotifySenders - настроенные каналы уведомлений, через них же отправляются оповещения
+func (s *Service) NotifySenders() map[string]notify.Sender {
+	return s.senders
+}
+
+func newSenders(cnf *config.Config, mailer *mail.Mailer) map[string]notify.Sender {
+
+	senders := map[string]notify.Sender{
+		types.NotifyChannelEmail: notify.NewEmailSender(mailer),
+	}
+	if cnf.Telegram != nil && cnf.Telegram.TelegramToken != "" {
+		senders[types.NotifyChannelTelegram] = notify.NewTelegramSender(cnf.Telegram.TelegramToken)
+	}
+
+	return senders
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"text/template"
+)
+
+type TeacherReply struct {
+	TeacherName string
+	LessonName  string
+	Text        string
+}
+
+type NewHomework struct {
+	StudentName string
+	LessonName  string
+	Text        string
+}
+
+// SLA - просроченный ответ ученику, для напоминания учителям и эскалации админам
+type SLA struct {
+	Text string
+}
+
+type messageTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+var templates = map[string]messageTemplate{
+	types.NotifyTeacherReply: {
+		title: template.Must(template.New("title").Parse("Учитель ответил по уроку «{{.LessonName}}»")),
+		body:  template.Must(template.New("body").Parse("{{.TeacherName}}: {{.Text}}")),
+	},
+	types.NotifyNewHomework: {
+		title: template.Must(template.New("title").Parse("Новое сообщение по уроку «{{.LessonName}}»")),
+		body:  template.Must(template.New("body").Parse("{{.StudentName}}: {{.Text}}")),
+	},
+	types.NotifySLAReminder: {
+		title: template.Must(template.New("title").Parse("Ученик ждет ответа")),
+		body:  template.Must(template.New("body").Parse("{{.Text}}")),
+	},
+	types.NotifySLAEscalated: {
+		title: template.Must(template.New("title").Parse("Просрочен ответ ученику")),
+		body:  template.Must(template.New("body").Parse("{{.Text}}")),
+	},
+}
+
+// Render собирает заголовок и текст уведомления по его виду
+func Render(kind string, data interface{}) (*types.Notification, error) {
+
+	t, ok := templates[kind]
+	if !ok {
+		return nil, errors.Errorf("unknown notification kind %q", kind)
+	}
+
+	title := new(bytes.Buffer)
+	if err := t.title.Execute(title, data); err != nil {
+		return nil, errors.Wrap(err, "err while Execute title")
+	}
+	body := new(bytes.Buffer)
+	if err := t.body.Execute(body, data); err != nil {
+		return nil, errors.Wrap(err, "err while Execute body")
+	}
+
+	return &types.Notification{Kind: kind, Title: title.String(), Body: body.String()}, nil
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/mail"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Sender доставляет уведомление по одному каналу, address - email или chat_id в зависимости от канала
+type Sender interface {
+	Send(address, title, body string) error
+}
+
+type EmailSender struct {
+	mailer *mail.Mailer
+}
+
+func NewEmailSender(mailer *mail.Mailer) *EmailSender {
+	return &EmailSender{mailer: mailer}
+}
+
+func (e *EmailSender) Send(address, title, body string) error {
+	return e.mailer.Send([]string{address}, mail.Notification{Title: title, Body: body})
+}
+
+type TelegramSender struct {
+	token  string
+	client *http.Client
+}
+
+func NewTelegramSender(token string) *TelegramSender {
+	return &TelegramSender{token: token, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (t *TelegramSender) Send(address, title, body string) error {
+	form := url.Values{}
+	form.Set("chat_id", address)
+	form.Set("text", title+"\n\n"+body)
+
+	res, err := t.client.PostForm(t.method("sendMessage"), form)
+	if err != nil {
+		return errors.Wrap(withoutURL(err), "err with PostForm")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code is %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// TelegramUpdate - входящее сообщение боту, остальные типы обновлений не запрашиваются
+type TelegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+// Updates - сообщения боту после offset, offset - update_id последнего обработанного + 1
+func (t *TelegramSender) Updates(ctx context.Context, offset int64) ([]TelegramUpdate, error) {
+
+	q := url.Values{}
+	q.Set("offset", strconv.FormatInt(offset, 10))
+	q.Set("allowed_updates", `["message"]`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.method("getUpdates")+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrap(withoutURL(err), "err with NewRequest")
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(withoutURL(err), "err with Do")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code is %d", res.StatusCode)
+	}
+	updates := struct {
+		Result []TelegramUpdate `json:"result"`
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&updates); err != nil {
+		return nil, errors.Wrap(err, "err with Decode updates")
+	}
+
+	return updates.Result, nil
+}
+
+func (t *TelegramSender) method(name string) string {
+	return fmt.Sprintf("https://api.telegram.org/bot%s/%s", t.token, name)
+}
+
+// withoutURL убирает адрес из ошибки http клиента, в адресе api телеграма токен бота
+func withoutURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
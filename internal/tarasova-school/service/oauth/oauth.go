@@ -0,0 +1,227 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderVK     = "vk"
+	ProviderYandex = "yandex"
+	ProviderGoogle = "google"
+)
+
+// Token - ответ token endpoint, extra хранит поля, которые некоторые провайдеры кладут прямо туда (vk: user_id, email)
+type Token struct {
+	AccessToken string
+	extra       map[string]interface{}
+}
+
+// Provider - OAuth2 клиент одного провайдера с PKCE
+type Provider struct {
+	name    string
+	cnf     config.OAuthProvider
+	profile func(ctx context.Context, p *Provider, token *Token) (*types.OAuthProfile, error)
+	client  *http.Client
+}
+
+type defaults struct {
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+	scopes      []string
+	profile     func(ctx context.Context, p *Provider, token *Token) (*types.OAuthProfile, error)
+}
+
+var providers = map[string]defaults{
+	ProviderVK: {
+		authURL:     "https://oauth.vk.com/authorize",
+		tokenURL:    "https://oauth.vk.com/access_token",
+		userInfoURL: "https://api.vk.com/method/users.get",
+		scopes:      []string{"email"},
+		profile:     vkProfile,
+	},
+	ProviderYandex: {
+		authURL:     "https://oauth.yandex.ru/authorize",
+		tokenURL:    "https://oauth.yandex.ru/token",
+		userInfoURL: "https://login.yandex.ru/info",
+		scopes:      []string{"login:email", "login:info"},
+		profile:     yandexProfile,
+	},
+	ProviderGoogle: {
+		authURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:    "https://oauth2.googleapis.com/token",
+		userInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+		scopes:      []string{"openid", "email", "profile"},
+		profile:     googleProfile,
+	},
+}
+
+// NewProviders собирает провайдеров из конфига, незаполненные адреса и scopes берутся по умолчанию
+func NewProviders(cnf *config.SocAuth) (map[string]*Provider, error) {
+
+	result := map[string]*Provider{}
+	if cnf == nil {
+		return result, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for name, p := range cnf.Providers {
+		d, ok := providers[name]
+		if !ok {
+			return nil, errors.Errorf("unknown oauth provider %q", name)
+		}
+		if p.ClientID == "" || p.RedirectURL == "" {
+			return nil, errors.Errorf("oauth provider %q: client_id and redirect_url are required", name)
+		}
+		if p.AuthURL == "" {
+			p.AuthURL = d.authURL
+		}
+		if p.TokenURL == "" {
+			p.TokenURL = d.tokenURL
+		}
+		if p.UserInfoURL == "" {
+			p.UserInfoURL = d.userInfoURL
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = d.scopes
+		}
+		result[name] = &Provider{name: name, cnf: p, profile: d.profile, client: client}
+	}
+
+	return result, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// AuthURL - адрес, на который отправляем пользователя для входа
+func (p *Provider) AuthURL(state, codeVerifier string) string {
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cnf.ClientID)
+	q.Set("redirect_uri", p.cnf.RedirectURL)
+	q.Set("scope", strings.Join(p.cnf.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+
+	return p.cnf.AuthURL + "?" + q.Encode()
+}
+
+// Exchange меняет code из callback на access token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cnf.RedirectURL)
+	form.Set("client_id", p.cnf.ClientID)
+	form.Set("client_secret", p.cnf.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cnf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "err with NewRequest")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(withoutURL(err), "err with Do")
+	}
+	defer res.Body.Close()
+
+	body := map[string]interface{}{}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, errors.Wrap(err, "err with Decode token")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint status code is %d: %v", res.StatusCode, body["error"])
+	}
+
+	accessToken, _ := body["access_token"].(string)
+	if accessToken == "" {
+		return nil, errors.New("empty access_token")
+	}
+
+	return &Token{AccessToken: accessToken, extra: body}, nil
+}
+
+// Profile запрашивает у провайдера данные пользователя
+func (p *Provider) Profile(ctx context.Context, token *Token) (*types.OAuthProfile, error) {
+
+	profile, err := p.profile(ctx, p, token)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Subject == "" {
+		return nil, errors.New("empty subject in profile")
+	}
+	profile.Provider = p.name
+	profile.Email = strings.ToLower(strings.TrimSpace(profile.Email))
+
+	return profile, nil
+}
+
+// getJSON делает GET к userinfo, authorization - значение заголовка Authorization, если провайдер его ждет
+func (p *Provider) getJSON(ctx context.Context, u, authorization string, dst interface{}) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "err with NewRequest")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrap(withoutURL(err), "err with Do")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("userinfo status code is %d", res.StatusCode)
+	}
+	if err = json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return errors.Wrap(err, "err with Decode userinfo")
+	}
+
+	return nil
+}
+
+// withoutURL убирает адрес из ошибки http клиента: в query может быть access_token (vk users.get)
+func withoutURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+// RandomString - случайная строка для state, code_verifier и nonce
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,163 @@
+package oauth
+
+import (
+	"context"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth/oauthtest"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestProvider(t *testing.T, name string, server *oauthtest.Server) *Provider {
+	t.Helper()
+
+	providers, err := NewProviders(&config.SocAuth{Providers: map[string]config.OAuthProvider{name: server.Config(name)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return providers[name]
+}
+
+func TestAuthURL(t *testing.T) {
+
+	server := oauthtest.NewServer(oauthtest.Profile{Subject: "1"})
+	defer server.Close()
+	provider := newTestProvider(t, ProviderGoogle, server)
+
+	u, err := url.Parse(provider.AuthURL("state-1", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             oauthtest.ClientID,
+		"redirect_uri":          oauthtest.RedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"code_challenge":        codeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if q.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), value)
+		}
+	}
+	if q.Get("code_challenge") == "verifier" {
+		t.Error("code_verifier is sent in auth url")
+	}
+}
+
+// TestExchangeSendsCodeVerifier - token endpoint получает code_verifier, хеш которого был в адресе входа
+func TestExchangeSendsCodeVerifier(t *testing.T) {
+
+	server := oauthtest.NewServer(oauthtest.Profile{Subject: "1"})
+	defer server.Close()
+	provider := newTestProvider(t, ProviderGoogle, server)
+
+	code, _, err := server.Authorize(provider.AuthURL("state-1", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := provider.Exchange(context.Background(), code, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access-1" {
+		t.Errorf("access token %q", token.AccessToken)
+	}
+
+	requests := server.TokenRequests()
+	if len(requests) != 1 {
+		t.Fatalf("%d token requests, want 1", len(requests))
+	}
+	form := requests[0]
+	if form.Get("grant_type") != "authorization_code" || form.Get("code") != code ||
+		form.Get("code_verifier") != "verifier" || form.Get("redirect_uri") != oauthtest.RedirectURL {
+		t.Errorf("token request %v", form)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+
+	server := oauthtest.NewServer(oauthtest.Profile{Subject: "1"})
+	defer server.Close()
+	provider := newTestProvider(t, ProviderGoogle, server)
+
+	code, _, err := server.Authorize(provider.AuthURL("state-1", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), code, "other")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("err %v, want invalid_grant", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+
+	tests := []struct {
+		provider string
+		profile  oauthtest.Profile
+		want     types.OAuthProfile
+	}{
+		{
+			provider: ProviderVK,
+			profile:  oauthtest.Profile{Subject: "12345", Email: "Anna@Mail.ru", FirstName: "Анна"},
+			want:     types.OAuthProfile{Provider: ProviderVK, Subject: "12345", Email: "anna@mail.ru", EmailVerified: true, FirstName: "Анна"},
+		},
+		{
+			provider: ProviderYandex,
+			profile:  oauthtest.Profile{Subject: "yandex-1", Email: "boris@yandex.ru", FirstName: "Борис"},
+			want:     types.OAuthProfile{Provider: ProviderYandex, Subject: "yandex-1", Email: "boris@yandex.ru", EmailVerified: true, FirstName: "Борис"},
+		},
+		{
+			provider: ProviderGoogle,
+			profile:  oauthtest.Profile{Subject: "google-1", Email: "vera@gmail.com", FirstName: "Вера"},
+			want:     types.OAuthProfile{Provider: ProviderGoogle, Subject: "google-1", Email: "vera@gmail.com", FirstName: "Вера"},
+		},
+		{
+			provider: ProviderGoogle,
+			profile:  oauthtest.Profile{Subject: "google-2", Email: "gleb@gmail.com", EmailVerified: true, FirstName: "Глеб"},
+			want:     types.OAuthProfile{Provider: ProviderGoogle, Subject: "google-2", Email: "gleb@gmail.com", EmailVerified: true, FirstName: "Глеб"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.profile.Subject, func(t *testing.T) {
+			server := oauthtest.NewServer(tt.profile)
+			defer server.Close()
+			provider := newTestProvider(t, tt.provider, server)
+
+			code, _, err := server.Authorize(provider.AuthURL("state", "verifier"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := provider.Exchange(context.Background(), code, "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			profile, err := provider.Profile(context.Background(), token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *profile != tt.want {
+				t.Errorf("profile %+v, want %+v", *profile, tt.want)
+			}
+		})
+	}
+}
+
+// TestProfileErrorHidesAccessToken - vk передает access_token в query, в ошибке его быть не должно
+func TestProfileErrorHidesAccessToken(t *testing.T) {
+
+	server := oauthtest.NewServer(oauthtest.Profile{Subject: "12345"})
+	provider := newTestProvider(t, ProviderVK, server)
+	server.Close()
+
+	_, err := provider.Profile(context.Background(), &Token{AccessToken: "secret-token", extra: map[string]interface{}{}})
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("err %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package oauthtest - локальный фейковый OAuth2 провайдер для тестов входа через соцсети.
+// Token endpoint проверяет PKCE, userinfo отдает профиль в формате vk, yandex или google
+package oauthtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/tarasova-school/internal/types/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const (
+	ClientID     = "client"
+	ClientSecret = "secret"
+	RedirectURL  = "https://tarasova-school.ru/oauth/callback"
+)
+
+// Profile - пользователь провайдера, для vk Subject должен быть числом
+type Profile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+}
+
+type Server struct {
+	*httptest.Server
+	Profile Profile
+
+	mu            sync.Mutex
+	challenges    map[string]string
+	tokenRequests []url.Values
+}
+
+func NewServer(profile Profile) *Server {
+
+	s := &Server{Profile: profile, challenges: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/vk", s.vk)
+	mux.HandleFunc("/yandex", s.yandex)
+	mux.HandleFunc("/google", s.google)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Config - настройки провайдера name, все адреса ведут на фейковый сервер
+func (s *Server) Config(name string) config.OAuthProvider {
+	return config.OAuthProvider{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  RedirectURL,
+		AuthURL:      s.URL + "/authorize",
+		TokenURL:     s.URL + "/token",
+		UserInfoURL:  s.URL + "/" + name,
+	}
+}
+
+// Authorize - пользователь согласился на вход по адресу authURL: провайдер запоминает code_challenge
+// и возвращает code и state, с которыми браузер придет на callback
+func (s *Server) Authorize(authURL string) (code, state string, err error) {
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code = "code-" + strconv.Itoa(len(s.challenges)+1)
+	if q.Get("code_challenge_method") == "S256" {
+		s.challenges[code] = q.Get("code_challenge")
+	}
+
+	return code, q.Get("state"), nil
+}
+
+// TokenRequests - формы, пришедшие на token endpoint
+func (s *Server) TokenRequests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.tokenRequests...)
+}
+
+func (s *Server) accessToken() string {
+	return "access-" + s.Profile.Subject
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	s.tokenRequests = append(s.tokenRequests, r.PostForm)
+	challenge, ok := s.challenges[r.PostForm.Get("code")]
+	delete(s.challenges, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("client_secret") != ClientSecret:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+	case !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+	default:
+		body := map[string]interface{}{"access_token": s.accessToken(), "token_type": "bearer"}
+		//vk кладет id и email прямо в ответ token endpoint
+		if id, err := strconv.Atoi(s.Profile.Subject); err == nil {
+			body["user_id"] = id
+		}
+		if s.Profile.Email != "" {
+			body["email"] = s.Profile.Email
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+func (s *Server) vk(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Query().Get("access_token") != s.accessToken() {
+		writeJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	id, _ := strconv.Atoi(s.Profile.Subject)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"response": []map[string]interface{}{{"id": id, "first_name": s.Profile.FirstName}},
+	})
+}
+
+func (s *Server) yandex(w http.ResponseWriter, r *http.Request) {
+
+	if r.Header.Get("Authorization") != "OAuth "+s.accessToken() {
+		writeJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id": s.Profile.Subject, "default_email": s.Profile.Email, "first_name": s.Profile.FirstName,
+	})
+}
+
+func (s *Server) google(w http.ResponseWriter, r *http.Request) {
+
+	if r.Header.Get("Authorization") != "Bearer "+s.accessToken() {
+		writeJSON(w, http.StatusUnauthorized, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub": s.Profile.Subject, "email": s.Profile.Email, "email_verified": s.Profile.EmailVerified,
+		"given_name": s.Profile.FirstName,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
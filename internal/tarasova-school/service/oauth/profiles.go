@@ -0,0 +1,85 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"net/url"
+)
+
+const vkAPIVersion = "5.131"
+
+// vkProfile - vk отдает user_id и email прямо в ответе token endpoint, имя берем из users.get
+func vkProfile(ctx context.Context, p *Provider, token *Token) (*types.OAuthProfile, error) {
+
+	profile := &types.OAuthProfile{}
+	if userID, ok := token.extra["user_id"].(float64); ok {
+		profile.Subject = fmt.Sprintf("%.0f", userID)
+	}
+	if email, ok := token.extra["email"].(string); ok {
+		profile.Email = email
+		//vk отдает только подтвержденный email
+		profile.EmailVerified = true
+	}
+
+	q := url.Values{}
+	q.Set("access_token", token.AccessToken)
+	q.Set("v", vkAPIVersion)
+	users := struct {
+		Response []struct {
+			ID        int    `json:"id"`
+			FirstName string `json:"first_name"`
+		} `json:"response"`
+	}{}
+	if err := p.getJSON(ctx, p.cnf.UserInfoURL+"?"+q.Encode(), "", &users); err != nil {
+		return nil, errors.Wrap(err, "err with users.get")
+	}
+	if len(users.Response) > 0 {
+		profile.FirstName = users.Response[0].FirstName
+		if profile.Subject == "" {
+			profile.Subject = fmt.Sprintf("%d", users.Response[0].ID)
+		}
+	}
+
+	return profile, nil
+}
+
+func yandexProfile(ctx context.Context, p *Provider, token *Token) (*types.OAuthProfile, error) {
+
+	info := struct {
+		ID           string `json:"id"`
+		DefaultEmail string `json:"default_email"`
+		FirstName    string `json:"first_name"`
+	}{}
+	if err := p.getJSON(ctx, p.cnf.UserInfoURL+"?format=json", "OAuth "+token.AccessToken, &info); err != nil {
+		return nil, err
+	}
+
+	return &types.OAuthProfile{
+		Subject:       info.ID,
+		Email:         info.DefaultEmail,
+		EmailVerified: info.DefaultEmail != "",
+		FirstName:     info.FirstName,
+	}, nil
+}
+
+func googleProfile(ctx context.Context, p *Provider, token *Token) (*types.OAuthProfile, error) {
+
+	info := struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+	}{}
+	if err := p.getJSON(ctx, p.cnf.UserInfoURL, "Bearer "+token.AccessToken, &info); err != nil {
+		return nil, err
+	}
+
+	return &types.OAuthProfile{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		FirstName:     info.GivenName,
+	}, nil
+}
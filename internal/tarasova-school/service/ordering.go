@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+)
+
+func (s *Service) ReorderSection(ctx context.Context, idCourse, idSection int, placement *types.Placement) error {
+
+	//check correct courseID in URL
+	if err := s.p.CheckURLByCS(ctx, idCourse, idSection); err != nil {
+		return infrastruct.ErrorNotFound
+	}
+
+	placement.ID = idSection
+	ok, err := s.p.ReorderSection(ctx, placement)
+	return placementResult(ctx, "ReorderSection", ok, err)
+}
+
+func (s *Service) ReorderLevel(ctx context.Context, idCourse, idSection, idLevel int, placement *types.Placement) error {
+
+	//check correct courseID and sectionID in URL
+	if err := s.p.CheckURLByCSL(ctx, idCourse, idSection, idLevel); err != nil {
+		return infrastruct.ErrorNotFound
+	}
+
+	placement.ID = idLevel
+	ok, err := s.p.ReorderLevel(ctx, placement)
+	return placementResult(ctx, "ReorderLevel", ok, err)
+}
+
+func (s *Service) ReorderLesson(ctx context.Context, idCourse, idSection, idLevel, idLesson int, placement *types.Placement) error {
+
+	//check correct courseID, sectionID and levelID in URL
+	if err := s.p.CheckURLByCSLL(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
+		return infrastruct.ErrorNotFound
+	}
+
+	placement.ID = idLesson
+	ok, err := s.p.MoveLesson(ctx, placement, idLevel)
+	return placementResult(ctx, "MoveLesson", ok, err)
+}
+
+// MoveLesson переносит урок в другой уровень того же курса, в том числе другого раздела. Чаты урока уходят вместе с ним,
+// поэтому их видят учителя нового раздела
+func (s *Service) MoveLesson(ctx context.Context, idCourse, idSection, idLevel, idLesson int, move *types.MoveLesson) (*types.Placement, error) {
+
+	//check correct courseID, sectionID and levelID in URL
+	if err := s.p.CheckURLByCSLL(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	placement := &types.Placement{ID: idLesson, Position: move.Position, Version: move.Version}
+	ok, err := s.p.MoveLesson(ctx, placement, move.LevelID)
+	if err = placementResult(ctx, "MoveLesson", ok, err); err != nil {
+		return nil, err
+	}
+
+	return placement, nil
+}
+
+// placementResult - ошибка для клиента по результату перестановки: нет элемента, устаревшая версия или сбой
+func placementResult(ctx context.Context, op string, ok bool, err error) error {
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return infrastruct.ErrorNotFound
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with "+op))
+		return infrastruct.ErrorInternalServerError
+	}
+	if !ok {
+		return infrastruct.ErrorVersionConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/mail"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"math/big"
+	"time"
+)
+
+const (
+	defaultRecoveryCodeTTL      = 15 * time.Minute
+	defaultRecoveryCodeAttempts = 5
+	defaultRecoveryWindow       = time.Hour
+	defaultRecoveryMaxPerEmail  = 10
+	defaultRecoveryMaxPerIP     = 30
+
+	recoveryCodeDigits = 6
+)
+
+// checkRecoveryLimit блокирует восстановление, если с этого email или ip было слишком много попыток за окно
+func (s *Service) checkRecoveryLimit(ctx context.Context, email, ip string) error {
+
+	byEmail, byIP, err := s.p.CountRecoveryAttempts(ctx, email, ip, time.Now().Add(-s.recovery.Window))
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CountRecoveryAttempts"))
+		return infrastruct.ErrorInternalServerError
+	}
+	if byEmail >= s.recovery.MaxPerEmail || byIP >= s.recovery.MaxPerIP {
+		return infrastruct.ErrorTooManyRequests
+	}
+
+	return nil
+}
+
+// checkRecoveryCode сверяет код. Каждая проверка, и удачная тоже, тратит одну из code_attempts попыток,
+// счетчик увеличивается в базе одним запросом вместе с чтением хеша
+func (s *Service) checkRecoveryCode(ctx context.Context, email, code, ip string) (bool, error) {
+
+	codeHash, err := s.p.UseRecoveryPassAttempt(ctx, email, s.recovery.CodeAttempts)
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UseRecoveryPassAttempt"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+	if err == nil && hmac.Equal([]byte(codeHash), []byte(s.recoveryCodeHash(email, code))) {
+		return true, nil
+	}
+
+	if err = s.p.AddRecoveryAttempt(ctx, email, ip); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddRecoveryAttempt"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+
+	return false, nil
+}
+
+// recoveryCodeHash - в базе лежит только hmac кода, утечка таблицы не дает кодов
+func (s *Service) recoveryCodeHash(email, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.secretKey))
+	mac.Write([]byte(email + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendPasswordChanged запускается горутиной, перед запуском нужен s.background.Add(1)
+func (s *Service) sendPasswordChanged(ctx context.Context, user *types.User) {
+	defer s.background.Done()
+	if err := s.mailer.Send([]string{user.Email}, mail.PasswordChanged{FirstName: user.FirstName}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with send Email"))
+	}
+}
+
+func generateRecoveryCode() (string, error) {
+
+	max := big.NewInt(1)
+	for i := 0; i < recoveryCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", recoveryCodeDigits, n), nil
+}
+
+func newRecoveryConfig(recovery *config.PasswordRecovery) *config.PasswordRecovery {
+
+	if recovery == nil {
+		recovery = &config.PasswordRecovery{}
+	}
+	if recovery.CodeTTL <= 0 {
+		recovery.CodeTTL = defaultRecoveryCodeTTL
+	}
+	if recovery.CodeAttempts <= 0 {
+		recovery.CodeAttempts = defaultRecoveryCodeAttempts
+	}
+	if recovery.Window <= 0 {
+		recovery.Window = defaultRecoveryWindow
+	}
+	if recovery.MaxPerEmail <= 0 {
+		recovery.MaxPerEmail = defaultRecoveryMaxPerEmail
+	}
+	if recovery.MaxPerIP <= 0 {
+		recovery.MaxPerIP = defaultRecoveryMaxPerIP
+	}
+
+	return recovery
+}
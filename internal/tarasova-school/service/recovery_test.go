@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"github.com/tarasova-school/internal/clients/postgres/postgrestest"
+	"github.com/tarasova-school/internal/types/config"
+	"testing"
+)
+
+// newTestService - сервис поверх фейковой базы с конфигом по умолчанию
+func newTestService(t *testing.T) (*Service, *postgrestest.DB) {
+	t.Helper()
+
+	cnf := config.Defaults()
+	cnf.SecretKeyJWT = "test"
+	cnf.Email = &config.ConfigForSendEmail{}
+	db, pg := postgrestest.New()
+	srv, err := NewService(pg, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, db
+}
+
+func TestCheckRecoveryCode(t *testing.T) {
+
+	const email = "anna@mail.ru"
+
+	tests := []struct {
+		name    string
+		stored  bool
+		code    string
+		ok      bool
+		attempt bool
+	}{
+		{name: "valid code", stored: true, code: "123456", ok: true},
+		{name: "wrong code", stored: true, code: "654321", attempt: true},
+		//код истек, попытки кончились или его не было: UPDATE не вернул строку
+		{name: "no live code", stored: false, code: "123456", attempt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestService(t)
+			stub := db.On("UPDATE recovery_pass SET attempts = attempts + 1", "code_hash")
+			if tt.stored {
+				stub.Row(srv.recoveryCodeHash(email, "123456"))
+			}
+
+			ok, err := srv.checkRecoveryCode(context.Background(), email, tt.code, "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Errorf("ok %v, want %v", ok, tt.ok)
+			}
+			if got := db.Executed("INSERT INTO recovery_attempts"); got != tt.attempt {
+				t.Errorf("recovery attempt recorded %v, want %v", got, tt.attempt)
+			}
+
+			//попытка тратится тем же запросом, что читает хеш, с лимитом из конфига
+			queries := db.Queries()
+			if len(queries) == 0 || len(queries[0].Args) != 2 || queries[0].Args[1] != srv.recovery.CodeAttempts {
+				t.Errorf("queries %v", queries)
+			}
+		})
+	}
+}
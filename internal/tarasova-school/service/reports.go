@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/export"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"strconv"
+	"time"
+)
+
+func (s *Service) ExportCoursesInfo(ctx context.Context, period *types.ReportPeriod, w export.Writer) error {
+
+	if err := w.WriteRow([]string{"id", "курс", "стоимость", "активные ученики", "сданные дз", "скидка", "цена со скидкой"}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with WriteRow"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	err := s.p.ExportCoursesInfo(ctx, period, func(c *types.CourseInfoForAdmin) error {
+		return w.WriteRow([]string{strconv.Itoa(c.ID), c.Name, c.Cost, strconv.Itoa(c.Users),
+			strconv.Itoa(c.Dz), strconv.Itoa(c.Sale), strconv.Itoa(c.Total)})
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ExportCoursesInfo"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return closeReport(ctx, w)
+}
+
+func (s *Service) ExportTeachersInfo(ctx context.Context, period *types.ReportPeriod, w export.Writer) error {
+
+	if err := w.WriteRow([]string{"id", "имя", "хорошо", "доработать", "ахтунг", "часов на сайте",
+		"среднее время ответа, мин"}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with WriteRow"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	err := s.p.ExportTeachersInfo(ctx, period, func(t *types.TeacherFullInfo) error {
+		return w.WriteRow([]string{strconv.Itoa(t.ID), t.FirstName, strconv.Itoa(t.Good),
+			strconv.Itoa(t.Improve), strconv.Itoa(t.Ahtung), strconv.Itoa(t.Times / 60 / 60),
+			strconv.Itoa(t.AverageTime / 60)})
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ExportTeachersInfo"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return closeReport(ctx, w)
+}
+
+func (s *Service) ExportStudents(ctx context.Context, period *types.ReportPeriod, w export.Writer) error {
+
+	if err := w.WriteRow([]string{"id", "email", "имя", "дата регистрации", "часов на сайте"}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with WriteRow"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	err := s.p.ExportStudents(ctx, period, func(st *types.StudentReport) error {
+		return w.WriteRow([]string{strconv.Itoa(st.ID), st.Email, st.FirstName,
+			st.CreatedAT.Format(time.RFC3339), strconv.Itoa(st.Times / 60 / 60)})
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ExportStudents"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return closeReport(ctx, w)
+}
+
+func (s *Service) ExportTeacherChatStats(ctx context.Context, period *types.ReportPeriod, w export.Writer) error {
+
+	if err := w.WriteRow([]string{"id", "имя", "активные чаты", "сообщений от учеников",
+		"сообщений от учителей"}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with WriteRow"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	err := s.p.ExportTeacherChatStats(ctx, period, func(st *types.TeacherChatStat) error {
+		return w.WriteRow([]string{strconv.Itoa(st.TeacherID), st.FirstName, strconv.Itoa(st.Chats),
+			strconv.Itoa(st.StudentMessages), strconv.Itoa(st.TeacherMessages)})
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ExportTeacherChatStats"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return closeReport(ctx, w)
+}
+
+func closeReport(ctx context.Context, w export.Writer) error {
+
+	if err := w.Close(); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with close report"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
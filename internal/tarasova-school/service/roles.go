@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rolesCacheTTL - права ролей кешируются, чтобы не ходить в базу на каждый запрос.
+// Изменения через API сбрасывают кеш сразу, изменения с другого инстанса подтянутся за это время
+const rolesCacheTTL = time.Minute
+
+var roleNameRegexp = regexp.MustCompile(`^[a-z][a-z_]{1,63}$`)
+
+type rolesCache struct {
+	mu       sync.RWMutex
+	loadedAt time.Time
+	roles    map[string]map[string]bool
+}
+
+// HasPermission проверяет, есть ли у роли право
+func (s *Service) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+
+	s.roles.mu.RLock()
+	fresh := time.Since(s.roles.loadedAt) < rolesCacheTTL
+	permissions, ok := s.roles.roles[role]
+	s.roles.mu.RUnlock()
+	if fresh {
+		return ok && permissions[permission], nil
+	}
+
+	if err := s.reloadRoles(ctx); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with reloadRoles"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+
+	s.roles.mu.RLock()
+	defer s.roles.mu.RUnlock()
+	return s.roles.roles[role][permission], nil
+}
+
+func (s *Service) GetRoles(ctx context.Context) ([]types.Role, error) {
+
+	roles, err := s.p.GetRoles(ctx)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetRoles"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return roles, nil
+}
+
+func (s *Service) GetPermissions() []types.Permission {
+	return types.Permissions
+}
+
+func (s *Service) CreateRole(ctx context.Context, role *types.Role) error {
+
+	if err := prepareRole(role); err != nil {
+		return err
+	}
+	exist, err := s.roleExists(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return infrastruct.ErrorRoleIsExist
+	}
+
+	if err = s.p.CreateRole(ctx, role); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateRole"))
+		return infrastruct.ErrorInternalServerError
+	}
+	s.resetRolesCache()
+
+	return nil
+}
+
+func (s *Service) UpdateRole(ctx context.Context, role *types.Role) error {
+
+	if err := prepareRole(role); err != nil {
+		return err
+	}
+	//без этого права админы не смогут вернуть себе доступ к ролям
+	if role.Name == types.RoleAdmin && !containsString(role.Permissions, types.PermRolesManage) {
+		return infrastruct.ErrorBadRequest
+	}
+
+	if err := s.p.UpdateRole(ctx, role); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateRole"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+	s.resetRolesCache()
+
+	return nil
+}
+
+func (s *Service) DeleteRole(ctx context.Context, name string) error {
+
+	roles, err := s.p.GetRoles(ctx)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetRoles"))
+		return infrastruct.ErrorInternalServerError
+	}
+	var role *types.Role
+	for i := range roles {
+		if roles[i].Name == name {
+			role = &roles[i]
+		}
+	}
+	if role == nil {
+		return infrastruct.ErrorNotFound
+	}
+	if role.Builtin {
+		return infrastruct.ErrorPermissionDenied
+	}
+
+	if err = s.p.DeleteRole(ctx, name); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteRole"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorRoleInUse
+	}
+	s.resetRolesCache()
+
+	return nil
+}
+
+func (s *Service) roleExists(ctx context.Context, name string) (bool, error) {
+
+	if err := s.reloadRoles(ctx); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with reloadRoles"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+
+	s.roles.mu.RLock()
+	defer s.roles.mu.RUnlock()
+	_, ok := s.roles.roles[name]
+	return ok, nil
+}
+
+func (s *Service) reloadRoles(ctx context.Context) error {
+
+	roles, err := s.p.GetRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		permissions := make(map[string]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			permissions[permission] = true
+		}
+		loaded[role.Name] = permissions
+	}
+
+	s.roles.mu.Lock()
+	s.roles.roles = loaded
+	s.roles.loadedAt = time.Now()
+	s.roles.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) resetRolesCache() {
+	s.roles.mu.Lock()
+	s.roles.loadedAt = time.Time{}
+	s.roles.mu.Unlock()
+}
+
+// prepareRole проверяет имя роли и права, убирает повторы
+func prepareRole(role *types.Role) error {
+
+	role.Name = strings.TrimSpace(role.Name)
+	role.Description = strings.TrimSpace(role.Description)
+	if !roleNameRegexp.MatchString(role.Name) {
+		return infrastruct.ErrorBadRequest
+	}
+
+	known := make(map[string]bool, len(types.Permissions))
+	for _, permission := range types.Permissions {
+		known[permission.Name] = true
+	}
+	permissions := make([]string, 0, len(role.Permissions))
+	seen := map[string]bool{}
+	for _, permission := range role.Permissions {
+		if !known[permission] {
+			return infrastruct.ErrorBadRequest
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	role.Permissions = permissions
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,16 +1,19 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/hashicorp/go-uuid"
 	"github.com/pkg/errors"
 	"github.com/tarasova-school/internal/clients/postgres"
 	"github.com/tarasova-school/internal/tarasova-school/service/mail"
+	"github.com/tarasova-school/internal/tarasova-school/service/notify"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth"
 	"github.com/tarasova-school/internal/types"
 	"github.com/tarasova-school/internal/types/config"
 	"github.com/tarasova-school/pkg/infrastruct"
 	"github.com/tarasova-school/pkg/logger"
+	"github.com/tarasova-school/pkg/metrics"
 	"io"
 	"os"
 	"path/filepath"
@@ -21,103 +24,119 @@ import (
 )
 
 type Service struct {
-	p                *postgres.Postgres
-	secretKey        string
-	email            *config.ConfigForSendEmail
-	htmlRecoveryPath string
-	htmlNewPassPath  string
-	videoDir         string
+	p             *postgres.Postgres
+	secretKey     string
+	mailer        *mail.Mailer
+	videoDir      string
+	sla           *config.SLA
+	notifications *config.Notifications
+	verification  *config.EmailVerification
+	recovery      *config.PasswordRecovery
+	twoFactor     *config.TwoFactor
+	senders       map[string]notify.Sender
+	oauth         map[string]*oauth.Provider
+	oauthStateTTL time.Duration
+	impersonation *config.Impersonation
+	audit         *config.Audit
+	roles         rolesCache
+	unanswered    unansweredCache
+	metrics       *metrics.Registry
+	background    sync.WaitGroup
+	lockout       *config.LoginLockout
+	courseClone   *config.CourseClone
+	telegram      *config.Telegram
 }
 
 func NewService(pg *postgres.Postgres, cnf *config.Config) (*Service, error) {
 
-	return &Service{
-		p:                pg,
-		secretKey:        cnf.SecretKeyJWT,
-		email:            cnf.Email,
-		htmlRecoveryPath: cnf.HtmlRecoveryPath,
-		htmlNewPassPath:  cnf.HtmlNewPassPath,
-		videoDir:         cnf.VideoDir,
-	}, nil
-}
-
-func (s *Service) AuthorizeVK(auth *types.AuthorizeVK) (*types.Token, error) {
-	user, err := s.p.GetUserByEmail(auth.Email)
+	if cnf.Email == nil {
+		return nil, errors.New("server_email is not set")
+	}
+	transport, err := mail.NewTransport(cnf.Email)
 	if err != nil {
-		if err != sql.ErrNoRows {
-			logger.LogError(err)
-			return nil, infrastruct.ErrorInternalServerError
-		}
-
-		newPass, err := uuid.GenerateUUID()
-		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with GenerateUUID"))
-			return nil, infrastruct.ErrorInternalServerError
-		}
-		user := &types.User{
-			FirstName: auth.Firstname,
-			Email:     auth.Email,
-			Password:  newPass,
-			UserRole:  types.RoleStudent,
-		}
-		id, err := s.p.CreateUser(user)
-		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with CreateUser"))
-			return nil, infrastruct.ErrorInternalServerError
-		}
-		user.ID = id
-
-		r := mail.NewRequest([]string{user.Email}, s.email)
-		if err = r.Send(s.htmlNewPassPath, newPass); err != nil {
-			logger.LogError(errors.Wrap(err, "err with send Email"))
-			return nil, infrastruct.ErrorInternalServerError
-		}
-
-		token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, s.secretKey)
-		if err != nil {
-			logger.LogError(err)
-			return nil, infrastruct.ErrorInternalServerError
-		}
-
-		return &types.Token{Token: token}, nil
+		return nil, errors.Wrap(err, "err with NewTransport")
 	}
-
-	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, s.secretKey)
+	mailer := mail.NewMailer(cnf.Email, transport)
+	verification, err := newVerificationConfig(cnf.Verification)
 	if err != nil {
-		logger.LogError(err)
-		return nil, infrastruct.ErrorInternalServerError
+		return nil, err
 	}
+	providers, err := oauth.NewProviders(cnf.Soc)
+	if err != nil {
+		return nil, err
+	}
+	notifications := newNotificationsConfig(cnf.Notifications)
 
-	return &types.Token{Token: token}, nil
+	srv := &Service{
+		p:             pg,
+		secretKey:     cnf.SecretKeyJWT,
+		mailer:        mailer,
+		videoDir:      cnf.VideoDir,
+		sla:           newSLAConfig(cnf.SLA),
+		notifications: notifications,
+		verification:  verification,
+		recovery:      newRecoveryConfig(cnf.Recovery),
+		twoFactor:     newTwoFactorConfig(cnf.TwoFactor),
+		senders:       newSenders(cnf, mailer),
+		oauth:         providers,
+		oauthStateTTL: newOAuthStateTTL(cnf.Soc),
+		impersonation: newImpersonationConfig(cnf.Impersonation),
+		audit:         newAuditConfig(cnf.Audit),
+		lockout:       newLoginLockoutConfig(cnf.LoginLockout),
+		courseClone:   newCourseCloneConfig(cnf.CourseClone),
+		telegram:      newTelegramConfig(cnf.Telegram),
+	}
+	srv.registerMetrics()
+
+	return srv, nil
 }
 
-func (s *Service) Authorize(auth *types.Authorize) (*types.Token, error) {
-	user, err := s.p.GetUserByEmail(strings.TrimSpace(auth.Email))
+func (s *Service) Authorize(ctx context.Context, auth *types.Authorize) (*types.Token, error) {
+	//блокировка и поиск пользователя должны видеть один и тот же email, иначе пробелы и регистр дают новый счетчик
+	auth.Email = normalizeEmail(auth.Email)
+	if err := s.checkLoginLockout(ctx, auth.Email); err != nil {
+		return nil, err
+	}
+
+	user, err := s.p.GetUserByEmail(ctx, auth.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			loginFailures.Inc(loginFailurePassword)
+			s.addLoginFailure(ctx, auth.Email)
 			return nil, infrastruct.ErrorPasswordIsIncorrect
 		}
-		logger.LogError(err)
+		logger.LogErrorCtx(ctx, err)
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	if user.Password != strings.TrimSpace(auth.Password) {
+		loginFailures.Inc(loginFailurePassword)
+		s.addLoginFailure(ctx, auth.Email)
 		return nil, infrastruct.ErrorPasswordIsIncorrect
 	}
+	s.resetLoginFailures(ctx, auth.Email)
+	if user.Suspended {
+		loginFailures.Inc(loginFailureSuspended)
+		return nil, suspendedError(user.SuspendReason)
+	}
+
+	if challenge, err := s.twoFactorChallenge(ctx, user); err != nil || challenge != nil {
+		return challenge, err
+	}
 
-	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, s.secretKey)
+	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, user.TokenVersion, s.secretKey)
 	if err != nil {
-		logger.LogError(err)
+		logger.LogErrorCtx(ctx, err)
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return &types.Token{Token: token}, nil
 }
 
-func (s *Service) GetVideoURL(video *types.GetVideo) (string, error) {
+func (s *Service) GetVideoURL(ctx context.Context, video *types.GetVideo) (string, error) {
 
 	//check correct courseID in URL
-	if err := s.p.CheckURLByCSLL(video.CourseID, video.SectionID, video.LevelID, video.LessonID); err != nil {
+	if err := s.p.CheckURLByCSLL(ctx, video.CourseID, video.SectionID, video.LevelID, video.LessonID); err != nil {
 		return "", infrastruct.ErrorNotFound
 	}
 
@@ -126,12 +145,12 @@ func (s *Service) GetVideoURL(video *types.GetVideo) (string, error) {
 	return url, nil
 }
 
-func (s *Service) RegisterStudent(user *types.User) (*types.Token, error) {
+func (s *Service) RegisterStudent(ctx context.Context, user *types.User) (*types.Token, error) {
 	trimSpaceUser(user)
-	_, err := s.p.GetUserByEmail(user.Email)
+	_, err := s.p.GetUserByEmail(ctx, user.Email)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(err)
+			logger.LogErrorCtx(ctx, err)
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	} else {
@@ -139,29 +158,37 @@ func (s *Service) RegisterStudent(user *types.User) (*types.Token, error) {
 	}
 
 	user.UserRole = types.RoleStudent
-	id, err := s.p.CreateUser(user)
+	id, err := s.p.CreateUser(ctx, user)
 	if err != nil {
-		logger.LogError(err)
+		logger.LogErrorCtx(ctx, err)
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	user.ID = id
 
-	logger.SendMessage(fmt.Sprintf("Зарегистрировался новый студент: %s, email: %s",
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Зарегистрировался новый студент: %s, email: %s",
 		user.FirstName, user.Email))
 
-	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, s.secretKey)
+	s.background.Add(1)
+	go func(ctx context.Context, user types.User) {
+		defer s.background.Done()
+		if err := s.sendEmailVerification(ctx, &user); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with sendEmailVerification"))
+		}
+	}(logger.Detach(ctx), *user)
+
+	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, user.TokenVersion, s.secretKey)
 	if err != nil {
-		logger.LogError(err)
+		logger.LogErrorCtx(ctx, err)
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return &types.Token{Token: token}, nil
 }
 
-func (s *Service) RegisterTeacher(teacher *types.Teacher) (*types.OnlyID, error) {
+func (s *Service) RegisterTeacher(ctx context.Context, teacher *types.Teacher) (*types.OnlyID, error) {
 	trimSpaceTeacher(teacher)
-	_, err := s.p.GetUserByEmail(teacher.Email)
+	_, err := s.p.GetUserByEmail(ctx, teacher.Email)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, infrastruct.ErrorInternalServerError
@@ -171,31 +198,31 @@ func (s *Service) RegisterTeacher(teacher *types.Teacher) (*types.OnlyID, error)
 	}
 
 	teacher.UserRole = types.RoleTeacher
-	err = s.p.CreateTeacher(teacher)
+	err = s.p.CreateTeacher(ctx, teacher)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with CreateTeacher"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateTeacher"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
-	teacher, err = s.p.GetTeacherByEmail(teacher.Email)
+	teacher, err = s.p.GetTeacherByEmail(ctx, teacher.Email)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetTeacherByEmail"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTeacherByEmail"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	id := &types.OnlyID{ID: teacher.ID}
-	logger.SendMessage(fmt.Sprintf("Новый учитель успешно зарегистрирован: %s, email: %s",
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Новый учитель успешно зарегистрирован: %s, email: %s",
 		teacher.FirstName, teacher.Email))
 
 	return id, nil
 }
 
-func (s *Service) GetTeacher(idTeacher int) (*types.TeacherFullInfo, error) {
+func (s *Service) GetTeacher(ctx context.Context, idTeacher int) (*types.TeacherFullInfo, error) {
 
-	teacher, err := s.p.GetTeacherByID(idTeacher)
+	teacher, err := s.p.GetTeacherByID(ctx, idTeacher)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(err)
+			logger.LogErrorCtx(ctx, err)
 			return nil, infrastruct.ErrorInternalServerError
 		}
 		return nil, infrastruct.ErrorNotFound
@@ -203,9 +230,9 @@ func (s *Service) GetTeacher(idTeacher int) (*types.TeacherFullInfo, error) {
 
 	teacher.Times = teacher.Times / 60 / 60
 
-	averageTime, err := s.p.GetAverageTimeByTeacherID(idTeacher)
+	averageTime, err := s.p.GetAverageTimeByTeacherID(ctx, idTeacher)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with s.p.GetAverageTimeByTeacherID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with s.p.GetAverageTimeByTeacherID"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
@@ -218,79 +245,79 @@ func (s *Service) GetTeacher(idTeacher int) (*types.TeacherFullInfo, error) {
 	return teacher, nil
 }
 
-func (s *Service) UpdateTeacher(teacher *types.Teacher) error {
+func (s *Service) UpdateTeacher(ctx context.Context, teacher *types.Teacher) error {
 
 	//check correct idTeacher
-	if _, err := s.GetTeacher(teacher.ID); err != nil {
+	if _, err := s.GetTeacher(ctx, teacher.ID); err != nil {
 		return err
 	}
 
 	trimSpaceTeacher(teacher)
-	if err := s.p.UpdateTeacher(teacher); err != nil {
-		logger.LogError(err)
+	if err := s.p.UpdateTeacher(ctx, teacher); err != nil {
+		logger.LogErrorCtx(ctx, err)
 		return infrastruct.ErrorInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Service) DeleteTeacher(idTeacher int) error {
+func (s *Service) DeleteTeacher(ctx context.Context, idTeacher int) error {
 
-	if err := s.p.DeleteTeacher(idTeacher); err != nil {
-		logger.LogError(err)
+	if err := s.p.DeleteTeacher(ctx, idTeacher); err != nil {
+		logger.LogErrorCtx(ctx, err)
 		return infrastruct.ErrorInternalServerError
 	}
 
-	if err := s.p.DeleteSectionAndTeachersBDByTeacherID(idTeacher); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteSectionAndTeachersBD"))
+	if err := s.p.DeleteSectionAndTeachersBDByTeacherID(ctx, idTeacher); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteSectionAndTeachersBD"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Service) GetStudentByID(idStudent int) (*types.User, error) {
+func (s *Service) GetStudentByID(ctx context.Context, idStudent int) (*types.UserProfile, error) {
 
-	user, err := s.p.GetUserByID(idStudent)
+	user, err := s.p.GetUserByID(ctx, idStudent)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(err)
+			logger.LogErrorCtx(ctx, err)
 			return nil, infrastruct.ErrorInternalServerError
 		}
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	return user, nil
+	return &types.UserProfile{ID: user.ID, Email: user.Email, FirstName: user.FirstName, UserRole: user.UserRole}, nil
 }
 
-func (s *Service) GetUsers(role string) ([]types.UserStat, error) {
+func (s *Service) GetUsers(ctx context.Context, role string) ([]types.UserStat, error) {
 
 	moreUser := []types.UserStat{}
 
 	var err error
 	switch role {
 	case "student":
-		moreUser, err = s.p.GetAllStudentsForAdmin()
+		moreUser, err = s.p.GetAllStudentsForAdmin(ctx)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "Err with GetAllStudentsForAdmin"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "Err with GetAllStudentsForAdmin"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	case "teacher":
-		moreUser, err = s.p.GetAllTeachersForAdmin()
+		moreUser, err = s.p.GetAllTeachersForAdmin(ctx)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "Err with GetAllTeachersForAdmin"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "Err with GetAllTeachersForAdmin"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	case "admin":
-		moreUser, err = s.p.GetAllAdminsForAdmin()
+		moreUser, err = s.p.GetAllAdminsForAdmin(ctx)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "Err with GetAllAdminsForAdmin"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "Err with GetAllAdminsForAdmin"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	case "":
-		moreUser, err = s.p.GetAllUsersForAdmin()
+		moreUser, err = s.p.GetAllUsersForAdmin(ctx)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "Err with GetAllUsersForAdmin"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "Err with GetAllUsersForAdmin"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	default:
@@ -300,11 +327,11 @@ func (s *Service) GetUsers(role string) ([]types.UserStat, error) {
 	return moreUser, nil
 }
 
-func (s *Service) GetAllTeachersInfoForAdmin() ([]types.TeacherFullInfo, error) {
+func (s *Service) GetAllTeachersInfoForAdmin(ctx context.Context) ([]types.TeacherFullInfo, error) {
 
-	teacherArr, err := s.p.GetAllTeachersInfoForAdmin()
+	teacherArr, err := s.p.GetAllTeachersInfoForAdmin(ctx)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "Err with GetAllTeachersInfoForAdmin"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "Err with GetAllTeachersInfoForAdmin"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
@@ -315,92 +342,93 @@ func (s *Service) GetAllTeachersInfoForAdmin() ([]types.TeacherFullInfo, error)
 	return teacherArr, nil
 }
 
-func (s *Service) GetAllCourse() ([]types.Course, error) {
+func (s *Service) GetAllCourse(ctx context.Context) ([]types.Course, error) {
 
-	courseArr, err := s.p.GetAllCourse()
+	courseArr, err := s.p.GetAllCourse(ctx)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(errors.Wrap(err, "err with GetAllCourse"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllCourse"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return courseArr, nil
 }
 
-func (s *Service) GetAllCoursesInfoForAdmin() ([]types.CourseInfoForAdmin, error) {
+func (s *Service) GetAllCoursesInfoForAdmin(ctx context.Context) ([]types.CourseInfoForAdmin, error) {
 
-	courseArr, err := s.p.GetAllCoursesInfoForAdmin()
+	courseArr, err := s.p.GetAllCoursesInfoForAdmin(ctx)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(errors.Wrap(err, "err with GetAllCoursesInfoForAdmin"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllCoursesInfoForAdmin"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return courseArr, nil
 }
 
-func (s *Service) GetAllSectionsInCourse(idCourse int) ([]types.Section, error) {
+func (s *Service) GetAllSectionsInCourse(ctx context.Context, idCourse int) ([]types.Section, error) {
 
 	//check idCourse in URL
-	if err := s.p.CheckURLByC(idCourse); err != nil {
+	if err := s.p.CheckURLByC(ctx, idCourse); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	sectionArr, err := s.p.GetAllSectionInCourses(idCourse)
+	sectionArr, err := s.p.GetAllSectionInCourses(ctx, idCourse)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(errors.Wrap(err, "err with GetAllSectionInCourses"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllSectionInCourses"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return sectionArr, nil
 }
 
-func (s *Service) GetAllLevelsInSection(idCourse, idSection int) ([]types.Level, error) {
+func (s *Service) GetAllLevelsInSection(ctx context.Context, idCourse, idSection int) ([]types.Level, error) {
 
 	//check idCourse and idSection in URL
-	if err := s.p.CheckURLByCS(idCourse, idSection); err != nil {
+	if err := s.p.CheckURLByCS(ctx, idCourse, idSection); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	levelArr, err := s.p.GetAllLevelsInSection(idCourse, idSection)
+	levelArr, err := s.p.GetAllLevelsInSection(ctx, idCourse, idSection)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(errors.Wrap(err, "err with GetAllLevelsInSection"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllLevelsInSection"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return levelArr, nil
 }
 
-func (s *Service) GetAllLessonsInLevel(idCourse, idSection, idLevel int) ([]types.Lesson, error) {
+func (s *Service) GetAllLessonsInLevel(ctx context.Context, idCourse, idSection, idLevel int) ([]types.Lesson, error) {
 
 	//check idCourse, idSection and idLevel in URL
-	if err := s.p.CheckURLByCSL(idCourse, idSection, idLevel); err != nil {
+	if err := s.p.CheckURLByCSL(ctx, idCourse, idSection, idLevel); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	lessonArr, err := s.p.GetAllLessonsInLevel(idCourse, idSection, idLevel)
+	lessonArr, err := s.p.GetAllLessonsInLevel(ctx, idCourse, idSection, idLevel)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(errors.Wrap(err, "err with GetAllLessonsInLevel"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllLessonsInLevel"))
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
 	return lessonArr, nil
 }
 
-func (s *Service) ChangePassword(ch *types.ChangePassword) error {
+// ChangePassword меняет пароль и, как восстановление, отзывает все выданные токены: после смены нужно войти заново
+func (s *Service) ChangePassword(ctx context.Context, ch *types.ChangePassword) error {
 	ch.OldPassword = strings.TrimSpace(ch.OldPassword)
 	ch.NewPassword = strings.TrimSpace(ch.NewPassword)
 	ch.RepeatPassword = strings.TrimSpace(ch.RepeatPassword)
@@ -409,9 +437,9 @@ func (s *Service) ChangePassword(ch *types.ChangePassword) error {
 		return infrastruct.ErrorPasswordsDoNotMatch
 	}
 
-	user, err := s.p.GetUserByID(ch.UserID)
+	user, err := s.p.GetUserByID(ctx, ch.UserID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetUserByID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
 		return infrastruct.ErrorInternalServerError
 	}
 
@@ -419,155 +447,149 @@ func (s *Service) ChangePassword(ch *types.ChangePassword) error {
 		return infrastruct.ErrorPasswordIsIncorrect
 	}
 
-	if err := s.p.UpdatePassword(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdatePassword"))
+	if err := s.p.UpdatePasswordAndRevokeTokens(ctx, ch.UserID, ch.NewPassword); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdatePasswordAndRevokeTokens"))
 		return infrastruct.ErrorInternalServerError
 	}
 
+	s.background.Add(1)
+	go s.sendPasswordChanged(logger.Detach(ctx), user)
+
 	return nil
 }
 
-func (s *Service) RecoveryPassword(ch *types.RecoveryPasswordEmail) error {
+func (s *Service) RecoveryPassword(ctx context.Context, ch *types.RecoveryPasswordEmail) error {
 
-	user, err := s.p.GetUserByEmail(ch.Email)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetUserByID"))
-			return infrastruct.ErrorInternalServerError
-		}
-		return infrastruct.ErrorEmailNotFind
+	if err := s.checkRecoveryLimit(ctx, ch.Email, ch.IP); err != nil {
+		return err
+	}
+	//каждый запрос кода тоже попытка, иначе можно бесконечно слать письма
+	if err := s.p.AddRecoveryAttempt(ctx, ch.Email, ch.IP); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddRecoveryAttempt"))
+		return infrastruct.ErrorInternalServerError
 	}
 
-	//проверяем есть ли уже сгенерированный код - если есть, удаляем и делаем новый
-	have, err := s.p.CheckDBRecoveryPassword(user.Email)
+	user, err := s.p.GetUserByEmail(ctx, ch.Email)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with CheckDBRecoveryPassword"))
-			return infrastruct.ErrorInternalServerError
-		}
-	}
-	if have {
-		if err := s.p.DeleteRecoveryPass(user.Email); err != nil {
-			logger.LogError(errors.Wrap(err, "err with DeleteRecoveryPass"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
 			return infrastruct.ErrorInternalServerError
 		}
+		return infrastruct.ErrorEmailNotFind
 	}
 
-	code, err := uuid.GenerateUUID()
+	code, err := generateRecoveryCode()
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GenerateUUID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with generateRecoveryCode"))
 		return infrastruct.ErrorInternalServerError
 	}
-	code = code[:5]
-	code = strings.ToUpper(code)
 
-	if err := s.p.AddCodeForRecoveryPass(user.Email, code); err != nil {
-		logger.LogError(errors.Wrap(err, "err with AddCodeForRecoveryPass"))
+	//новый код заменяет предыдущий
+	expiresAt := time.Now().Add(s.recovery.CodeTTL)
+	if err := s.p.AddCodeForRecoveryPass(ctx, user.Email, s.recoveryCodeHash(user.Email, code), expiresAt); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddCodeForRecoveryPass"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	r := mail.NewRequest([]string{user.Email}, s.email)
-	if err = r.Send(s.htmlRecoveryPath, code); err != nil {
-		logger.LogError(errors.Wrap(err, "err with send Email"))
+	if err = s.mailer.Send([]string{user.Email}, mail.PasswordRecovery{Code: code}); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with send Email"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Service) CheckValidRecoveryPassword(ch *types.RecoveryPasswordEmailAndCode) (bool, error) {
+func (s *Service) CheckValidRecoveryPassword(ctx context.Context, ch *types.RecoveryPasswordEmailAndCode) (bool, error) {
 
-	if err := s.p.CheckRecoveryPass(ch); err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		logger.LogError(errors.Wrap(err, "err with CheckValidRecoveryPassword"))
-		return false, infrastruct.ErrorInternalServerError
+	if err := s.checkRecoveryLimit(ctx, ch.Email, ch.IP); err != nil {
+		return false, err
 	}
 
-	return true, nil
+	return s.checkRecoveryCode(ctx, ch.Email, ch.Code, ch.IP)
 }
 
-func (s *Service) NewRecoveryPassword(ch *types.RecoveryPasswordNewPass) error {
-	ch.Code = strings.ToUpper(ch.Code)
+func (s *Service) NewRecoveryPassword(ctx context.Context, ch *types.RecoveryPasswordNewPass) error {
 
-	recovery := &types.RecoveryPasswordEmailAndCode{Email: ch.Email, Code: ch.Code}
-	ok, err := s.CheckValidRecoveryPassword(recovery)
-	if err != nil {
+	if err := s.checkRecoveryLimit(ctx, ch.Email, ch.IP); err != nil {
 		return err
 	}
 
+	ok, err := s.checkRecoveryCode(ctx, ch.Email, ch.Code, ch.IP)
+	if err != nil {
+		return err
+	}
 	if !ok {
-		//todo если пароль код и пасс не корректные - значит человек не прошел валидацию на предыдущем этапе, поэтому шлем внутреннюю ошибку
-		return infrastruct.ErrorInternalServerError
+		return infrastruct.ErrorRecoveryCodeInvalid
 	}
 
 	if ch.NewPassword != ch.RepeatPassword {
 		return infrastruct.ErrorPasswordsDoNotMatch
 	}
 
-	id, err := s.p.GetUserByEmail(ch.Email)
+	user, err := s.p.GetUserByEmail(ctx, ch.Email)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetUserByEmail"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByEmail"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	newPass := &types.ChangePassword{UserID: id.ID, NewPassword: ch.NewPassword}
-	if err := s.p.UpdatePassword(newPass); err != nil {
-		logger.LogError(errors.Wrap(err, "err  with UpdatePass"))
+	if err := s.p.UpdatePasswordAndRevokeTokens(ctx, user.ID, ch.NewPassword); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err  with UpdatePasswordAndRevokeTokens"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	if err := s.p.DeleteRecoveryPass(recovery.Email); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteRecoveryPass"))
+	if err := s.p.DeleteRecoveryPass(ctx, ch.Email); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteRecoveryPass"))
 		return infrastruct.ErrorInternalServerError
 	}
 
+	s.background.Add(1)
+	go s.sendPasswordChanged(logger.Detach(ctx), user)
+
 	return nil
 }
 
-func (s *Service) AddCourse(ch *types.Course) (*types.OnlyID, error) {
+func (s *Service) AddCourse(ctx context.Context, ch *types.Course) (*types.OnlyID, error) {
 
 	ch.TotalPrice = ch.Cost
-	id, err := s.p.CreateCourse(ch)
+	id, err := s.p.CreateCourse(ctx, ch)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with CreateCourse"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateCourse"))
 		return id, infrastruct.ErrorInternalServerError
 	}
 
 	return id, nil
 }
 
-func (s *Service) AddSection(ch *types.Section) (*types.OnlyID, error) {
+func (s *Service) AddSection(ctx context.Context, ch *types.Section) (*types.OnlyID, error) {
 
 	//check correct courseID in URL
-	if err := s.p.CheckURLByC(ch.CourseID); err != nil {
+	if err := s.p.CheckURLByC(ctx, ch.CourseID); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	id, err := s.p.CreateSection(ch)
+	id, err := s.p.CreateSection(ctx, ch)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with CreateSection"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateSection"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
-		logger.LogError(err)
+		logger.LogErrorCtx(ctx, err)
 		return id, infrastruct.ErrorInternalServerError
 	}
 
 	return id, nil
 }
 
-func (s *Service) AddLevel(ch *types.Level) (*types.OnlyID, error) {
+func (s *Service) AddLevel(ctx context.Context, ch *types.Level) (*types.OnlyID, error) {
 
 	//check correct courseID and sectionID in URL
-	if err := s.p.CheckURLByCS(ch.CourseID, ch.SectionID); err != nil {
+	if err := s.p.CheckURLByCS(ctx, ch.CourseID, ch.SectionID); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	id, err := s.p.CreateLevel(ch)
+	id, err := s.p.CreateLevel(ctx, ch)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with CreateLevel"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateLevel"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
@@ -577,47 +599,47 @@ func (s *Service) AddLevel(ch *types.Level) (*types.OnlyID, error) {
 	return id, nil
 }
 
-func (s *Service) AddLesson(ch *types.Lesson) (*types.OnlyID, error) {
+func (s *Service) AddLesson(ctx context.Context, ch *types.Lesson) (*types.OnlyID, error) {
 
 	//check correct courseID and sectionID in URL
-	if err := s.p.CheckURLByCSL(ch.CourseID, ch.SectionID, ch.LevelID); err != nil {
+	if err := s.p.CheckURLByCSL(ctx, ch.CourseID, ch.SectionID, ch.LevelID); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	id, err := s.p.CreateLesson(ch)
+	id, err := s.p.CreateLesson(ctx, ch)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with CreateLesson"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateLesson"))
 		return id, infrastruct.ErrorInternalServerError
 	}
 
-	carousel, err := s.p.GetLessonCarousel(ch.LevelID)
+	carousel, err := s.p.GetLessonCarousel(ctx, ch.LevelID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetLessonCarousel"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonCarousel"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 		idLesson := []int{id.ID}
-		if err := s.p.AddCarousel(ch.CourseID, ch.SectionID, ch.LevelID, idLesson); err != nil {
-			logger.LogError(errors.Wrap(err, "err with AddCarousel"))
+		if err := s.p.AddCarousel(ctx, ch.CourseID, ch.SectionID, ch.LevelID, idLesson); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddCarousel"))
 			return id, infrastruct.ErrorInternalServerError
 		}
 		return id, nil
 	}
 
 	carousel.LessonArray = append(carousel.LessonArray, int64(id.ID))
-	if err = s.p.UpdateCarousel(carousel); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateCarousel"))
+	if err = s.p.UpdateCarousel(ctx, carousel); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateCarousel"))
 		return id, infrastruct.ErrorInternalServerError
 	}
 
 	return id, nil
 }
 
-func (s *Service) GetCourse(idCourse int) (*types.Course, error) {
+func (s *Service) GetCourse(ctx context.Context, idCourse int) (*types.Course, error) {
 
-	course, err := s.p.GetCourse(idCourse)
+	course, err := s.p.GetCourse(ctx, idCourse)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetCourse"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetCourse"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
@@ -627,16 +649,16 @@ func (s *Service) GetCourse(idCourse int) (*types.Course, error) {
 	return course, nil
 }
 
-func (s *Service) GetSection(idCourse, idSection int) (*types.Section, error) {
+func (s *Service) GetSection(ctx context.Context, idCourse, idSection int) (*types.Section, error) {
 
 	//check correct courseID in URL
-	if err := s.p.CheckURLByCS(idCourse, idSection); err != nil {
+	if err := s.p.CheckURLByCS(ctx, idCourse, idSection); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	section, err := s.p.GetSection(idSection)
+	section, err := s.p.GetSection(ctx, idSection)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetSection"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetSection"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
@@ -646,16 +668,16 @@ func (s *Service) GetSection(idCourse, idSection int) (*types.Section, error) {
 	return section, nil
 }
 
-func (s *Service) GetLevel(idCourse, idSection, idLevel int) (*types.Level, error) {
+func (s *Service) GetLevel(ctx context.Context, idCourse, idSection, idLevel int) (*types.Level, error) {
 
 	//check correct courseID and sectionID in URL
-	if err := s.p.CheckURLByCSL(idCourse, idSection, idLevel); err != nil {
+	if err := s.p.CheckURLByCSL(ctx, idCourse, idSection, idLevel); err != nil {
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	level, err := s.p.GetLevel(idLevel)
+	level, err := s.p.GetLevel(ctx, idLevel)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetLevel"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLevel"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
@@ -665,71 +687,45 @@ func (s *Service) GetLevel(idCourse, idSection, idLevel int) (*types.Level, erro
 	return level, nil
 }
 
-func (s *Service) GetLesson(idCourse, idSection, idLevel, idLesson int) (*types.Lesson, error) {
+func (s *Service) GetLesson(ctx context.Context, idCourse, idSection, idLevel, idLesson int) (*types.Lesson, error) {
 
 	//check correct courseID, sectionID and levelID in URL
-	if err := s.p.CheckURLByCSLL(idCourse, idSection, idLevel, idLesson); err != nil {
-		logger.LogError(errors.Wrap(err, "err with CheckURLByCSLL"))
+	if err := s.p.CheckURLByCSLL(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CheckURLByCSLL"))
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	lesson, err := s.p.GetLesson(idLesson)
+	lesson, err := s.p.GetLesson(ctx, idLesson)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetLesson"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLesson"))
 		if err == sql.ErrNoRows {
 			return nil, infrastruct.ErrorNotFound
 		}
 		return nil, infrastruct.ErrorInternalServerError
 	}
 
-	//make video url
-	arrLesson, err := s.p.GetLessonCarousel(idLevel)
+	//следующий урок может быть и в другом уровне или разделе, см. GetLessonByID
+	_, next, err := s.lessonNeighbours(ctx, lesson)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetLessonCarousel"))
-		return nil, infrastruct.ErrorInternalServerError
+		return nil, err
 	}
+	setNextLesson(lesson, next)
 
-	lesson.NextLessonID = 0
-	if idLesson != int(arrLesson.LessonArray[len(arrLesson.LessonArray)-1]) {
-		for i, v := range arrLesson.LessonArray {
-			if int(v) == idLesson {
-				lesson.NextLessonID = int(arrLesson.LessonArray[i+1])
-				break
-			}
-		}
-	}
-
-	if lesson.NextLessonID != 0 {
-		lesson.NextLessonURL = fmt.Sprintf("/courses/%d/sections/%d/levels/%d/courses/%d",
-			lesson.CourseID, lesson.SectionID, lesson.LevelID, lesson.NextLessonID)
-	}
 	return lesson, nil
 }
 
-func (s *Service) UpdateCourse(ch *types.Course) error {
+func (s *Service) UpdateCourse(ctx context.Context, ch *types.Course) error {
 
 	//check correct courseID in URL
-	if err := s.p.CheckURLByC(ch.ID); err != nil {
+	if err := s.p.CheckURLByC(ctx, ch.ID); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	//add sale
-	if ch.Sale != 0 {
-		if ch.Sale < 0 {
-			ch.Sale = ch.Sale * (-1)
-		}
-
-		var sumSale float64
-
-		sumSale = (float64(ch.Cost) * float64(ch.Sale)) / 100
-		a := float64(ch.Cost) - sumSale
-		ch.TotalPrice = int(a)
-	} else {
-		ch.TotalPrice = ch.Cost
-	}
+	//add sale, скидка уже проверена на входе: от 0 до 100 процентов
+	ch.TotalPrice = totalPrice(ch.Cost, ch.Sale)
 
-	if err := s.p.UpdateCourse(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateCourse"))
+	if err := s.p.UpdateCourse(ctx, ch); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateCourse"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -739,15 +735,26 @@ func (s *Service) UpdateCourse(ch *types.Course) error {
 	return nil
 }
 
-func (s *Service) UpdateSection(ch *types.Section) error {
+// totalPrice - цена со скидкой sale в процентах
+func totalPrice(cost, sale int) int {
+
+	if sale == 0 {
+		return cost
+	}
+	sumSale := (float64(cost) * float64(sale)) / 100
+
+	return int(float64(cost) - sumSale)
+}
+
+func (s *Service) UpdateSection(ctx context.Context, ch *types.Section) error {
 
 	//check correct courseID, sectionID in URL
-	if err := s.p.CheckURLByCS(ch.CourseID, ch.ID); err != nil {
+	if err := s.p.CheckURLByCS(ctx, ch.CourseID, ch.ID); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	if err := s.p.UpdateSection(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateSection"))
+	if err := s.p.UpdateSection(ctx, ch); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateSection"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -757,15 +764,15 @@ func (s *Service) UpdateSection(ch *types.Section) error {
 	return nil
 }
 
-func (s *Service) UpdateLevel(ch *types.Level) error {
+func (s *Service) UpdateLevel(ctx context.Context, ch *types.Level) error {
 
 	//check correct courseID and sectionID, levelID in URL
-	if err := s.p.CheckURLByCSL(ch.CourseID, ch.SectionID, ch.ID); err != nil {
+	if err := s.p.CheckURLByCSL(ctx, ch.CourseID, ch.SectionID, ch.ID); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	if err := s.p.UpdateLevel(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateLevel"))
+	if err := s.p.UpdateLevel(ctx, ch); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateLevel"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -775,15 +782,15 @@ func (s *Service) UpdateLevel(ch *types.Level) error {
 	return nil
 }
 
-func (s *Service) UpdateLesson(ch *types.Lesson) error {
+func (s *Service) UpdateLesson(ctx context.Context, ch *types.Lesson) error {
 
 	//check correct courseID, sectionID, levelID and LessonId in URL
-	if err := s.p.CheckURLByCSLL(ch.CourseID, ch.SectionID, ch.LevelID, ch.ID); err != nil {
+	if err := s.p.CheckURLByCSLL(ctx, ch.CourseID, ch.SectionID, ch.LevelID, ch.ID); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	if err := s.p.UpdateLesson(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateLesson"))
+	if err := s.p.UpdateLesson(ctx, ch); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateLesson"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -793,27 +800,27 @@ func (s *Service) UpdateLesson(ch *types.Lesson) error {
 	return nil
 }
 
-func (s *Service) DeleteCourse(idCourse int) error {
+func (s *Service) DeleteCourse(ctx context.Context, idCourse int) error {
 
 	//check correct url
-	if err := s.p.CheckURLByC(idCourse); err != nil {
+	if err := s.p.CheckURLByC(ctx, idCourse); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	sections, err := s.GetAllSectionsInCourse(idCourse)
+	sections, err := s.GetAllSectionsInCourse(ctx, idCourse)
 	if err != nil {
 		return err
 	}
 	for index, _ := range sections {
 		idSection := sections[index].ID
-		if err := s.DeleteSection(idCourse, idSection); err != nil {
+		if err := s.DeleteSection(ctx, idCourse, idSection); err != nil {
 			if err != infrastruct.ErrorNotFound {
 				return err
 			}
 		}
 	}
-	if err := s.p.DeleteCourse(idCourse); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteCourse"))
+	if err := s.p.DeleteCourse(ctx, idCourse); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteCourse"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -823,66 +830,66 @@ func (s *Service) DeleteCourse(idCourse int) error {
 	return nil
 }
 
-func (s *Service) DeleteSection(idCourse, idSection int) error {
+func (s *Service) DeleteSection(ctx context.Context, idCourse, idSection int) error {
 
 	//check correct url
-	if err := s.p.CheckURLByCS(idCourse, idSection); err != nil {
+	if err := s.p.CheckURLByCS(ctx, idCourse, idSection); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	levels, err := s.GetAllLevelsInSection(idCourse, idSection)
+	levels, err := s.GetAllLevelsInSection(ctx, idCourse, idSection)
 	if err != nil {
 		return err
 	}
 
 	for index, _ := range levels {
 		idLevels := levels[index].ID
-		if err := s.DeleteLevel(idCourse, idSection, idLevels); err != nil {
+		if err := s.DeleteLevel(ctx, idCourse, idSection, idLevels); err != nil {
 			if err != infrastruct.ErrorNotFound {
 				return err
 			}
 		}
 	}
 
-	if err := s.p.DeleteSection(idCourse, idSection); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteSection"))
+	if err := s.p.DeleteSection(ctx, idCourse, idSection); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteSection"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
 		return infrastruct.ErrorInternalServerError
 	}
 
-	if err := s.p.DeleteSectionAndTeachersBDBySectionID(idSection); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteSectionAndTeachersBD"))
+	if err := s.p.DeleteSectionAndTeachersBDBySectionID(ctx, idSection); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteSectionAndTeachersBD"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Service) DeleteLevel(idCourse, idSection, idLevel int) error {
+func (s *Service) DeleteLevel(ctx context.Context, idCourse, idSection, idLevel int) error {
 
 	//check correct url
-	if err := s.p.CheckURLByCSL(idCourse, idSection, idLevel); err != nil {
+	if err := s.p.CheckURLByCSL(ctx, idCourse, idSection, idLevel); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	lessons, err := s.GetAllLessonsInLevel(idCourse, idSection, idLevel)
+	lessons, err := s.GetAllLessonsInLevel(ctx, idCourse, idSection, idLevel)
 	if err != nil {
 		return err
 	}
 
 	for index, _ := range lessons {
 		idLesson := lessons[index].ID
-		if err := s.DeleteLesson(idCourse, idSection, idLevel, idLesson); err != nil {
+		if err := s.DeleteLesson(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
 			if err != infrastruct.ErrorNotFound {
 				return err
 			}
 		}
 	}
 
-	if err := s.p.DeleteLevel(idCourse, idSection, idLevel); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteLevel"))
+	if err := s.p.DeleteLevel(ctx, idCourse, idSection, idLevel); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteLevel"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
@@ -892,46 +899,46 @@ func (s *Service) DeleteLevel(idCourse, idSection, idLevel int) error {
 	return nil
 }
 
-func (s *Service) DeleteLesson(idCourse, idSection, idLevel, idLesson int) error {
+func (s *Service) DeleteLesson(ctx context.Context, idCourse, idSection, idLevel, idLesson int) error {
 
 	//check correct url
-	if err := s.p.CheckURLByCSLL(idCourse, idSection, idLevel, idLesson); err != nil {
+	if err := s.p.CheckURLByCSLL(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
-	chatsIDArr, err := s.p.GetChatsIDByLessonID(idLesson)
+	chatsIDArr, err := s.p.GetChatsIDByLessonID(ctx, idLesson)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetAllLevelsInSection"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllLevelsInSection"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 	for index, _ := range chatsIDArr {
-		if err := s.p.DeleteChat(chatsIDArr[index]); err != nil {
+		if err := s.p.DeleteChat(ctx, chatsIDArr[index]); err != nil {
 			if err != sql.ErrNoRows {
-				logger.LogError(errors.Wrap(err, "err with DeleteChatByLessonID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteChatByLessonID"))
 				return infrastruct.ErrorInternalServerError
 			}
 		}
-		if err := s.p.DeleteMessageByChatID(chatsIDArr[index]); err != nil {
+		if err := s.p.DeleteMessageByChatID(ctx, chatsIDArr[index]); err != nil {
 			if err != sql.ErrNoRows {
-				logger.LogError(errors.Wrap(err, "err with DeleteMessageByLessonID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteMessageByLessonID"))
 				return infrastruct.ErrorInternalServerError
 			}
 		}
 	}
 
-	if err := s.p.DeleteLesson(idCourse, idSection, idLevel, idLesson); err != nil {
-		logger.LogError(errors.Wrap(err, "err with DeleteLesson"))
+	if err := s.p.DeleteLesson(ctx, idCourse, idSection, idLevel, idLesson); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteLesson"))
 		if err == sql.ErrNoRows {
 			return infrastruct.ErrorNotFound
 		}
 		return infrastruct.ErrorInternalServerError
 	}
 
-	oldCarousel, err := s.p.GetLessonCarousel(idLevel)
+	oldCarousel, err := s.p.GetLessonCarousel(ctx, idLevel)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetLessonCarousel"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonCarousel"))
 		return infrastruct.ErrorNotFound
 	}
 
@@ -947,14 +954,14 @@ func (s *Service) DeleteLesson(idCourse, idSection, idLevel, idLesson int) error
 
 	newCarousel := &types.LessonCarousel{LessonArray: newCarouselArray, CourseID: idCourse,
 		SectionID: idSection, LevelID: idLevel}
-	if err = s.p.UpdateCarousel(newCarousel); err != nil {
-		logger.LogError(errors.Wrap(err, "err with UpdateCarousel"))
+	if err = s.p.UpdateCarousel(ctx, newCarousel); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UpdateCarousel"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	if len(newCarousel.LessonArray) == 0 {
-		if err := s.p.DeleteCarousel(idLevel); err != nil {
-			logger.LogError(errors.Wrap(err, "err with DeleteCarousel"))
+		if err := s.p.DeleteCarousel(ctx, idLevel); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteCarousel"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
@@ -962,57 +969,57 @@ func (s *Service) DeleteLesson(idCourse, idSection, idLevel, idLesson int) error
 	return nil
 }
 
-func (s *Service) RecordTime(rec *types.RecordTime) error {
+func (s *Service) RecordTime(ctx context.Context, rec *types.RecordTime) error {
 
-	lastSessionS, err := s.p.LastSession(rec.UserID)
+	lastSessionS, err := s.p.LastSession(ctx, rec.UserID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with s.p.LastSession"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with s.p.LastSession"))
 		}
 	}
 
 	lastSessionT, err := time.Parse(time.RFC3339, lastSessionS)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with time.Parse"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with time.Parse"))
 	}
 
 	then := time.Since(lastSessionT).Seconds()
 	if int(then) < (30 * 60) {
-		if err = s.p.AddTime(int(then), rec.UserID); err != nil {
-			logger.LogError(errors.Wrap(err, "err with s.p.WriteTime()"))
+		if err = s.p.AddTime(ctx, int(then), rec.UserID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with s.p.WriteTime(ctx)"))
 		}
 	}
 
-	if err := s.p.RecordTime(rec); err != nil {
+	if err := s.p.RecordTime(ctx, rec); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *Service) GetChatByLessonForStudent(chat *types.ChatData) (*types.ChatData, error) {
+func (s *Service) GetChatByLessonForStudent(ctx context.Context, chat *types.ChatData) (*types.ChatData, error) {
 
 	var err error
 
-	chat.ChatID, err = s.p.GetChatID(chat)
+	chat.ChatID, err = s.p.GetChatID(ctx, chat)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
 
-	if err = s.p.OffsetTeacherMessages(chat.ChatID); err != nil {
+	if err = s.p.OffsetTeacherMessages(ctx, chat.ChatID); err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with offsetTeacherMessages"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with offsetTeacherMessages"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
 
-	chat.Messages, err = s.p.GetMessage(chat.ChatID)
+	chat.Messages, err = s.p.GetMessage(ctx, chat.ChatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetMessage"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetMessage"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1020,47 +1027,51 @@ func (s *Service) GetChatByLessonForStudent(chat *types.ChatData) (*types.ChatDa
 	return chat, nil
 }
 
-func (s *Service) SendMessageToChatByLessonForStudent(chat *types.ChatData, mes *types.MessageBody) error {
+func (s *Service) SendMessageToChatByLessonForStudent(ctx context.Context, chat *types.ChatData, mes *types.MessageBody) error {
 
 	var err error
 
-	mes.FirstName, err = s.p.GetUserNameByUserID(mes.UserID)
+	mes.FirstName, err = s.p.GetUserNameByUserID(ctx, mes.UserID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetUserNameByUserID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	chat.ChatID, err = s.p.GetChatID(chat)
+	chat.ChatID, err = s.p.GetChatID(ctx, chat)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatID"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 
 	if chat.ChatID == 0 {
-		chat.ChatID, err = s.p.MakeChat(chat)
+		chat.ChatID, err = s.p.MakeChat(ctx, chat)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with MakeChat"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MakeChat"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 
-	if err = s.p.SendMessageChat(chat.ChatID, mes); err != nil {
-		logger.LogError(errors.Wrap(err, "err with SendMessageChat"))
+	if err = s.p.SendMessageChat(ctx, chat.ChatID, mes); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SendMessageChat"))
 		return infrastruct.ErrorInternalServerError
 	}
 
+	chatMessagesSent.Inc(types.RoleStudent)
+	s.background.Add(1)
+	go s.notifyTeachersAboutHomework(logger.Detach(ctx), chat, mes)
+
 	return nil
 }
 
-func (s *Service) GetChatByProfileStudent(chatID int, claims *infrastruct.CustomClaims) (*types.ChatData, error) {
+func (s *Service) GetChatByProfileStudent(ctx context.Context, chatID int, claims *infrastruct.CustomClaims) (*types.ChatData, error) {
 
 	var err error
-	chat, err := s.p.GetChatDataByChatID(chatID)
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		}
 		return nil, infrastruct.ErrorNotFound
 	}
@@ -1070,17 +1081,17 @@ func (s *Service) GetChatByProfileStudent(chatID int, claims *infrastruct.Custom
 		return nil, infrastruct.ErrorPermissionDenied
 	}
 
-	if err = s.p.OffsetTeacherMessages(chat.ChatID); err != nil {
+	if err = s.p.OffsetTeacherMessages(ctx, chat.ChatID); err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with offsetTeacherMessages"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with offsetTeacherMessages"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
 
-	chat.Messages, err = s.p.GetMessage(chat.ChatID)
+	chat.Messages, err = s.p.GetMessage(ctx, chat.ChatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetMessage"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetMessage"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1088,14 +1099,14 @@ func (s *Service) GetChatByProfileStudent(chatID int, claims *infrastruct.Custom
 	return chat, nil
 }
 
-func (s *Service) SendMessageToChatByProfileStudent(chatID int, mes *types.MessageBody) error {
+func (s *Service) SendMessageToChatByProfileStudent(ctx context.Context, chatID int, mes *types.MessageBody) error {
 
 	var err error
 
-	chat, err := s.p.GetChatDataByChatID(chatID)
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		}
 		return infrastruct.ErrorNotFound
 	}
@@ -1105,27 +1116,31 @@ func (s *Service) SendMessageToChatByProfileStudent(chatID int, mes *types.Messa
 		return infrastruct.ErrorPermissionDenied
 	}
 
-	mes.FirstName, err = s.p.GetUserNameByUserID(mes.UserID)
+	mes.FirstName, err = s.p.GetUserNameByUserID(ctx, mes.UserID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetUserNameByUserID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	if err = s.p.SendMessageChat(chat.ChatID, mes); err != nil {
-		logger.LogError(errors.Wrap(err, "err with SendMessageChat"))
+	if err = s.p.SendMessageChat(ctx, chat.ChatID, mes); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SendMessageChat"))
 		return infrastruct.ErrorInternalServerError
 	}
 
+	chatMessagesSent.Inc(types.RoleStudent)
+	s.background.Add(1)
+	go s.notifyTeachersAboutHomework(logger.Detach(ctx), chat, mes)
+
 	return nil
 }
 
-func (s *Service) GetChatForTeacher(chatID int, claims *infrastruct.CustomClaims) (*types.ChatData, error) {
+func (s *Service) GetChatForTeacher(ctx context.Context, chatID int, claims *infrastruct.CustomClaims) (*types.ChatData, error) {
 
 	var err error
-	chat, err := s.p.GetChatDataByChatID(chatID)
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		}
 		return nil, infrastruct.ErrorNotFound
 	}
@@ -1135,17 +1150,17 @@ func (s *Service) GetChatForTeacher(chatID int, claims *infrastruct.CustomClaims
 	//	return nil, infrastruct.ErrorPermissionDenied
 	//}
 
-	if err = s.p.OffsetStudentMessages(chat.ChatID); err != nil {
+	if err = s.p.OffsetStudentMessages(ctx, chat.ChatID); err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with offsetTeacherMessages"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with offsetTeacherMessages"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
 
-	chat.Messages, err = s.p.GetMessage(chat.ChatID)
+	chat.Messages, err = s.p.GetMessage(ctx, chat.ChatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetMessage"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetMessage"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1153,21 +1168,21 @@ func (s *Service) GetChatForTeacher(chatID int, claims *infrastruct.CustomClaims
 	return chat, nil
 }
 
-func (s *Service) GetChatForAdmin(chatID int) (*types.ChatData, error) {
+func (s *Service) GetChatForAdmin(ctx context.Context, chatID int) (*types.ChatData, error) {
 
 	var err error
-	chat, err := s.p.GetChatDataByChatID(chatID)
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		}
 		return nil, infrastruct.ErrorNotFound
 	}
 
-	chat.Messages, err = s.p.GetMessage(chat.ChatID)
+	chat.Messages, err = s.p.GetMessage(ctx, chat.ChatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetMessage"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetMessage"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1175,14 +1190,14 @@ func (s *Service) GetChatForAdmin(chatID int) (*types.ChatData, error) {
 	return chat, nil
 }
 
-func (s *Service) SendMessageToChatForTeacher(chatID int, mes *types.MessageBody) error {
+func (s *Service) SendMessageToChatForTeacher(ctx context.Context, chatID int, mes *types.MessageBody) error {
 
 	var err error
 
-	chat, err := s.p.GetChatDataByChatID(chatID)
+	chat, err := s.p.GetChatDataByChatID(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		}
 		return infrastruct.ErrorNotFound
 	}
@@ -1192,47 +1207,53 @@ func (s *Service) SendMessageToChatForTeacher(chatID int, mes *types.MessageBody
 	//	return infrastruct.ErrorPermissionDenied
 	//}
 
-	mes.FirstName, err = s.p.GetUserNameByUserID(mes.UserID)
+	mes.FirstName, err = s.p.GetUserNameByUserID(ctx, mes.UserID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetUserNameByUserID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
 		return infrastruct.ErrorInternalServerError
 	}
 
-	timeLastStudentMesS, err := s.p.FindLastStudentMessageNotAnswer(chatID)
+	timeLastStudentMesS, err := s.p.FindLastStudentMessageNotAnswer(ctx, chatID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with s.p.FindLastStudentMessageNotAnswer"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with s.p.FindLastStudentMessageNotAnswer"))
 		}
 	}
 
 	if timeLastStudentMesS != "" {
 		timeLastStudentMesT, err := time.Parse(time.RFC3339, timeLastStudentMesS)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with time.Parse"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with time.Parse"))
 		}
 
 		then := time.Since(timeLastStudentMesT).Seconds()
 
-		if err = s.p.AddTimeAnswer(mes.UserID, int(then)); err != nil {
-			logger.LogError(errors.Wrap(err, "err with s.p.AddTimeAnswer"))
+		if err = s.p.AddTimeAnswer(ctx, mes.UserID, int(then)); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with s.p.AddTimeAnswer"))
 		}
+		s.addTeacherEvent(ctx, &types.TeacherEvent{TeacherID: mes.UserID, ChatID: chatID,
+			Event: types.TeacherEventAnswer, Value: int(then)})
 	}
 
-	if err = s.p.SendMessageChat(chat.ChatID, mes); err != nil {
-		logger.LogError(errors.Wrap(err, "err with SendMessageChat"))
+	if err = s.p.SendMessageChat(ctx, chat.ChatID, mes); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SendMessageChat"))
 		return infrastruct.ErrorInternalServerError
 	}
 
+	chatMessagesSent.Inc(types.RoleTeacher)
+	s.background.Add(1)
+	go s.notifyStudentAboutReply(logger.Detach(ctx), chat, mes)
+
 	return nil
 }
 
-func (s *Service) GetAllChatsForTeacher(teacherID int) ([]types.ChatsPreviewForTeacher, error) {
+func (s *Service) GetAllChatsForTeacher(ctx context.Context, teacherID int) ([]types.ChatsPreviewForTeacher, error) {
 
 	//find id sections
-	sectionsID, err := s.p.GetAllSectionsIDByTeacherID(teacherID)
+	sectionsID, err := s.p.GetAllSectionsIDByTeacherID(ctx, teacherID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1241,9 +1262,9 @@ func (s *Service) GetAllChatsForTeacher(teacherID int) ([]types.ChatsPreviewForT
 	chatPreview := types.ChatsPreviewForTeacher{}
 
 	for _, sectionID := range sectionsID {
-		chatsID, err := s.p.GetChatsIDBySectionID(sectionID)
+		chatsID, err := s.p.GetChatsIDBySectionID(ctx, sectionID)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with GetChatsIDBySectionID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatsIDBySectionID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 		for _, chatID := range chatsID {
@@ -1261,60 +1282,60 @@ func (s *Service) GetAllChatsForTeacher(teacherID int) ([]types.ChatsPreviewForT
 		wg.Add(1)
 		go func(index int) {
 			wg.Done()
-			chatsPreview[index].StudentID, err = s.p.GetStudentIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].StudentID, err = s.p.GetStudentIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetStudentIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetStudentIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].StudentFirstName, err = s.p.GetUserNameByUserID(chatsPreview[index].StudentID)
+			chatsPreview[index].StudentFirstName, err = s.p.GetUserNameByUserID(ctx, chatsPreview[index].StudentID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetUserNameByUserID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(chatsPreview[index].LessonID)
+			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(ctx, chatsPreview[index].LessonID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonNameByLessonID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(chatsPreview[index].SectionsID)
+			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(ctx, chatsPreview[index].SectionsID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetSectionNameBySectionsID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetSectionNameBySectionsID"))
 				errorChan <- struct{}{}
 				return
 			}
-			timeS, err := s.p.GetTimeByChatID(chatsPreview[index].ChatID)
+			timeS, err := s.p.GetTimeByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetTimeByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTimeByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
 			timeT, err := time.Parse(time.RFC3339, timeS)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with time.Parse"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with time.Parse"))
 				errorChan <- struct{}{}
 				return
 			}
 			timeT = timeT.Add(time.Hour * 24)
 			chatsPreview[index].Time = timeT.Format(time.RFC3339)
 
-			chatsPreview[index].Ahtung, err = s.p.GetAhtungByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].Ahtung, err = s.p.GetAhtungByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetAhtungByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAhtungByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].NotViewMessage, err = s.p.GetNotViewMessageForTeacherByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].NotViewMessage, err = s.p.GetNotViewMessageForTeacherByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetAhtungByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAhtungByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
@@ -1329,12 +1350,12 @@ func (s *Service) GetAllChatsForTeacher(teacherID int) ([]types.ChatsPreviewForT
 	}
 }
 
-func (s *Service) GetAllChatsForAdmin(teacherID int) ([]types.ChatsPreviewForAdmin, error) {
+func (s *Service) GetAllChatsForAdmin(ctx context.Context, teacherID int) ([]types.ChatsPreviewForAdmin, error) {
 	//find id sections
-	sectionsID, err := s.p.GetAllSectionsIDByTeacherID(teacherID)
+	sectionsID, err := s.p.GetAllSectionsIDByTeacherID(ctx, teacherID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1343,9 +1364,9 @@ func (s *Service) GetAllChatsForAdmin(teacherID int) ([]types.ChatsPreviewForAdm
 	chatPreview := types.ChatsPreviewForAdmin{}
 
 	for _, sectionID := range sectionsID {
-		chatsID, err := s.p.GetChatsIDBySectionID(sectionID)
+		chatsID, err := s.p.GetChatsIDBySectionID(ctx, sectionID)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with GetChatsIDBySectionID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatsIDBySectionID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 		for _, chatID := range chatsID {
@@ -1363,51 +1384,51 @@ func (s *Service) GetAllChatsForAdmin(teacherID int) ([]types.ChatsPreviewForAdm
 		wg.Add(1)
 		go func(index int) {
 			defer wg.Done()
-			chatsPreview[index].StudentID, err = s.p.GetStudentIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].StudentID, err = s.p.GetStudentIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetStudentIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetStudentIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].StudentFirstName, err = s.p.GetUserNameByUserID(chatsPreview[index].StudentID)
+			chatsPreview[index].StudentFirstName, err = s.p.GetUserNameByUserID(ctx, chatsPreview[index].StudentID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetUserNameByUserID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserNameByUserID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(chatsPreview[index].LessonID)
+			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(ctx, chatsPreview[index].LessonID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonNameByLessonID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(chatsPreview[index].SectionsID)
+			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(ctx, chatsPreview[index].SectionsID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetSectionNameBySectionsID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetSectionNameBySectionsID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].Time, err = s.p.GetTimeByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].Time, err = s.p.GetTimeByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetTimeByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTimeByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].Rating, err = s.p.GetRatingByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].Rating, err = s.p.GetRatingByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetRatingByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetRatingByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LastMessage, err = s.p.GetLastMessageByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].LastMessage, err = s.p.GetLastMessageByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLastMessageByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLastMessageByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
@@ -1423,12 +1444,12 @@ func (s *Service) GetAllChatsForAdmin(teacherID int) ([]types.ChatsPreviewForAdm
 	}
 }
 
-func (s *Service) GetAllChatsForStudent(studentID int) ([]types.ChatsPreviewForStudent, error) {
+func (s *Service) GetAllChatsForStudent(ctx context.Context, studentID int) ([]types.ChatsPreviewForStudent, error) {
 	//find id sections
-	chatsID, err := s.p.GetAllChatsIDByStudentID(studentID)
+	chatsID, err := s.p.GetAllChatsIDByStudentID(ctx, studentID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAllSectionsIDByTeacherID"))
 			return nil, infrastruct.ErrorInternalServerError
 		}
 	}
@@ -1449,39 +1470,39 @@ func (s *Service) GetAllChatsForStudent(studentID int) ([]types.ChatsPreviewForS
 		wg.Add(1)
 		go func(index int) {
 			defer wg.Done()
-			chatsPreview[index].SectionsID, err = s.p.GetSectionIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].SectionsID, err = s.p.GetSectionIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetSectionIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetSectionIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(chatsPreview[index].SectionsID)
+			chatsPreview[index].SectionsName, err = s.p.GetSectionNameBySectionsID(ctx, chatsPreview[index].SectionsID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetSectionNameBySectionsID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetSectionNameBySectionsID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].LessonID, err = s.p.GetLessonIDByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonIDByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonIDByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(chatsPreview[index].LessonID)
+			chatsPreview[index].LessonName, err = s.p.GetLessonNameByLessonID(ctx, chatsPreview[index].LessonID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLessonNameByLessonID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLessonNameByLessonID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].LastMessage, err = s.p.GetLastTeacherMessageByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].LastMessage, err = s.p.GetLastTeacherMessageByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetLastTeacherMessageByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetLastTeacherMessageByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
-			chatsPreview[index].NotViewMessage, err = s.p.GetNotViewMessageForStudentByChatID(chatsPreview[index].ChatID)
+			chatsPreview[index].NotViewMessage, err = s.p.GetNotViewMessageForStudentByChatID(ctx, chatsPreview[index].ChatID)
 			if err != nil {
-				logger.LogError(errors.Wrap(err, "err with GetNotViewMessageForStudentByChatID"))
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetNotViewMessageForStudentByChatID"))
 				errorChan <- struct{}{}
 				return
 			}
@@ -1496,123 +1517,159 @@ func (s *Service) GetAllChatsForStudent(studentID int) ([]types.ChatsPreviewForS
 	}
 }
 
-func (s *Service) Ahtung(ch *types.Ahtung) error {
+func (s *Service) Ahtung(ctx context.Context, ch *types.Ahtung) error {
 	//todo нету проверки доступа к чату
-	ahtung, err := s.p.GetAhtungByChatID(ch.ChatID)
+	ahtung, err := s.p.GetAhtungByChatID(ctx, ch.ChatID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetAhtungByChatID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetAhtungByChatID"))
 		return infrastruct.ErrorInternalServerError
 	}
 	if ahtung {
 		ch.Ahtung = false
-		if err := s.p.ChangeAhtung(ch); err != nil {
-			logger.LogError(errors.Wrap(err, "err with ChangeAhtung"))
+		if err := s.p.ChangeAhtung(ctx, ch); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ChangeAhtung"))
 			return infrastruct.ErrorInternalServerError
 		}
 	} else {
 		ch.Ahtung = true
-		if err := s.p.ChangeAhtung(ch); err != nil {
-			logger.LogError(errors.Wrap(err, "err with ChangeAhtung"))
+		if err := s.p.ChangeAhtung(ctx, ch); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ChangeAhtung"))
 			return infrastruct.ErrorInternalServerError
 		}
 
-		if err = s.p.IncrementAhtung(ch.TeacherID); err != nil {
-			logger.LogError(errors.Wrap(err, "err with IncrementAhtung"))
+		if err = s.p.IncrementAhtung(ctx, ch.TeacherID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with IncrementAhtung"))
 		}
+		s.addTeacherEvent(ctx, &types.TeacherEvent{TeacherID: ch.TeacherID, ChatID: ch.ChatID,
+			Event: types.TeacherEventAhtung})
 	}
 
 	return nil
 }
 
-func (s *Service) Rating(ch *types.Rating) error {
+func (s *Service) Rating(ctx context.Context, ch *types.Rating) error {
 	//todo нету проверки доступа к чату
-	if ch.Rating != "good" && ch.Rating != "improve" {
-		return infrastruct.ErrorBadRequest
-	}
-
 	if ch.Rating == "good" {
-		if err := s.p.IncrementGood(ch.TeacherID); err != nil {
-			logger.LogError(errors.Wrap(err, "err with IncrementGood"))
+		if err := s.p.IncrementGood(ctx, ch.TeacherID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with IncrementGood"))
 			return infrastruct.ErrorInternalServerError
 		}
 	} else {
-		if err := s.p.IncrementImprove(ch.TeacherID); err != nil {
-			logger.LogError(errors.Wrap(err, "err with IncrementImprove"))
+		if err := s.p.IncrementImprove(ctx, ch.TeacherID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with IncrementImprove"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 
-	oldRating, err := s.p.GetRatingByChatID(ch.ChatID)
+	oldRating, err := s.p.GetRatingByChatID(ctx, ch.ChatID)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetRatingByChatID"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetRatingByChatID"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	if oldRating == "" {
-		courseID, err := s.p.GetCourseIDByChatID(ch.ChatID)
+		courseID, err := s.p.GetCourseIDByChatID(ctx, ch.ChatID)
 		if err != nil {
-			logger.LogError(errors.Wrap(err, "err with GetCourseIDByChatID"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetCourseIDByChatID"))
 			return infrastruct.ErrorInternalServerError
 		}
-		if err = s.p.IncrementHomeWork(courseID); err != nil {
-			logger.LogError(errors.Wrap(err, "err with IncrementHomeWork"))
+		if err = s.p.IncrementHomeWork(ctx, courseID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with IncrementHomeWork"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 
-	if err := s.p.ChangeRating(ch); err != nil {
-		logger.LogError(errors.Wrap(err, "err with GetChatDataByChatID"))
+	if err := s.p.ChangeRating(ctx, ch); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetChatDataByChatID"))
 		return infrastruct.ErrorInternalServerError
 	}
+	s.addTeacherEvent(ctx, &types.TeacherEvent{TeacherID: ch.TeacherID, ChatID: ch.ChatID, Event: ch.Rating})
 
 	return nil
 }
 
-func (s *Service) UploadVideo(video *types.UploadVideo) error {
+func (s *Service) UploadVideo(ctx context.Context, video *types.UploadVideo) error {
 
 	//check url
-	if err := s.p.CheckURLByCSLL(video.CourseID, video.SectionID, video.LevelID, video.LessonID); err != nil {
+	if err := s.p.CheckURLByCSLL(ctx, video.CourseID, video.SectionID, video.LevelID, video.LessonID); err != nil {
 		return infrastruct.ErrorNotFound
 	}
 
 	//Проверить наличие видео
-	existenceVideoID, err := s.checkExistenceVideo(video.LessonID)
+	existenceVideoID, err := s.checkExistenceVideo(ctx, video.LessonID)
 	if err != nil {
 		return infrastruct.ErrorInternalServerError
 	}
 	if existenceVideoID > 0 {
 		if err := os.Remove(fmt.Sprintf("%s/%d", s.videoDir, existenceVideoID)); err != nil {
-			logger.LogError(errors.Wrap(err, "err with os.Remove"))
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with os.Remove"))
 			return infrastruct.ErrorInternalServerError
 		}
 	}
 
 	dst, err := os.Create(filepath.Join(s.videoDir, fmt.Sprintf("%d", video.LessonID)))
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with Create in UploadVideo"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with Create in UploadVideo"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	_, err = io.Copy(dst, video.Body)
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with Copy in UploadVideo"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with Copy in UploadVideo"))
 		return infrastruct.ErrorInternalServerError
 	}
 
 	return nil
 }
 
-func (s *Service) CheckUserInDBUsers(userID int) error {
+// CheckUserInDBUsers проверяет, что пользователь не удален и токен не отозван сменой пароля
+func (s *Service) CheckUserInDBUsers(ctx context.Context, claims *infrastruct.CustomClaims) error {
+
+	access, err := s.getUserAccess(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if access.TokenVersion != claims.Version {
+		return infrastruct.ErrorJWTIsBroken
+	}
+	if access.Suspended {
+		return suspendedError(access.SuspendReason)
+	}
+	if claims.ImpersonatorID == 0 {
+		return nil
+	}
+
+	//вход от имени пользователя работает, пока у админа есть право и его самого не заблокировали
+	impersonator, err := s.getUserAccess(ctx, claims.ImpersonatorID)
+	if err != nil {
+		return err
+	}
+	if impersonator.Suspended {
+		return infrastruct.ErrorJWTIsBroken
+	}
+	ok, err := s.HasPermission(ctx, impersonator.Role, types.PermImpersonate)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return infrastruct.ErrorJWTIsBroken
+	}
+
+	return nil
+}
+
+func (s *Service) getUserAccess(ctx context.Context, userID int) (*types.UserAccess, error) {
 
-	if err := s.p.CheckUserInDBUsers(userID); err != nil {
+	access, err := s.p.GetUserAccess(ctx, userID)
+	if err != nil {
 		if err != sql.ErrNoRows {
-			logger.LogError(errors.Wrap(err, "err with CheckUserInDBUsers"))
-			return infrastruct.ErrorInternalServerError
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserAccess"))
+			return nil, infrastruct.ErrorInternalServerError
 		}
-		return infrastruct.ErrorPermissionDenied
+		return nil, infrastruct.ErrorPermissionDenied
 	}
 
-	return nil
+	return access, nil
 }
 
 func trimSpaceUser(user *types.User) {
@@ -1627,19 +1684,19 @@ func trimSpaceTeacher(teacher *types.Teacher) {
 	teacher.Email = strings.TrimSpace(teacher.Email)
 }
 
-func (s *Service) checkExistenceVideo(lessonID int) (int, error) {
+func (s *Service) checkExistenceVideo(ctx context.Context, lessonID int) (int, error) {
 
 	fileInfo, err := os.Stat(fmt.Sprintf("%s/%d", s.videoDir, lessonID))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, nil
 		}
-		logger.LogError(errors.Wrap(err, "err with os.IsNotExist"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with os.IsNotExist"))
 		return 0, err
 	}
 	name, err := strconv.Atoi(fileInfo.Name())
 	if err != nil {
-		logger.LogError(errors.Wrap(err, "err with strconv.Atoi"))
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with strconv.Atoi"))
 		return 0, err
 	}
 
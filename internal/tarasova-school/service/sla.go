@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/notify"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSLAReminder = 24 * time.Hour
+	defaultSLAEscalate = 48 * time.Hour
+)
+
+// RunSLAMonitor периодически ищет неотвеченные чаты и рассылает напоминания, пока не отменят ctx
+func (s *Service) RunSLAMonitor(ctx context.Context) {
+
+	if s.sla.CheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.sla.CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.checkSLA(ctx); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with checkSLA"))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) GetSLAOverview(ctx context.Context) (*types.SLAOverview, error) {
+
+	chats, err := s.overdueChats(ctx)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with overdueChats"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	overview := &types.SLAOverview{
+		Courses:  make([]types.SLACourseOverdue, 0),
+		Teachers: make([]types.SLATeacherOverdue, 0),
+	}
+	sectionIDs := make([]int, 0, len(chats))
+	for i := range chats {
+		sectionIDs = append(sectionIDs, chats[i].SectionID)
+	}
+	sectionTeachers, err := s.p.GetTeachersBySectionIDs(ctx, sectionIDs)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTeachersBySectionIDs"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	courses := make(map[int]*types.SLACourseOverdue)
+	teachers := make(map[int]*types.SLATeacherOverdue)
+	for i := range chats {
+		_, escalateAfter := s.slaForCourse(chats[i].CourseID)
+		escalated := time.Since(chats[i].WaitingSince) >= escalateAfter
+
+		course, ok := courses[chats[i].CourseID]
+		if !ok {
+			course = &types.SLACourseOverdue{CourseID: chats[i].CourseID}
+			courses[chats[i].CourseID] = course
+		}
+		overview.Overdue++
+		course.Overdue++
+		if escalated {
+			overview.Escalated++
+			course.Escalated++
+		}
+
+		for _, t := range sectionTeachers[chats[i].SectionID] {
+			teacher, ok := teachers[t.ID]
+			if !ok {
+				teacher = &types.SLATeacherOverdue{TeacherID: t.ID, FirstName: t.FirstName}
+				teachers[t.ID] = teacher
+			}
+			teacher.Overdue++
+		}
+	}
+
+	for _, course := range courses {
+		overview.Courses = append(overview.Courses, *course)
+	}
+	for _, teacher := range teachers {
+		overview.Teachers = append(overview.Teachers, *teacher)
+	}
+	sort.Slice(overview.Courses, func(i, j int) bool { return overview.Courses[i].CourseID < overview.Courses[j].CourseID })
+	sort.Slice(overview.Teachers, func(i, j int) bool { return overview.Teachers[i].TeacherID < overview.Teachers[j].TeacherID })
+
+	return overview, nil
+}
+
+func (s *Service) checkSLA(ctx context.Context) error {
+
+	chats, err := s.overdueChats(ctx)
+	if err != nil {
+		return errors.Wrap(err, "err with overdueChats")
+	}
+
+	for i := range chats {
+		chat := &chats[i]
+		_, escalateAfter := s.slaForCourse(chat.CourseID)
+
+		if chat.RemindedAt == nil {
+			if err = s.remindTeachers(ctx, chat); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with remindTeachers"))
+				continue
+			}
+			if err = s.p.MarkSLAReminded(ctx, chat.ChatID, chat.MessageID); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkSLAReminded"))
+				continue
+			}
+		}
+
+		if chat.EscalatedAt == nil && time.Since(chat.WaitingSince) >= escalateAfter {
+			if err = s.escalateToAdmins(ctx, chat); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with escalateToAdmins"))
+				continue
+			}
+			if err = s.p.MarkSLAEscalated(ctx, chat.ChatID, chat.MessageID); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with MarkSLAEscalated"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// overdueChats возвращает чаты, которые ждут ответа дольше срока напоминания своего курса
+func (s *Service) overdueChats(ctx context.Context) ([]types.OverdueChat, error) {
+
+	minReminder := s.sla.ReminderAfter
+	for _, course := range s.sla.Courses {
+		if course.ReminderAfter > 0 && course.ReminderAfter < minReminder {
+			minReminder = course.ReminderAfter
+		}
+	}
+
+	chats, err := s.p.GetChatsWaitingAnswer(ctx, time.Now().Add(-minReminder))
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := chats[:0]
+	for _, chat := range chats {
+		reminderAfter, _ := s.slaForCourse(chat.CourseID)
+		if time.Since(chat.WaitingSince) >= reminderAfter {
+			overdue = append(overdue, chat)
+		}
+	}
+
+	return overdue, nil
+}
+
+func (s *Service) slaForCourse(courseID int) (time.Duration, time.Duration) {
+
+	reminderAfter, escalateAfter := s.sla.ReminderAfter, s.sla.EscalateAfter
+	if course, ok := s.sla.Courses[courseID]; ok {
+		if course.ReminderAfter > 0 {
+			reminderAfter = course.ReminderAfter
+		}
+		if course.EscalateAfter > 0 {
+			escalateAfter = course.EscalateAfter
+		}
+	}
+
+	return reminderAfter, escalateAfter
+}
+
+// remindTeachers отправляет напоминание каждому учителю раздела отдельно, через его каналы уведомлений
+func (s *Service) remindTeachers(ctx context.Context, chat *types.OverdueChat) error {
+
+	teachers, err := s.p.GetTeachersBySectionID(ctx, chat.SectionID)
+	if err != nil {
+		return errors.Wrap(err, "err with GetTeachersBySectionID")
+	}
+	if len(teachers) == 0 {
+		return nil
+	}
+
+	text, err := s.slaMessage(ctx, chat)
+	if err != nil {
+		return err
+	}
+
+	for _, teacher := range teachers {
+		s.notify(ctx, teacher.ID, types.NotifySLAReminder, notify.SLA{Text: text})
+	}
+
+	return nil
+}
+
+// escalateToAdmins отправляет эскалацию каждому админу отдельно, через его каналы уведомлений
+func (s *Service) escalateToAdmins(ctx context.Context, chat *types.OverdueChat) error {
+
+	text, err := s.slaMessage(ctx, chat)
+	if err != nil {
+		return err
+	}
+	logger.LogInfoCtx(ctx, "Просрочен ответ ученику. "+text)
+
+	admins, err := s.p.GetAdminIDs(ctx)
+	if err != nil {
+		return errors.Wrap(err, "err with GetAdminIDs")
+	}
+	for _, id := range admins {
+		s.notify(ctx, id, types.NotifySLAEscalated, notify.SLA{Text: text})
+	}
+
+	return nil
+}
+
+func (s *Service) slaMessage(ctx context.Context, chat *types.OverdueChat) (string, error) {
+
+	studentName, err := s.p.GetUserNameByUserID(ctx, chat.StudentID)
+	if err != nil {
+		return "", errors.Wrap(err, "err with GetUserNameByUserID")
+	}
+	lessonName, err := s.p.GetLessonNameByLessonID(ctx, chat.LessonID)
+	if err != nil {
+		return "", errors.Wrap(err, "err with GetLessonNameByLessonID")
+	}
+
+	return fmt.Sprintf("Ученик %s ждет ответа в чате %d по уроку «%s» с %s",
+		studentName, chat.ChatID, lessonName, chat.WaitingSince.Format("2006-01-02 15:04")), nil
+}
+
+func newSLAConfig(sla *config.SLA) *config.SLA {
+
+	if sla == nil {
+		sla = &config.SLA{}
+	}
+	if sla.ReminderAfter <= 0 {
+		sla.ReminderAfter = defaultSLAReminder
+	}
+	if sla.EscalateAfter <= 0 {
+		sla.EscalateAfter = defaultSLAEscalate
+	}
+
+	return sla
+}
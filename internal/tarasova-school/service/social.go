@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"time"
+)
+
+const defaultOAuthStateTTL = 10 * time.Minute
+
+// OAuthLoginURL начинает вход через соцсеть, если userID не 0 - привязку соцсети к этому пользователю.
+// Nonce ответа отдается браузеру в cookie, без него callback не примет state, уведенный из чужой ссылки
+func (s *Service) OAuthLoginURL(ctx context.Context, providerName string, userID int) (*types.OAuthRedirect, error) {
+
+	provider, ok := s.oauth[providerName]
+	if !ok {
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	state, err := oauth.RandomString()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RandomString"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	verifier, err := oauth.RandomString()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RandomString"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	nonce, err := oauth.RandomString()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RandomString"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	if err = s.p.DeleteOAuthStatesBefore(ctx, time.Now().Add(-s.oauthStateTTL)); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteOAuthStatesBefore"))
+	}
+	err = s.p.AddOAuthState(ctx, &types.OAuthState{
+		State:        state,
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		NonceHash:    nonceHash(nonce),
+		UserID:       userID,
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddOAuthState"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.OAuthRedirect{URL: provider.AuthURL(state, verifier), Nonce: nonce}, nil
+}
+
+// OAuthCallback завершает вход: проверяет state и nonce из cookie, меняет code на токен и находит или создает пользователя
+func (s *Service) OAuthCallback(ctx context.Context, providerName, code, stateValue, nonce string) (*types.Token, error) {
+
+	provider, ok := s.oauth[providerName]
+	if !ok {
+		return nil, infrastruct.ErrorNotFound
+	}
+	if code == "" || stateValue == "" {
+		return nil, infrastruct.ErrorBadRequest
+	}
+
+	state, err := s.p.TakeOAuthState(ctx, stateValue)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with TakeOAuthState"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		return nil, infrastruct.ErrorOAuthStateInvalid
+	}
+	if state.Provider != providerName || time.Since(state.CreatedAT) > s.oauthStateTTL {
+		return nil, infrastruct.ErrorOAuthStateInvalid
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(nonceHash(nonce)), []byte(state.NonceHash)) != 1 {
+		return nil, infrastruct.ErrorOAuthStateInvalid
+	}
+
+	token, err := provider.Exchange(ctx, code, state.CodeVerifier)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrapf(err, "err with Exchange %s", providerName))
+		return nil, infrastruct.ErrorOAuthStateInvalid
+	}
+	profile, err := provider.Profile(ctx, token)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrapf(err, "err with Profile %s", providerName))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	userID, err := s.p.GetUserIDByIdentity(ctx, profile.Provider, profile.Subject)
+	switch {
+	case err == nil:
+		if state.UserID != 0 && state.UserID != userID {
+			return nil, infrastruct.ErrorOAuthIdentityLinked
+		}
+	case err != sql.ErrNoRows:
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserIDByIdentity"))
+		return nil, infrastruct.ErrorInternalServerError
+	case state.UserID != 0:
+		userID = state.UserID
+		if err = s.addIdentity(ctx, userID, profile); err != nil {
+			return nil, err
+		}
+	default:
+		if userID, err = s.registerByProfile(ctx, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	if user.Suspended {
+		return nil, suspendedError(user.SuspendReason)
+	}
+
+	if challenge, err := s.twoFactorChallenge(ctx, user); err != nil || challenge != nil {
+		return challenge, err
+	}
+
+	jwt, err := infrastruct.GenerateJWT(user.ID, user.UserRole, user.TokenVersion, s.secretKey)
+	if err != nil {
+		logger.LogErrorCtx(ctx, err)
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.Token{Token: jwt}, nil
+}
+
+func (s *Service) GetUserIdentities(ctx context.Context, userID int) ([]types.UserIdentity, error) {
+
+	identities, err := s.p.GetUserIdentities(ctx, userID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserIdentities"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return identities, nil
+}
+
+// UnlinkIdentity отвязывает соцсеть, но не последнюю у аккаунта, созданного через соцсеть: его пароль никто не знает
+func (s *Service) UnlinkIdentity(ctx context.Context, userID int, provider string) error {
+
+	ok, err := s.p.DeleteUserIdentity(ctx, userID, provider)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteUserIdentity"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+	if !ok {
+		return infrastruct.ErrorOAuthLastMethod
+	}
+
+	return nil
+}
+
+// registerByProfile создает студента для нового входа через соцсеть.
+// Аккаунт с тем же email сам не привязываем: иначе чужая соцсеть с этим email получит доступ к аккаунту
+func (s *Service) registerByProfile(ctx context.Context, profile *types.OAuthProfile) (int, error) {
+
+	if profile.Email == "" {
+		return 0, infrastruct.ErrorBadRequest
+	}
+	if _, err := s.p.GetUserByEmail(ctx, profile.Email); err == nil {
+		return 0, infrastruct.ErrorOAuthAccountExists
+	} else if err != sql.ErrNoRows {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByEmail"))
+		return 0, infrastruct.ErrorInternalServerError
+	}
+
+	//пароль никому не отправляем, при желании пользователь задаст его через восстановление
+	password, err := oauth.RandomString()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RandomString"))
+		return 0, infrastruct.ErrorInternalServerError
+	}
+	user := &types.User{
+		FirstName:      profile.FirstName,
+		Email:          profile.Email,
+		Password:       password,
+		UserRole:       types.RoleStudent,
+		RandomPassword: true,
+	}
+	if user.ID, err = s.p.CreateUser(ctx, user); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CreateUser"))
+		return 0, infrastruct.ErrorInternalServerError
+	}
+
+	if profile.EmailVerified {
+		if err = s.p.SetEmailVerified(ctx, user.ID, user.Email); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetEmailVerified"))
+			return 0, infrastruct.ErrorInternalServerError
+		}
+	} else {
+		s.background.Add(1)
+		go func(ctx context.Context, user types.User) {
+			defer s.background.Done()
+			if err := s.sendEmailVerification(ctx, &user); err != nil {
+				logger.LogErrorCtx(ctx, errors.Wrap(err, "err with sendEmailVerification"))
+			}
+		}(logger.Detach(ctx), *user)
+	}
+
+	if err = s.addIdentity(ctx, user.ID, profile); err != nil {
+		return 0, err
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Зарегистрировался новый студент через %s: %s, email: %s",
+		profile.Provider, user.FirstName, user.Email))
+
+	return user.ID, nil
+}
+
+func (s *Service) addIdentity(ctx context.Context, userID int, profile *types.OAuthProfile) error {
+
+	err := s.p.AddUserIdentity(ctx, &types.UserIdentity{
+		UserID:   userID,
+		Provider: profile.Provider,
+		Subject:  profile.Subject,
+		Email:    profile.Email,
+	})
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddUserIdentity"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+// OAuthStateTTL - сколько живет начатый вход через соцсеть, столько же живет cookie с nonce
+func (s *Service) OAuthStateTTL() time.Duration {
+	return s.oauthStateTTL
+}
+
+func nonceHash(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+func newOAuthStateTTL(cnf *config.SocAuth) time.Duration {
+	if cnf == nil || cnf.StateTTL <= 0 {
+		return defaultOAuthStateTTL
+	}
+	return cnf.StateTTL
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"github.com/tarasova-school/internal/clients/postgres/postgrestest"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth/oauthtest"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newOAuthTestService - сервис поверх фейковой базы с провайдером google на фейковом OAuth сервере
+func newOAuthTestService(t *testing.T, profile oauthtest.Profile) (*Service, *postgrestest.DB, *oauthtest.Server) {
+	t.Helper()
+
+	server := oauthtest.NewServer(profile)
+	t.Cleanup(server.Close)
+
+	cnf := config.Defaults()
+	cnf.SecretKeyJWT = "test"
+	cnf.Email = &config.ConfigForSendEmail{}
+	cnf.Soc = &config.SocAuth{Providers: map[string]config.OAuthProvider{
+		oauth.ProviderGoogle: server.Config(oauth.ProviderGoogle),
+	}}
+	db, pg := postgrestest.New()
+	srv, err := NewService(pg, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, db, server
+}
+
+// startOAuth начинает вход и отдает браузеру адрес провайдера и nonce. Если stored, сохраненный state
+// фейковая база вернет на callback, как настоящая
+func startOAuth(t *testing.T, srv *Service, db *postgrestest.DB, stored bool) *types.OAuthRedirect {
+	t.Helper()
+
+	redirect, err := srv.OAuthLoginURL(context.Background(), oauth.ProviderGoogle, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored {
+		return redirect
+	}
+	for _, q := range db.Queries() {
+		if len(q.Args) == 5 && strings.HasPrefix(q.SQL, "INSERT INTO oauth_states") {
+			db.On("DELETE FROM oauth_states WHERE state = $1", "provider", "code_verifier", "nonce_hash", "user_id", "created_at").
+				Row(q.Args[1], q.Args[2], q.Args[3], q.Args[4], time.Now())
+			return redirect
+		}
+	}
+	t.Fatal("oauth state is not saved")
+	return nil
+}
+
+func TestOAuthCallbackChecksStateAndNonce(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		nonce  func(nonce string) string
+		stored bool
+	}{
+		{name: "unknown state", nonce: func(nonce string) string { return nonce }, stored: false},
+		{name: "nonce mismatch", nonce: func(string) string { return "other" }, stored: true},
+		{name: "no nonce cookie", nonce: func(string) string { return "" }, stored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db, server := newOAuthTestService(t, oauthtest.Profile{Subject: "google-1", Email: "anna@gmail.com"})
+			redirect := startOAuth(t, srv, db, tt.stored)
+			code, state, err := server.Authorize(redirect.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = srv.OAuthCallback(context.Background(), oauth.ProviderGoogle, code, state, tt.nonce(redirect.Nonce))
+			if err != infrastruct.ErrorOAuthStateInvalid {
+				t.Errorf("err %v, want ErrorOAuthStateInvalid", err)
+			}
+			if n := len(server.TokenRequests()); n != 0 {
+				t.Errorf("code exchanged %d times before state check", n)
+			}
+		})
+	}
+}
+
+func TestOAuthCallbackLogin(t *testing.T) {
+
+	srv, db, server := newOAuthTestService(t, oauthtest.Profile{Subject: "google-1", Email: "anna@gmail.com"})
+	redirect := startOAuth(t, srv, db, true)
+	db.On("SELECT user_id FROM user_identities", "user_id").Row(42)
+	db.On("FROM users WHERE id = $1", "email", "pass", "first_name", "user_role", "token_version", "suspended", "suspend_reason").
+		Row("anna@gmail.com", "", "Анна", types.RoleStudent, 0, false, "")
+
+	code, state, err := server.Authorize(redirect.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := srv.OAuthCallback(context.Background(), oauth.ProviderGoogle, code, state, redirect.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt, err := infrastruct.ValidateJwt(token.Token, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := jwt.Claims.(*infrastruct.CustomClaims).UserID; id != 42 {
+		t.Errorf("token for user %d, want 42", id)
+	}
+	//fake сервер принимает code только с code_verifier, чей хеш был в адресе входа
+	if requests := server.TokenRequests(); len(requests) != 1 || requests[0].Get("code_verifier") == "" {
+		t.Errorf("token requests %v", requests)
+	}
+}
+
+// TestOAuthCallbackExistingEmail - новая соцсеть с email существующего аккаунта сама к нему не привязывается
+func TestOAuthCallbackExistingEmail(t *testing.T) {
+
+	srv, db, server := newOAuthTestService(t, oauthtest.Profile{Subject: "google-1", Email: "anna@gmail.com",
+		EmailVerified: true})
+	redirect := startOAuth(t, srv, db, true)
+	db.On("FROM users WHERE email = $1", "id", "pass", "first_name", "user_role", "token_version", "suspended", "suspend_reason").
+		Row(7, "secret", "Анна", types.RoleStudent, 0, false, "")
+
+	code, state, err := server.Authorize(redirect.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = srv.OAuthCallback(context.Background(), oauth.ProviderGoogle, code, state, redirect.Nonce)
+	if err != infrastruct.ErrorOAuthAccountExists {
+		t.Errorf("err %v, want ErrorOAuthAccountExists", err)
+	}
+	if db.Executed("INSERT INTO users") || db.Executed("INSERT INTO user_identities") {
+		t.Error("account or identity created for existing email")
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		passwordSet bool
+		identities  int
+		deleted     int64
+		err         error
+	}{
+		{name: "last method", passwordSet: false, identities: 1, deleted: 1, err: infrastruct.ErrorOAuthLastMethod},
+		{name: "other identity left", passwordSet: false, identities: 2, deleted: 1},
+		{name: "password set", passwordSet: true, identities: 1, deleted: 1},
+		{name: "not linked", passwordSet: true, identities: 1, deleted: 0, err: infrastruct.ErrorNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db, _ := newOAuthTestService(t, oauthtest.Profile{})
+			db.On("SELECT password_set FROM users", "password_set").Row(tt.passwordSet)
+			db.On("SELECT COUNT(*) FROM user_identities", "count").Row(tt.identities)
+			db.On("DELETE FROM user_identities").Affected(tt.deleted)
+
+			err := srv.UnlinkIdentity(context.Background(), 7, oauth.ProviderGoogle)
+			if err != tt.err {
+				t.Errorf("err %v, want %v", err, tt.err)
+			}
+			if committed := db.Executed("COMMIT"); committed != (tt.err == nil) {
+				t.Errorf("committed %v with err %v", committed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/notify"
+	"github.com/tarasova-school/internal/tarasova-school/service/oauth"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTelegramLinkTTL = 15 * time.Minute
+	telegramPollInterval   = 3 * time.Second
+
+	telegramStart   = "/start "
+	telegramLinkURL = "https://t.me/%s?start=%s"
+)
+
+// StartTelegramLink выдает ссылку на бота с одноразовым кодом. Чат подключается, когда пользователь нажимает
+// start по этой ссылке: так бот видит, что чат принадлежит владельцу кода, см. RunTelegramLinker
+func (s *Service) StartTelegramLink(ctx context.Context, userID int) (*types.TelegramLink, error) {
+
+	if _, ok := s.senders[types.NotifyChannelTelegram]; !ok || s.telegram.BotName == "" {
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	code, err := oauth.RandomString()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RandomString"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	if err = s.p.DeleteTelegramLinkCodesBefore(ctx, time.Now().Add(-s.telegram.LinkTTL)); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteTelegramLinkCodesBefore"))
+	}
+	if err = s.p.AddTelegramLinkCode(ctx, nonceHash(code), userID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddTelegramLinkCode"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.TelegramLink{
+		URL:       fmt.Sprintf(telegramLinkURL, s.telegram.BotName, code),
+		ExpiresAt: time.Now().Add(s.telegram.LinkTTL).Format(time.RFC3339),
+	}, nil
+}
+
+// RunTelegramLinker забирает у бота сообщения /start <код> и подключает чаты, пока не отменят ctx
+func (s *Service) RunTelegramLinker(ctx context.Context) {
+
+	bot, ok := s.senders[types.NotifyChannelTelegram].(*notify.TelegramSender)
+	if !ok || s.telegram.BotName == "" {
+		return
+	}
+
+	ticker := time.NewTicker(telegramPollInterval)
+	defer ticker.Stop()
+	var offset int64
+	for {
+		updates, err := bot.Updates(ctx, offset)
+		if err != nil && ctx.Err() == nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with telegram Updates"))
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			s.linkTelegram(ctx, bot, update)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) linkTelegram(ctx context.Context, bot *notify.TelegramSender, update notify.TelegramUpdate) {
+
+	m := update.Message
+	if m == nil || m.Chat.Type != "private" || !strings.HasPrefix(m.Text, telegramStart) {
+		return
+	}
+	chatID := strconv.FormatInt(m.Chat.ID, 10)
+
+	userID, createdAt, err := s.p.TakeTelegramLinkCode(ctx, nonceHash(strings.TrimSpace(strings.TrimPrefix(m.Text, telegramStart))))
+	if err != nil && err != sql.ErrNoRows {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with TakeTelegramLinkCode"))
+		return
+	}
+	title, body := "Уведомления подключены", "Сюда будут приходить уведомления школы"
+	if err == sql.ErrNoRows || time.Since(createdAt) > s.telegram.LinkTTL {
+		title, body = "Ссылка устарела", "Получите новую ссылку в настройках уведомлений"
+	} else if err = s.p.SetTelegramChat(ctx, userID, chatID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetTelegramChat"))
+		return
+	}
+
+	if err = bot.Send(chatID, title, body); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with telegram Send"))
+	}
+}
+
+func newTelegramConfig(telegram *config.Telegram) *config.Telegram {
+
+	if telegram == nil {
+		telegram = &config.Telegram{}
+	}
+	if telegram.LinkTTL <= 0 {
+		telegram.LinkTTL = defaultTelegramLinkTTL
+	}
+
+	return telegram
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"github.com/tarasova-school/pkg/totp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTwoFactorIssuer       = "tarasova-school.ru"
+	defaultTwoFactorChallengeTTL = 5 * time.Minute
+	defaultTwoFactorStepUpTTL    = 5 * time.Minute
+
+	recoveryCodesCount   = 10
+	recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	recoveryCodeLength   = 10
+	totpSkew             = 1
+	challengeIDLength    = 16
+)
+
+// SetupTwoFactor выдает новый секрет, 2FA включится после подтверждения первым кодом
+func (s *Service) SetupTwoFactor(ctx context.Context, userID int) (*types.TwoFactorSetup, error) {
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Enabled {
+		//перевыпуск секрета только через отключение, иначе можно снять 2FA без кода
+		return nil, infrastruct.ErrorBadRequest
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GenerateSecret"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	if err = s.p.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SaveTOTPSecret"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: totp.URL(s.twoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor включает 2FA по первому коду из приложения и возвращает коды восстановления, они показываются один раз
+func (s *Service) EnableTwoFactor(ctx context.Context, userID int, code string) (*types.RecoveryCodes, error) {
+
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.Enabled {
+		return nil, infrastruct.ErrorBadRequest
+	}
+	if ok, err := s.checkTOTPCode(ctx, current, code); err != nil || !ok {
+		return nil, twoFactorError(err)
+	}
+
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		recoveryCode, err := generateTwoFactorRecoveryCode()
+		if err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with generateTwoFactorRecoveryCode"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		codes = append(codes, recoveryCode)
+		hashes = append(hashes, s.twoFactorRecoveryHash(userID, recoveryCode))
+	}
+
+	if err = s.p.EnableTOTP(ctx, userID, hashes); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with EnableTOTP"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.RecoveryCodes{Codes: codes}, nil
+}
+
+func (s *Service) DisableTwoFactor(ctx context.Context, userID int, code string) error {
+
+	if _, err := s.checkSecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := s.p.DeleteTOTP(ctx, userID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with DeleteTOTP"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+func (s *Service) GetTwoFactorStatus(ctx context.Context, userID int) (*types.TwoFactorStatus, error) {
+
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &types.TwoFactorStatus{Enabled: current != nil && current.Enabled}
+	if !status.Enabled {
+		return status, nil
+	}
+
+	if status.RecoveryCodesLeft, err = s.p.CountRecoveryCodesLeft(ctx, userID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with CountRecoveryCodesLeft"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return status, nil
+}
+
+// AuthorizeTwoFactor меняет challenge из Authorize и код 2FA на обычный токен. Challenge одноразовый:
+// гасится при успехе и при блокировке перебора, тогда вход начинается заново с пароля
+func (s *Service) AuthorizeTwoFactor(ctx context.Context, login *types.TwoFactorLogin) (*types.Token, error) {
+
+	claims, err := infrastruct.ParsePurposeToken(login.Challenge, infrastruct.PurposeTwoFactor, s.secretKey)
+	if err != nil {
+		return nil, infrastruct.ErrorJWTIsBroken
+	}
+	current, err := s.getTOTP(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || claims.Id == "" || current.Challenge != claims.Id {
+		return nil, infrastruct.ErrorJWTIsBroken
+	}
+
+	locked, err := s.checkSecondFactor(ctx, claims.UserID, login.Code)
+	if locked {
+		if err := s.p.SetTOTPChallenge(ctx, claims.UserID, ""); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetTOTPChallenge"))
+		}
+	}
+	if err != nil {
+		if err == infrastruct.ErrorTwoFactorInvalid {
+			loginFailures.Inc(loginFailureTwoFactor)
+		}
+		return nil, err
+	}
+	used, err := s.p.UseTOTPChallenge(ctx, claims.UserID, claims.Id)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UseTOTPChallenge"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	if !used {
+		return nil, infrastruct.ErrorJWTIsBroken
+	}
+
+	user, err := s.p.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	if user.Suspended {
+		loginFailures.Inc(loginFailureSuspended)
+		return nil, suspendedError(user.SuspendReason)
+	}
+
+	token, err := infrastruct.GenerateJWT(user.ID, user.UserRole, user.TokenVersion, s.secretKey)
+	if err != nil {
+		logger.LogErrorCtx(ctx, err)
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.Token{Token: token}, nil
+}
+
+// StepUp подтверждает кодом 2FA, что за компьютером сам владелец, и выдает короткий одноразовый токен
+// для одного опасного действия. Новый токен отменяет прежний, еще не использованный
+func (s *Service) StepUp(ctx context.Context, userID int, code string) (*types.StepUpToken, error) {
+
+	if _, err := s.checkSecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, challengeIDLength)
+	if _, err := rand.Read(id); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with rand.Read"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	stepUpID := hex.EncodeToString(id)
+	if err := s.p.SetTOTPStepUp(ctx, userID, stepUpID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetTOTPStepUp"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	token, err := infrastruct.GenerateOneTimeToken(infrastruct.PurposeStepUp, userID, "", stepUpID, s.secretKey,
+		s.twoFactor.StepUpTTL)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GenerateOneTimeToken"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.StepUpToken{Token: token}, nil
+}
+
+// CheckStepUp проверяет и гасит step-up токен, второй запрос с ним не пройдет.
+// Без включенной 2FA пропускаем, если это не запрещено настройкой step_up_required
+func (s *Service) CheckStepUp(ctx context.Context, userID int, token string) error {
+
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.Enabled {
+		if s.twoFactor.StepUpRequired {
+			return infrastruct.ErrorTwoFactorRequired
+		}
+		return nil
+	}
+
+	claims, err := infrastruct.ParsePurposeToken(token, infrastruct.PurposeStepUp, s.secretKey)
+	if err != nil || claims.UserID != userID || claims.Id == "" {
+		return infrastruct.ErrorTwoFactorRequired
+	}
+	used, err := s.p.UseTOTPStepUp(ctx, userID, claims.Id)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UseTOTPStepUp"))
+		return infrastruct.ErrorInternalServerError
+	}
+	if !used {
+		return infrastruct.ErrorTwoFactorRequired
+	}
+
+	return nil
+}
+
+// twoFactorChallenge - если у пользователя включена 2FA, вместо токена отдаем challenge
+func (s *Service) twoFactorChallenge(ctx context.Context, user *types.User) (*types.Token, error) {
+
+	current, err := s.getTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || !current.Enabled {
+		return nil, nil
+	}
+
+	id := make([]byte, challengeIDLength)
+	if _, err = rand.Read(id); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with rand.Read"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+	challengeID := hex.EncodeToString(id)
+	if err = s.p.SetTOTPChallenge(ctx, user.ID, challengeID); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetTOTPChallenge"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	challenge, err := infrastruct.GenerateOneTimeToken(infrastruct.PurposeTwoFactor, user.ID, "", challengeID, s.secretKey,
+		s.twoFactor.ChallengeTTL)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GenerateOneTimeToken"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return &types.Token{Challenge: challenge}, nil
+}
+
+// checkSecondFactor проверяет код 2FA с защитой от перебора: неверные коды считаются по пользователю,
+// после threshold из login_lockout проверка блокируется. locked - пользователь сейчас заблокирован
+func (s *Service) checkSecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+
+	key := twoFactorLockoutKey(userID)
+	wait, err := s.lockedFor(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if wait > 0 {
+		return true, infrastruct.NewRetryError(infrastruct.ErrorTwoFactorLocked, wait)
+	}
+
+	ok, err := s.verifySecondFactor(ctx, userID, code)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if wait = s.addFailure(ctx, key); wait > 0 {
+			return true, infrastruct.NewRetryError(infrastruct.ErrorTwoFactorLocked, wait)
+		}
+		return false, infrastruct.ErrorTwoFactorInvalid
+	}
+	s.resetFailures(ctx, key)
+
+	return false, nil
+}
+
+// verifySecondFactor принимает код из приложения или одноразовый код восстановления
+func (s *Service) verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+
+	current, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if current == nil || !current.Enabled {
+		return false, nil
+	}
+
+	code = strings.ToUpper(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	if len(code) == totp.Digits {
+		return s.checkTOTPCode(ctx, current, code)
+	}
+
+	ok, err := s.p.UseRecoveryCode(ctx, userID, s.twoFactorRecoveryHash(userID, code))
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UseRecoveryCode"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+
+	return ok, nil
+}
+
+func (s *Service) checkTOTPCode(ctx context.Context, current *types.TOTP, code string) (bool, error) {
+
+	step, ok := totp.Validate(current.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+
+	used, err := s.p.UseTOTPStep(ctx, current.UserID, step)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UseTOTPStep"))
+		return false, infrastruct.ErrorInternalServerError
+	}
+
+	return used, nil
+}
+
+func (s *Service) getTOTP(ctx context.Context, userID int) (*types.TOTP, error) {
+
+	current, err := s.p.GetTOTP(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetTOTP"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	return current, nil
+}
+
+func (s *Service) twoFactorRecoveryHash(userID int, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.secretKey))
+	mac.Write([]byte(fmt.Sprintf("2fa:%d:%s", userID, code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func twoFactorError(err error) error {
+	if err != nil {
+		return err
+	}
+	return infrastruct.ErrorTwoFactorInvalid
+}
+
+func generateTwoFactorRecoveryCode() (string, error) {
+
+	b := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+func newTwoFactorConfig(twoFactor *config.TwoFactor) *config.TwoFactor {
+
+	if twoFactor == nil {
+		twoFactor = &config.TwoFactor{}
+	}
+	if twoFactor.Issuer == "" {
+		twoFactor.Issuer = defaultTwoFactorIssuer
+	}
+	if twoFactor.ChallengeTTL <= 0 {
+		twoFactor.ChallengeTTL = defaultTwoFactorChallengeTTL
+	}
+	if twoFactor.StepUpTTL <= 0 {
+		twoFactor.StepUpTTL = defaultTwoFactorStepUpTTL
+	}
+
+	return twoFactor
+}
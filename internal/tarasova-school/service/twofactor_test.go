@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"testing"
+	"time"
+)
+
+func TestCheckStepUpIsSingleUse(t *testing.T) {
+
+	const userID = 7
+
+	tests := []struct {
+		name    string
+		token   func() (string, error)
+		unused  bool
+		err     error
+		consume bool
+	}{
+		{name: "fresh token", unused: true, consume: true,
+			token: func() (string, error) {
+				return infrastruct.GenerateOneTimeToken(infrastruct.PurposeStepUp, userID, "", "jti", "test", time.Minute)
+			}},
+		{name: "already used", unused: false, err: infrastruct.ErrorTwoFactorRequired, consume: true,
+			token: func() (string, error) {
+				return infrastruct.GenerateOneTimeToken(infrastruct.PurposeStepUp, userID, "", "jti", "test", time.Minute)
+			}},
+		{name: "other user", unused: true, err: infrastruct.ErrorTwoFactorRequired,
+			token: func() (string, error) {
+				return infrastruct.GenerateOneTimeToken(infrastruct.PurposeStepUp, userID+1, "", "jti", "test", time.Minute)
+			}},
+		{name: "no token id", unused: true, err: infrastruct.ErrorTwoFactorRequired,
+			token: func() (string, error) {
+				return infrastruct.GeneratePurposeToken(infrastruct.PurposeStepUp, userID, "", "test", time.Minute)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db := newTestService(t)
+			db.On("FROM user_totp WHERE user_id", "secret", "enabled", "last_step", "challenge").
+				Row("SECRET", true, 0, "")
+			stub := db.On("UPDATE user_totp SET step_up = NULL")
+			if tt.unused {
+				stub.Affected(1)
+			}
+			token, err := tt.token()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = srv.CheckStepUp(context.Background(), userID, token); err != tt.err {
+				t.Errorf("err %v, want %v", err, tt.err)
+			}
+			if consumed := db.Executed("UPDATE user_totp SET step_up = NULL"); consumed != tt.consume {
+				t.Errorf("token consumed %v, want %v", consumed, tt.consume)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"strings"
+	"time"
+)
+
+const (
+	defaultImpersonationTTL = 30 * time.Minute
+	maxImpersonationTTL     = 8 * time.Hour
+)
+
+// ChangeUserRole меняет роль пользователя, после этого ему нужно заново войти
+func (s *Service) ChangeUserRole(ctx context.Context, adminID, userID int, role string) error {
+
+	if adminID == userID {
+		//свою роль меняет другой админ, иначе можно случайно остаться без доступа
+		return infrastruct.ErrorPermissionDenied
+	}
+	exist, err := s.roleExists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return infrastruct.ErrorBadRequest
+	}
+
+	if err = s.p.ChangeUserRole(ctx, userID, role); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with ChangeUserRole"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Пользователь %d сменил роль пользователя %d на %s", adminID, userID, role))
+
+	return nil
+}
+
+// SuspendUser блокирует пользователя, причину он увидит при входе
+func (s *Service) SuspendUser(ctx context.Context, adminID, userID int, reason string) error {
+
+	reason = strings.TrimSpace(reason)
+	if adminID == userID || reason == "" {
+		return infrastruct.ErrorBadRequest
+	}
+	if _, err := s.getManageableUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.p.SuspendUser(ctx, userID, reason); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SuspendUser"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Пользователь %d заблокировал пользователя %d: %s", adminID, userID, reason))
+
+	return nil
+}
+
+func (s *Service) UnsuspendUser(ctx context.Context, adminID, userID int) error {
+
+	if err := s.p.UnsuspendUser(ctx, userID); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with UnsuspendUser"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Пользователь %d разблокировал пользователя %d", adminID, userID))
+
+	return nil
+}
+
+// ForceLogout отзывает все токены пользователя, включая токены входа от его имени
+func (s *Service) ForceLogout(ctx context.Context, adminID, userID int) error {
+
+	if _, err := s.getManageableUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.p.RevokeUserTokens(ctx, userID); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with RevokeUserTokens"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorNotFound
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Пользователь %d завершил все сессии пользователя %d", adminID, userID))
+
+	return nil
+}
+
+// Impersonate выдает админу короткий токен пользователя. В токене записан id админа,
+// каждый вход сохраняется в таблицу impersonations
+func (s *Service) Impersonate(ctx context.Context, adminID, userID int, reason string) (*types.ImpersonationToken, error) {
+
+	reason = strings.TrimSpace(reason)
+	if adminID == userID || reason == "" {
+		return nil, infrastruct.ErrorBadRequest
+	}
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		return nil, infrastruct.ErrorNotFound
+	}
+	if user.Suspended {
+		return nil, suspendedError(user.SuspendReason)
+	}
+
+	//от имени тех, кто сам управляет пользователями или ролями, входить нельзя - это повышение прав
+	protected, err := s.hasAnyPermission(ctx, user.UserRole, types.PermUsersManage, types.PermRolesManage,
+		types.PermImpersonate)
+	if err != nil {
+		return nil, err
+	}
+	if protected {
+		return nil, infrastruct.ErrorPermissionDenied
+	}
+
+	token, expiresAt, err := infrastruct.GenerateImpersonationJWT(user.ID, user.UserRole, user.TokenVersion, adminID,
+		s.secretKey, s.impersonation.TTL)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GenerateImpersonationJWT"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	if err = s.p.AddImpersonation(ctx, adminID, userID, reason, expiresAt); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with AddImpersonation"))
+		return nil, infrastruct.ErrorInternalServerError
+	}
+
+	logger.LogInfoCtx(ctx, fmt.Sprintf("Пользователь %d вошел от имени пользователя %s (%d): %s",
+		adminID, user.Email, user.ID, reason))
+
+	return &types.ImpersonationToken{
+		Token:     token,
+		UserID:    user.ID,
+		ExpiresAT: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// getManageableUser загружает пользователя, которого можно блокировать и разлогинивать. Тех, кто сам
+// управляет пользователями или ролями, так не трогаем: иначе любая роль с users.manage выключит админов
+func (s *Service) getManageableUser(ctx context.Context, userID int) (*types.User, error) {
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	protected, err := s.hasAnyPermission(ctx, user.UserRole, types.PermUsersManage, types.PermRolesManage)
+	if err != nil {
+		return nil, err
+	}
+	if protected {
+		return nil, infrastruct.ErrorPermissionDenied
+	}
+
+	return user, nil
+}
+
+// hasAnyPermission - есть ли у роли хотя бы одно из прав
+func (s *Service) hasAnyPermission(ctx context.Context, role string, permissions ...string) (bool, error) {
+
+	for _, permission := range permissions {
+		ok, err := s.HasPermission(ctx, role, permission)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func suspendedError(reason string) error {
+	if reason == "" {
+		return infrastruct.ErrorUserSuspended
+	}
+	return infrastruct.ErrorUserSuspended.WithDetail(reason)
+}
+
+func newImpersonationConfig(impersonation *config.Impersonation) *config.Impersonation {
+
+	if impersonation == nil {
+		impersonation = &config.Impersonation{}
+	}
+	if impersonation.TTL <= 0 {
+		impersonation.TTL = defaultImpersonationTTL
+	}
+	if impersonation.TTL > maxImpersonationTTL {
+		impersonation.TTL = maxImpersonationTTL
+	}
+
+	return impersonation
+}
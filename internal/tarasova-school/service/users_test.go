@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"github.com/tarasova-school/internal/clients/postgres/postgrestest"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"testing"
+)
+
+// stubRoles - роли как в migrations.sql и роль moderator, созданная админом, с правом users.manage
+func stubRoles(db *postgrestest.DB) {
+	db.On("FROM roles LEFT JOIN role_permissions", "name", "description", "builtin", "permissions").
+		Row(types.RoleStudent, "", true, "{chats.ask}").
+		Row(types.RoleTeacher, "", true, "{chats.answer,users.view,auth.two_factor}").
+		Row(types.RoleAdmin, "", true, "{content.edit,users.manage,roles.manage,users.impersonate}").
+		Row("moderator", "", false, "{users.view,users.manage}").
+		Row("owner", "", false, "{roles.manage}")
+}
+
+func TestManageUsersProtectsManagers(t *testing.T) {
+
+	tests := []struct {
+		role string
+		err  error
+	}{
+		{role: types.RoleStudent},
+		{role: types.RoleTeacher},
+		{role: types.RoleAdmin, err: infrastruct.ErrorPermissionDenied},
+		{role: "moderator", err: infrastruct.ErrorPermissionDenied},
+		{role: "owner", err: infrastruct.ErrorPermissionDenied},
+	}
+	actions := map[string]struct {
+		query string
+		call  func(srv *Service) error
+	}{
+		"suspend": {query: "UPDATE users SET suspended_at", call: func(srv *Service) error {
+			return srv.SuspendUser(context.Background(), 1, 7, "спам")
+		}},
+		"force logout": {query: "UPDATE users SET token_version", call: func(srv *Service) error {
+			return srv.ForceLogout(context.Background(), 1, 7)
+		}},
+	}
+	for name, action := range actions {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.role, func(t *testing.T) {
+				srv, db := newTestService(t)
+				stubRoles(db)
+				db.On("FROM users WHERE id = $1", "email", "pass", "first_name", "user_role", "token_version", "suspended", "suspend_reason").
+					Row("user@mail.ru", "", "Анна", tt.role, 0, false, "")
+				db.On(action.query).Affected(1)
+
+				if err := action.call(srv); err != tt.err {
+					t.Errorf("err %v, want %v", err, tt.err)
+				}
+				if changed := db.Executed(action.query); changed != (tt.err == nil) {
+					t.Errorf("user changed %v with err %v", changed, tt.err)
+				}
+			})
+		}
+	}
+}
+
+func TestSuspendUnknownUser(t *testing.T) {
+
+	srv, _ := newTestService(t)
+	if err := srv.SuspendUser(context.Background(), 1, 7, "спам"); err != infrastruct.ErrorNotFound {
+		t.Errorf("err %v, want ErrorNotFound", err)
+	}
+}
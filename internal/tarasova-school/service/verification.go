@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/tarasova-school/service/mail"
+	"github.com/tarasova-school/internal/types"
+	"github.com/tarasova-school/internal/types/config"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"github.com/tarasova-school/pkg/logger"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultVerifyLinkURL        = "https://tarasova-school.ru/verify?token="
+	defaultVerifyTokenTTL       = 72 * time.Hour
+	defaultVerifyResendInterval = time.Minute
+	defaultVerifyResendPerDay   = 5
+)
+
+// VerifyEmail подтверждает email по токену из письма
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+
+	claims, err := infrastruct.ParsePurposeToken(token, infrastruct.PurposeVerifyEmail, s.secretKey)
+	if err != nil || claims.Email == "" {
+		return infrastruct.ErrorVerifyTokenInvalid
+	}
+
+	status, err := s.GetEmailVerificationStatus(ctx, claims.UserID)
+	if err != nil {
+		if err == infrastruct.ErrorNotFound {
+			return infrastruct.ErrorVerifyTokenInvalid
+		}
+		return err
+	}
+	if status.Verified {
+		return nil
+	}
+
+	if err = s.p.SetEmailVerified(ctx, claims.UserID, claims.Email); err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with SetEmailVerified"))
+			return infrastruct.ErrorInternalServerError
+		}
+		//email поменяли или пользователя удалили после отправки письма
+		return infrastruct.ErrorVerifyTokenInvalid
+	}
+
+	s.background.Add(1)
+	go func(ctx context.Context, userID int) {
+		defer s.background.Done()
+		if err := s.sendWelcome(ctx, userID); err != nil {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with sendWelcome"))
+		}
+	}(logger.Detach(ctx), claims.UserID)
+
+	return nil
+}
+
+func (s *Service) GetEmailVerificationStatus(ctx context.Context, userID int) (*types.EmailVerificationStatus, error) {
+
+	verifiedAt, err := s.p.GetEmailVerifiedAt(ctx, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetEmailVerifiedAt"))
+			return nil, infrastruct.ErrorInternalServerError
+		}
+		return nil, infrastruct.ErrorNotFound
+	}
+
+	status := &types.EmailVerificationStatus{Verified: verifiedAt != nil}
+	if verifiedAt != nil {
+		status.VerifiedAT = verifiedAt.Format(time.RFC3339)
+	}
+
+	return status, nil
+}
+
+// ResendEmailVerification повторно отправляет письмо, не чаще resend_interval и не больше resend_per_day в сутки
+func (s *Service) ResendEmailVerification(ctx context.Context, userID int) error {
+
+	status, err := s.GetEmailVerificationStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if status.Verified {
+		return nil
+	}
+
+	count, last, err := s.p.GetEmailVerificationSends(ctx, userID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetEmailVerificationSends"))
+		return infrastruct.ErrorInternalServerError
+	}
+	if count >= s.verification.ResendPerDay ||
+		(last != nil && time.Since(*last) < s.verification.ResendInterval) {
+		return infrastruct.ErrorTooManyRequests
+	}
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetUserByID"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	if err = s.sendEmailVerification(ctx, user); err != nil {
+		logger.LogErrorCtx(ctx, errors.Wrap(err, "err with sendEmailVerification"))
+		return infrastruct.ErrorInternalServerError
+	}
+
+	return nil
+}
+
+// CheckEmailVerified проверяет, что политика разрешает неподтвержденному пользователю это действие
+func (s *Service) CheckEmailVerified(ctx context.Context, userID int, write bool) error {
+
+	switch s.verification.Policy {
+	case types.VerifyPolicyNone:
+		return nil
+	case types.VerifyPolicyWrite:
+		if !write {
+			return nil
+		}
+	}
+
+	verifiedAt, err := s.p.GetEmailVerifiedAt(ctx, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.LogErrorCtx(ctx, errors.Wrap(err, "err with GetEmailVerifiedAt"))
+			return infrastruct.ErrorInternalServerError
+		}
+		return infrastruct.ErrorPermissionDenied
+	}
+	if verifiedAt == nil {
+		return infrastruct.ErrorEmailNotVerified
+	}
+
+	return nil
+}
+
+func (s *Service) sendEmailVerification(ctx context.Context, user *types.User) error {
+
+	token, err := infrastruct.GeneratePurposeToken(infrastruct.PurposeVerifyEmail, user.ID, user.Email,
+		s.secretKey, s.verification.TokenTTL)
+	if err != nil {
+		return errors.Wrap(err, "err with GeneratePurposeToken")
+	}
+
+	if err = s.p.AddEmailVerificationSend(ctx, user.ID); err != nil {
+		return errors.Wrap(err, "err with AddEmailVerificationSend")
+	}
+
+	data := mail.EmailVerification{
+		FirstName: user.FirstName,
+		URL:       s.verification.LinkURL + url.QueryEscape(token),
+	}
+	if err = s.mailer.Send([]string{user.Email}, data); err != nil {
+		return errors.Wrap(err, "err with send Email")
+	}
+
+	return nil
+}
+
+func (s *Service) sendWelcome(ctx context.Context, userID int) error {
+
+	user, err := s.p.GetUserByID(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "err with GetUserByID")
+	}
+
+	if err = s.mailer.Send([]string{user.Email}, mail.Welcome{FirstName: user.FirstName}); err != nil {
+		return errors.Wrap(err, "err with send Email")
+	}
+
+	return nil
+}
+
+func newVerificationConfig(v *config.EmailVerification) (*config.EmailVerification, error) {
+
+	if v == nil {
+		v = &config.EmailVerification{}
+	}
+	switch v.Policy {
+	case "":
+		v.Policy = types.VerifyPolicyWrite
+	case types.VerifyPolicyNone, types.VerifyPolicyWrite, types.VerifyPolicyAll:
+	default:
+		return nil, errors.Errorf("unknown email_verification policy %q", v.Policy)
+	}
+	if v.LinkURL == "" {
+		v.LinkURL = defaultVerifyLinkURL
+	}
+	if v.TokenTTL <= 0 {
+		v.TokenTTL = defaultVerifyTokenTTL
+	}
+	if v.ResendInterval <= 0 {
+		v.ResendInterval = defaultVerifyResendInterval
+	}
+	if v.ResendPerDay <= 0 {
+		v.ResendPerDay = defaultVerifyResendPerDay
+	}
+
+	return v, nil
+}
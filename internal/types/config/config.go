@@ -1,32 +1,224 @@
 package config
 
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Config - настройки сервиса, поля с тегом secret:"true" скрываются в дампе конфига, см. Redact
 type Config struct {
-	PostgresDsn      string              `yaml:"postgres_dsn"`
-	ServerPort       string              `yaml:"server_port"`
-	SecretKeyJWT     string              `yaml:"secret_key_jwt"`
-	HtmlRecoveryPath string              `yaml:"html_recovery_path"`
-	HtmlNewPassPath  string              `yaml:"html_new_pass_path"`
-	Email            *ConfigForSendEmail `yaml:"server_email"`
-	Soc              *SocAuth            `yaml:"soc_auth"`
-	Telegram         *Telegram           `yaml:"telegram"`
-	VideoDir         string              `yaml:"video_directory_path"`
+	PostgresDsn   string              `yaml:"postgres_dsn" secret:"true"`
+	ServerPort    string              `yaml:"server_port"`
+	SecretKeyJWT  string              `yaml:"secret_key_jwt" secret:"true"`
+	Email         *ConfigForSendEmail `yaml:"server_email"`
+	Soc           *SocAuth            `yaml:"soc_auth"`
+	Telegram      *Telegram           `yaml:"telegram"`
+	VideoDir      string              `yaml:"video_directory_path"`
+	DocsDir       string              `yaml:"docs_directory_path"`
+	SLA           *SLA                `yaml:"sla"`
+	Notifications *Notifications      `yaml:"notifications"`
+	Verification  *EmailVerification  `yaml:"email_verification"`
+	Recovery      *PasswordRecovery   `yaml:"password_recovery"`
+	TwoFactor     *TwoFactor          `yaml:"two_factor"`
+	Impersonation *Impersonation      `yaml:"impersonation"`
+	Audit         *Audit              `yaml:"audit"`
+	Alerting      *Alerting           `yaml:"alerting"`
+	Metrics       *Metrics            `yaml:"metrics"`
+	Server        *Server             `yaml:"server"`
+	RateLimit     *RateLimit          `yaml:"rate_limit"`
+	LoginLockout  *LoginLockout       `yaml:"login_lockout"`
+	CourseClone   *CourseClone        `yaml:"course_clone"`
 }
 
 type ConfigForSendEmail struct {
 	EmailHost  string `yaml:"host"`
 	EmailPort  string `yaml:"port"`
 	EmailLogin string `yaml:"login"`
-	EmailPass  string `yaml:"pass"`
+	EmailPass  string `yaml:"pass" secret:"true"`
+	FromName   string `yaml:"from_name"`
+	Transport  string `yaml:"transport"` // smtp или file
+	FileDir    string `yaml:"file_dir"`
 }
 
+// SocAuth - вход через соцсети. Ключ в providers - имя провайдера: vk, yandex или google
 type SocAuth struct {
-	VKAppID       string `yaml:"vk_app_id"`
-	VKCallbackURL string `yaml:"vk_callback"`
-	VKSecretKey   string `yaml:"vk_secret_key"`
+	StateTTL  time.Duration            `yaml:"state_ttl"`
+	Providers map[string]OAuthProvider `yaml:"providers"`
+}
+
+// OAuthProvider - настройки OAuth2 клиента, адреса провайдера можно переопределить, например на локальный фейковый сервер
+type OAuthProvider struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	AuthURL      string   `yaml:"auth_url"`
+	TokenURL     string   `yaml:"token_url"`
+	UserInfoURL  string   `yaml:"userinfo_url"`
 }
 
+// Telegram - бот школы. bot_name нужен для ссылки, по которой пользователь подключает уведомления в телеграм,
+// ссылка действует link_ttl
 type Telegram struct {
-	TelegramToken string `yaml:"telegram_token"`
-	ChatID        string `yaml:"chat_id"`
-	ChannelID     string `yaml:"channel_id"`
+	TelegramToken string        `yaml:"telegram_token" secret:"true"`
+	ChatID        string        `yaml:"chat_id"`
+	ChannelID     string        `yaml:"channel_id"`
+	BotName       string        `yaml:"bot_name"`
+	LinkTTL       time.Duration `yaml:"link_ttl"`
+}
+
+// SLA - сроки ответа на домашку. Если check_interval не задан, мониторинг выключен
+type SLA struct {
+	CheckInterval time.Duration     `yaml:"check_interval"`
+	ReminderAfter time.Duration     `yaml:"reminder_after"`
+	EscalateAfter time.Duration     `yaml:"escalate_after"`
+	Courses       map[int]SLACourse `yaml:"courses"`
+}
+
+type SLACourse struct {
+	ReminderAfter time.Duration `yaml:"reminder_after"`
+	EscalateAfter time.Duration `yaml:"escalate_after"`
+}
+
+type Notifications struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	BatchSize    int           `yaml:"batch_size"`
+}
+
+// EmailVerification - подтверждение email после регистрации.
+// Policy: none - ничего не ограничиваем, write - без подтверждения нельзя писать учителям, all - нельзя ничего в кабинете
+type EmailVerification struct {
+	Policy         string        `yaml:"policy"`
+	LinkURL        string        `yaml:"link_url"`
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+	ResendInterval time.Duration `yaml:"resend_interval"`
+	ResendPerDay   int           `yaml:"resend_per_day"`
+}
+
+// PasswordRecovery - коды восстановления пароля. Запросы и неудачные проверки кода считаются попытками,
+// после max_per_email или max_per_ip попыток за window восстановление блокируется до конца окна
+type PasswordRecovery struct {
+	CodeTTL      time.Duration `yaml:"code_ttl"`
+	CodeAttempts int           `yaml:"code_attempts"`
+	Window       time.Duration `yaml:"window"`
+	MaxPerEmail  int           `yaml:"max_per_email"`
+	MaxPerIP     int           `yaml:"max_per_ip"`
+}
+
+// TwoFactor - TOTP для админов и учителей. step_up_required запрещает опасные действия админам без 2FA
+type TwoFactor struct {
+	Issuer         string        `yaml:"issuer"`
+	ChallengeTTL   time.Duration `yaml:"challenge_ttl"`
+	StepUpTTL      time.Duration `yaml:"step_up_ttl"`
+	StepUpRequired bool          `yaml:"step_up_required"`
+}
+
+// Impersonation - вход админа от имени пользователя
+type Impersonation struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Audit - журнал действий админов и учителей, записи старше retention удаляются раз в cleanup_interval
+type Audit struct {
+	Retention       time.Duration `yaml:"retention"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+// Alerting - оповещения об ошибках и событиях. routes сопоставляет важность (info, error, critical) с именами sinks.
+// Одинаковые сообщения за group_window отправляются один раз со сводкой повторов,
+// в каждый sink уходит не больше max_per_minute сообщений в минуту
+type Alerting struct {
+	QueueSize    int                  `yaml:"queue_size"`
+	GroupWindow  time.Duration        `yaml:"group_window"`
+	MaxPerMinute int                  `yaml:"max_per_minute"`
+	Sinks        map[string]AlertSink `yaml:"sinks"`
+	Routes       map[string][]string  `yaml:"routes"`
+}
+
+// AlertSink - канал оповещений. Type: telegram и email шлют на адреса из to, webhook - POST json на url
+type AlertSink struct {
+	Type string   `yaml:"type"`
+	To   []string `yaml:"to"`
+	URL  string   `yaml:"url" secret:"true"`
+}
+
+// Metrics - /metrics для Prometheus. Если задан listen, метрики отдаются только на этом адресе,
+// иначе на основном порту с заголовком Authorization: Bearer token. Без listen и token метрики не отдаются
+type Metrics struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token" secret:"true"`
+}
+
+// Server - таймауты http сервера. write_timeout должен покрывать отдачу видео целиком,
+// shutdown_timeout - сколько ждать текущие запросы и фоновые задачи при остановке.
+// trusted_proxies - адреса или подсети прокси (nginx), только от них принимаются X-Forwarded-For и X-Real-IP
+type Server struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	TrustedProxies    []string      `yaml:"trusted_proxies"`
+}
+
+// Proxies - trusted_proxies в виде подсетей, одиночный адрес - подсеть из одного адреса
+func (s *Server) Proxies() ([]*net.IPNet, error) {
+
+	if s == nil {
+		return nil, nil
+	}
+	proxies := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("bad address %q", proxy)
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("bad subnet %q", proxy)
+		}
+		proxies = append(proxies, subnet)
+	}
+
+	return proxies, nil
+}
+
+// RateLimit - ограничение частоты запросов корзинами токенов. backend: memory - у каждого инстанса свои лимиты,
+// postgres - общие. policies переопределяют встроенные политики auth, auth_2fa, register, recovery и chat
+type RateLimit struct {
+	Backend  string                     `yaml:"backend"`
+	Policies map[string][]RateLimitRule `yaml:"policies"`
+}
+
+// RateLimitRule - requests запросов за per на один ключ by (ip, user или email), burst - сколько можно сразу
+type RateLimitRule struct {
+	By       string        `yaml:"by"`
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+// LoginLockout - после threshold неудачных входов подряд (с перерывами меньше window) вход по email
+// блокируется на base_duration, каждая следующая неудача удваивает блокировку, но не больше max_duration.
+// Так же по пользователю считаются неверные коды 2FA при входе, step-up и отключении 2FA
+type LoginLockout struct {
+	Threshold    int           `yaml:"threshold"`
+	Window       time.Duration `yaml:"window"`
+	BaseDuration time.Duration `yaml:"base_duration"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+}
+
+// CourseClone - фоновое копирование курсов. Задачи берутся из базы раз в poll_interval, задачу, которую инстанс
+// не продлевал дольше lock_for (например, упал), подхватывает другой. Лок продлевается после каждого урока и видео,
+// поэтому lock_for должен покрывать копирование самого большого видео
+type CourseClone struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	LockFor      time.Duration `yaml:"lock_for"`
 }
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv задает переменную окружения на время теста
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(name, old)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
+
+// writeFile пишет файл во временный каталог теста и возвращает путь к нему
+func writeFile(t *testing.T, name, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testYAML = `
+postgres_dsn: postgres://yaml
+server_email:
+  host: smtp.mail.ru
+  pass: yaml-pass
+soc_auth:
+  providers:
+    vk:
+      client_id: vk-id
+      client_secret: yaml-secret
+`
+
+func TestEnvName(t *testing.T) {
+
+	tests := map[string][]string{
+		"SCHOOL_POSTGRES_DSN":                        {"postgres_dsn"},
+		"SCHOOL_SERVER_EMAIL_PASS":                   {"server_email", "pass"},
+		"SCHOOL_SOC_AUTH_PROVIDERS_VK_CLIENT_SECRET": {"soc_auth", "providers", "vk", "client_secret"},
+		"SCHOOL_SLA_COURSES_12_REMINDER_AFTER":       {"sla", "courses", "12", "reminder_after"},
+		"SCHOOL_ALERTING_SINKS_OPS_CHAT_URL":         {"alerting", "sinks", "ops-chat", "url"},
+	}
+	for want, path := range tests {
+		if got := EnvName(path); got != want {
+			t.Errorf("EnvName(%v) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(cnf *Config) bool
+	}{
+		{name: "top level string", env: map[string]string{"SCHOOL_POSTGRES_DSN": "postgres://env"},
+			check: func(cnf *Config) bool { return cnf.PostgresDsn == "postgres://env" }},
+		{name: "existing section", env: map[string]string{"SCHOOL_SERVER_EMAIL_PASS": "env-pass"},
+			check: func(cnf *Config) bool {
+				return cnf.Email.EmailPass == "env-pass" && cnf.Email.EmailHost == "smtp.mail.ru"
+			}},
+		{name: "section missing in yaml", env: map[string]string{"SCHOOL_TWO_FACTOR_STEP_UP_TTL": "10m"},
+			check: func(cnf *Config) bool { return cnf.TwoFactor != nil && cnf.TwoFactor.StepUpTTL == 10*time.Minute }},
+		{name: "int and bool", env: map[string]string{"SCHOOL_NOTIFICATIONS_MAX_ATTEMPTS": "3",
+			"SCHOOL_TWO_FACTOR_STEP_UP_REQUIRED": "true"},
+			check: func(cnf *Config) bool { return cnf.Notifications.MaxAttempts == 3 && cnf.TwoFactor.StepUpRequired }},
+		{name: "string list", env: map[string]string{"SCHOOL_SERVER_TRUSTED_PROXIES": "10.0.0.1, ,10.1.0.0/16"},
+			check: func(cnf *Config) bool {
+				return reflect.DeepEqual(cnf.Server.TrustedProxies, []string{"10.0.0.1", "10.1.0.0/16"})
+			}},
+		{name: "map item from yaml", env: map[string]string{"SCHOOL_SOC_AUTH_PROVIDERS_VK_CLIENT_SECRET": "env-secret"},
+			check: func(cnf *Config) bool {
+				vk := cnf.Soc.Providers["vk"]
+				return vk.ClientSecret == "env-secret" && vk.ClientID == "vk-id"
+			}},
+		{name: "no env keeps yaml and leaves sections nil", env: map[string]string{},
+			check: func(cnf *Config) bool {
+				return cnf.PostgresDsn == "postgres://yaml" && cnf.Metrics == nil && cnf.TwoFactor == nil &&
+					cnf.ServerPort == ":8080"
+			}},
+	}
+	path := writeFile(t, "config.yaml", testYAML)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				setenv(t, name, value)
+			}
+			cnf, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cnf) {
+				dump, _ := json.Marshal(cnf)
+				t.Errorf("config %s", dump)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+
+	setenv(t, "SCHOOL_SECRET_KEY_JWT", "from-env")
+	setenv(t, "SCHOOL_SECRET_KEY_JWT_FILE", writeFile(t, "jwt", "from-file\r\n"))
+
+	cnf, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//файл важнее переменной, перевод строки в конце файла отрезается
+	if cnf.SecretKeyJWT != "from-file" {
+		t.Errorf("secret_key_jwt %q, want from-file", cnf.SecretKeyJWT)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "bad duration", env: map[string]string{"SCHOOL_SLA_CHECK_INTERVAL": "often"},
+			want: "SCHOOL_SLA_CHECK_INTERVAL"},
+		{name: "bad int", env: map[string]string{"SCHOOL_NOTIFICATIONS_BATCH_SIZE": "ten"},
+			want: "SCHOOL_NOTIFICATIONS_BATCH_SIZE"},
+		{name: "bad bool", env: map[string]string{"SCHOOL_TWO_FACTOR_STEP_UP_REQUIRED": "yes please"},
+			want: "SCHOOL_TWO_FACTOR_STEP_UP_REQUIRED"},
+		{name: "missing secret file", env: map[string]string{"SCHOOL_POSTGRES_DSN_FILE": "/no/such/file"},
+			want: "SCHOOL_POSTGRES_DSN_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				setenv(t, name, value)
+			}
+			_, err := Load("")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err %v, want mention of %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Load(writeFile(t, "bad.yaml", "server_port: [")); err == nil {
+		t.Error("broken yaml loaded")
+	}
+	if _, err := Load("/no/such/config.yaml"); err == nil {
+		t.Error("missing config file loaded")
+	}
+}
+
+// fill заполняет все строки конфига, создавая секции и по одному элементу в каждой map.
+// Секретные поля получают значения с префиксом secret-, возвращает их число
+func fill(v reflect.Value, path string, secret bool) int {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fill(v.Elem(), path, secret)
+	case reflect.Struct:
+		count := 0
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			count += fill(v.Field(i), path+"."+field.Name, field.Tag.Get("secret") == "true")
+		}
+		return count
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		item := reflect.New(v.Type().Elem()).Elem()
+		count := fill(item, path+".item", secret)
+		v.SetMapIndex(reflect.New(v.Type().Key()).Elem(), item)
+		return count
+	case reflect.String:
+		if secret {
+			v.SetString("secret-" + path)
+			return 1
+		}
+		v.SetString("value-" + path)
+	}
+
+	return 0
+}
+
+func TestRedactMasksSecrets(t *testing.T) {
+
+	cnf := &Config{}
+	secrets := fill(reflect.ValueOf(cnf).Elem(), "config", false)
+	if secrets < 6 {
+		t.Fatalf("found %d secret fields, tags are lost", secrets)
+	}
+
+	dump, err := json.Marshal(Redact(cnf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dump), "secret-") {
+		t.Errorf("secret value in dump %s", dump)
+	}
+	if got := strings.Count(string(dump), `"`+redacted+`"`); got != secrets {
+		t.Errorf("%d masked values, want %d", got, secrets)
+	}
+	if !strings.Contains(string(dump), `"host":"value-config.Email.EmailHost"`) {
+		t.Errorf("plain values must stay visible: %s", dump)
+	}
+}
+
+func TestRedactKeepsEmptySecretsEmpty(t *testing.T) {
+
+	dump := Redact(&Config{ServerPort: ":8080", Server: &Server{WriteTimeout: time.Minute}})
+
+	//пустой секрет видно как пустой, чтобы было понятно, что его забыли задать
+	if dump["postgres_dsn"] != "" || dump["server_port"] != ":8080" {
+		t.Errorf("dump %v", dump)
+	}
+	if server := dump["server"].(map[string]interface{}); server["write_timeout"] != "1m0s" {
+		t.Errorf("server %v", server)
+	}
+	if dump["metrics"] != nil {
+		t.Errorf("metrics %v, want nil for missing section", dump["metrics"])
+	}
+}
+
+// validConfig - минимальный конфиг, который проходит Validate
+func validConfig() *Config {
+	cnf := Defaults()
+	cnf.PostgresDsn = "postgres://db"
+	cnf.SecretKeyJWT = "secret"
+	cnf.VideoDir = "/video"
+	cnf.Email.EmailHost = "smtp.mail.ru"
+	cnf.Email.EmailPort = "465"
+	cnf.Email.EmailLogin = "school@mail.ru"
+	return cnf
+}
+
+func TestValidate(t *testing.T) {
+
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(cnf *Config)
+		want   []string
+	}{
+		{name: "required fields", change: func(cnf *Config) {
+			cnf.PostgresDsn = ""
+			cnf.SecretKeyJWT = " "
+		}, want: []string{"postgres_dsn: is required, set it in yaml or SCHOOL_POSTGRES_DSN", "secret_key_jwt: is required"}},
+		{name: "no email section", change: func(cnf *Config) { cnf.Email = nil },
+			want: []string{"server_email: section is required"}},
+		{name: "smtp without host", change: func(cnf *Config) { cnf.Email.EmailHost = "" },
+			want: []string{"server_email.host: is required, set it in yaml or SCHOOL_SERVER_EMAIL_HOST"}},
+		{name: "file transport", change: func(cnf *Config) { cnf.Email.Transport = "file" },
+			want: []string{"server_email.file_dir: is required"}},
+		{name: "unknown transport", change: func(cnf *Config) { cnf.Email.Transport = "sendmail" },
+			want: []string{`unknown transport "sendmail"`}},
+		{name: "oauth provider", change: func(cnf *Config) {
+			cnf.Soc = &SocAuth{Providers: map[string]OAuthProvider{"vk": {ClientID: "id"}}}
+		}, want: []string{"soc_auth.providers.vk.client_secret: is required", "soc_auth.providers.vk.redirect_url: is required"}},
+		{name: "telegram without token", change: func(cnf *Config) { cnf.Telegram = &Telegram{ChatID: "1"} },
+			want: []string{"telegram.telegram_token: is required"}},
+		{name: "verification policy", change: func(cnf *Config) { cnf.Verification = &EmailVerification{Policy: "some"} },
+			want: []string{`unknown policy "some"`}},
+		{name: "alerting", change: func(cnf *Config) {
+			cnf.Alerting = &Alerting{
+				Sinks: map[string]AlertSink{
+					"chat": {Type: "telegram"},
+					"hook": {Type: "webhook", URL: "ftp://hook"},
+					"sms":  {Type: "sms"},
+				},
+				Routes: map[string][]string{"warning": {"chat"}, "error": {"ops"}},
+			}
+		}, want: []string{
+			"alerting.sinks.chat: telegram sink needs telegram.telegram_token",
+			"alerting.sinks.chat.to: is required",
+			"alerting.sinks.hook.url: must be http or https url",
+			`alerting.sinks.sms.type: unknown type "sms"`,
+			`alerting.routes: unknown severity "warning"`,
+			`alerting.routes.error: unknown sink "ops"`,
+		}},
+		{name: "rate limit", change: func(cnf *Config) {
+			cnf.RateLimit = &RateLimit{Backend: "redis", Policies: map[string][]RateLimitRule{
+				"chat": {{By: "session", Requests: 0, Per: time.Minute}},
+			}}
+		}, want: []string{
+			`rate_limit.backend: unknown backend "redis"`,
+			`rate_limit.policies.chat[0].by: unknown key "session"`,
+			"rate_limit.policies.chat[0]: requests and per must be positive",
+		}},
+		{name: "trusted proxies", change: func(cnf *Config) { cnf.Server = &Server{TrustedProxies: []string{"nginx"}} },
+			want: []string{`server.trusted_proxies: bad address "nginx"`}},
+		{name: "metrics on server port", change: func(cnf *Config) { cnf.Metrics = &Metrics{Listen: cnf.ServerPort} },
+			want: []string{"metrics.listen: must differ from server_port"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := validConfig()
+			tt.change(cnf)
+			err := cnf.Validate()
+			if err == nil {
+				t.Fatal("invalid config passed")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%v\nhas no %q", err, want)
+				}
+			}
+			//все ошибки возвращаются разом, по строке на каждую
+			if got := strings.Count(err.Error(), "\n  - "); got != len(tt.want) {
+				t.Errorf("%d problems, want %d:\n%v", got, len(tt.want), err)
+			}
+		})
+	}
+}
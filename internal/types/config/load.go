@@ -0,0 +1,230 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix - переменные окружения строятся из yaml пути: server_email.pass -> SCHOOL_SERVER_EMAIL_PASS.
+// Если задана переменная с суффиксом _FILE, значение читается из этого файла (docker/k8s secrets)
+const EnvPrefix = "SCHOOL_"
+
+const redacted = "***"
+
+var envNameRegexp = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// Defaults - значения, поверх которых читается yaml
+func Defaults() *Config {
+	return &Config{
+		ServerPort: ":8080",
+		DocsDir:    "static/swagger-ui",
+		Email:      &ConfigForSendEmail{Transport: "smtp"},
+	}
+}
+
+// Load собирает конфиг слоями: значения по умолчанию, yaml файл, переменные окружения, файлы секретов.
+// path может быть пустым, тогда конфиг целиком берется из окружения
+func Load(path string) (*Config, error) {
+
+	cnf := Defaults()
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "err with read config file")
+		}
+		if err = yaml.Unmarshal(b, cnf); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("err with parse config %s", path))
+		}
+	}
+
+	if _, err := applyEnv(reflect.ValueOf(cnf).Elem(), nil); err != nil {
+		return nil, err
+	}
+
+	return cnf, nil
+}
+
+// applyEnv проходит по полям конфига и подставляет значения из окружения, возвращает true, если что-то поменялось
+func applyEnv(v reflect.Value, path []string) (bool, error) {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return false, nil
+		}
+		if !v.IsNil() {
+			return applyEnv(v.Elem(), path)
+		}
+		//секции нет в yaml, создаем ее, только если для нее есть переменные
+		section := reflect.New(v.Type().Elem())
+		changed, err := applyEnv(section.Elem(), path)
+		if changed {
+			v.Set(section)
+		}
+		return changed, err
+	case reflect.Struct:
+		changed := false
+		for i := 0; i < v.NumField(); i++ {
+			name := yamlName(v.Type().Field(i))
+			if name == "" {
+				continue
+			}
+			fieldChanged, err := applyEnv(v.Field(i), append(path[:len(path):len(path)], name))
+			if err != nil {
+				return false, err
+			}
+			changed = changed || fieldChanged
+		}
+		return changed, nil
+	case reflect.Map:
+		//в map меняются только уже описанные в yaml элементы, например soc_auth.providers.vk.client_secret
+		changed := false
+		for _, key := range v.MapKeys() {
+			item := reflect.New(v.Type().Elem()).Elem()
+			item.Set(v.MapIndex(key))
+			itemChanged, err := applyEnv(item, append(path[:len(path):len(path)], fmt.Sprint(key.Interface())))
+			if err != nil {
+				return false, err
+			}
+			if itemChanged {
+				v.SetMapIndex(key, item)
+				changed = true
+			}
+		}
+		return changed, nil
+	}
+
+	name := EnvName(path)
+	raw, ok, err := lookupEnv(name)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err = setValue(v, raw); err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("err with %s", name))
+	}
+
+	return true, nil
+}
+
+// EnvName - имя переменной окружения для поля по его yaml пути
+func EnvName(path []string) string {
+	return EnvPrefix + strings.Trim(envNameRegexp.ReplaceAllString(strings.ToUpper(strings.Join(path, "_")), "_"), "_")
+}
+
+func lookupEnv(name string) (string, bool, error) {
+
+	if file, ok := os.LookupEnv(name + "_FILE"); ok {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", false, errors.Wrap(err, fmt.Sprintf("err with read %s_FILE", name))
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported type %s", v.Type())
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// Redact - конфиг для просмотра: ключи как в yaml, поля с тегом secret:"true" скрыты
+func Redact(cnf *Config) map[string]interface{} {
+	dump, _ := redactValue(reflect.ValueOf(cnf), false).(map[string]interface{})
+	return dump
+}
+
+func redactValue(v reflect.Value, secret bool) interface{} {
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), secret)
+	case reflect.Struct:
+		dump := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if name := yamlName(field); name != "" {
+				dump[name] = redactValue(v.Field(i), field.Tag.Get("secret") == "true")
+			}
+		}
+		return dump
+	case reflect.Map:
+		dump := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			dump[fmt.Sprint(key.Interface())] = redactValue(v.MapIndex(key), secret)
+		}
+		return dump
+	}
+
+	if secret {
+		if v.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	return v.Interface()
+}
+
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" || field.PkgPath != "" {
+		return ""
+	}
+	return name
+}
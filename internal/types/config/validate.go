@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Validate проверяет конфиг при старте и возвращает сразу все найденные ошибки
+func (c *Config) Validate() error {
+
+	v := &validator{}
+
+	v.required("postgres_dsn", c.PostgresDsn)
+	v.required("server_port", c.ServerPort)
+	v.required("secret_key_jwt", c.SecretKeyJWT)
+	v.required("video_directory_path", c.VideoDir)
+
+	if c.Email == nil {
+		v.add("server_email: section is required")
+	} else {
+		switch c.Email.Transport {
+		case "", "smtp":
+			v.required("server_email.host", c.Email.EmailHost)
+			v.required("server_email.port", c.Email.EmailPort)
+			v.required("server_email.login", c.Email.EmailLogin)
+		case "file":
+			v.required("server_email.file_dir", c.Email.FileDir)
+		default:
+			v.add(fmt.Sprintf("server_email.transport: unknown transport %q, expected smtp or file", c.Email.Transport))
+		}
+	}
+
+	if c.Soc != nil {
+		for name, provider := range c.Soc.Providers {
+			v.required("soc_auth.providers."+name+".client_id", provider.ClientID)
+			v.required("soc_auth.providers."+name+".client_secret", provider.ClientSecret)
+			v.required("soc_auth.providers."+name+".redirect_url", provider.RedirectURL)
+		}
+	}
+
+	if c.Telegram != nil {
+		v.required("telegram.telegram_token", c.Telegram.TelegramToken)
+	}
+
+	if c.Verification != nil {
+		switch c.Verification.Policy {
+		case "", "none", "write", "all":
+		default:
+			v.add(fmt.Sprintf("email_verification.policy: unknown policy %q, expected none, write or all", c.Verification.Policy))
+		}
+	}
+
+	if c.Alerting != nil {
+		c.Alerting.validate(v, c.Telegram)
+	}
+
+	if c.RateLimit != nil {
+		c.RateLimit.validate(v)
+	}
+
+	if _, err := c.Server.Proxies(); err != nil {
+		v.add("server.trusted_proxies: " + err.Error())
+	}
+
+	if c.Metrics != nil && c.Metrics.Listen != "" && c.Metrics.Listen == c.ServerPort {
+		v.add("metrics.listen: must differ from server_port")
+	}
+
+	return v.err()
+}
+
+func (a *Alerting) validate(v *validator, telegram *Telegram) {
+
+	for name, sink := range a.Sinks {
+		switch sink.Type {
+		case "telegram":
+			if telegram == nil || telegram.TelegramToken == "" {
+				v.add(fmt.Sprintf("alerting.sinks.%s: telegram sink needs telegram.telegram_token", name))
+			}
+			fallthrough
+		case "email":
+			if len(sink.To) == 0 {
+				v.add(fmt.Sprintf("alerting.sinks.%s.to: is required", name))
+			}
+		case "webhook":
+			if !strings.HasPrefix(sink.URL, "http://") && !strings.HasPrefix(sink.URL, "https://") {
+				v.add(fmt.Sprintf("alerting.sinks.%s.url: must be http or https url", name))
+			}
+		default:
+			v.add(fmt.Sprintf("alerting.sinks.%s.type: unknown type %q, expected telegram, email or webhook", name, sink.Type))
+		}
+	}
+
+	for severity, sinks := range a.Routes {
+		switch severity {
+		case "info", "error", "critical":
+		default:
+			v.add(fmt.Sprintf("alerting.routes: unknown severity %q, expected info, error or critical", severity))
+		}
+		for _, name := range sinks {
+			if _, ok := a.Sinks[name]; !ok {
+				v.add(fmt.Sprintf("alerting.routes.%s: unknown sink %q", severity, name))
+			}
+		}
+	}
+}
+
+func (r *RateLimit) validate(v *validator) {
+
+	switch r.Backend {
+	case "", "memory", "postgres":
+	default:
+		v.add(fmt.Sprintf("rate_limit.backend: unknown backend %q, expected memory or postgres", r.Backend))
+	}
+
+	for name, rules := range r.Policies {
+		for i, rule := range rules {
+			switch rule.By {
+			case "ip", "user", "email":
+			default:
+				v.add(fmt.Sprintf("rate_limit.policies.%s[%d].by: unknown key %q, expected ip, user or email", name, i, rule.By))
+			}
+			if rule.Requests <= 0 || rule.Per <= 0 {
+				v.add(fmt.Sprintf("rate_limit.policies.%s[%d]: requests and per must be positive", name, i))
+			}
+		}
+	}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(problem string) {
+	v.problems = append(v.problems, problem)
+}
+
+func (v *validator) required(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(fmt.Sprintf("%s: is required, set it in yaml or %s", name, EnvName(strings.Split(name, "."))))
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid config:\n  - " + strings.Join(v.problems, "\n  - "))
+}
@@ -1,7 +1,9 @@
 package types
 
 import (
+	"github.com/tarasova-school/pkg/infrastruct"
 	"mime/multipart"
+	"time"
 )
 
 const (
@@ -10,66 +12,220 @@ const (
 	RoleAdmin   = "admin"
 )
 
+// Права доступа, роли в таблице roles собираются из них
 const (
-	EmailRecoveryTitle = "Востановление пароля для tarasova-school.ru"
-	MIME               = "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	PermContentEdit  = "content.edit"
+	PermChatsAsk     = "chats.ask"
+	PermChatsAnswer  = "chats.answer"
+	PermChatsReadAll = "chats.read_all"
+	PermUsersView    = "users.view"
+	PermUsersManage  = "users.manage"
+	PermReportsView  = "reports.view"
+	PermRolesManage  = "roles.manage"
+	PermImpersonate  = "users.impersonate"
+	PermAuditView    = "audit.view"
+	PermConfigView   = "config.view"
+	PermTwoFactor    = "auth.two_factor"
 )
 
+var Permissions = []Permission{
+	{Name: PermContentEdit, Description: "создание, изменение и удаление курсов, уроков и видео"},
+	{Name: PermChatsAsk, Description: "вопросы учителю в чатах уроков"},
+	{Name: PermChatsAnswer, Description: "ответы ученикам в чатах своих разделов, оценки и ахтунги"},
+	{Name: PermChatsReadAll, Description: "просмотр чатов любых учителей"},
+	{Name: PermUsersView, Description: "просмотр списков пользователей"},
+	{Name: PermUsersManage, Description: "управление учителями и пользователями"},
+	{Name: PermReportsView, Description: "отчеты, выгрузки, аналитика и SLA"},
+	{Name: PermRolesManage, Description: "управление ролями и их правами, смена роли пользователя"},
+	{Name: PermImpersonate, Description: "вход от имени пользователя"},
+	{Name: PermAuditView, Description: "просмотр журнала действий"},
+	{Name: PermConfigView, Description: "просмотр настроек сервиса без секретов"},
+	{Name: PermTwoFactor, Description: "подключение двухфакторной авторизации"},
+}
+
+const (
+	TeacherEventGood    = "good"
+	TeacherEventImprove = "improve"
+	TeacherEventAhtung  = "ahtung"
+	TeacherEventAnswer  = "answer"
+)
+
+const (
+	NotifyChannelEmail    = "email"
+	NotifyChannelTelegram = "telegram"
+)
+
+const (
+	NotifyTeacherReply = "teacher_reply"
+	NotifyNewHomework  = "new_homework"
+	NotifySLAReminder  = "sla_reminder"
+	NotifySLAEscalated = "sla_escalated"
+)
+
+const (
+	VerifyPolicyNone  = "none"
+	VerifyPolicyWrite = "write"
+	VerifyPolicyAll   = "all"
+)
+
+const (
+	AnalyticsByDay  = "day"
+	AnalyticsByWeek = "week"
+)
+
+// Error - тело ответа с ошибкой. Code - стабильный код ошибки, Error - сообщение на языке из Accept-Language,
+// Fields - ошибки в полях запроса
+type Error struct {
+	Err    string                   `json:"error"`
+	Code   string                   `json:"code"`
+	Fields []infrastruct.FieldError `json:"fields,omitempty"`
+}
+
+// ChangePassword - смена пароля текущего пользователя, UserID берется из токена
 type ChangePassword struct {
-	UserID         int    `json:"user_id"`
-	OldPassword    string `json:"old_password"`
-	NewPassword    string `json:"new_password"`
-	RepeatPassword string `json:"repeat_password"`
+	UserID         int    `json:"-"`
+	OldPassword    string `json:"old_password" validate:"required"`
+	NewPassword    string `json:"new_password" validate:"required,min=6,max=72"`
+	RepeatPassword string `json:"repeat_password" validate:"required"`
 }
 
 type RecoveryPasswordEmail struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required,email,max=254"`
+	IP    string `json:"-"`
 }
 
 type RecoveryPasswordEmailAndCode struct {
-	Email string `json:"email"`
-	Code  string `json:"code"`
+	Email string `json:"email" validate:"required,email,max=254"`
+	Code  string `json:"code" validate:"required,max=32"`
+	IP    string `json:"-"`
 }
 
 type RecoveryPasswordNewPass struct {
-	Email          string `json:"email"`
-	Code           string `json:"code"`
-	NewPassword    string `json:"new_password"`
-	RepeatPassword string `json:"repeat_password"`
+	Email          string `json:"email" validate:"required,email,max=254"`
+	Code           string `json:"code" validate:"required,max=32"`
+	NewPassword    string `json:"new_password" validate:"required,min=6,max=72"`
+	RepeatPassword string `json:"repeat_password" validate:"required"`
+	IP             string `json:"-"`
 }
 
 type CheckCode struct {
 	Code bool `json:"code"`
 }
 
-type AuthorizeVK struct {
-	Email     string
-	Firstname string
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type EmailVerificationStatus struct {
+	Verified   bool   `json:"verified"`
+	VerifiedAT string `json:"verified_at,omitempty"`
+}
+
+type OAuthProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+}
+
+type OAuthState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	NonceHash    string //sha256 nonce из cookie браузера, который начал вход
+	UserID       int    //не 0, если пользователь привязывает соцсеть к своему аккаунту
+	CreatedAT    time.Time
+}
+
+type OAuthRedirect struct {
+	URL string `json:"url"`
+	//Nonce уходит в cookie, callback принимается только из того же браузера
+	Nonce string `json:"-"`
+}
+
+type UserIdentity struct {
+	UserID    int    `json:"-"`
+	Provider  string `json:"provider"`
+	Subject   string `json:"-"`
+	Email     string `json:"email"`
+	CreatedAT string `json:"created_at"`
 }
 
 type Authorize struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=72"`
 }
 
+// Token - при включенной 2FA вместо token приходит challenge, его меняем на token в /users/auth/2fa
 type Token struct {
-	Token string `json:"token"`
+	Token     string `json:"token,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorLogin struct {
+	Challenge string `json:"challenge" validate:"required"`
+	Code      string `json:"code" validate:"required,max=32"`
+}
+
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type StepUpToken struct {
+	Token string `json:"step_up_token"`
+}
+
+type TOTP struct {
+	UserID   int
+	Secret   string
+	Enabled  bool
+	LastStep int64
+	//Challenge - id последнего выданного challenge входа, пусто - погашен
+	Challenge string
 }
 
 type User struct {
-	FirstName string `json:"first_name"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
+	FirstName     string `json:"first_name" validate:"required,max=100"`
+	Email         string `json:"email" validate:"required,email,max=254"`
+	Password      string `json:"password,omitempty" validate:"required,min=6,max=72"`
+	ID            int    `json:"id"`
+	UserRole      string `json:"role"`
+	CreatedAT     string `json:"created_at"`
+	UpdatedAT     string `json:"updated_at"`
+	TokenVersion  int    `json:"-"`
+	Suspended     bool   `json:"-"`
+	SuspendReason string `json:"-"`
+	//RandomPassword - пароль сгенерирован при входе через соцсеть и пользователю не известен
+	RandomPassword bool `json:"-"`
+}
+
+// UserProfile - пользователь для просмотра другими, без пароля и служебных полей
+type UserProfile struct {
 	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
 	UserRole  string `json:"role"`
-	CreatedAT string `json:"created_at"`
-	UpdatedAT string `json:"updated_at"`
 }
 
 type Teacher struct {
-	FirstName string `json:"first_name"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,email,max=254"`
+	Password  string `json:"password" validate:"max=72"`
 	ID        int    `json:"id"`
 	UserRole  string `json:"role"`
 	CreatedAT string `json:"created_at"`
@@ -101,6 +257,18 @@ type Admin struct {
 	UpdatedAT string `json:"updated_at"`
 }
 
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	Name        string   `json:"name" validate:"required,max=64"`
+	Description string   `json:"description" validate:"max=500"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+}
+
 type UserStat struct {
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
@@ -109,9 +277,9 @@ type UserStat struct {
 
 type Course struct {
 	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Cost       int    `json:"cost"`
-	Sale       int    `json:"sale"`
+	Name       string `json:"name" validate:"required,max=200"`
+	Cost       int    `json:"cost" validate:"min=0,max=10000000"`
+	Sale       int    `json:"sale" validate:"min=0,max=100"` //скидка в процентах
 	TotalPrice int    `json:"total_price"`
 }
 
@@ -128,14 +296,18 @@ type CourseInfoForAdmin struct {
 type Section struct {
 	ID       int    `json:"id"`
 	CourseID int    `json:"course_id"`
-	Name     string `json:"name"`
+	Name     string `json:"name" validate:"required,max=200"`
+	Position int    `json:"position"`
+	Version  int    `json:"version"`
 }
 
 type Level struct {
 	ID        int    `json:"id"`
 	CourseID  int    `json:"course_id"`
 	SectionID int    `json:"section_id"`
-	Name      string `json:"name"`
+	Name      string `json:"name" validate:"required,max=200"`
+	Position  int    `json:"position"`
+	Version   int    `json:"version"`
 }
 
 type Lesson struct {
@@ -144,14 +316,72 @@ type Lesson struct {
 	SectionID int `json:"section_id"`
 	LevelID   int `json:"level_id"`
 
-	Name        string   `json:"name"`
-	Description string   `json:"lesson_description"`
-	Thesis      []string `json:"lesson_thesis"`
-	Task        string   `json:"lesson_task"`
+	Name        string   `json:"name" validate:"required,max=200"`
+	Description string   `json:"lesson_description" validate:"required,max=20000"`
+	Thesis      []string `json:"lesson_thesis" validate:"required,max=50,dive,required,max=1000"`
+	Task        string   `json:"lesson_task" validate:"required,max=20000"`
 
 	Status        bool   `json:"status_free"`
 	NextLessonID  int    `json:"next_lesson_id"`
 	NextLessonURL string `json:"next_lesson_url"`
+	Version       int    `json:"version"`
+}
+
+// Placement - место раздела, уровня или урока среди соседей, Position считается с нуля.
+// В запросе Version - версия, которую видел клиент: если элемент с тех пор переносили, ответ 409.
+// В ответе - итоговое место и новая версия
+type Placement struct {
+	ID       int `json:"id"`
+	Position int `json:"position" validate:"min=0"`
+	Version  int `json:"version" validate:"min=0"`
+}
+
+// MoveLesson - перенос урока на место Position в уровень LevelID, раздел и курс берутся из уровня
+type MoveLesson struct {
+	LevelID  int `json:"level_id" validate:"required,min=1"`
+	Position int `json:"position" validate:"min=0"`
+	Version  int `json:"version" validate:"min=0"`
+}
+
+// Breadcrumb - родитель в дереве курса, Type - course, section, level или lesson
+type Breadcrumb struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+const (
+	BreadcrumbCourse  = "course"
+	BreadcrumbSection = "section"
+	BreadcrumbLevel   = "level"
+	BreadcrumbLesson  = "lesson"
+)
+
+// LessonNav - соседний урок курса, он может быть в другом уровне или разделе
+type LessonNav struct {
+	ID        int    `json:"id"`
+	CourseID  int    `json:"course_id"`
+	SectionID int    `json:"section_id"`
+	LevelID   int    `json:"level_id"`
+	Name      string `json:"name"`
+}
+
+// LessonView - урок по id вместе с родителями и соседними уроками
+type LessonView struct {
+	Lesson
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+	Previous    *LessonNav   `json:"previous"`
+	Next        *LessonNav   `json:"next"`
+}
+
+type LevelView struct {
+	Level
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
+
+type ChatView struct {
+	ChatData
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
 }
 
 type LessonCarousel struct {
@@ -191,7 +421,7 @@ type Message struct {
 }
 
 type MessageBody struct {
-	Text      string `json:"text"`
+	Text      string `json:"text" validate:"required,max=10000"`
 	Role      string `json:"role"`
 	FirstName string `json:"first_name"`
 	UserID    int    `json:"user_id"`
@@ -243,7 +473,7 @@ type Ahtung struct {
 type Rating struct {
 	ChatID    int    `json:"chat_id"`
 	TeacherID int    `json:"teacher_id"`
-	Rating    string `json:"rating"` //improve or good or ""
+	Rating    string `json:"rating" validate:"required,oneof=good|improve"`
 }
 
 type UploadVideo struct {
@@ -261,3 +491,236 @@ type GetVideo struct {
 	LevelID   int `json:"level_id"`
 	LessonID  int `json:"lesson_id"`
 }
+
+type ReportPeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+type StudentReport struct {
+	ID        int
+	Email     string
+	FirstName string
+	CreatedAT time.Time
+	Times     int
+}
+
+type TeacherChatStat struct {
+	TeacherID       int
+	FirstName       string
+	Chats           int
+	StudentMessages int
+	TeacherMessages int
+}
+
+type TeacherEvent struct {
+	TeacherID int
+	ChatID    int
+	Event     string
+	Value     int
+}
+
+type TeacherAnalytics struct {
+	TeacherID  int                      `json:"teacher_id"`
+	FirstName  string                   `json:"first_name"`
+	Unanswered int                      `json:"unanswered"`
+	Total      TeacherAnalyticsBucket   `json:"total"`
+	Buckets    []TeacherAnalyticsBucket `json:"buckets,omitempty"`
+}
+
+type TeacherAnalyticsBucket struct {
+	Start         string `json:"start,omitempty"`
+	Good          int    `json:"good"`
+	Improve       int    `json:"improve"`
+	Ahtung        int    `json:"ahtung"`
+	Answers       int    `json:"answers"`
+	AnswerTimeP50 int    `json:"answer_time_p50_sec"`
+	AnswerTimeP90 int    `json:"answer_time_p90_sec"`
+}
+
+type OverdueChat struct {
+	ChatID       int
+	CourseID     int
+	SectionID    int
+	LessonID     int
+	StudentID    int
+	MessageID    int
+	WaitingSince time.Time
+	RemindedAt   *time.Time
+	EscalatedAt  *time.Time
+}
+
+type SLAOverview struct {
+	Overdue   int                 `json:"overdue"`
+	Escalated int                 `json:"escalated"`
+	Courses   []SLACourseOverdue  `json:"courses"`
+	Teachers  []SLATeacherOverdue `json:"teachers"`
+}
+
+type SLACourseOverdue struct {
+	CourseID  int `json:"course_id"`
+	Overdue   int `json:"overdue"`
+	Escalated int `json:"escalated"`
+}
+
+type SLATeacherOverdue struct {
+	TeacherID int    `json:"teacher_id"`
+	FirstName string `json:"first_name"`
+	Overdue   int    `json:"overdue"`
+}
+
+// NotificationSettings - каналы уведомлений. telegram_chat_id только для чтения: чат подключается ссылкой
+// из POST /v1/me/notifications/telegram, когда пользователь нажимает start у бота
+type NotificationSettings struct {
+	Email          bool   `json:"email"`
+	Telegram       bool   `json:"telegram"`
+	TelegramChatID string `json:"telegram_chat_id" validate:"max=64"`
+	InApp          bool   `json:"in_app"`
+}
+
+type TelegramLink struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type Notification struct {
+	ID        int    `json:"id"`
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Read      bool   `json:"read"`
+	CreatedAT string `json:"created_at"`
+}
+
+type NotificationFeed struct {
+	Unread        int            `json:"unread"`
+	Notifications []Notification `json:"notifications"`
+}
+
+type OutboxMessage struct {
+	ID       int
+	UserID   int
+	Channel  string
+	Address  string
+	Title    string
+	Body     string
+	Attempts int
+}
+
+type UserRoleChange struct {
+	Role string `json:"role" validate:"required,max=64"`
+}
+
+type UserSuspend struct {
+	Reason string `json:"reason" validate:"required,max=512"`
+}
+
+type Impersonate struct {
+	Reason string `json:"reason" validate:"required,max=512"`
+}
+
+// ImpersonationToken - токен для входа от имени пользователя, действует до expires_at
+type ImpersonationToken struct {
+	Token     string `json:"token"`
+	UserID    int    `json:"user_id"`
+	ExpiresAT string `json:"expires_at"`
+}
+
+// UserAccess - то, что проверяется по базе на каждый запрос с токеном
+type UserAccess struct {
+	Role          string `json:"role"`
+	TokenVersion  int    `json:"-"`
+	Suspended     bool   `json:"suspended"`
+	SuspendReason string `json:"suspend_reason,omitempty"`
+}
+
+// AuditEntry - запись журнала действий. В before и after только изменившиеся поля,
+// при создании before пустой, при удалении пустой after
+type AuditEntry struct {
+	ID             int    `json:"id"`
+	ActorID        int    `json:"actor_id"`
+	ActorRole      string `json:"actor_role"`
+	ImpersonatorID int    `json:"impersonator_id,omitempty"`
+	Action         string `json:"action"`
+	Entity         string `json:"entity"`
+	EntityID       string `json:"entity_id"`
+	Before         []byte `json:"-"`
+	After          []byte `json:"-"`
+	IP             string `json:"ip"`
+	UserAgent      string `json:"user_agent"`
+	CreatedAT      string `json:"created_at"`
+}
+
+type AuditEntryView struct {
+	AuditEntry
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+	ActorID  int
+	Action   string
+	Entity   string
+	EntityID string
+	Period   *ReportPeriod
+	Limit    int
+	Offset   int
+}
+
+type AuditLog struct {
+	Entries []AuditEntryView `json:"entries"`
+	Total   int              `json:"total"`
+}
+
+const (
+	CheckOK     = "ok"
+	CheckFailed = "fail"
+)
+
+// Readiness - результат /readyz, Checks - состояние каждой зависимости
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	CloneQueued  = "queued"
+	CloneRunning = "running"
+	CloneDone    = "done"
+	CloneFailed  = "failed"
+)
+
+const (
+	CloneVideosNone = "none"
+	CloneVideosLink = "link"
+	CloneVideosCopy = "copy"
+)
+
+// CloneCourse - параметры копии курса. Name по умолчанию - имя курса с пометкой «копия», Cost - новая цена,
+// без нее остается цена курса, ResetSale убирает скидку. Videos: none - без видео, link - жесткие ссылки
+// на те же файлы, copy - отдельные копии файлов
+type CloneCourse struct {
+	Name      string `json:"name,omitempty" validate:"max=200"`
+	Cost      *int   `json:"cost,omitempty" validate:"min=0,max=10000000"`
+	ResetSale bool   `json:"reset_sale"`
+	Videos    string `json:"videos,omitempty" validate:"oneof=none|link|copy"`
+}
+
+// CourseCloneJob - фоновое копирование курса. Done из Total - сколько разделов, уровней, уроков и видео уже скопировано,
+// NewCourseID появляется, когда курс со всеми уроками создан, видео копируются после этого
+type CourseCloneJob struct {
+	ID          int         `json:"id"`
+	CourseID    int         `json:"course_id"`
+	NewCourseID int         `json:"new_course_id"`
+	Options     CloneCourse `json:"options"`
+	Status      string      `json:"status" validate:"oneof=queued|running|done|failed"`
+	Total       int         `json:"total"`
+	Done        int         `json:"done"`
+	Progress    int         `json:"progress"` //в процентах
+	Error       string      `json:"error,omitempty"`
+	CreatedBy   int         `json:"created_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+	StartedAt   *time.Time  `json:"started_at"`
+	FinishedAt  *time.Time  `json:"finished_at"`
+	LessonMap   map[int]int `json:"-"` //id урока курса -> id его копии
+}
@@ -0,0 +1,301 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/tarasova-school/internal/types/config"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+
+	defaultQueueSize    = 1000
+	defaultGroupWindow  = 5 * time.Minute
+	defaultMaxPerMinute = 20
+	flushInterval       = time.Second
+)
+
+var severities = []string{SeverityInfo, SeverityError, SeverityCritical}
+
+// stderr - ошибки самих оповещений пишем только в лог, иначе они снова попадут в очередь
+var stderr = zerolog.New(os.Stderr).With().Timestamp().Str("component", "alert").Logger()
+
+type Alert struct {
+	Severity  string    `json:"severity"`
+	Text      string    `json:"text"`
+	RequestID string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+	//Repeats - сколько раз такое же сообщение повторилось за окно группировки после первого
+	Repeats int `json:"repeats,omitempty"`
+}
+
+// Alerter принимает сообщения без блокировки и рассылает их в фоне: одинаковые сообщения за group_window
+// склеиваются в одно, каждый канал ограничен max_per_minute сообщениями в минуту
+type Alerter struct {
+	queue        chan Alert
+	routes       map[string][]*limitedSink
+	groupWindow  time.Duration
+	groups       map[string]*group
+	dropped      int64
+	done         chan struct{}
+	cancel       context.CancelFunc
+	stopOnce     sync.Once
+	startOnce    sync.Once
+	maxPerMinute int
+	//now - часы, тесты подменяют их, чтобы проверить окна группировки и ограничение частоты
+	now func() time.Time
+}
+
+type group struct {
+	alert   Alert
+	until   time.Time
+	repeats int
+}
+
+// limitedSink - канал с ограничением частоты, пропущенные сообщения считаются и упоминаются в следующем
+type limitedSink struct {
+	Sink
+	minute     time.Time
+	sent       int
+	suppressed int
+}
+
+func New(cnf *config.Alerting, senders map[string]Sender) (*Alerter, error) {
+
+	if cnf == nil {
+		cnf = &config.Alerting{}
+	}
+
+	a := &Alerter{
+		queue:        make(chan Alert, valueOr(cnf.QueueSize, defaultQueueSize)),
+		routes:       make(map[string][]*limitedSink),
+		groupWindow:  cnf.GroupWindow,
+		groups:       make(map[string]*group),
+		done:         make(chan struct{}),
+		maxPerMinute: valueOr(cnf.MaxPerMinute, defaultMaxPerMinute),
+		now:          time.Now,
+	}
+	if a.groupWindow <= 0 {
+		a.groupWindow = defaultGroupWindow
+	}
+
+	sinks := make(map[string]*limitedSink, len(cnf.Sinks))
+	for name, sinkCnf := range cnf.Sinks {
+		sink, err := newSink(name, sinkCnf, senders)
+		if err != nil {
+			return nil, err
+		}
+		sinks[name] = &limitedSink{Sink: sink}
+	}
+
+	for severity, names := range cnf.Routes {
+		if !knownSeverity(severity) {
+			return nil, errors.Errorf("unknown alert severity %q", severity)
+		}
+		for _, name := range names {
+			sink, ok := sinks[name]
+			if !ok {
+				return nil, errors.Errorf("unknown alert sink %q in route %s", name, severity)
+			}
+			a.routes[severity] = append(a.routes[severity], sink)
+		}
+	}
+
+	return a, nil
+}
+
+// TelegramConfig - оповещения по старой секции telegram, если alerting не задан:
+// все сообщения в chat_id, критические еще и в channel_id
+func TelegramConfig(t *config.Telegram) *config.Alerting {
+
+	if t == nil || t.TelegramToken == "" || t.ChatID == "" {
+		return nil
+	}
+
+	cnf := &config.Alerting{
+		Sinks: map[string]config.AlertSink{"chat": {Type: SinkTelegram, To: []string{t.ChatID}}},
+		Routes: map[string][]string{
+			SeverityInfo:     {"chat"},
+			SeverityError:    {"chat"},
+			SeverityCritical: {"chat"},
+		},
+	}
+	if t.ChannelID != "" && t.ChannelID != t.ChatID {
+		cnf.Sinks["channel"] = config.AlertSink{Type: SinkTelegram, To: []string{t.ChannelID}}
+		cnf.Routes[SeverityCritical] = append(cnf.Routes[SeverityCritical], "channel")
+	}
+
+	return cnf
+}
+
+// Alert ставит сообщение в очередь. Если очередь переполнена, сообщение теряется, потери видны в логе
+func (a *Alerter) Alert(severity, text, requestID string) {
+
+	if len(a.routes[severity]) == 0 {
+		return
+	}
+
+	select {
+	case a.queue <- Alert{Severity: severity, Text: text, RequestID: requestID, Time: a.now()}:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+}
+
+// Run рассылает сообщения, пока не отменят ctx. Перед выходом отправляет то, что осталось в очереди
+func (a *Alerter) Run(ctx context.Context) {
+
+	a.startOnce.Do(func() {
+		ctx, a.cancel = context.WithCancel(ctx)
+		go a.run(ctx)
+	})
+}
+
+// Stop останавливает рассылку и ждет отправки оставшихся сообщений не дольше timeout
+func (a *Alerter) Stop(timeout time.Duration) {
+
+	a.stopOnce.Do(func() {
+		if a.cancel == nil {
+			return
+		}
+		a.cancel()
+		select {
+		case <-a.done:
+		case <-time.After(timeout):
+			stderr.Warn().Msg("alert queue is not flushed before timeout")
+		}
+	})
+}
+
+func (a *Alerter) run(ctx context.Context) {
+
+	defer close(a.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case alert := <-a.queue:
+			a.handle(alert)
+		case <-ticker.C:
+			a.flushGroups(a.now(), false)
+			a.reportDropped()
+		case <-ctx.Done():
+			for {
+				select {
+				case alert := <-a.queue:
+					a.handle(alert)
+				default:
+					a.flushGroups(a.now(), true)
+					a.reportDropped()
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle отправляет первое сообщение группы сразу, повторы только считает
+func (a *Alerter) handle(alert Alert) {
+
+	key := alert.Severity + "\x00" + alert.Text
+	if g, ok := a.groups[key]; ok && alert.Time.Before(g.until) {
+		g.repeats++
+		return
+	}
+
+	a.groups[key] = &group{alert: alert, until: alert.Time.Add(a.groupWindow)}
+	a.send(alert)
+}
+
+// flushGroups закрывает группы, у которых кончилось окно, и отправляет сводку по повторам
+func (a *Alerter) flushGroups(now time.Time, all bool) {
+
+	for key, g := range a.groups {
+		if !all && now.Before(g.until) {
+			continue
+		}
+		delete(a.groups, key)
+		if g.repeats == 0 {
+			continue
+		}
+
+		summary := g.alert
+		summary.Repeats = g.repeats
+		summary.Time = now
+		summary.RequestID = ""
+		a.send(summary)
+	}
+}
+
+func (a *Alerter) reportDropped() {
+	if dropped := atomic.SwapInt64(&a.dropped, 0); dropped > 0 {
+		stderr.Warn().Int64("dropped", dropped).Msg("alert queue is full")
+	}
+}
+
+func (a *Alerter) send(alert Alert) {
+
+	now := a.now()
+	for _, sink := range a.routes[alert.Severity] {
+		if minute := now.Truncate(time.Minute); !sink.minute.Equal(minute) {
+			sink.minute = minute
+			sink.sent = 0
+		}
+		if sink.sent >= a.maxPerMinute {
+			sink.suppressed++
+			continue
+		}
+		sink.sent++
+
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := sink.Send(ctx, alert, sink.suppressed)
+		cancel()
+		if err != nil {
+			stderr.Err(err).Str("sink", sink.Name()).Msg("err with send alert")
+			continue
+		}
+		sink.suppressed = 0
+	}
+}
+
+// Format - текст сообщения для чатов и почты
+func Format(alert Alert, suppressed int) string {
+
+	text := fmt.Sprintf("%s [%s]: %s", alert.Severity, alert.Time.Format("2006-01-02T15:04:05"), alert.Text)
+	if alert.RequestID != "" {
+		text += fmt.Sprintf(" (request_id %s)", alert.RequestID)
+	}
+	if alert.Repeats > 0 {
+		text = fmt.Sprintf("повторилось еще %d раз: %s", alert.Repeats, text)
+	}
+	if suppressed > 0 {
+		text += fmt.Sprintf("\n(пропущено сообщений из-за ограничения частоты: %d)", suppressed)
+	}
+
+	return text
+}
+
+func knownSeverity(severity string) bool {
+	for _, s := range severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+func valueOr(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
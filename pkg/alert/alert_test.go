@@ -0,0 +1,283 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"github.com/tarasova-school/internal/types/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink запоминает отправленные сообщения вместе с числом пропущенных перед ними
+type fakeSink struct {
+	mu         sync.Mutex
+	alerts     []Alert
+	suppressed []int
+	err        error
+}
+
+func (f *fakeSink) Name() string {
+	return "fake"
+}
+
+func (f *fakeSink) Send(_ context.Context, alert Alert, suppressed int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.alerts = append(f.alerts, alert)
+	f.suppressed = append(f.suppressed, suppressed)
+	return nil
+}
+
+func (f *fakeSink) sent() []Alert {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Alert(nil), f.alerts...)
+}
+
+// fakeClock - часы, которые двигает тест
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// newTestAlerter - alerter с одним фейковым каналом на все уровни и фейковыми часами
+func newTestAlerter(t *testing.T, cnf *config.Alerting) (*Alerter, *fakeSink, *fakeClock) {
+	t.Helper()
+
+	a, err := New(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &fakeSink{}
+	limited := &limitedSink{Sink: sink}
+	for _, severity := range severities {
+		a.routes[severity] = []*limitedSink{limited}
+	}
+	clock := &fakeClock{t: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)}
+	a.now = clock.now
+
+	return a, sink, clock
+}
+
+// alert - сообщение с текущим временем фейковых часов, как его поставил бы в очередь Alert
+func alert(clock *fakeClock, severity, text string) Alert {
+	return Alert{Severity: severity, Text: text, RequestID: "req", Time: clock.now()}
+}
+
+func TestNew(t *testing.T) {
+
+	senders := map[string]Sender{SinkEmail: nil}
+	tests := []struct {
+		name string
+		cnf  *config.Alerting
+		ok   bool
+	}{
+		{name: "empty", ok: true},
+		{name: "email and webhook", ok: true, cnf: &config.Alerting{
+			Sinks: map[string]config.AlertSink{
+				"ops":  {Type: SinkEmail, To: []string{"ops@mail.ru"}},
+				"hook": {Type: SinkWebhook, URL: "https://example.com/alert"},
+			},
+			Routes: map[string][]string{SeverityError: {"ops"}, SeverityCritical: {"ops", "hook"}},
+		}},
+		{name: "unknown severity", cnf: &config.Alerting{
+			Sinks:  map[string]config.AlertSink{"ops": {Type: SinkEmail, To: []string{"ops@mail.ru"}}},
+			Routes: map[string][]string{"warning": {"ops"}},
+		}},
+		{name: "unknown sink in route", cnf: &config.Alerting{
+			Routes: map[string][]string{SeverityError: {"ops"}},
+		}},
+		{name: "sender not configured", cnf: &config.Alerting{
+			Sinks: map[string]config.AlertSink{"chat": {Type: SinkTelegram, To: []string{"1"}}},
+		}},
+		{name: "empty to", cnf: &config.Alerting{
+			Sinks: map[string]config.AlertSink{"ops": {Type: SinkEmail}},
+		}},
+		{name: "bad webhook url", cnf: &config.Alerting{
+			Sinks: map[string]config.AlertSink{"hook": {Type: SinkWebhook, URL: "example.com"}},
+		}},
+		{name: "unknown sink type", cnf: &config.Alerting{
+			Sinks: map[string]config.AlertSink{"sms": {Type: "sms"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cnf, senders); (err == nil) != tt.ok {
+				t.Errorf("err %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGroupWindow(t *testing.T) {
+
+	a, sink, clock := newTestAlerter(t, &config.Alerting{GroupWindow: 5 * time.Minute})
+
+	a.handle(alert(clock, SeverityError, "db down"))
+	clock.add(time.Minute)
+	a.handle(alert(clock, SeverityError, "db down"))
+	a.handle(alert(clock, SeverityError, "db down"))
+	//тот же текст с другим уровнем - другая группа
+	a.handle(alert(clock, SeverityCritical, "db down"))
+	if got := len(sink.sent()); got != 2 {
+		t.Fatalf("sent %d alerts inside the window, want 2", got)
+	}
+
+	clock.add(time.Minute)
+	a.flushGroups(clock.now(), false)
+	if got := len(sink.sent()); got != 2 {
+		t.Fatalf("group flushed before its window ended, sent %d", got)
+	}
+
+	clock.add(3 * time.Minute)
+	a.flushGroups(clock.now(), false)
+	sent := sink.sent()
+	if len(sent) != 3 {
+		t.Fatalf("sent %d alerts after the window, want summary", len(sent))
+	}
+	summary := sent[2]
+	if summary.Text != "db down" || summary.Severity != SeverityError || summary.Repeats != 2 || summary.RequestID != "" {
+		t.Errorf("summary %+v", summary)
+	}
+	if len(a.groups) != 1 {
+		t.Errorf("groups %d, critical group has its own window", len(a.groups))
+	}
+
+	//после закрытия окна сообщение снова уходит сразу
+	a.handle(alert(clock, SeverityError, "db down"))
+	if sent = sink.sent(); len(sent) != 4 || sent[3].Repeats != 0 {
+		t.Errorf("sent %+v", sent)
+	}
+}
+
+func TestFlushAllGroups(t *testing.T) {
+
+	a, sink, clock := newTestAlerter(t, nil)
+
+	a.handle(alert(clock, SeverityError, "a"))
+	a.handle(alert(clock, SeverityError, "a"))
+	a.handle(alert(clock, SeverityError, "b"))
+	a.flushGroups(clock.now(), true)
+
+	sent := sink.sent()
+	if len(sent) != 3 || sent[2].Text != "a" || sent[2].Repeats != 1 {
+		t.Errorf("sent %+v", sent)
+	}
+	if len(a.groups) != 0 {
+		t.Errorf("groups %d left after flush", len(a.groups))
+	}
+}
+
+func TestRateLimitPerSink(t *testing.T) {
+
+	a, sink, clock := newTestAlerter(t, &config.Alerting{MaxPerMinute: 2})
+	other := &fakeSink{}
+	a.routes[SeverityInfo] = append(a.routes[SeverityInfo], &limitedSink{Sink: other})
+
+	for _, text := range []string{"1", "2", "3", "4"} {
+		a.handle(alert(clock, SeverityInfo, text))
+	}
+	if got := len(sink.sent()); got != 2 {
+		t.Fatalf("sent %d alerts in a minute, want 2", got)
+	}
+	if got := len(other.sent()); got != 2 {
+		t.Fatalf("other sink sent %d, each sink has its own limit", got)
+	}
+
+	clock.add(time.Minute)
+	a.handle(alert(clock, SeverityInfo, "5"))
+	a.handle(alert(clock, SeverityInfo, "6"))
+	if sent := sink.sent(); len(sent) != 4 || sent[2].Text != "5" {
+		t.Fatalf("sent %+v", sent)
+	}
+	//число пропущенных приходит со следующим сообщением и обнуляется
+	if got := sink.suppressed; got[2] != 2 || got[3] != 0 {
+		t.Errorf("suppressed %v, want 2 then 0", got)
+	}
+}
+
+func TestRateLimitKeepsSuppressedOnError(t *testing.T) {
+
+	a, sink, clock := newTestAlerter(t, &config.Alerting{MaxPerMinute: 1})
+
+	a.handle(alert(clock, SeverityInfo, "1"))
+	a.handle(alert(clock, SeverityInfo, "2"))
+	clock.add(time.Minute)
+	sink.err = errors.New("unavailable")
+	a.handle(alert(clock, SeverityInfo, "3"))
+	clock.add(time.Minute)
+	sink.err = nil
+	a.handle(alert(clock, SeverityInfo, "4"))
+
+	if got := sink.suppressed; len(got) != 2 || got[1] != 1 {
+		t.Errorf("suppressed %v, count must survive a failed send", got)
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+
+	a, _, _ := newTestAlerter(t, &config.Alerting{QueueSize: 2})
+	delete(a.routes, SeverityInfo)
+
+	//без маршрута сообщение даже не ставится в очередь
+	a.Alert(SeverityInfo, "skip", "")
+	for i := 0; i < 3; i++ {
+		a.Alert(SeverityError, "x", "")
+	}
+
+	if got := len(a.queue); got != 2 {
+		t.Errorf("queue %d, want 2", got)
+	}
+	if a.dropped != 1 {
+		t.Errorf("dropped %d, want 1", a.dropped)
+	}
+	a.reportDropped()
+	if a.dropped != 0 {
+		t.Errorf("dropped %d after report, want 0", a.dropped)
+	}
+}
+
+func TestStopFlushesQueue(t *testing.T) {
+
+	a, sink, _ := newTestAlerter(t, nil)
+
+	a.Alert(SeverityError, "a", "")
+	a.Alert(SeverityError, "a", "")
+	a.Alert(SeverityCritical, "b", "")
+	a.Run(context.Background())
+	a.Stop(time.Second)
+
+	sent := sink.sent()
+	if len(sent) != 3 {
+		t.Fatalf("sent %+v, want two alerts and the repeats summary", sent)
+	}
+	if sent[2].Text != "a" || sent[2].Repeats != 1 {
+		t.Errorf("summary %+v", sent[2])
+	}
+}
+
+func TestFormat(t *testing.T) {
+
+	a := Alert{Severity: SeverityError, Text: "db down", RequestID: "req", Repeats: 3,
+		Time: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)}
+	got := Format(a, 2)
+
+	for _, want := range []string{"повторилось еще 3 раз", "error [2021-01-01T12:00:00]: db down", "(request_id req)",
+		"пропущено сообщений из-за ограничения частоты: 2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q has no %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	SinkTelegram = "telegram"
+	SinkEmail    = "email"
+	SinkWebhook  = "webhook"
+
+	sendTimeout = 10 * time.Second
+)
+
+// Sink - канал оповещений, suppressed - сколько сообщений перед этим не отправлено из-за ограничения частоты
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, alert Alert, suppressed int) error
+}
+
+// Sender - отправка по адресу, так устроены каналы уведомлений пользователей (email, telegram)
+type Sender interface {
+	Send(address, title, body string) error
+}
+
+// senderSink отправляет оповещение на каждый адрес через Sender
+type senderSink struct {
+	name    string
+	sender  Sender
+	address []string
+}
+
+func (s *senderSink) Name() string {
+	return s.name
+}
+
+func (s *senderSink) Send(_ context.Context, alert Alert, suppressed int) error {
+
+	title := "Оповещение tarasova-school: " + alert.Severity
+	for _, address := range s.address {
+		if err := s.sender.Send(address, title, Format(alert, suppressed)); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("err with send to %s", address))
+		}
+	}
+
+	return nil
+}
+
+// webhookSink отправляет оповещение json-ом POST запросом
+type webhookSink struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (w *webhookSink) Name() string {
+	return w.name
+}
+
+func (w *webhookSink) Send(ctx context.Context, alert Alert, suppressed int) error {
+
+	body, err := json.Marshal(struct {
+		Alert
+		Suppressed int    `json:"suppressed,omitempty"`
+		Message    string `json:"message"`
+	}{Alert: alert, Suppressed: suppressed, Message: Format(alert, suppressed)})
+	if err != nil {
+		return errors.Wrap(err, "err with Marshal")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "err with NewRequest")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "err with Do")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook status code is %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func newSink(name string, cnf config.AlertSink, senders map[string]Sender) (Sink, error) {
+
+	switch cnf.Type {
+	case SinkTelegram, SinkEmail:
+		sender, ok := senders[cnf.Type]
+		if !ok {
+			return nil, errors.Errorf("alert sink %s: %s is not configured", name, cnf.Type)
+		}
+		if len(cnf.To) == 0 {
+			return nil, errors.Errorf("alert sink %s: empty to", name)
+		}
+		return &senderSink{name: name, sender: sender, address: cnf.To}, nil
+	case SinkWebhook:
+		if !strings.HasPrefix(cnf.URL, "http://") && !strings.HasPrefix(cnf.URL, "https://") {
+			return nil, errors.Errorf("alert sink %s: bad url %q", name, cnf.URL)
+		}
+		return &webhookSink{name: name, url: cnf.URL, client: &http.Client{Timeout: sendTimeout}}, nil
+	}
+
+	return nil, errors.Errorf("alert sink %s: unknown type %q", name, cnf.Type)
+}
@@ -1,32 +1,144 @@
 package infrastruct
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
 
+// CustomError - ошибка для клиента. key - стабильный код ошибки, по нему клиент отличает ошибки
+// и ищется перевод сообщения, msg - сообщение на русском, Code - http статус
 type CustomError struct {
-	msg  string
-	Code int
+	key    string
+	msg    string
+	detail string
+	cause  error
+	Code   int
 }
 
-func NewError(msg string, code int) *CustomError {
+func NewError(key, msg string, code int) *CustomError {
 	return &CustomError{
+		key:  key,
 		msg:  msg,
 		Code: code,
 	}
 }
 
 func (c *CustomError) Error() string {
-	return c.msg
+	return c.Message(DefaultLang)
+}
+
+// Key - код ошибки, например auth.password_incorrect
+func (c *CustomError) Key() string {
+	return c.key
+}
+
+// Message - сообщение на языке lang, если перевода нет - на русском
+func (c *CustomError) Message(lang string) string {
+	msg := c.msg
+	if translated, ok := messages[lang][c.key]; ok {
+		msg = translated
+	}
+	if c.detail != "" {
+		msg += ": " + c.detail
+	}
+	return msg
+}
+
+// WithDetail - та же ошибка с уточнением, которое не переводится, например причиной блокировки от админа
+func (c *CustomError) WithDetail(detail string) *CustomError {
+	e := *c
+	e.detail = detail
+	return &e
+}
+
+// Wrap - та же ошибка с причиной. Клиент причину не видит, apiErrorEncode пишет ее в лог
+func (c *CustomError) Wrap(cause error) *CustomError {
+	e := *c
+	e.cause = cause
+	return &e
+}
+
+func (c *CustomError) Unwrap() error {
+	return c.cause
+}
+
+// Is - ошибки с одним кодом равны, даже если у них разные причины и уточнения
+func (c *CustomError) Is(target error) bool {
+	t, ok := target.(*CustomError)
+	return ok && t.key == c.key
+}
+
+// RetryError - ошибка, после которой запрос можно повторить через RetryAfter, отдается с заголовком Retry-After
+type RetryError struct {
+	*CustomError
+	RetryAfter time.Duration
+}
+
+func NewRetryError(err *CustomError, retryAfter time.Duration) *RetryError {
+	return &RetryError{CustomError: err, RetryAfter: retryAfter}
+}
+
+// FieldError - ошибка в одном поле запроса, Field - имя поля как в json, Code - код проверки, например too_long
+type FieldError struct {
+	Field   string        `json:"field"`
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Params  []interface{} `json:"-"`
+}
+
+func NewFieldError(field, code string, params ...interface{}) FieldError {
+	f := FieldError{Field: field, Code: code, Params: params}
+	return f.Localize(DefaultLang)
+}
+
+// Localize - та же ошибка с сообщением на языке lang
+func (f FieldError) Localize(lang string) FieldError {
+	format, ok := messages[lang]["validation."+f.Code]
+	if !ok {
+		format = messages[DefaultLang]["validation."+f.Code]
+	}
+	f.Message = fmt.Sprintf(format, f.Params...)
+	return f
+}
+
+// ValidationError - запрос не прошел проверку, по Fields фронт подсвечивает поля
+type ValidationError struct {
+	*CustomError
+	Fields []FieldError
+}
+
+func NewValidationError(fields []FieldError) *ValidationError {
+	return &ValidationError{CustomError: ErrorValidation, Fields: fields}
 }
 
 var (
-	ErrorEmailIsExist        = NewError("email уже зарегистрирован", http.StatusBadRequest)
-	ErrorInternalServerError = NewError("внутренняя ошибка сервера", http.StatusInternalServerError)
-	ErrorBadRequest          = NewError("плохие входные данные запроса", http.StatusBadRequest)
-	ErrorJWTIsBroken         = NewError("jwt испорчен", http.StatusForbidden)
-	ErrorPermissionDenied    = NewError("у вас недостаточно прав", http.StatusForbidden)
-	ErrorPasswordIsIncorrect = NewError("неверный пароль", http.StatusForbidden)
-	ErrorPasswordsDoNotMatch = NewError("пароли не совпадают", http.StatusBadRequest)
-	ErrorEmailNotFind        = NewError("Пользователь с таким Email не найден", http.StatusBadRequest)
-
-	ErrorNotFound = NewError("материалы не найдены", http.StatusNotFound)
+	ErrorEmailIsExist        = NewError("auth.email_exists", "email уже зарегистрирован", http.StatusBadRequest)
+	ErrorInternalServerError = NewError("internal", "внутренняя ошибка сервера", http.StatusInternalServerError)
+	ErrorValidation          = NewError("request.validation_failed", "некоторые поля заполнены неверно", http.StatusBadRequest)
+	ErrorBadRequest          = NewError("request.invalid", "плохие входные данные запроса", http.StatusBadRequest)
+	ErrorJWTIsBroken         = NewError("auth.token_invalid", "jwt испорчен", http.StatusForbidden)
+	ErrorPermissionDenied    = NewError("auth.permission_denied", "у вас недостаточно прав", http.StatusForbidden)
+	ErrorPasswordIsIncorrect = NewError("auth.password_incorrect", "неверный пароль", http.StatusForbidden)
+	ErrorPasswordsDoNotMatch = NewError("auth.passwords_mismatch", "пароли не совпадают", http.StatusBadRequest)
+	ErrorEmailNotFind        = NewError("auth.email_not_found", "Пользователь с таким Email не найден", http.StatusBadRequest)
+	ErrorEmailNotVerified    = NewError("auth.email_not_verified", "email не подтвержден", http.StatusForbidden)
+	ErrorVerifyTokenInvalid  = NewError("auth.verify_token_invalid", "ссылка для подтверждения недействительна или устарела", http.StatusBadRequest)
+	ErrorRecoveryCodeInvalid = NewError("auth.recovery_code_invalid", "код восстановления неверный или устарел", http.StatusBadRequest)
+	ErrorOAuthStateInvalid   = NewError("oauth.state_invalid", "сессия входа через соцсеть устарела, попробуйте еще раз", http.StatusBadRequest)
+	ErrorOAuthAccountExists  = NewError("oauth.account_exists", "аккаунт с таким email уже есть, войдите по паролю и привяжите соцсеть в профиле", http.StatusConflict)
+	ErrorOAuthIdentityLinked = NewError("oauth.identity_linked", "эта соцсеть уже привязана к другому аккаунту", http.StatusConflict)
+	ErrorOAuthLastMethod     = NewError("oauth.last_login_method", "это единственный способ входа, сначала задайте пароль через восстановление", http.StatusConflict)
+	ErrorTwoFactorInvalid    = NewError("auth.two_factor_invalid", "неверный код подтверждения", http.StatusForbidden)
+	ErrorTwoFactorRequired   = NewError("auth.two_factor_required", "для этого действия нужно подтвердить вход кодом 2FA", http.StatusForbidden)
+	ErrorRoleIsExist         = NewError("roles.exists", "роль с таким именем уже есть", http.StatusConflict)
+	ErrorRoleInUse           = NewError("roles.in_use", "роль нельзя удалить, она назначена пользователям", http.StatusConflict)
+	ErrorUserSuspended       = NewError("auth.user_suspended", "аккаунт заблокирован", http.StatusForbidden)
+	ErrorTooManyRequests     = NewError("request.rate_limited", "слишком много запросов, попробуйте позже", http.StatusTooManyRequests)
+	ErrorLoginLocked         = NewError("auth.login_locked", "слишком много неудачных попыток входа, попробуйте позже", http.StatusTooManyRequests)
+	ErrorTelegramNotLinked   = NewError("notifications.telegram_not_linked", "сначала подключите телеграм по ссылке из профиля", http.StatusBadRequest)
+	ErrorTwoFactorLocked     = NewError("auth.two_factor_locked", "слишком много неверных кодов 2FA, попробуйте позже", http.StatusTooManyRequests)
+
+	ErrorNotFound        = NewError("content.not_found", "материалы не найдены", http.StatusNotFound)
+	ErrorVersionConflict = NewError("content.version_conflict", "материалы уже изменили, обновите страницу и попробуйте снова", http.StatusConflict)
 )
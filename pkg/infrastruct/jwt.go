@@ -3,13 +3,17 @@ package infrastruct
 import (
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/tarasova-school/internal/types"
 	"net/http"
+	"time"
 )
 
 type CustomClaims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
+	UserID  int    `json:"user_id"`
+	Role    string `json:"role"`
+	Version int    `json:"ver,omitempty"` //token_version пользователя, после сброса пароля старые токены не проходят
+	//ImpersonatorID - id админа, который вошел от имени пользователя. Такие токены всегда ограничены по времени
+	ImpersonatorID int   `json:"imp,omitempty"`
+	ExpiresAt      int64 `json:"exp,omitempty"`
 }
 
 func ValidateJwt(tokenString string, key string) (*jwt.Token, error) {
@@ -35,18 +39,27 @@ func (c CustomClaims) Valid() error {
 		return ErrorJWTIsBroken
 	}
 
-	if c.Role != types.RoleStudent && c.Role != types.RoleAdmin && c.Role != types.RoleTeacher {
+	//роли хранятся в базе, права роли проверяет CheckPermission
+	if c.Role == "" {
+		return ErrorJWTIsBroken
+	}
+
+	if c.ImpersonatorID != 0 && c.ExpiresAt == 0 {
+		return ErrorJWTIsBroken
+	}
+	if c.ExpiresAt != 0 && time.Now().Unix() > c.ExpiresAt {
 		return ErrorJWTIsBroken
 	}
 
 	return nil
 }
 
-func GenerateJWT(userID int, role, secretKey string) (string, error) {
+func GenerateJWT(userID int, role string, version int, secretKey string) (string, error) {
 
 	claims := CustomClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:  userID,
+		Role:    role,
+		Version: version,
 	}
 
 	tokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -59,6 +72,27 @@ func GenerateJWT(userID int, role, secretKey string) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateImpersonationJWT - токен пользователя userID, выданный админу impersonatorID на время ttl
+func GenerateImpersonationJWT(userID int, role string, version, impersonatorID int, secretKey string,
+	ttl time.Duration) (string, time.Time, error) {
+
+	expiresAt := time.Now().Add(ttl)
+	claims := CustomClaims{
+		UserID:         userID,
+		Role:           role,
+		Version:        version,
+		ImpersonatorID: impersonatorID,
+		ExpiresAt:      expiresAt.Unix(),
+	}
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
 func GetClaimsByRequest(r *http.Request, secretKeyJWT string) (*CustomClaims, error) {
 	tokenString := r.Header.Get("X-api-token")
 	if len(tokenString) == 0 {
@@ -78,3 +112,67 @@ func GetClaimsByRequest(r *http.Request, secretKeyJWT string) (*CustomClaims, er
 
 	return nil, ErrorJWTIsBroken
 }
+
+const (
+	PurposeVerifyEmail = "verify_email"
+	PurposeTwoFactor   = "two_factor"
+	PurposeStepUp      = "step_up"
+)
+
+// PurposeClaims - короткоживущий токен под одно действие (подтверждение email, второй фактор), авторизоваться им нельзя
+type PurposeClaims struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+func (c PurposeClaims) Valid() error {
+
+	if c.UserID == 0 || c.Purpose == "" {
+		return ErrorJWTIsBroken
+	}
+
+	return c.StandardClaims.Valid()
+}
+
+func GeneratePurposeToken(purpose string, userID int, email, secretKey string, ttl time.Duration) (string, error) {
+	return GenerateOneTimeToken(purpose, userID, email, "", secretKey, ttl)
+}
+
+// GenerateOneTimeToken - токен с id, который сервер хранит и гасит после использования, см. challenge 2FA
+func GenerateOneTimeToken(purpose string, userID int, email, id, secretKey string, ttl time.Duration) (string, error) {
+
+	claims := PurposeClaims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+}
+
+// ParsePurposeToken проверяет подпись, срок и назначение токена
+func ParsePurposeToken(tokenString, purpose, secretKey string) (*PurposeClaims, error) {
+
+	token, err := jwt.ParseWithClaims(tokenString, &PurposeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("неизвестный метод подписи: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrorJWTIsBroken
+	}
+
+	claims, ok := token.Claims.(*PurposeClaims)
+	if !ok || claims.Purpose != purpose {
+		return nil, ErrorJWTIsBroken
+	}
+
+	return claims, nil
+}
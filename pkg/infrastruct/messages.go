@@ -0,0 +1,100 @@
+package infrastruct
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	LangRU = "ru"
+	LangEN = "en"
+
+	// DefaultLang - язык ответа, если клиент не прислал Accept-Language с поддерживаемым языком
+	DefaultLang = LangRU
+)
+
+// messages - переводы по коду ошибки. Русские сообщения ошибок задаются в NewError,
+// здесь по-русски только шаблоны проверки полей
+var messages = map[string]map[string]string{
+	LangRU: {
+		"validation.required":      "обязательное поле",
+		"validation.too_short":     "не короче %d символов",
+		"validation.too_long":      "не длиннее %d символов",
+		"validation.too_few":       "не меньше %d элементов",
+		"validation.too_many":      "не больше %d элементов",
+		"validation.too_small":     "не меньше %d",
+		"validation.too_large":     "не больше %d",
+		"validation.invalid_email": "некорректный email",
+		"validation.not_allowed":   "допустимые значения: %s",
+	},
+	LangEN: {
+		"auth.email_exists":                 "email is already registered",
+		"internal":                          "internal server error",
+		"request.validation_failed":         "some fields are invalid",
+		"request.invalid":                   "bad request data",
+		"auth.token_invalid":                "token is invalid",
+		"auth.permission_denied":            "you do not have enough permissions",
+		"auth.password_incorrect":           "incorrect password",
+		"auth.passwords_mismatch":           "passwords do not match",
+		"auth.email_not_found":              "no user with this email",
+		"auth.email_not_verified":           "email is not verified",
+		"auth.verify_token_invalid":         "verification link is invalid or expired",
+		"auth.recovery_code_invalid":        "recovery code is invalid or expired",
+		"oauth.state_invalid":               "social login session expired, please try again",
+		"oauth.account_exists":              "an account with this email already exists, sign in with password and link the social account in your profile",
+		"oauth.identity_linked":             "this social account is already linked to another user",
+		"oauth.last_login_method":           "this is your only way to sign in, set a password via recovery first",
+		"auth.two_factor_invalid":           "invalid confirmation code",
+		"auth.two_factor_required":          "confirm sign in with a 2FA code to do this",
+		"roles.exists":                      "a role with this name already exists",
+		"roles.in_use":                      "the role is assigned to users and cannot be deleted",
+		"auth.user_suspended":               "account is suspended",
+		"request.rate_limited":              "too many requests, try again later",
+		"auth.login_locked":                 "too many failed sign in attempts, try again later",
+		"auth.two_factor_locked":            "too many invalid 2FA codes, try again later",
+		"notifications.telegram_not_linked": "connect telegram with the link from your profile first",
+		"content.not_found":                 "content not found",
+		"content.version_conflict":          "content was changed by someone else, reload the page and try again",
+
+		"validation.required":      "required field",
+		"validation.too_short":     "at least %d characters",
+		"validation.too_long":      "at most %d characters",
+		"validation.too_few":       "at least %d items",
+		"validation.too_many":      "at most %d items",
+		"validation.too_small":     "at least %d",
+		"validation.too_large":     "at most %d",
+		"validation.invalid_email": "invalid email",
+		"validation.not_allowed":   "allowed values: %s",
+	},
+}
+
+// Lang выбирает язык ответа по заголовку Accept-Language, например "en-US,en;q=0.9,ru;q=0.8"
+func Lang(acceptLanguage string) string {
+
+	best, bestQ := DefaultLang, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if i := strings.Index(tag, "-"); i != -1 {
+			tag = tag[:i]
+		}
+		if _, ok := messages[tag]; !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+
+	return best
+}
@@ -1,43 +1,24 @@
 package logger
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"github.com/rs/zerolog"
-	"github.com/tarasova-school/internal/types/config"
-	"net/http"
+	"github.com/tarasova-school/pkg/alert"
 	"os"
-	"strings"
 	"time"
 )
 
-var (
-	chatID    = ""
-	channelID = ""
-	infoMsg   = "INFO"
-	errMsg    = "ERROR"
-	token     = ""
-)
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 
-func NewLogger(t *config.Telegram) error {
+// alertFlushTimeout - сколько LogFatal ждет отправки оповещений перед выходом
+const alertFlushTimeout = 5 * time.Second
 
-	chatID = t.ChatID
-	channelID = t.ChannelID
-	token = t.TelegramToken
+var alerter *alert.Alerter
 
-	return nil
-}
-
-var logger = zerolog.New(os.Stdout)
-var Debug = true
-
-func CheckDebug() {
-	if Debug {
-		infoMsg += "-DEBUG"
-		errMsg += "-DEBUG"
-	} else {
-		chatID = channelID
-	}
+// SetAlerter включает оповещения, до вызова ошибки пишутся только в лог
+func SetAlerter(a *alert.Alerter) {
+	alerter = a
 }
 
 func LogError(err error) {
@@ -51,59 +32,88 @@ func LogInfo(msg string) {
 	SendMessage(msg)
 }
 
-func LogFatal(err error) {
+type requestKey struct{}
+
+// request - данные запроса, которые попадают во все записи лога этого запроса
+type request struct {
+	id     string
+	logger zerolog.Logger
+}
+
+// NewContext кладет в ctx логгер запроса с request_id и user_id, если пользователь авторизован
+func NewContext(ctx context.Context, requestID string, userID int) context.Context {
 
-	if unwrap := errors.Unwrap(err); unwrap != nil {
-		err = unwrap
+	l := logger.With().Str("request_id", requestID)
+	if userID != 0 {
+		l = l.Int("user_id", userID)
 	}
 
-	SendError(err)
-	logger.Fatal().Err(err).Send()
+	return context.WithValue(ctx, requestKey{}, &request{id: requestID, logger: l.Logger()})
 }
-func SendError(err error) {
 
-	if unwrap := errors.Unwrap(err); unwrap != nil {
-		err = unwrap
+// Detach - контекст для фоновой работы после ответа: логгер запроса сохраняется, отмена запроса на него не влияет
+func Detach(ctx context.Context) context.Context {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		return context.WithValue(context.Background(), requestKey{}, req)
 	}
+	return context.Background()
+}
 
-	url := makeURLSendMessage(errMsg, err.Error())
-	if err := send(url); err != nil {
-		logger.Err(err).Send()
+func RequestID(ctx context.Context) string {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		return req.id
 	}
+	return ""
 }
 
-func SendMessage(msg string) {
-	url := makeURLSendMessage(infoMsg, msg)
-	if err := send(url); err != nil {
-		logger.Err(err).Send()
+// FromContext - логгер запроса, вне запроса общий логгер
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if req, ok := ctx.Value(requestKey{}).(*request); ok {
+		return &req.logger
 	}
+	return &logger
 }
 
-func makeURLSendMessage(typeMsg, text string) string {
+func LogErrorCtx(ctx context.Context, err error) {
+	FromContext(ctx).Err(err).Send()
+	sendAlert(alert.SeverityError, unwrap(err).Error(), RequestID(ctx))
+}
 
-	text = fmt.Sprintf("%s [%s]: %s", typeMsg, time.Now().Format("2006-01-02T15:04:05"), text)
-	str := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s&text=%s",
-		token, chatID, text)
-	return strings.ReplaceAll(str, " ", "+")
+func LogInfoCtx(ctx context.Context, msg string) {
+	FromContext(ctx).Info().Msg(msg)
+	sendAlert(alert.SeverityInfo, msg, RequestID(ctx))
 }
 
-func send(urlForSend string) error {
-	req, err := http.NewRequest(http.MethodPost, urlForSend, nil)
-	if err != nil {
-		return err
+// LogFatal отправляет критическое оповещение, ждет отправки очереди и завершает процесс
+func LogFatal(err error) {
+
+	err = unwrap(err)
+	sendAlert(alert.SeverityCritical, err.Error(), "")
+	if alerter != nil {
+		alerter.Stop(alertFlushTimeout)
 	}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	logger.Fatal().Err(err).Send()
+}
+
+// SendError - оповещение об ошибке без записи в лог
+func SendError(err error) {
+	sendAlert(alert.SeverityError, unwrap(err).Error(), "")
+}
+
+// SendMessage - информационное оповещение без записи в лог
+func SendMessage(msg string) {
+	sendAlert(alert.SeverityInfo, msg, "")
+}
+
+func sendAlert(severity, text, requestID string) {
+	if alerter != nil {
+		alerter.Alert(severity, text, requestID)
 	}
+}
 
-	defer func() {
-		if err = res.Body.Close(); err != nil {
-			logger.Err(err)
-		}
-	}()
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("status code is %d", res.StatusCode)
+func unwrap(err error) error {
+	if unwrapped := errors.Unwrap(err); unwrapped != nil {
+		return unwrapped
 	}
-	return nil
+	return err
 }
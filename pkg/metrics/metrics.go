@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets - границы гистограмм длительности в секундах
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector пишет свои метрики в текстовом формате Prometheus
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry - набор метрик, каждое имя встречается в выдаче один раз
+type Registry struct {
+	mu         sync.Mutex
+	names      []string
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// defaultRegistry - метрики уровня пакета: счетчики и гистограммы, объявленные глобальными переменными
+var defaultRegistry = NewRegistry()
+
+// register повторно с тем же именем заменяет прежнюю метрику, а не дублирует ее
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.collectors[name] = c
+}
+
+// write пишет метрики реестра, кроме уже выведенных имен из written
+func (r *Registry) write(w *bufio.Writer, written map[string]bool) {
+
+	r.mu.Lock()
+	list := make([]collector, 0, len(r.names))
+	for _, name := range r.names {
+		if !written[name] {
+			written[name] = true
+			list = append(list, r.collectors[name])
+		}
+	}
+	r.mu.Unlock()
+
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// Handler отдает метрики пакета и метрики переданных реестров, nil реестры пропускаются
+func Handler(registries ...*Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		buf := bufio.NewWriter(w)
+		written := make(map[string]bool)
+		defaultRegistry.write(buf, written)
+		for _, registry := range registries {
+			if registry != nil {
+				registry.write(buf, written)
+			}
+		}
+		_ = buf.Flush()
+	})
+}
+
+// CounterVec - счетчик с метками, значения меток передаются в порядке labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*counterValue)}
+	defaultRegistry.register(name, c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+
+	key := strings.Join(labelValues, "\x00")
+	c.mu.Lock()
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labels: labelValues}
+		c.values[key] = value
+	}
+	value.value += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	//счетчик без меток виден с нуля, еще до первого события
+	if len(keys) == 0 && len(c.labels) == 0 {
+		writeSample(w, c.name, nil, nil, "", "", 0)
+	}
+	for _, key := range keys {
+		value := c.values[key]
+		writeSample(w, c.name, c.labels, value.labels, "", "", value.value)
+	}
+}
+
+// HistogramVec - гистограмма с метками
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+	defaultRegistry.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+
+	key := strings.Join(labelValues, "\x00")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{labels: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := h.values[key]
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, value.labels, "le", formatFloat(bound), float64(value.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, value.labels, "le", "+Inf", float64(value.count))
+		writeSample(w, h.name+"_sum", h.labels, value.labels, "", "", value.sum)
+		writeSample(w, h.name+"_count", h.labels, value.labels, "", "", float64(value.count))
+	}
+}
+
+// GaugeFunc - значение считается при каждом запросе метрик
+type GaugeFunc struct {
+	name string
+	help string
+	kind string
+	fn   func() (float64, bool)
+}
+
+// NewGaugeFunc регистрирует gauge в реестре, fn возвращает false, если значение сейчас получить не удалось
+func (r *Registry) NewGaugeFunc(name, help string, fn func() (float64, bool)) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, kind: "gauge", fn: fn}
+	r.register(name, g)
+	return g
+}
+
+// NewCounterFunc - то же для счетчиков, которые ведет кто-то другой, например database/sql
+func (r *Registry) NewCounterFunc(name, help string, fn func() (float64, bool)) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, kind: "counter", fn: fn}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	value, ok := g.fn()
+	if !ok {
+		return
+	}
+	writeHeader(w, g.name, g.help, g.kind)
+	writeSample(w, g.name, nil, nil, "", "", value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		if i < len(values) {
+			pairs = append(pairs, label+"="+quoteLabel(values[i]))
+		}
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+"="+quoteLabel(extraValue))
+	}
+
+	w.WriteString(name)
+	if len(pairs) != 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
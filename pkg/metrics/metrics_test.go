@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func output(c collector) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	c.write(w)
+	_ = w.Flush()
+	return buf.String()
+}
+
+func TestCounterVec(t *testing.T) {
+
+	c := &CounterVec{name: "test_requests_total", help: "Запросы\nпо роутам", labels: []string{"method", "route"},
+		values: make(map[string]*counterValue)}
+	c.Inc("GET", "/b")
+	c.Add(2.5, "GET", "/a")
+	c.Inc("GET", "/a")
+
+	want := "# HELP test_requests_total Запросы\\nпо роутам\n" +
+		"# TYPE test_requests_total counter\n" +
+		"test_requests_total{method=\"GET\",route=\"/a\"} 3.5\n" +
+		"test_requests_total{method=\"GET\",route=\"/b\"} 1\n"
+	if got := output(c); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterWithoutLabelsStartsAtZero(t *testing.T) {
+
+	c := &CounterVec{name: "test_events_total", help: "События", values: make(map[string]*counterValue)}
+	if got := output(c); !strings.HasSuffix(got, "\ntest_events_total 0\n") {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+
+	c := &CounterVec{name: "test_total", help: "h", labels: []string{"path"}, values: make(map[string]*counterValue)}
+	c.Inc("a\\b\"c\nd")
+
+	want := `test_total{path="a\\b\"c\nd"} 1` + "\n"
+	if got := output(c); !strings.HasSuffix(got, want) {
+		t.Errorf("got\n%s\nwant suffix\n%s", got, want)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+
+	h := &HistogramVec{name: "test_duration_seconds", help: "h", labels: []string{"route"},
+		buckets: []float64{.1, 1}, values: make(map[string]*histogramValue)}
+	h.Observe(.05, "/a")
+	h.Observe(.1, "/a")
+	h.Observe(.5, "/a")
+	h.Observe(3, "/a")
+
+	want := "# HELP test_duration_seconds h\n" +
+		"# TYPE test_duration_seconds histogram\n" +
+		"test_duration_seconds_bucket{route=\"/a\",le=\"0.1\"} 2\n" +
+		"test_duration_seconds_bucket{route=\"/a\",le=\"1\"} 3\n" +
+		"test_duration_seconds_bucket{route=\"/a\",le=\"+Inf\"} 4\n" +
+		"test_duration_seconds_sum{route=\"/a\"} 3.65\n" +
+		"test_duration_seconds_count{route=\"/a\"} 4\n"
+	if got := output(h); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeFuncSkippedWithoutValue(t *testing.T) {
+
+	r := NewRegistry()
+	r.NewGaugeFunc("test_up", "h", func() (float64, bool) { return 0, false })
+	r.NewGaugeFunc("test_connections", "h", func() (float64, bool) { return 3, true })
+
+	rec := httptest.NewRecorder()
+	Handler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); strings.Contains(body, "test_up") || !strings.Contains(body, "test_connections 3\n") {
+		t.Errorf("got\n%s", body)
+	}
+}
+
+// TestRegistrationIdempotent - повторная регистрация и второй реестр с теми же именами не дублируют семейства
+func TestRegistrationIdempotent(t *testing.T) {
+
+	first, second := NewRegistry(), NewRegistry()
+	first.NewGaugeFunc("test_open_connections", "h", func() (float64, bool) { return 1, true })
+	first.NewGaugeFunc("test_open_connections", "h", func() (float64, bool) { return 2, true })
+	second.NewGaugeFunc("test_open_connections", "h", func() (float64, bool) { return 3, true })
+
+	rec := httptest.NewRecorder()
+	Handler(first, nil, second).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if n := strings.Count(body, "# TYPE test_open_connections gauge\n"); n != 1 {
+		t.Errorf("%d TYPE lines in\n%s", n, body)
+	}
+	if !strings.Contains(body, "test_open_connections 2\n") {
+		t.Errorf("latest registration is not served\n%s", body)
+	}
+}
@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateResponse сверяет json ответ операции со схемой из документа. Проверяются типы, обязательные поля,
+// enum и null, ограничения длины не проверяются - они описывают входные данные
+func (d *Document) ValidateResponse(method, path string, status int, body []byte) error {
+
+	op := d.Operation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s: operation is not described", method, path)
+	}
+	resp, ok := op.Responses[Status(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not described", method, path, status)
+	}
+	media, ok := resp.Content["application/json"]
+	if !ok || media.Schema == nil {
+		if len(strings.TrimSpace(string(body))) == 0 {
+			return nil
+		}
+		return fmt.Errorf("%s %s: status %d must have no json body", method, path, status)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s %s: bad json: %v", method, path, err)
+	}
+
+	return d.check("$", media.Schema, value)
+}
+
+func (d *Document) check(at string, s *Schema, value interface{}) error {
+
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		ref, ok := d.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, name)
+		}
+		s = ref
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch(at, s.Type, value)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+		if s.Type == "integer" && n != float64(int64(n)) {
+			return mismatch(at, s.Type, value)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+		if len(s.Enum) != 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %s", at, str, strings.Join(s.Enum, ", "))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+		for i, item := range items {
+			if err := d.check(fmt.Sprintf("%s[%d]", at, i), s.Items, item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(at, s.Type, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: required field %s is missing", at, name)
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				return fmt.Errorf("%s: field %s is not described", at, key)
+			}
+			if err := d.check(at+"."+key, property, object[key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func mismatch(at, want string, value interface{}) error {
+	return fmt.Errorf("%s: want %s, got %T", at, want, value)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/tarasova-school/pkg/validate"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+// Document - OpenAPI 3 документ, описано только то, что использует этот API
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem - операции пути по http методу в нижнем регистре
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	//Permission - право роли, без которого маршрут отвечает 403
+	Permission string `json:"x-permission,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// pathParamRegexp - параметр в шаблоне пути gorilla/mux: {idCourse:[0-9]+} или {provider}
+var pathParamRegexp = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// Path - путь в openapi из шаблона gorilla/mux, регулярные выражения параметров убираются
+func Path(template string) string {
+	return pathParamRegexp.ReplaceAllString(template, "{$1}")
+}
+
+// PathParameters - параметры пути из шаблона gorilla/mux, [0-9]+ описывается как integer
+func PathParameters(template string) []Parameter {
+
+	params := make([]Parameter, 0)
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(template, -1) {
+		schema := &Schema{Type: "string"}
+		switch match[2] {
+		case "":
+		case "[0-9]+":
+			schema = &Schema{Type: "integer"}
+		default:
+			schema.Pattern = "^" + match[2] + "$"
+		}
+		params = append(params, Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+
+	return params
+}
+
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+}
+
+// Add добавляет операцию, путь - в формате openapi, см. Path
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Operation - операция по методу и пути в формате openapi
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[path][strings.ToLower(method)]
+}
+
+// SchemaOf - схема для значения v. Именованные структуры попадают в components.schemas и подставляются ссылкой,
+// ограничения полей берутся из тегов validate
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return d.schema(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schema(t reflect.Type) *Schema {
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := d.schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		//nil slice кодируется в null
+		return &Schema{Type: "array", Items: d.schema(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem()), Nullable: true}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		name := t.Name()
+		if _, ok := d.Components.Schemas[name]; !ok {
+			//заглушка до построения, чтобы рекурсивные типы не зацикливались
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	panic(fmt.Sprintf("openapi: unsupported type %s", t))
+}
+
+func (d *Document) object(t reflect.Type) *Schema {
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		//встроенная структура без json имени разворачивается в поля родителя, как в encoding/json
+		if field.Anonymous && name == "" {
+			embedded := d.object(indirect(field.Type))
+			for key, value := range embedded.Properties {
+				s.Properties[key] = value
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schema(field.Type)
+		if tag := field.Tag.Get("validate"); tag != "" {
+			rules, err := validate.Parse(tag)
+			if err != nil {
+				panic(fmt.Sprintf("openapi: %s.%s: %v", t.Name(), field.Name, err))
+			}
+			//поле с omitempty может не прийти в ответе, поэтому обязательным не описывается
+			if constrain(property, rules) && !strings.Contains(field.Tag.Get("json"), ",omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = property
+	}
+	sort.Strings(s.Required)
+
+	return s
+}
+
+// constrain переносит правила validate в схему поля, возвращает true, если поле обязательное
+func constrain(s *Schema, rules []validate.Rule) bool {
+
+	required := false
+	for _, rule := range rules {
+		n := rule.N
+		switch rule.Name {
+		case "required":
+			required = true
+			switch s.Type {
+			case "string":
+				one := 1
+				s.MinLength = &one
+			case "array":
+				one := 1
+				s.MinItems = &one
+			}
+		case "min", "max":
+			switch {
+			case s.Type == "string" && rule.Name == "min":
+				s.MinLength = &n
+			case s.Type == "string":
+				s.MaxLength = &n
+			case s.Type == "array" && rule.Name == "min":
+				s.MinItems = &n
+			case s.Type == "array":
+				s.MaxItems = &n
+			case rule.Name == "min":
+				s.Minimum = &n
+			default:
+				s.Maximum = &n
+			}
+		case "email":
+			s.Format = "email"
+		case "oneof":
+			s.Enum = strings.Split(rule.Arg, "|")
+		case "dive":
+			if s.Items != nil && s.Items.Ref == "" {
+				constrain(s.Items, rule.Items)
+			}
+		}
+	}
+
+	return required
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+
+	tag := field.Tag.Get("json")
+	if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+		return "", true
+	}
+
+	return strings.Split(tag, ",")[0], false
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Status - код ответа строкой, как в responses
+func Status(code int) string {
+	return strconv.Itoa(code)
+}
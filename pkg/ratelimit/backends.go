@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cleanupInterval - как часто удалять корзины, которые давно наполнились и не используются
+const cleanupInterval = 10 * time.Minute
+
+// Memory - корзины в памяти процесса, у каждого инстанса свои лимиты
+type Memory struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), lastCleanup: time.Now()}
+}
+
+func (m *Memory) Take(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastCleanup) > cleanupInterval {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastCleanup = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.updated, now, rate, burst)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, waitFor(b.tokens, rate), nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+
+	return true, 0, nil
+}
+
+// Postgres - корзины в таблице rate_limits, лимиты общие для всех инстансов
+type Postgres struct {
+	store       Store
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewPostgres(store Store) *Postgres {
+	return &Postgres{store: store, lastCleanup: time.Now()}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+
+	now := time.Now()
+	p.mu.Lock()
+	cleanup := now.Sub(p.lastCleanup) > cleanupInterval
+	if cleanup {
+		p.lastCleanup = now
+	}
+	p.mu.Unlock()
+	//корзины, не тронутые сутки, точно полные, их можно удалить
+	if cleanup {
+		if err := p.store.DeleteRateLimitsBefore(ctx, now.Add(-24*time.Hour)); err != nil {
+			return false, 0, err
+		}
+	}
+
+	allowed, tokens, err := p.store.TakeRateLimitToken(ctx, key, rate, burst, now)
+	if err != nil || allowed {
+		return allowed, 0, err
+	}
+
+	return false, waitFor(tokens, rate), nil
+}
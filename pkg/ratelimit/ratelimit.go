@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tarasova-school/internal/types/config"
+	"math"
+	"time"
+)
+
+const (
+	ByIP    = "ip"
+	ByUser  = "user"
+	ByEmail = "email"
+
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+
+	PolicyAuth      = "auth"
+	PolicyTwoFactor = "auth_2fa"
+	PolicyRegister  = "register"
+	PolicyRecovery  = "recovery"
+	PolicyChat      = "chat"
+)
+
+// DefaultPolicies - политики, которые действуют, если их не переопределили в rate_limit.policies
+var DefaultPolicies = map[string][]config.RateLimitRule{
+	PolicyAuth: {
+		{By: ByIP, Requests: 30, Per: time.Minute, Burst: 30},
+		{By: ByEmail, Requests: 10, Per: time.Minute, Burst: 10},
+	},
+	PolicyTwoFactor: {
+		{By: ByIP, Requests: 10, Per: time.Minute, Burst: 10},
+	},
+	PolicyRegister: {
+		{By: ByIP, Requests: 10, Per: time.Hour, Burst: 5},
+	},
+	PolicyRecovery: {
+		{By: ByIP, Requests: 20, Per: time.Hour, Burst: 10},
+		{By: ByEmail, Requests: 10, Per: time.Hour, Burst: 5},
+	},
+	PolicyChat: {
+		{By: ByUser, Requests: 30, Per: time.Minute, Burst: 10},
+	},
+}
+
+// Backend хранит корзины токенов. Take забирает токен из корзины key и возвращает,
+// сколько ждать до следующего токена, если корзина пуста
+type Backend interface {
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// Keys - значения, по которым считаются лимиты запроса, пустые пропускаются
+type Keys map[string]string
+
+type Limiter struct {
+	backend  Backend
+	policies map[string][]config.RateLimitRule
+}
+
+// Store - хранилище для общего postgres backend
+type Store interface {
+	TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error)
+	DeleteRateLimitsBefore(ctx context.Context, before time.Time) error
+}
+
+func New(cnf *config.RateLimit, store Store) (*Limiter, error) {
+
+	if cnf == nil {
+		cnf = &config.RateLimit{}
+	}
+
+	policies := make(map[string][]config.RateLimitRule, len(DefaultPolicies))
+	for name, rules := range DefaultPolicies {
+		policies[name] = append([]config.RateLimitRule(nil), rules...)
+	}
+	for name, rules := range cnf.Policies {
+		policies[name] = append([]config.RateLimitRule(nil), rules...)
+	}
+	for name, rules := range policies {
+		for i := range rules {
+			if rules[i].Requests <= 0 || rules[i].Per <= 0 {
+				return nil, errors.Errorf("rate limit policy %s: requests and per must be positive", name)
+			}
+			if rules[i].Burst <= 0 {
+				rules[i].Burst = rules[i].Requests
+			}
+		}
+	}
+
+	var backend Backend
+	switch cnf.Backend {
+	case "", BackendMemory:
+		backend = NewMemory()
+	case BackendPostgres:
+		backend = NewPostgres(store)
+	default:
+		return nil, errors.Errorf("unknown rate limit backend %q", cnf.Backend)
+	}
+
+	return &Limiter{backend: backend, policies: policies}, nil
+}
+
+// Allow проверяет все правила политики. При отказе возвращает, через сколько можно повторить запрос
+func (l *Limiter) Allow(ctx context.Context, policy string, keys Keys) (bool, time.Duration, error) {
+
+	for _, rule := range l.policies[policy] {
+		value := keys[rule.By]
+		if value == "" {
+			continue
+		}
+
+		rate := float64(rule.Requests) / rule.Per.Seconds()
+		allowed, retryAfter, err := l.backend.Take(ctx, policy+":"+rule.By+":"+value, rate, rule.Burst)
+		if err != nil {
+			return false, 0, errors.Wrap(err, "err with Take")
+		}
+		if !allowed {
+			return false, retryAfter, nil
+		}
+	}
+
+	return true, 0, nil
+}
+
+// refill - сколько токенов в корзине к now, если в updated было tokens
+func refill(tokens float64, updated, now time.Time, rate float64, burst int) float64 {
+	return math.Min(float64(burst), tokens+now.Sub(updated).Seconds()*rate)
+}
+
+// waitFor - через сколько в корзине появится целый токен
+func waitFor(tokens, rate float64) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / rate * float64(time.Second)))
+}
@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/tarasova-school/internal/types/config"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+
+	tests := []struct {
+		name string
+		cnf  *config.RateLimit
+		ok   bool
+	}{
+		{name: "defaults", ok: true},
+		{name: "memory", cnf: &config.RateLimit{Backend: BackendMemory}, ok: true},
+		{name: "postgres", cnf: &config.RateLimit{Backend: BackendPostgres}, ok: true},
+		{name: "unknown backend", cnf: &config.RateLimit{Backend: "redis"}},
+		{name: "zero requests", cnf: &config.RateLimit{Policies: map[string][]config.RateLimitRule{
+			PolicyChat: {{By: ByUser, Per: time.Minute}}}}},
+		{name: "zero period", cnf: &config.RateLimit{Policies: map[string][]config.RateLimitRule{
+			PolicyChat: {{By: ByUser, Requests: 1}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cnf, nil); (err == nil) != tt.ok {
+				t.Errorf("err %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewKeepsDefaults(t *testing.T) {
+
+	cnf := &config.RateLimit{Policies: map[string][]config.RateLimitRule{
+		PolicyChat: {{By: ByUser, Requests: 2, Per: time.Minute}},
+	}}
+	l, err := New(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := l.policies[PolicyChat][0].Burst; got != 2 {
+		t.Errorf("burst %d, want requests when not set", got)
+	}
+	if len(l.policies[PolicyAuth]) != len(DefaultPolicies[PolicyAuth]) {
+		t.Error("default policy lost when another one is overridden")
+	}
+	if DefaultPolicies[PolicyChat][0].Requests != 30 {
+		t.Error("override changed DefaultPolicies")
+	}
+}
+
+func TestAllow(t *testing.T) {
+
+	cnf := &config.RateLimit{Policies: map[string][]config.RateLimitRule{
+		PolicyAuth: {
+			{By: ByIP, Requests: 3, Per: time.Hour, Burst: 3},
+			{By: ByEmail, Requests: 1, Per: time.Hour, Burst: 1},
+		},
+	}}
+	l, err := New(cnf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	allow := func(keys Keys) bool {
+		t.Helper()
+		ok, retryAfter, err := l.Allow(ctx, PolicyAuth, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok && retryAfter <= 0 {
+			t.Errorf("denied without retry after")
+		}
+		return ok
+	}
+
+	if !allow(Keys{ByIP: "1.1.1.1", ByEmail: "a@a.ru"}) {
+		t.Fatal("first request denied")
+	}
+	if allow(Keys{ByIP: "1.1.1.1", ByEmail: "a@a.ru"}) {
+		t.Error("second request for the same email allowed")
+	}
+	if !allow(Keys{ByIP: "1.1.1.1", ByEmail: "b@b.ru"}) {
+		t.Error("other email denied")
+	}
+	//пустой ключ пропускается, работает только лимит по ip
+	if allow(Keys{ByIP: "1.1.1.1", ByEmail: ""}) {
+		t.Error("ip limit is not applied")
+	}
+	if !allow(Keys{ByIP: "2.2.2.2"}) {
+		t.Error("other ip denied")
+	}
+	if ok, _, _ := l.Allow(ctx, "unknown", Keys{ByIP: "1.1.1.1"}); !ok {
+		t.Error("policy without rules denied")
+	}
+}
+
+func TestMemoryRefill(t *testing.T) {
+
+	m := NewMemory()
+	ctx := context.Background()
+	rate := 1.0 / 60
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := m.Take(ctx, "k", rate, 2); !ok {
+			t.Fatalf("request %d within burst denied", i)
+		}
+	}
+	ok, retryAfter, _ := m.Take(ctx, "k", rate, 2)
+	if ok {
+		t.Fatal("request over burst allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("retry after %s, want up to a minute", retryAfter)
+	}
+
+	//прошла минута - в корзине снова один токен
+	m.buckets["k"].updated = m.buckets["k"].updated.Add(-time.Minute)
+	if ok, _, _ = m.Take(ctx, "k", rate, 2); !ok {
+		t.Error("token is not refilled")
+	}
+}
+
+func TestRefill(t *testing.T) {
+
+	now := time.Now()
+	if got := refill(0, now.Add(-10*time.Second), now, 1, 5); got != 5 {
+		t.Errorf("refill %v, want capped at burst 5", got)
+	}
+	if got := refill(1, now.Add(-2*time.Second), now, 1, 5); got != 3 {
+		t.Errorf("refill %v, want 3", got)
+	}
+	if got := waitFor(0.5, 1); got != 500*time.Millisecond {
+		t.Errorf("wait %s, want 500ms", got)
+	}
+}
+
+type fakeStore struct {
+	tokens  float64
+	allowed bool
+	err     error
+	deleted int
+}
+
+func (s *fakeStore) TakeRateLimitToken(_ context.Context, _ string, _ float64, _ int, _ time.Time) (bool, float64, error) {
+	return s.allowed, s.tokens, s.err
+}
+
+func (s *fakeStore) DeleteRateLimitsBefore(_ context.Context, _ time.Time) error {
+	s.deleted++
+	return nil
+}
+
+func TestPostgres(t *testing.T) {
+
+	ctx := context.Background()
+	store := &fakeStore{allowed: true}
+	p := NewPostgres(store)
+
+	if ok, _, err := p.Take(ctx, "k", 1, 1); !ok || err != nil {
+		t.Errorf("got (%v, %v), want allowed", ok, err)
+	}
+
+	store.allowed, store.tokens = false, 0.25
+	if ok, retryAfter, _ := p.Take(ctx, "k", 1, 1); ok || retryAfter != 750*time.Millisecond {
+		t.Errorf("got (%v, %s), want denied for 750ms", ok, retryAfter)
+	}
+
+	store.err = errors.New("db is down")
+	if _, _, err := p.Take(ctx, "k", 1, 1); err == nil {
+		t.Error("store error is lost")
+	}
+
+	if store.deleted != 0 {
+		t.Error("cleanup before interval")
+	}
+	p.lastCleanup = time.Now().Add(-cleanupInterval - time.Second)
+	p.Take(ctx, "k", 1, 1)
+	if store.deleted != 1 {
+		t.Error("old buckets are not cleaned up")
+	}
+}
@@ -0,0 +1,111 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret - ключ "12345678901234567890" из приложения B RFC 6238 в base32
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeRFC6238 - векторы SHA1 из RFC 6238, у нас 6 цифр, поэтому сверяются последние 6 из 8
+func TestCodeRFC6238(t *testing.T) {
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-Digits:]; code != want {
+			t.Errorf("time %d: code %s, want %s", tt.unix, code, want)
+		}
+	}
+}
+
+func TestCodeNormalizesSecret(t *testing.T) {
+
+	want, err := Code(secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Code(" "+strings.ToLower(secret)+" ", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("code %s, want %s", got, want)
+	}
+
+	if _, err = Code("not base32!", 1); err == nil {
+		t.Error("bad secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	previous, err := Code(secret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		skew int64
+		ok   bool
+		step int64
+	}{
+		{name: "current", code: "050471", ok: true, step: step},
+		{name: "spaces", code: " 050471 ", ok: true, step: step},
+		{name: "previous within skew", code: previous, skew: 1, ok: true, step: step - 1},
+		{name: "previous without skew", code: previous},
+		{name: "wrong", code: "000000", skew: 1},
+		{name: "short", code: "05047", skew: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(secret, tt.code, now, tt.skew)
+			if ok != tt.ok || got != tt.step {
+				t.Errorf("got (%d, %v), want (%d, %v)", got, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+
+	s, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 20 {
+		t.Errorf("key length %d, want 20", len(key))
+	}
+}
+
+func TestURL(t *testing.T) {
+
+	got := URL("Школа", "anna@mail.ru", secret)
+	if !strings.HasPrefix(got, "otpauth://totp/") || !strings.Contains(got, "secret="+secret) ||
+		!strings.Contains(got, "digits=6") || !strings.Contains(got, "period=30") {
+		t.Errorf("unexpected url %s", got)
+	}
+}
@@ -0,0 +1,282 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/tarasova-school/pkg/infrastruct"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Правила в теге validate перечисляются через запятую, например `validate:"required,email,max=254"`:
+//
+//	required  - строка не пустая после обрезки пробелов, число не 0, список не пустой
+//	min=N     - длина строки в символах, значение числа или длина списка не меньше N
+//	max=N     - то же, не больше N
+//	email     - строка является email адресом
+//	oneof=a|b - строка одно из значений
+//	dive      - правила после dive проверяются для каждого элемента списка
+//
+// Пустые значения проверяет только required, остальные правила их пропускают
+const (
+	CodeRequired = "required"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeTooFew   = "too_few"
+	CodeTooMany  = "too_many"
+	CodeTooSmall = "too_small"
+	CodeTooLarge = "too_large"
+	CodeEmail    = "invalid_email"
+	CodeOneOf    = "not_allowed"
+)
+
+// Rule - одно правило из тега validate, Items - правила для элементов списка после dive
+type Rule struct {
+	Name  string
+	Arg   string
+	N     int
+	Items []Rule
+}
+
+type field struct {
+	index int
+	name  string
+	rules []Rule
+}
+
+// cache - разобранные теги по типам, теги читаются один раз
+var cache sync.Map
+
+// Struct проверяет структуру (или указатель на нее) по тегам validate.
+// Возвращает *infrastruct.ValidationError со всеми ошибками или nil
+func Struct(v interface{}) error {
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var problems []infrastruct.FieldError
+	for _, f := range fields(value.Type()) {
+		problems = check(problems, f.name, value.Field(f.index), f.rules)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return infrastruct.NewValidationError(problems)
+}
+
+// Field проверяет одно значение по правилам tag, для проверок, которые зависят от запроса,
+// например пароль обязателен только при регистрации учителя
+func Field(name string, value interface{}, tag string) error {
+
+	rules, err := Parse(tag)
+	if err != nil {
+		panic(fmt.Sprintf("validate: %s: %v", name, err))
+	}
+	if problems := check(nil, name, reflect.ValueOf(value), rules); len(problems) != 0 {
+		return infrastruct.NewValidationError(problems)
+	}
+
+	return nil
+}
+
+func fields(t reflect.Type) []field {
+
+	if cached, ok := cache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	list := make([]field, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || sf.PkgPath != "" {
+			continue
+		}
+		rules, err := Parse(tag)
+		if err != nil {
+			//ошибка в теге - ошибка в коде, ее видно при первом же запросе
+			panic(fmt.Sprintf("validate: %s.%s: %v", t.Name(), sf.Name, err))
+		}
+		list = append(list, field{index: i, name: jsonName(sf), rules: rules})
+	}
+	cache.Store(t, list)
+
+	return list
+}
+
+// Parse разбирает тег validate, им же openapi описывает ограничения полей
+func Parse(tag string) ([]Rule, error) {
+
+	parts := strings.Split(tag, ",")
+	rules := make([]Rule, 0, len(parts))
+	for i, part := range parts {
+		name, arg := part, ""
+		if eq := strings.Index(part, "="); eq != -1 {
+			name, arg = part[:eq], part[eq+1:]
+		}
+		r := Rule{Name: name, Arg: arg}
+		switch name {
+		case "required", "email":
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s argument %q", name, arg)
+			}
+			r.N = n
+		case "oneof":
+			if arg == "" {
+				return nil, fmt.Errorf("oneof without values")
+			}
+		case "dive":
+			items, err := Parse(strings.Join(parts[i+1:], ","))
+			if err != nil {
+				return nil, err
+			}
+			r.Items = items
+			return append(rules, r), nil
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+func check(problems []infrastruct.FieldError, name string, v reflect.Value, rules []Rule) []infrastruct.FieldError {
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+
+	for _, r := range rules {
+		if r.Name == "dive" {
+			if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+				for i := 0; i < v.Len(); i++ {
+					problems = check(problems, fmt.Sprintf("%s[%d]", name, i), v.Index(i), r.Items)
+				}
+			}
+			continue
+		}
+		if r.Name == "required" {
+			if empty(v) {
+				return append(problems, infrastruct.NewFieldError(name, CodeRequired))
+			}
+			continue
+		}
+		if empty(v) {
+			continue
+		}
+		if p, ok := apply(name, v, r); !ok {
+			//одной ошибки на поле достаточно, остальные правила не проверяем
+			return append(problems, p)
+		}
+	}
+
+	return problems
+}
+
+func apply(name string, v reflect.Value, r Rule) (infrastruct.FieldError, bool) {
+
+	switch r.Name {
+	case "min", "max":
+		size, kind := measure(v)
+		switch {
+		case r.Name == "min" && size < int64(r.N):
+			switch kind {
+			case "string":
+				return infrastruct.NewFieldError(name, CodeTooShort, r.N), false
+			case "slice":
+				return infrastruct.NewFieldError(name, CodeTooFew, r.N), false
+			}
+			return infrastruct.NewFieldError(name, CodeTooSmall, r.N), false
+		case r.Name == "max" && size > int64(r.N):
+			switch kind {
+			case "string":
+				return infrastruct.NewFieldError(name, CodeTooLong, r.N), false
+			case "slice":
+				return infrastruct.NewFieldError(name, CodeTooMany, r.N), false
+			}
+			return infrastruct.NewFieldError(name, CodeTooLarge, r.N), false
+		}
+	case "email":
+		if v.Kind() == reflect.String && !isEmail(v.String()) {
+			return infrastruct.NewFieldError(name, CodeEmail), false
+		}
+	case "oneof":
+		if v.Kind() == reflect.String {
+			allowed := strings.Split(r.Arg, "|")
+			for _, item := range allowed {
+				if v.String() == item {
+					return infrastruct.FieldError{}, true
+				}
+			}
+			return infrastruct.NewFieldError(name, CodeOneOf, strings.Join(allowed, ", ")), false
+		}
+	}
+
+	return infrastruct.FieldError{}, true
+}
+
+// measure - длина строки в символах, значение числа или длина списка
+func measure(v reflect.Value) (int64, string) {
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(v.String())), "string"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return int64(v.Len()), "slice"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), "number"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), "number"
+	}
+
+	return 0, ""
+}
+
+func empty(v reflect.Value) bool {
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
+
+// isEmail - адрес без имени и угловых скобок, как его вводят в форме
+func isEmail(value string) bool {
+	value = strings.TrimSpace(value)
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Name == "" && addr.Address == value && strings.Contains(value[strings.LastIndex(value, "@"):], ".")
+}
+
+func jsonName(sf reflect.StructField) string {
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
@@ -0,0 +1,141 @@
+package validate
+
+import (
+	"github.com/tarasova-school/pkg/infrastruct"
+	"reflect"
+	"testing"
+)
+
+type sample struct {
+	Name    string   `json:"name" validate:"required,max=5"`
+	Email   string   `json:"email" validate:"email"`
+	Age     int      `json:"age" validate:"min=1,max=120"`
+	Role    string   `json:"role" validate:"oneof=student|teacher"`
+	Tags    []string `json:"tags" validate:"max=2,dive,required,min=2"`
+	Comment *string  `json:"comment" validate:"min=3"`
+	Count   *int     `json:"count" validate:"required,max=10"`
+	Skipped string   `json:"-" validate:"required"`
+}
+
+func valid() sample {
+	comment, count := "hello", 1
+	return sample{Name: "Анна", Email: "anna@mail.ru", Age: 30, Role: "student", Tags: []string{"go"},
+		Comment: &comment, Count: &count, Skipped: "x"}
+}
+
+func TestStruct(t *testing.T) {
+
+	short, large := "no", 11
+	tests := []struct {
+		name   string
+		modify func(s *sample)
+		want   []infrastruct.FieldError
+	}{
+		{name: "valid", modify: func(s *sample) {}},
+		{name: "required string", modify: func(s *sample) { s.Name = "" },
+			want: []infrastruct.FieldError{{Field: "name", Code: CodeRequired}}},
+		{name: "required spaces", modify: func(s *sample) { s.Name = "   " },
+			want: []infrastruct.FieldError{{Field: "name", Code: CodeRequired}}},
+		{name: "max in runes", modify: func(s *sample) { s.Name = "Ананас" },
+			want: []infrastruct.FieldError{{Field: "name", Code: CodeTooLong, Params: []interface{}{5}}}},
+		{name: "email", modify: func(s *sample) { s.Email = "Anna <anna@mail.ru>" },
+			want: []infrastruct.FieldError{{Field: "email", Code: CodeEmail}}},
+		{name: "email without domain zone", modify: func(s *sample) { s.Email = "anna@mail" },
+			want: []infrastruct.FieldError{{Field: "email", Code: CodeEmail}}},
+		{name: "number too large", modify: func(s *sample) { s.Age = 121 },
+			want: []infrastruct.FieldError{{Field: "age", Code: CodeTooLarge, Params: []interface{}{120}}}},
+		{name: "number too small", modify: func(s *sample) { s.Age = -1 },
+			want: []infrastruct.FieldError{{Field: "age", Code: CodeTooSmall, Params: []interface{}{1}}}},
+		{name: "oneof", modify: func(s *sample) { s.Role = "admin" },
+			want: []infrastruct.FieldError{{Field: "role", Code: CodeOneOf, Params: []interface{}{"student, teacher"}}}},
+		{name: "empty skips non required", modify: func(s *sample) { s.Email, s.Age, s.Role, s.Tags, s.Comment = "", 0, "", nil, nil }},
+		{name: "too many items", modify: func(s *sample) { s.Tags = []string{"go", "js", "py"} },
+			want: []infrastruct.FieldError{{Field: "tags", Code: CodeTooMany, Params: []interface{}{2}}}},
+		{name: "dive", modify: func(s *sample) { s.Tags = []string{"", "a"} },
+			want: []infrastruct.FieldError{{Field: "tags[0]", Code: CodeRequired},
+				{Field: "tags[1]", Code: CodeTooShort, Params: []interface{}{2}}}},
+		{name: "pointer value", modify: func(s *sample) { s.Comment = &short },
+			want: []infrastruct.FieldError{{Field: "comment", Code: CodeTooShort, Params: []interface{}{3}}}},
+		{name: "nil pointer required", modify: func(s *sample) { s.Count = nil },
+			want: []infrastruct.FieldError{{Field: "count", Code: CodeRequired}}},
+		{name: "pointer to number", modify: func(s *sample) { s.Count = &large },
+			want: []infrastruct.FieldError{{Field: "count", Code: CodeTooLarge, Params: []interface{}{10}}}},
+		{name: "json dash uses field name", modify: func(s *sample) { s.Skipped = "" },
+			want: []infrastruct.FieldError{{Field: "Skipped", Code: CodeRequired}}},
+		{name: "all problems", modify: func(s *sample) { s.Name, s.Age = "", 200 },
+			want: []infrastruct.FieldError{{Field: "name", Code: CodeRequired},
+				{Field: "age", Code: CodeTooLarge, Params: []interface{}{120}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.modify(&s)
+			if got := problems(t, Struct(&s)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructNotStruct(t *testing.T) {
+
+	var s *sample
+	if err := Struct(s); err != nil {
+		t.Errorf("nil pointer: %v", err)
+	}
+	if err := Struct(5); err != nil {
+		t.Errorf("not a struct: %v", err)
+	}
+}
+
+func TestField(t *testing.T) {
+
+	if err := Field("password", "", "required,min=6"); err == nil {
+		t.Error("empty password passed")
+	}
+	if err := Field("password", "secret", "required,min=6"); err != nil {
+		t.Errorf("valid password: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	rules, err := Parse("required,max=10,dive,oneof=a|b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{Name: "required"}, {Name: "max", Arg: "10", N: 10},
+		{Name: "dive", Items: []Rule{{Name: "oneof", Arg: "a|b"}}}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("got %+v, want %+v", rules, want)
+	}
+
+	for _, tag := range []string{"min=x", "oneof=", "unknown", "dive,max=y"} {
+		if _, err = Parse(tag); err == nil {
+			t.Errorf("tag %q parsed without error", tag)
+		}
+	}
+}
+
+// problems - ошибки полей без сообщений, сообщения проверяются в infrastruct
+func problems(t *testing.T, err error) []infrastruct.FieldError {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	v, ok := err.(*infrastruct.ValidationError)
+	if !ok {
+		t.Fatalf("unexpected error type %T", err)
+	}
+	fields := make([]infrastruct.FieldError, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		f.Message = ""
+		if len(f.Params) == 0 {
+			f.Params = nil
+		}
+		fields = append(fields, f)
+	}
+
+	return fields
+}